@@ -0,0 +1,121 @@
+package gsim
+
+// ActorModel builds a graph from actors: sequential processes, each a
+// list of events, which communicate by messages. The events of each
+// actor are ordered by edges added automatically, so only the
+// constraints between actors need be declared, with Send and
+// Channel. For example:
+//
+//	m := gsim.NewActorModel()
+//	client, server := m.Actor("client"), m.Actor("server")
+//	req := client.Step("send request")
+//	recv := server.Step("receive request")
+//	m.Send(req, recv)
+//	server.Step("send response")
+//	gen := m.NewGraphPermutation()
+type ActorModel struct {
+	actors []*Actor
+	owner  map[*GraphNode]*Actor
+}
+
+// Actor is a sequential process within an ActorModel.
+type Actor struct {
+	Name   string
+	model  *ActorModel
+	events []*GraphNode
+}
+
+// Construct a new, empty, ActorModel.
+func NewActorModel() *ActorModel {
+	return &ActorModel{owner: make(map[*GraphNode]*Actor)}
+}
+
+// Actor adds a new actor to the model.
+func (m *ActorModel) Actor(name string) *Actor {
+	a := &Actor{Name: name, model: m}
+	m.actors = append(m.actors, a)
+	return a
+}
+
+// Actors returns every actor, in the order they were added.
+func (m *ActorModel) Actors() []*Actor {
+	return append([]*Actor(nil), m.actors...)
+}
+
+// ActorOf returns the actor which owns the node, if any.
+func (m *ActorModel) ActorOf(gn *GraphNode) (*Actor, bool) {
+	a, found := m.owner[gn]
+	return a, found
+}
+
+// OptionActor returns the actor which owns the option, a *GraphNode
+// generated by the model's graph, or nil if it has none. It suits the
+// bounding functions, such as ContextBounded.
+func (m *ActorModel) OptionActor(option interface{}) *Actor {
+	gn, ok := option.(*GraphNode)
+	if !ok {
+		return nil
+	}
+	return m.owner[gn]
+}
+
+// Step adds an event with the given value to the end of the actor,
+// and returns its node.
+func (a *Actor) Step(value interface{}) *GraphNode {
+	gn := NewGraphNode(value)
+	a.Append(gn)
+	return gn
+}
+
+// Append adds an existing node to the end of the actor. This allows
+// an actor to contain a sub-graph: append the sub-graph's entry node,
+// build the sub-graph from it, and then append its exit node. A node
+// may belong to at most one actor.
+func (a *Actor) Append(gn *GraphNode) {
+	if _, found := a.model.owner[gn]; found {
+		panic("GraphNode already belongs to an actor: " + gn.String())
+	}
+	if l := len(a.events); l > 0 {
+		a.events[l-1].AddEdgeTo(gn)
+	}
+	a.events = append(a.events, gn)
+	a.model.owner[gn] = a
+}
+
+// Events returns the events of the actor, in the order they were
+// added.
+func (a *Actor) Events() []*GraphNode {
+	return append([]*GraphNode(nil), a.events...)
+}
+
+// Send declares that recv is the receipt of the message sent by
+// send: recv can only happen once send has, in addition to following
+// the preceding event of its own actor.
+func (m *ActorModel) Send(send, recv *GraphNode) {
+	requireNodes(recv, send)
+}
+
+// Channel declares that the messages sent by sends are received, in
+// order, by receives, over a FIFO channel with the given capacity. See
+// WireFIFOChannel.
+func (m *ActorModel) Channel(sends, receives []*GraphNode, capacity int) error {
+	return WireFIFOChannel(sends, receives, capacity)
+}
+
+// StartNodes returns the first event of each actor which does not
+// depend on any other event (for example, because it is a receive).
+func (m *ActorModel) StartNodes() []*GraphNode {
+	var start []*GraphNode
+	for _, a := range m.actors {
+		if len(a.events) > 0 && len(a.events[0].In) == 0 {
+			start = append(start, a.events[0])
+		}
+	}
+	return start
+}
+
+// NewGraphPermutation constructs an OptionGenerator for the model,
+// starting from its StartNodes.
+func (m *ActorModel) NewGraphPermutation() OptionGenerator {
+	return NewGraphPermutation(m.StartNodes()...)
+}
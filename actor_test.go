@@ -0,0 +1,72 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestActorModel(t *testing.T) {
+	m := NewActorModel()
+	client, server := m.Actor("client"), m.Actor("server")
+	req := client.Step("req")
+	client.Step("other")
+	recv := server.Step("recv")
+	m.Send(req, recv)
+	server.Step("resp")
+
+	if start := m.StartNodes(); len(start) != 1 || start[0] != req {
+		t.Fatalf("got start nodes %v", start)
+	}
+	if a, found := m.ActorOf(recv); !found || a != server {
+		t.Fatalf("recv belongs to %v", a)
+	}
+	if events := client.Events(); len(events) != 2 || events[0] != req {
+		t.Fatalf("got client events %v", events)
+	}
+	checkPerms(t, collectSorted(BuildPermutations(m.NewGraphPermutation())), []string{
+		"req other recv resp",
+		"req recv other resp",
+		"req recv resp other",
+	})
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic")
+		}
+	}()
+	server.Append(req)
+}
+
+func TestActorModelChannel(t *testing.T) {
+	build := func(capacity int) []string {
+		m := NewActorModel()
+		producer, consumer := m.Actor("producer"), m.Actor("consumer")
+		producer.Step("start")
+		sends := []*GraphNode{producer.Step("s1"), producer.Step("s2")}
+		receives := []*GraphNode{consumer.Step("r1"), consumer.Step("r2")}
+		if err := m.Channel(sends, receives, capacity); err != nil {
+			t.Fatal(err)
+		}
+		if actors := m.Actors(); len(actors) != 2 || actors[0] != producer || actors[1] != consumer {
+			t.Fatalf("got actors %v", actors)
+		}
+		return collectSorted(BuildPermutations(m.NewGraphPermutation()))
+	}
+	checkPerms(t, build(0), []string{
+		"start s1 r1 s2 r2",
+		"start s1 s2 r1 r2",
+	})
+	checkPerms(t, build(1), []string{
+		"start s1 r1 s2 r2",
+	})
+
+	m := NewActorModel()
+	a := m.Actor("a")
+	if err := m.Channel([]*GraphNode{a.Step("s1")}, []*GraphNode{a.Step("r1"), a.Step("r2")}, 0); err == nil {
+		t.Fatal("more receives than sends accepted")
+	}
+	// Actors returns a copy.
+	m.Actors()[0] = nil
+	if m.Actors()[0] != a {
+		t.Fatal("Actors shares the model's actors")
+	}
+}
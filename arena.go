@@ -0,0 +1,54 @@
+package gsim
+
+import (
+	"math/big"
+)
+
+// walkArena recycles the nodes of a walk, and their numbers, once
+// they have been explored, so that the walk allocates afresh only as
+// the worklist grows beyond its previous size. Recycled numbers keep
+// their backing arrays, so computing a child's number usually
+// allocates nothing either.
+//
+// Numbers supplied to consumers may be retained by them, so only the
+// numbers of nodes which have children of their own are recycled, and
+// then only if the walk allocated them (see node.pooled) and no child
+// has taken them over.
+type walkArena[T any] struct {
+	nodes []*node[T]
+	nums  []*big.Int
+	// keepNums is set if numbers must never be recycled, because
+	// they are recorded elsewhere (as WithStateDeduplication does).
+	keepNums bool
+}
+
+// node returns a zeroed node.
+func (wa *walkArena[T]) node() *node[T] {
+	if l := len(wa.nodes); l > 0 {
+		n := wa.nodes[l-1]
+		wa.nodes = wa.nodes[:l-1]
+		return n
+	}
+	return &node[T]{}
+}
+
+// num returns a number, with any value.
+func (wa *walkArena[T]) num() *big.Int {
+	if l := len(wa.nums); l > 0 {
+		num := wa.nums[l-1]
+		wa.nums = wa.nums[:l-1]
+		return num
+	}
+	return new(big.Int)
+}
+
+// release recycles n, which must no longer be referenced, along with
+// its number if recycleNum is set and the number belongs to the
+// arena.
+func (wa *walkArena[T]) release(n *node[T], recycleNum bool) {
+	if recycleNum && n.pooled && !wa.keepNums {
+		wa.nums = append(wa.nums, n.n)
+	}
+	*n = node[T]{} // don't keep values and generators alive
+	wa.nodes = append(wa.nodes, n)
+}
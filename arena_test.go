@@ -0,0 +1,45 @@
+package gsim
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestWalkArena(t *testing.T) {
+	wa := &walkArena[int]{}
+	n := wa.node()
+	n.value, n.n, n.pooled = 7, wa.num(), true
+	num := n.n
+	wa.release(n, true)
+	if n2 := wa.node(); n2 != n || n2.value != 0 || n2.n != nil {
+		t.Fatalf("got node %+v", n2)
+	}
+	if wa.num() != num {
+		t.Fatal("number not recycled")
+	}
+
+	// Numbers which are not pooled, or must be kept, are not recycled.
+	wa.release(&node[int]{n: num}, true)
+	wa.keepNums = true
+	wa.release(&node[int]{n: num, pooled: true}, true)
+	if len(wa.nums) != 0 {
+		t.Fatalf("recycled %d numbers", len(wa.nums))
+	}
+}
+
+func TestRetainedNumbersSurviveRecycling(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(diamonds(4)...))
+	var nums []*big.Int
+	var perms []string
+	p.ForEach(consumerFunc(func(n *big.Int, perm []interface{}) {
+		nums = append(nums, n)
+		perms = append(perms, permString(perm))
+	}))
+	seen := make(map[string]bool)
+	for idx, n := range nums {
+		if got := permString(p.Permutation(n)); got != perms[idx] || seen[n.String()] {
+			t.Fatalf("retained number %v now gives %q, want %q", n, got, perms[idx])
+		}
+		seen[n.String()] = true
+	}
+}
@@ -0,0 +1,93 @@
+package gsim
+
+// AtomicBlock is a chain of GraphNodes which, once entered, runs to
+// completion with no other nodes interleaved. See DeclareAtomic.
+type AtomicBlock struct {
+	nodes     []*GraphNode
+	composite *GraphNode
+}
+
+// DeclareAtomic declares that the given GraphNodes form an atomic
+// block, such as a critical section. Edges are added from each node
+// to the next. Once the first node has been chosen, the only option
+// is the next node of the block, and so on until the block is
+// complete; other nodes can only be chosen before or after the
+// block, which can drastically cut the number of permutations. If the
+// next node of the block is not available (because, for example, its
+// callback requires some other node too) then the block ends early.
+//
+// A node may be in at most one atomic block. Atomic blocks cannot be
+// saved by WriteDOT or WriteGraphJSON.
+func DeclareAtomic(nodes ...*GraphNode) *AtomicBlock {
+	ab := &AtomicBlock{nodes: nodes}
+	for idx, gn := range nodes {
+		if gn.atomic != nil {
+			panic("GraphNode is already in an atomic block: " + gn.String())
+		}
+		gn.atomic = ab
+		gn.atomicIdx = idx
+		if idx > 0 {
+			nodes[idx-1].AddEdgeTo(gn)
+		}
+	}
+	return ab
+}
+
+// Nodes returns the nodes of the block, in order.
+func (ab *AtomicBlock) Nodes() []*GraphNode {
+	return append([]*GraphNode(nil), ab.nodes...)
+}
+
+// Collapse causes the block to appear in permutations as a single
+// step rather than as its individual nodes. The returned GraphNode,
+// which has the given value and no edges, is offered in place of the
+// block's first node, and choosing it chooses all the nodes of the
+// block in turn. Calling Collapse again replaces the value.
+func (ab *AtomicBlock) Collapse(value interface{}) *GraphNode {
+	ab.composite = NewGraphNode(value)
+	ab.composite.atomic = ab
+	return ab.composite
+}
+
+// atomicNext returns the node which must follow gn, if gn is in an
+// atomic block which is not collapsed.
+func (gn *GraphNode) atomicNext() *GraphNode {
+	if ab := gn.atomic; ab != nil && ab.composite == nil && gn.atomicIdx+1 < len(ab.nodes) {
+		return ab.nodes[gn.atomicIdx+1]
+	}
+	return nil
+}
+
+// visitAtomic chooses each node of a collapsed block in turn.
+func (gp *graphPermutation) visitAtomic(ab *AtomicBlock) {
+	gp.atomicNext = nil
+	gp.visit(ab.nodes[0])
+	for _, gn := range ab.nodes[1:] {
+		if !containsOption(gp.current, interface{}(gn)) {
+			return
+		}
+		gp.visit(gn)
+	}
+}
+
+// collapseAtomic replaces the first node of each collapsed block with
+// the block's composite node. If there are none, nodes itself is
+// returned.
+func collapseAtomic(nodes []interface{}) []interface{} {
+	var collapsed []interface{}
+	for idx, node := range nodes {
+		gn := node.(*GraphNode)
+		if gn.atomic == nil || gn.atomicIdx != 0 || gn.atomic.composite == nil {
+			continue
+		}
+		if collapsed == nil {
+			collapsed = make([]interface{}, len(nodes))
+			copy(collapsed, nodes)
+		}
+		collapsed[idx] = gn.atomic.composite
+	}
+	if collapsed == nil {
+		return nodes
+	}
+	return collapsed
+}
@@ -0,0 +1,34 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestDeclareAtomic(t *testing.T) {
+	g := nodes("lock", "write", "unlock", "other")
+	DeclareAtomic(g[:3]...)
+	p := BuildPermutations(NewGraphPermutation(g[0], g[3]))
+	checkPerms(t, collectSorted(p), []string{
+		"lock write unlock other",
+		"other lock write unlock",
+	})
+
+	// Collapsed, the block is a single step.
+	g = nodes("lock", "write", "unlock", "other")
+	ab := DeclareAtomic(g[:3]...)
+	ab.Collapse("critical")
+	if len(ab.Nodes()) != 3 {
+		t.Fatalf("got nodes %v", ab.Nodes())
+	}
+	checkPerms(t, collectSorted(BuildPermutations(NewGraphPermutation(g[0], g[3]))), []string{
+		"critical other",
+		"other critical",
+	})
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic")
+		}
+	}()
+	DeclareAtomic(g[2], g[3])
+}
@@ -0,0 +1,115 @@
+package gsim
+
+import (
+	"sync"
+	"time"
+)
+
+// parTargetBatchTime is the time ForEachParBounded aims for a
+// consuming go-routine to spend on each batch: long enough that
+// handing over batches is cheap in comparison, short enough that
+// batches stay small when consumers are slow.
+const parTargetBatchTime = 2 * time.Millisecond
+
+// flowControl bounds the number of permutations in flight between
+// the generating go-routine and the consuming go-routines, and sizes
+// batches according to how long consumers take over each permutation.
+type flowControl struct {
+	lock     sync.Mutex
+	cond     sync.Cond
+	max      int
+	inFlight int
+	stopped  bool
+	// maxBatch is the largest batch which still lets every consuming
+	// go-routine have two batches in flight.
+	maxBatch  int
+	batchSize int
+	// perPerm is a moving average of the time consumers spend on each
+	// permutation.
+	perPerm time.Duration
+}
+
+func newFlowControl(maxInFlight, par int) *flowControl {
+	maxBatch := maxInFlight / (2 * par)
+	if maxBatch < 1 {
+		maxBatch = 1
+	}
+	flow := &flowControl{
+		max:       maxInFlight,
+		maxBatch:  maxBatch,
+		batchSize: maxBatch,
+	}
+	flow.cond.L = &flow.lock
+	return flow
+}
+
+// acquire blocks until permutations may be added to a new batch, and
+// returns the number reserved for it. It returns 0 once stopped.
+func (flow *flowControl) acquire() int {
+	flow.lock.Lock()
+	defer flow.lock.Unlock()
+	for !flow.stopped && flow.inFlight >= flow.max {
+		flow.cond.Wait()
+	}
+	if flow.stopped {
+		return 0
+	}
+	reserved := flow.batchSize
+	if free := flow.max - flow.inFlight; reserved > free {
+		reserved = free
+	}
+	flow.inFlight += reserved
+	return reserved
+}
+
+// release returns the reservation of a batch of consumed permutations,
+// which took elapsed to consume, and adjusts the batch size.
+func (flow *flowControl) release(reserved, consumed int, elapsed time.Duration) {
+	flow.lock.Lock()
+	defer flow.lock.Unlock()
+	flow.inFlight -= reserved
+	if consumed > 0 {
+		flow.perPerm = (7*flow.perPerm + elapsed/time.Duration(consumed)) / 8
+		batchSize := flow.maxBatch
+		if flow.perPerm > 0 {
+			if target := int(parTargetBatchTime / flow.perPerm); target < batchSize {
+				batchSize = target
+			}
+		}
+		if batchSize < 1 {
+			batchSize = 1
+		}
+		flow.batchSize = batchSize
+	}
+	flow.cond.Broadcast()
+}
+
+// stop wakes, and fails, every current and future acquire.
+func (flow *flowControl) stop() {
+	flow.lock.Lock()
+	defer flow.lock.Unlock()
+	flow.stopped = true
+	flow.cond.Broadcast()
+}
+
+// ForEachParBounded is ForEachPar with bounded memory use: no more
+// than maxInFlight permutations are held at once between being
+// generated and being consumed, and generation blocks until consumers
+// have caught up. Rather than being fixed, the size of each batch is
+// adjusted as consumption proceeds: batches are made small when
+// consumers are slow, so that every consumer has work, and large when
+// they are fast, so that handing batches over is cheap. maxInFlight
+// should therefore be comfortably larger than the number of workers;
+// values smaller than 1 are treated as 1.
+func (p *TypedPermutations[T]) ForEachParBounded(maxInFlight int, f TypedPermutationConsumer[T]) error {
+	return p.ForEachParBoundedCheck(maxInFlight, consumerChecker[T]{TypedPermutationConsumer: f})
+}
+
+// ForEachParBoundedCheck is the checking equivalent of
+// ForEachParBounded, and stops in the same way as ForEachParCheck.
+func (p *TypedPermutations[T]) ForEachParBoundedCheck(maxInFlight int, f TypedPermutationChecker[T]) error {
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+	return p.forEachPar(f, 0, newFlowControl(maxInFlight, p.parallelism()))
+}
@@ -0,0 +1,34 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestForEachParBounded(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5, 6})).WithWorkers(4)
+	want := collectSorted(p)
+	for _, maxInFlight := range []int{0, 1, 10, 1000} {
+		c := newCollector()
+		if err := p.ForEachParBounded(maxInFlight, c); err != nil {
+			t.Fatal(err)
+		}
+		checkPerms(t, c.sorted(), want)
+	}
+
+	failed := errors.New("failed")
+	err := p.ForEachParBoundedCheck(10, checkerFunc(func(n *big.Int, perm []interface{}) error {
+		if perm[0] == 6 && perm[5] == 1 {
+			return failed
+		}
+		return nil
+	}))
+	var pe *PermutationError
+	if !errors.As(err, &pe) || !errors.Is(err, failed) {
+		t.Fatalf("got %v, want a PermutationError wrapping %v", err, failed)
+	}
+	if perm := p.Permutation(pe.N); perm[0] != 6 || perm[5] != 1 {
+		t.Fatalf("failure identifies %v", perm)
+	}
+}
@@ -0,0 +1,145 @@
+package gsim
+
+import (
+	"container/heap"
+	"math/big"
+)
+
+// A TypedScoreFunc scores a permutation prefix for ForEachBestFirst.
+// Prefixes with higher scores are explored first.
+type TypedScoreFunc[T any] func(prefix []T) float64
+
+// ScoreFunc is the interface{} instantiation of TypedScoreFunc.
+type ScoreFunc = TypedScoreFunc[interface{}]
+
+// ForEachBestFirst iterates through every permutation, as
+// ForEachCheck, but instead of walking the tree depth-first, it always
+// expands next the unexplored prefix with the highest score, so that
+// exploration is directed towards suspicious schedules first (for
+// example, those which maximise lock contention). Prefixes with equal
+// scores are explored most recent first, so with a constant score
+// the order is the same as ForEachCheck's. As f.Check can stop the
+// iteration by returning an error, this makes a directed model
+// checker: the failing permutation is likely to be found long before
+// the space is exhausted.
+//
+// Every unexplored prefix is held in memory along with its own clone
+// of the OptionGenerator, so this uses far more memory than
+// ForEachCheck. Sleep sets, progress reporting and Snapshot are not
+// supported.
+func (p *TypedPermutations[T]) ForEachBestFirst(score TypedScoreFunc[T], f TypedPermutationChecker[T]) error {
+	queue := &bestFirstQueue[T]{}
+	if p.resume == nil {
+		queue.push(p.root.clone(), 0)
+	} else {
+		for _, resumed := range p.resume {
+			queue.push(resumed.clone(), 0)
+		}
+	}
+	var seen map[uint64]*big.Int
+	if p.dedup {
+		seen = make(map[uint64]*big.Int)
+	}
+
+	perm := []T{}
+	for queue.Len() != 0 {
+		cur := heap.Pop(queue).(*scoredNode[T]).node
+		perm = append(append(perm[:0], cur.prefix...), cur.value)
+
+		options, ok := p.generate(cur.generator, cur.value, perm[1:])
+		if !ok || (p.tracksStates() && p.stateSeen(seen, cur.generator, perm[1:], cur.n)) {
+			continue
+		}
+		optionCount := len(options)
+
+		if optionCount == 0 {
+			if handled, err := p.deadlocked(f, cur.generator, cur.n, perm[1:]); err != nil {
+				return &PermutationError{N: cur.n, Err: err}
+			} else if handled {
+				continue
+			}
+			if err := f.Check(cur.n, perm[1:]); err != nil {
+				return &PermutationError{N: cur.n, Err: err}
+			}
+			continue
+		}
+
+		bounded, isBounded := cur.generator.(TypedBoundedGenerator[T])
+		prefix := append([]T(nil), perm...)
+		cumuOpts := new(big.Int).Mul(cur.cumuOpts, big.NewInt(int64(optionCount)))
+		weight := cur.weight / float64(optionCount)
+		for idx, option := range options {
+			childN := cur.n
+			if optionCount > 1 {
+				childN = big.NewInt(int64(idx))
+				childN.Mul(childN, cur.cumuOpts)
+				childN.Add(childN, cur.n)
+			}
+			// Unlike the depth-first walk, siblings may be explored in
+			// any order, so a child may only take over the parent's
+			// generator if it has none.
+			gen := cur.generator
+			if optionCount > 1 {
+				gen = gen.Clone()
+			}
+			child := &node[T]{
+				n:         childN,
+				depth:     cur.depth + 1,
+				value:     option,
+				generator: gen,
+				cumuOpts:  cumuOpts,
+				weight:    weight,
+				prefix:    prefix,
+			}
+			switch {
+			case score != nil:
+				queue.push(child, score(append(prefix[1:len(prefix):len(prefix)], option)))
+			case isBounded:
+				queue.push(child, -float64(bounded.Cost(option)))
+			default:
+				queue.push(child, 0)
+			}
+		}
+	}
+	return nil
+}
+
+type scoredNode[T any] struct {
+	node  *node[T]
+	score float64
+	seq   uint64
+}
+
+// bestFirstQueue is a max-heap of nodes by score, and then by the
+// order in which they were pushed, most recent first.
+type bestFirstQueue[T any] struct {
+	nodes []*scoredNode[T]
+	seq   uint64
+}
+
+func (q *bestFirstQueue[T]) push(n *node[T], score float64) {
+	q.seq++
+	heap.Push(q, &scoredNode[T]{node: n, score: score, seq: q.seq})
+}
+
+func (q *bestFirstQueue[T]) Len() int { return len(q.nodes) }
+
+func (q *bestFirstQueue[T]) Less(i, j int) bool {
+	a, b := q.nodes[i], q.nodes[j]
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	return a.seq > b.seq
+}
+
+func (q *bestFirstQueue[T]) Swap(i, j int) { q.nodes[i], q.nodes[j] = q.nodes[j], q.nodes[i] }
+
+func (q *bestFirstQueue[T]) Push(x interface{}) { q.nodes = append(q.nodes, x.(*scoredNode[T])) }
+
+func (q *bestFirstQueue[T]) Pop() interface{} {
+	l := len(q.nodes) - 1
+	n := q.nodes[l]
+	q.nodes[l] = nil
+	q.nodes = q.nodes[:l]
+	return n
+}
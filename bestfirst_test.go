@@ -0,0 +1,75 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"testing"
+)
+
+func TestForEachBestFirst(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4}))
+	record := func(score ScoreFunc) []string {
+		var got []string
+		err := p.ForEachBestFirst(score, checkerFunc(func(n *big.Int, perm []interface{}) error {
+			if want := permString(p.Permutation(n)); want != permString(perm) {
+				t.Fatalf("%q numbered as %q", permString(perm), want)
+			}
+			got = append(got, permString(perm))
+			return nil
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	checkPerms(t, record(nil), collect(p))
+
+	// Prefer 4 as early as possible.
+	got := record(func(prefix []interface{}) float64 {
+		for idx, elem := range prefix {
+			if elem == 4 {
+				return -float64(idx)
+			}
+		}
+		return -float64(len(prefix))
+	})
+	if len(got) != 24 || got[0][0] != '4' || got[5][0] != '4' || got[6][0] == '4' {
+		t.Fatalf("got %q", got)
+	}
+
+	failed := errors.New("failed")
+	err := p.ForEachBestFirst(nil, checkerFunc(func(n *big.Int, perm []interface{}) error {
+		return failed
+	}))
+	var pe *PermutationError
+	if !errors.As(err, &pe) || !errors.Is(err, failed) || permString(p.Permutation(pe.N)) != collect(p)[0] {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestForEachBestFirstSharesNoGenerators(t *testing.T) {
+	// Preferring either process explores one child of each prefix
+	// before its siblings, which must not see its state.
+	p := BuildPermutations(NewGraphPermutation(processes()...))
+	for _, preferred := range []byte{'a', 'b'} {
+		var got []string
+		err := p.ForEachBestFirst(func(prefix []interface{}) float64 {
+			score := 0.0
+			for _, elem := range prefix {
+				if processOf(elem) == preferred {
+					score++
+				}
+			}
+			return score
+		}, checkerFunc(func(n *big.Int, perm []interface{}) error {
+			got = append(got, permString(perm))
+			return nil
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(got)
+		checkPerms(t, got, collectSorted(p))
+	}
+}
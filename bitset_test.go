@@ -0,0 +1,172 @@
+package gsim
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// inhibitors builds a graph using every callback the bitset engine
+// supports: a inhibits c, z is inhibited once both a and b have been
+// chosen, x follows either a or b, and w requires both b and c, so is
+// stuck if a comes before c.
+func inhibitors() []*GraphNode {
+	g := nodes("a", "b", "c", "z", "x", "w")
+	a, b, c, z, x, w := g[0], g[1], g[2], g[3], g[4], g[5]
+	a.AddEdgeTo(c)
+	c.Callback = InhibitAnyCallback
+	a.AddEdgeTo(z)
+	b.AddEdgeTo(z)
+	z.Callback = NewInhibitAllCallback(a, b)
+	a.AddEdgeTo(x)
+	b.AddEdgeTo(x)
+	b.AddEdgeTo(w)
+	c.AddEdgeTo(w)
+	w.Callback = NewAvailableAllCallback(b, c)
+	return g[:4]
+}
+
+// bitsetGraphs are the graphs on which the bitset engine is compared
+// with NewGraphPermutation.
+func bitsetGraphs() []func() []*GraphNode {
+	happensBefore := func() []*GraphNode {
+		values := []interface{}{"a", "b", "c", "d", "e"}
+		_, start, _ := GraphFromHappensBefore(values, [][2]int{{0, 2}, {1, 2}, {1, 3}, {3, 4}})
+		return start
+	}
+	return []func() []*GraphNode{joins, processes, happensBefore, joinOrInhibit, inhibitors}
+}
+
+// bitsetPermutations builds the permutations of the graph with the
+// bitset engine.
+func bitsetPermutations(t *testing.T, build func() []*GraphNode) *Permutations {
+	t.Helper()
+	gen, err := NewBitsetGraphPermutation(build()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return BuildPermutations(gen)
+}
+
+// checkNumbered fails the test unless got and want consumed the same
+// permutations with the same numbers.
+func checkNumbered(t *testing.T, idx int, got, want *collector) {
+	t.Helper()
+	wantNumbered, gotNumbered := want.numbered(), got.numbered()
+	if len(gotNumbered) != len(wantNumbered) {
+		t.Fatalf("graph %d: got %d permutations, want %d", idx, len(gotNumbered), len(wantNumbered))
+	}
+	for n, perm := range wantNumbered {
+		if gotNumbered[n] != perm {
+			t.Fatalf("graph %d: permutation %s is %q, want %q", idx, n, gotNumbered[n], perm)
+		}
+	}
+}
+
+func TestBitsetGraphPermutationMatchesGraphPermutation(t *testing.T) {
+	for idx, build := range bitsetGraphs() {
+		want := newCollector()
+		BuildPermutations(NewGraphPermutation(build()...)).ForEach(want)
+		got := newCollector()
+		bitsetPermutations(t, build).ForEach(got)
+		checkNumbered(t, idx, got, want)
+	}
+}
+
+func TestBitsetGraphPermutationFutureOptions(t *testing.T) {
+	// Nodes are independent unless their values end alike.
+	independent := func(a, b interface{}) bool {
+		va, vb := a.(*GraphNode).Value.(string), b.(*GraphNode).Value.(string)
+		return va[len(va)-1] != vb[len(vb)-1]
+	}
+	for idx, build := range bitsetGraphs() {
+		want := newCollector()
+		BuildPermutations(NewGraphPermutation(build()...)).WithIndependence(independent).ForEach(want)
+		got := newCollector()
+		bitsetPermutations(t, build).WithIndependence(independent).ForEach(got)
+		checkNumbered(t, idx, got, want)
+	}
+}
+
+func TestBitsetGraphPermutationDeadlocks(t *testing.T) {
+	// deadlocks renders each deadlocked permutation along with its
+	// stuck nodes, which the engines may report in different orders.
+	deadlocks := func(p *Permutations) []string {
+		dc := &deadlockCollector{collector: newCollector()}
+		p.WithDeadlockPolicy(DeadlockFlag).ForEach(dc)
+		var found []string
+		for idx, perm := range dc.deadlocked {
+			stuck := strings.Fields(dc.stuck[idx])
+			sort.Strings(stuck)
+			found = append(found, perm+": "+strings.Join(stuck, " "))
+		}
+		sort.Strings(found)
+		return found
+	}
+	for _, build := range []func() []*GraphNode{joinOrInhibit, inhibitors} {
+		want := deadlocks(BuildPermutations(NewGraphPermutation(build()...)))
+		if len(want) == 0 {
+			t.Fatal("no deadlocks found")
+		}
+		checkPerms(t, deadlocks(bitsetPermutations(t, build)), want)
+	}
+}
+
+func TestBitsetGraphPermutationDeduplication(t *testing.T) {
+	// chosen renders the set of nodes chosen by each permutation.
+	chosen := func(perms []string) []string {
+		sets := make(map[string]bool)
+		for _, perm := range perms {
+			elems := strings.Fields(perm)
+			sort.Strings(elems)
+			sets[strings.Join(elems, " ")] = true
+		}
+		var sorted []string
+		for set := range sets {
+			sorted = append(sorted, set)
+		}
+		sort.Strings(sorted)
+		return sorted
+	}
+	for idx, build := range bitsetGraphs() {
+		all := collectSorted(bitsetPermutations(t, build))
+		duplicates := 0
+		deduplicated := collectSorted(bitsetPermutations(t, build).WithStateDeduplication(func([]interface{}, *big.Int, *big.Int) {
+			duplicates++
+		}))
+		if duplicates == 0 || len(deduplicated) >= len(all) {
+			t.Fatalf("graph %d: %d duplicates found, and %d of %d permutations consumed", idx, duplicates, len(deduplicated), len(all))
+		}
+		// Duplicate states have the same continuations, so every set
+		// of nodes is still chosen by some permutation.
+		checkPerms(t, chosen(deduplicated), chosen(all))
+	}
+}
+
+func TestBitsetGraphPermutationMerging(t *testing.T) {
+	for idx, build := range bitsetGraphs() {
+		want := newCollector()
+		bitsetPermutations(t, build).ForEach(want)
+		got := newCollector()
+		bitsetPermutations(t, build).WithStateMerging().ForEach(got)
+		checkNumbered(t, idx, got, want)
+	}
+}
+
+func TestBitsetGraphPermutationRejectsUnsupportedGraphs(t *testing.T) {
+	if _, err := NewBitsetGraphPermutation(egraph()...); err == nil {
+		t.Fatal("graph with a CombinationCallback accepted")
+	}
+
+	start := NewGraphNode(0)
+	prev := start
+	for idx := 1; idx <= maxBitsetNodes; idx++ {
+		gn := NewGraphNode(idx)
+		prev.AddEdgeTo(gn)
+		prev = gn
+	}
+	if _, err := NewBitsetGraphPermutation(start); err == nil {
+		t.Fatal("graph of too many nodes accepted")
+	}
+}
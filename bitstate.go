@@ -0,0 +1,124 @@
+package gsim
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Bitstate is the bit array used by bitstate hashing (also known as
+// supertrace): see WithBitstateHashing. Each generator state seen sets
+// a few bits, chosen by hashing the state, and a state whose bits are
+// all already set is taken to have been seen before. This is a Bloom
+// filter, so a state is occasionally taken to have been seen when it
+// has not, and its continuations are then wrongly skipped; but each
+// state costs only a few bits, rather than the many bytes which
+// WithStateDeduplication spends, so far larger state spaces can be
+// covered, most of them exhaustively.
+//
+// A Bitstate is not safe for concurrent use: it must be used by one
+// iteration at a time. States seen by one iteration remain set for
+// the next, so use a new Bitstate for each independent run.
+type Bitstate struct {
+	words  []uint64
+	mask   uint64
+	hashes int
+	// stored is the number of states recorded, and skipped the number
+	// taken to have been seen before.
+	stored  uint64
+	skipped uint64
+}
+
+// BitstateStats describes the states recorded by a Bitstate.
+type BitstateStats struct {
+	// States is the number of distinct states recorded, and Skipped
+	// the number of prefixes skipped because their state was taken to
+	// have been seen before.
+	States  uint64
+	Skipped uint64
+	// Fill is the fraction of the bits which are set.
+	Fill float64
+	// Omission is the probability that a new state would now be taken
+	// to have been seen: Fill raised to the number of hashes. Keep it
+	// small (well below 1%) by using more bits.
+	Omission float64
+	// Approximate is true if any prefix has been skipped: its
+	// continuations may not all have been explored, so the iteration
+	// cannot be taken to be exhaustive. It is false only if every
+	// state was new, in which case nothing was skipped.
+	Approximate bool
+}
+
+// NewBitstate creates a Bitstate of 2 to the power of log2Bits bits,
+// with each state setting the given number of bits. log2Bits must be
+// at least 6 (one word); 30 uses 128MiB. Two or three hashes are
+// usually best.
+func NewBitstate(log2Bits uint, hashes int) *Bitstate {
+	if log2Bits < 6 {
+		log2Bits = 6
+	}
+	if hashes < 1 {
+		hashes = 1
+	}
+	return &Bitstate{
+		words:  make([]uint64, 1<<(log2Bits-6)),
+		mask:   1<<log2Bits - 1,
+		hashes: hashes,
+	}
+}
+
+// WithBitstateHashing returns a copy of the receiver which, during
+// iteration with ForEach, ForEachPar and their variants, records the
+// state of the OptionGenerator after each prefix in bs, and skips the
+// prefix and all its continuations if its state appears to have been
+// seen before. As with WithStateDeduplication, the OptionGenerator
+// must implement StateHasher, and Count, Sample and the like are not
+// affected; unlike it, the iteration is only approximate, and once it
+// has returned, bs.Stats() reports whether any prefix was skipped and
+// how likely that was to be in error. ForEachParGen does not support
+// bitstate hashing, and returns ErrParGenUnsupported.
+func (p *TypedPermutations[T]) WithBitstateHashing(bs *Bitstate) *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) { p2.bitstate = bs })
+}
+
+// seen records the state with the given hash, reporting whether it
+// appears to have been recorded already.
+func (bs *Bitstate) seen(hash uint64) bool {
+	// The bits are chosen by double hashing, with the step derived
+	// from the hash by mixing (as splitmix64 does), and odd so that
+	// the bits chosen are distinct.
+	step := hash
+	step = (step ^ (step >> 30)) * 0xbf58476d1ce4e5b9
+	step = (step ^ (step >> 27)) * 0x94d049bb133111eb
+	step = (step ^ (step >> 31)) | 1
+	found := true
+	for idx := 0; idx < bs.hashes; idx++ {
+		bit := (hash + uint64(idx)*step) & bs.mask
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if bs.words[word]&mask == 0 {
+			found = false
+			bs.words[word] |= mask
+		}
+	}
+	if found {
+		bs.skipped++
+	} else {
+		bs.stored++
+	}
+	return found
+}
+
+// Stats returns statistics describing the states recorded.
+func (bs *Bitstate) Stats() BitstateStats {
+	set := 0
+	for _, word := range bs.words {
+		set += bits.OnesCount64(word)
+	}
+	fill := float64(set) / float64(bs.mask+1)
+	return BitstateStats{
+		States:      bs.stored,
+		Skipped:     bs.skipped,
+		Fill:        fill,
+		Omission:    math.Pow(fill, float64(bs.hashes)),
+		Approximate: bs.skipped > 0,
+	}
+}
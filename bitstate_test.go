@@ -0,0 +1,30 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestWithBitstateHashing(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(diamonds(4)...))
+	deduped := collect(p.WithStateDeduplication(nil))
+
+	// With plenty of bits, no state is mistaken for another, so the
+	// result is that of exact deduplication.
+	bs := NewBitstate(20, 3)
+	checkPerms(t, collect(p.WithBitstateHashing(bs)), deduped)
+	stats := bs.Stats()
+	if stats.States == 0 || stats.Skipped == 0 || !stats.Approximate || stats.Fill <= 0 || stats.Fill >= 0.01 || stats.Omission >= stats.Fill {
+		t.Fatalf("got %+v", stats)
+	}
+
+	// States seen by one iteration remain set for the next.
+	if got := collect(p.WithBitstateHashing(bs)); len(got) != 0 {
+		t.Fatalf("second iteration generated %q", got)
+	}
+
+	// With a single word, states are soon mistaken for one another.
+	bs = NewBitstate(0, 1)
+	if got := collect(p.WithBitstateHashing(bs)); len(got) >= len(deduped) || !bs.Stats().Approximate {
+		t.Fatalf("got %d permutations with %+v", len(got), bs.Stats())
+	}
+}
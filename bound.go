@@ -0,0 +1,251 @@
+package gsim
+
+import "reflect"
+
+// A TypedBoundedGenerator is an OptionGenerator which bounds the cost
+// of its permutations, as those returned by ContextBounded,
+// PreemptionBounded and DelayBounded do. Given no score function,
+// ForEachBestFirst uses Cost to explore the cheapest prefixes first.
+type TypedBoundedGenerator[T any] interface {
+	TypedOptionGenerator[T]
+	// Cost returns the cost of the permutation so far, were option,
+	// one of the options just generated, chosen next.
+	Cost(option T) int
+}
+
+// BoundedGenerator is the interface{} instantiation of
+// TypedBoundedGenerator.
+type BoundedGenerator = TypedBoundedGenerator[interface{}]
+
+// boundPolicy measures the cost of choosing options, for a
+// boundedGenerator. Policies are values: choose returns the policy
+// updated, so that clones may share the original.
+type boundPolicy[T any] interface {
+	// cost returns the cost of choosing option, at index idx, from
+	// options. idx is -1 if the index of option is not known.
+	cost(options []T, option T, idx int) int
+	// choose returns the policy after option has been chosen.
+	choose(option T) boundPolicy[T]
+}
+
+// boundedGenerator is the OptionGenerator returned by the bounding
+// functions, such as ContextBounded. It withholds the options whose
+// cost would take the total cost of the permutation beyond bound.
+type boundedGenerator[T any] struct {
+	gen     TypedOptionGenerator[T]
+	policy  boundPolicy[T]
+	bound   int
+	used    int
+	started bool
+	// options are the options gen generated last, before any were
+	// withheld.
+	options []T
+	// truncated is set if every one of the options was withheld, so
+	// that the permutation cannot be completed within the bound.
+	truncated bool
+}
+
+func (bg *boundedGenerator[T]) Clone() TypedOptionGenerator[T] {
+	return &boundedGenerator[T]{
+		gen:     bg.gen.Clone(),
+		policy:  bg.policy,
+		bound:   bg.bound,
+		used:    bg.used,
+		started: bg.started,
+		options: bg.options,
+	}
+}
+
+func (bg *boundedGenerator[T]) Generate(lastChosen T) []T {
+	if bg.started {
+		bg.used += bg.policy.cost(bg.options, lastChosen, optionIndex(bg.options, lastChosen))
+		bg.policy = bg.policy.choose(lastChosen)
+	}
+	bg.started = true
+	options := bg.gen.Generate(lastChosen)
+	bg.options = Retain(options)
+	bg.truncated = false
+	for idx, option := range options {
+		if bg.used+bg.policy.cost(bg.options, option, idx) <= bg.bound {
+			continue
+		}
+		kept := make([]T, idx, len(options)-1)
+		copy(kept, options[:idx])
+		for idx2, option := range options[idx+1:] {
+			if bg.used+bg.policy.cost(bg.options, option, idx+1+idx2) <= bg.bound {
+				kept = append(kept, option)
+			}
+		}
+		bg.truncated = len(kept) == 0
+		return kept
+	}
+	return options
+}
+
+func (bg *boundedGenerator[T]) Cost(option T) int {
+	return bg.used + bg.policy.cost(bg.options, option, optionIndex(bg.options, option))
+}
+
+// optionIndex returns the index of the first of options equal to
+// option, or -1 if there is none. Options are compared with ==, or
+// with reflect.DeepEqual where == would panic.
+func optionIndex[T any](options []T, option T) int {
+	target := reflect.ValueOf(interface{}(option))
+	for idx, o := range options {
+		other := reflect.ValueOf(interface{}(o))
+		switch {
+		case !target.IsValid() || !other.IsValid():
+			if target.IsValid() == other.IsValid() {
+				return idx
+			}
+		case target.Comparable() && other.Comparable():
+			if interface{}(o) == interface{}(option) {
+				return idx
+			}
+		case reflect.DeepEqual(interface{}(o), interface{}(option)):
+			return idx
+		}
+	}
+	return -1
+}
+
+// Stuck is the Stuck of the wrapped generator, if it is a
+// TypedDeadlockDetector.
+func (bg *boundedGenerator[T]) Stuck() []T {
+	if detector, ok := bg.gen.(TypedDeadlockDetector[T]); ok {
+		return detector.Stuck()
+	}
+	return nil
+}
+
+// Missed is the Missed of the wrapped generator, if it is a
+// TypedMilestoneDetector.
+func (bg *boundedGenerator[T]) Missed() []T {
+	if detector, ok := bg.gen.(TypedMilestoneDetector[T]); ok {
+		return detector.Missed()
+	}
+	return nil
+}
+
+// truncated reports whether gen is a boundedGenerator which withheld
+// every option it generated last. The prefix is then abandoned, as if
+// pruned, rather than supplied as a permutation.
+func truncated[T any](gen TypedOptionGenerator[T]) bool {
+	bg, ok := gen.(*boundedGenerator[T])
+	return ok && bg.truncated
+}
+
+// switchPolicy counts switches between actors or, if preemptive, only
+// those switches which preempt an actor able to continue.
+type switchPolicy[T any, A comparable] struct {
+	actorOf    func(option T) A
+	preemptive bool
+	last       A
+	hasLast    bool
+}
+
+func (sp switchPolicy[T, A]) cost(options []T, option T, idx int) int {
+	if !sp.hasLast || sp.actorOf(option) == sp.last {
+		return 0
+	} else if !sp.preemptive {
+		return 1
+	}
+	for _, other := range options {
+		if sp.actorOf(other) == sp.last {
+			return 1
+		}
+	}
+	return 0
+}
+
+func (sp switchPolicy[T, A]) choose(option T) boundPolicy[T] {
+	sp.last, sp.hasLast = sp.actorOf(option), true
+	return sp
+}
+
+// ContextBounded returns an OptionGenerator which only generates the
+// permutations of gen with at most bound context switches: choices of
+// an option whose actor, as given by actorOf, differs from that of
+// the option chosen before. Most concurrency bugs need only a few
+// context switches to manifest, so small bounds find them while
+// shrinking the space enormously. For graphs built with an
+// ActorModel, use its OptionActor as actorOf.
+//
+// Every switch counts against the bound, even one forced because the
+// actor has nothing more to do. So once the bound is spent, a prefix
+// whose actor has nothing more to do cannot be completed, and is
+// abandoned as WithPrune abandons prefixes: only complete
+// permutations are generated, and Count and Sample respect the bound.
+// PreemptionBounded counts only the switches which are not forced.
+//
+// The returned generator is a TypedDeadlockDetector and a
+// TypedMilestoneDetector if gen is, as are those of PreemptionBounded
+// and DelayBounded. It is neither a StateHasher nor a StateKeyer:
+// states of gen which are equal may differ in the bound left.
+func ContextBounded[T any, A comparable](gen TypedOptionGenerator[T], actorOf func(option T) A, bound int) TypedOptionGenerator[T] {
+	return &boundedGenerator[T]{
+		gen:    gen,
+		policy: switchPolicy[T, A]{actorOf: actorOf},
+		bound:  bound,
+	}
+}
+
+// PreemptionBounded returns an OptionGenerator which only generates
+// the permutations of gen with at most bound preemptions: choices of
+// an option whose actor, as given by actorOf, differs from that of
+// the option chosen before, while an option of that actor was still
+// available. Unlike ContextBounded, switches forced because the actor
+// has nothing more it can do are free, so no prefix is abandoned, and
+// a bound of 0 generates the schedules which run each actor until it
+// blocks or finishes. For graphs built with an ActorModel, use its
+// OptionActor as actorOf.
+func PreemptionBounded[T any, A comparable](gen TypedOptionGenerator[T], actorOf func(option T) A, bound int) TypedOptionGenerator[T] {
+	return &boundedGenerator[T]{
+		gen:    gen,
+		policy: switchPolicy[T, A]{actorOf: actorOf, preemptive: true},
+		bound:  bound,
+	}
+}
+
+// delayPolicy counts the options passed over.
+type delayPolicy[T any] struct{}
+
+func (dp delayPolicy[T]) cost(options []T, option T, idx int) int {
+	if idx == -1 {
+		return 0
+	}
+	return idx
+}
+
+func (dp delayPolicy[T]) choose(option T) boundPolicy[T] {
+	return dp
+}
+
+// DelayBounded returns an OptionGenerator which only generates the
+// permutations of gen which deviate from its default schedule by at
+// most bound delays. The default schedule always chooses the first of
+// gen's options, and choosing the option at index i instead delays
+// the i options before it. With a bound of 0, only the default
+// schedule is generated; each increment of the bound admits the
+// schedules which need one more delay.
+//
+// Each option generated is withheld according to its own index, but
+// once chosen an option is identified by its value: it is charged as
+// the first of the options equal to it, compared with == or, where ==
+// would panic, with reflect.DeepEqual. So an option equal to an
+// earlier one is charged as that earlier one, and an option which is
+// not equal even to itself, such as a func, is charged nothing.
+//
+// ForEach explores the permutations depth first, so the default
+// schedule comes first. Given no score function, ForEachBestFirst
+// instead checks them in order of the number of delays they require:
+// all the permutations with no delays, then those with one, and so
+// on, so that the bugs a deterministic scheduler is most likely to
+// hit are found first.
+func DelayBounded[T any](gen TypedOptionGenerator[T], bound int) TypedOptionGenerator[T] {
+	return &boundedGenerator[T]{
+		gen:    gen,
+		policy: delayPolicy[T]{},
+		bound:  bound,
+	}
+}
@@ -0,0 +1,151 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"testing"
+)
+
+// processOf is the actor of a node of processes: the first letter of
+// its value.
+func processOf(option interface{}) byte {
+	return option.(*GraphNode).Value.(string)[0]
+}
+
+func TestContextBounded(t *testing.T) {
+	// Prefixes which cannot be completed within the bound are
+	// abandoned.
+	for bound, want := range [][]string{
+		nil,
+		{"a1 a2 b1 b2", "b1 b2 a1 a2"},
+		{"a1 a2 b1 b2", "a1 b1 b2 a2", "b1 a1 a2 b2", "b1 b2 a1 a2"},
+	} {
+		p := BuildPermutations(ContextBounded[interface{}, byte](NewGraphPermutation(processes()...), processOf, bound))
+		checkPerms(t, collectSorted(p), want)
+		if count := p.Count(); count.Int64() != int64(len(want)) {
+			t.Fatalf("bound %d: counted %v permutations, want %d", bound, count, len(want))
+		}
+	}
+	gen := ContextBounded[interface{}, byte](NewGraphPermutation(processes()...), processOf, 3)
+	checkPerms(t, collectSorted(BuildPermutations(gen)), collectSorted(BuildPermutations(NewGraphPermutation(processes()...))))
+
+	// An ActorModel's OptionActor identifies the actors.
+	m := NewActorModel()
+	client, server := m.Actor("client"), m.Actor("server")
+	req := client.Step("req")
+	client.Step("other")
+	recv := server.Step("recv")
+	m.Send(req, recv)
+	server.Step("resp")
+	checkPerms(t, collectSorted(BuildPermutations(ContextBounded(m.NewGraphPermutation(), m.OptionActor, 1))), []string{
+		"req other recv resp",
+	})
+}
+
+func TestBoundedForwardsDetectors(t *testing.T) {
+	actorOf := func(interface{}) int { return 0 }
+	check := checkerFunc(func(*big.Int, []interface{}) error { return nil })
+	for idx, bounded := range []func(OptionGenerator) OptionGenerator{
+		func(gen OptionGenerator) OptionGenerator { return ContextBounded(gen, actorOf, 0) },
+		func(gen OptionGenerator) OptionGenerator { return PreemptionBounded(gen, actorOf, 0) },
+		func(gen OptionGenerator) OptionGenerator { return DelayBounded(gen, 3) },
+	} {
+		err := BuildPermutations(bounded(NewGraphPermutation(joinOrInhibit()...))).WithDeadlockPolicy(DeadlockAbort).ForEachCheck(check)
+		var de *DeadlockError
+		if !errors.As(err, &de) || permString(de.Stuck) != "x" {
+			t.Fatalf("generator %d: got %v, want x stuck", idx, err)
+		}
+
+		start := joinOrInhibit()
+		for _, gn := range reachableGraphNodes(start...) {
+			if gn.Value == "x" {
+				gn.SetMandatory()
+			}
+		}
+		err = BuildPermutations(bounded(NewGraphPermutation(start...))).WithMilestonePolicy(MilestoneAbort).ForEachCheck(check)
+		var me *MilestoneError
+		if !errors.As(err, &me) || permString(me.Missed) != "x" {
+			t.Fatalf("generator %d: got %v, want x missed", idx, err)
+		}
+	}
+}
+
+func TestPreemptionBounded(t *testing.T) {
+	for bound, want := range [][]string{
+		{"a1 a2 b1 b2", "b1 b2 a1 a2"},
+		{"a1 a2 b1 b2", "a1 b1 b2 a2", "b1 a1 a2 b2", "b1 b2 a1 a2"},
+	} {
+		gen := PreemptionBounded[interface{}, byte](NewGraphPermutation(processes()...), processOf, bound)
+		checkPerms(t, collectSorted(BuildPermutations(gen)), want)
+	}
+	gen := PreemptionBounded[interface{}, byte](NewGraphPermutation(processes()...), processOf, 2)
+	checkPerms(t, collectSorted(BuildPermutations(gen)), collectSorted(BuildPermutations(NewGraphPermutation(processes()...))))
+}
+
+func TestDelayBounded(t *testing.T) {
+	simple := func(bound int) *Permutations {
+		return BuildPermutations(DelayBounded(NewSimplePermutation([]interface{}{1, 2, 3, 4}), bound))
+	}
+	counts := make([]int, 7)
+	for bound := range counts {
+		counts[bound] = len(collect(simple(bound)))
+		if bound > 0 && counts[bound] < counts[bound-1] {
+			t.Fatalf("bound %d admits %d permutations, fewer than %d", bound, counts[bound], counts[bound-1])
+		}
+	}
+	if counts[0] != 1 || counts[6] != 24 {
+		t.Fatalf("got counts %v", counts)
+	}
+
+	// Best-first, the permutations needing fewer delays come first.
+	var got []string
+	err := simple(6).ForEachBestFirst(nil, checkerFunc(func(n *big.Int, perm []interface{}) error {
+		got = append(got, permString(perm))
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for bound := 0; bound < len(counts); bound++ {
+		first := append([]string{}, got[:counts[bound]]...)
+		sort.Strings(first)
+		checkPerms(t, first, collectSorted(simple(bound)))
+	}
+}
+
+// repeated offers the same options depth times over.
+type repeated struct {
+	options []interface{}
+	depth   int
+}
+
+func (r *repeated) Clone() OptionGenerator {
+	r2 := *r
+	return &r2
+}
+
+func (r *repeated) Generate(interface{}) []interface{} {
+	if r.depth == 0 {
+		return nil
+	}
+	r.depth--
+	return append([]interface{}{}, r.options...)
+}
+
+func TestDelayBoundedIdentifiesOptionsByIndex(t *testing.T) {
+	// Slices are not comparable, so must not be compared with ==.
+	slices := []interface{}{[]int{0}, []int{1}, []int{2}}
+	for bound, want := range []int{1, 3, 6, 8, 9} {
+		p := BuildPermutations(DelayBounded[interface{}](&repeated{options: slices, depth: 2}, bound))
+		if got := len(collect(p)); got != want {
+			t.Fatalf("bound %d: got %d permutations, want %d", bound, got, want)
+		}
+	}
+
+	// Equal options are withheld according to their own index, so
+	// only the default schedule has no delays.
+	duplicates := []interface{}{"x", "x", "y"}
+	p := BuildPermutations(DelayBounded[interface{}](&repeated{options: duplicates, depth: 2}, 0))
+	checkPerms(t, collect(p), []string{"x x"})
+}
@@ -0,0 +1,165 @@
+package gsim
+
+// GraphBuilder constructs graphs fluently, creating nodes, edges and
+// callbacks in one pass. Nodes are identified by their values, which
+// must therefore be distinct and comparable. For example:
+//
+//	b := gsim.NewGraphBuilder()
+//	b.Node("A").Then("B", "C").Join("D")
+//	b.Node("E").Inhibits("D")
+//	start := b.Build() // A and E
+//
+// Here B and C both follow A, D requires both B and C, and once E is
+// chosen D can never be.
+type GraphBuilder struct {
+	nodes      map[interface{}]*GraphNode
+	order      []*GraphNode
+	requireAll map[*GraphNode]bool
+	inhibitors map[*GraphNode][]*GraphNode
+}
+
+// GraphSelection is a set of nodes within a GraphBuilder, to which
+// edges and constraints can be added.
+type GraphSelection struct {
+	builder *GraphBuilder
+	nodes   []*GraphNode
+}
+
+// Construct a new, empty, GraphBuilder.
+func NewGraphBuilder() *GraphBuilder {
+	return &GraphBuilder{
+		nodes:      make(map[interface{}]*GraphNode),
+		requireAll: make(map[*GraphNode]bool),
+		inhibitors: make(map[*GraphNode][]*GraphNode),
+	}
+}
+
+// Node selects the nodes with the given values, creating any which do
+// not yet exist.
+func (b *GraphBuilder) Node(values ...interface{}) *GraphSelection {
+	nodes := make([]*GraphNode, len(values))
+	for idx, value := range values {
+		gn, found := b.nodes[value]
+		if !found {
+			gn = NewGraphNode(value)
+			b.nodes[value] = gn
+			b.order = append(b.order, gn)
+		}
+		nodes[idx] = gn
+	}
+	return &GraphSelection{builder: b, nodes: nodes}
+}
+
+// Then adds an edge from every selected node to each of the nodes
+// with the given values, and selects the latter.
+func (s *GraphSelection) Then(values ...interface{}) *GraphSelection {
+	next := s.builder.Node(values...)
+	for _, gn := range s.nodes {
+		for _, gn2 := range next.nodes {
+			gn.AddEdgeTo(gn2)
+		}
+	}
+	return next
+}
+
+// Join adds an edge from every selected node to the node with the
+// given value, which requires all of its predecessors (see
+// RequireAll), and selects it.
+func (s *GraphSelection) Join(value interface{}) *GraphSelection {
+	return s.Then(value).RequireAll()
+}
+
+// RequireAll adds an edge from each of the nodes with the given
+// values to every selected node, and makes the selected nodes become
+// available only once all of their predecessors (other than
+// inhibitors) have been reached. By default a node becomes available
+// as soon as any of its predecessors has been reached. The selection
+// is unchanged.
+func (s *GraphSelection) RequireAll(values ...interface{}) *GraphSelection {
+	s.builder.Node(values...).Then(s.values()...)
+	for _, gn := range s.nodes {
+		s.builder.requireAll[gn] = true
+	}
+	return s
+}
+
+// Inhibits adds an edge from every selected node to each of the nodes
+// with the given values, such that once any selected node is chosen
+// the latter are inhibited. The selection is unchanged.
+func (s *GraphSelection) Inhibits(values ...interface{}) *GraphSelection {
+	targets := s.builder.Node(values...)
+	for _, gn := range s.nodes {
+		for _, gn2 := range targets.nodes {
+			gn.AddEdgeTo(gn2)
+			if !containsGraphNode(s.builder.inhibitors[gn2], gn) {
+				s.builder.inhibitors[gn2] = append(s.builder.inhibitors[gn2], gn)
+			}
+		}
+	}
+	return s
+}
+
+// Nodes returns the selected nodes.
+func (s *GraphSelection) Nodes() []*GraphNode {
+	return s.nodes
+}
+
+func (s *GraphSelection) values() []interface{} {
+	values := make([]interface{}, len(s.nodes))
+	for idx, gn := range s.nodes {
+		values[idx] = gn.Value
+	}
+	return values
+}
+
+// Build sets the callbacks of every node created by the builder, and
+// returns the starting nodes: those with no predecessors other than
+// inhibitors, in the order in which they were created. These can be
+// passed to NewGraphPermutation.
+func (b *GraphBuilder) Build() []*GraphNode {
+	var start []*GraphNode
+	for _, gn := range b.order {
+		if setBuiltCallback(gn, b.requireAll[gn], b.inhibitors[gn]) {
+			start = append(start, gn)
+		}
+	}
+	return start
+}
+
+// setBuiltCallback sets the callback of gn, whose incoming edges are
+// all in place, to that returned by builtCallback, reporting whether
+// gn must be a starting node.
+func setBuiltCallback(gn *GraphNode, requireAll bool, inhibitors []*GraphNode) bool {
+	callback, start := builtCallback(gn, requireAll, inhibitors)
+	gn.Callback = callback
+	return start
+}
+
+// builtCallback returns a callback for gn, whose incoming edges are
+// all in place, such that it is inhibited once any of inhibitors is
+// reached, and otherwise becomes available once any (or, if
+// requireAll, every) other predecessor is reached. It also reports
+// whether gn has no predecessors other than inhibitors, and so must
+// be a starting node.
+func builtCallback(gn *GraphNode, requireAll bool, inhibitors []*GraphNode) (GraphNodeCallback, bool) {
+	var required []*GraphNode
+	for _, in := range gn.In {
+		if !containsGraphNode(inhibitors, in) {
+			required = append(required, in)
+		}
+	}
+
+	var available GraphNodeCallback = AvailableAnyCallback
+	if requireAll {
+		available = NewAvailableAllCallback(required...)
+	}
+	if len(inhibitors) == 0 {
+		return available, len(required) == 0
+	}
+	combination := NewCombinationCallback(InhibitThenAvailableCombiner)
+	for _, inhibitor := range inhibitors {
+		combination.AddCallback(NewInhibitAllCallback(inhibitor))
+	}
+	combination.AddCallback(available)
+	return combination, len(required) == 0
+}
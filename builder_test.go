@@ -0,0 +1,39 @@
+package gsim
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGraphBuilder(t *testing.T) {
+	b := NewGraphBuilder()
+	b.Node("A").Then("B", "C").Join("D")
+	b.Node("E").Inhibits("D")
+	start := b.Build()
+	if len(start) != 2 || start[0].Value != "A" || start[1].Value != "E" {
+		t.Fatalf("got starting nodes %v", start)
+	}
+	before := func(perm, x, y string) bool {
+		return strings.Index(perm, x) < strings.Index(perm, y)
+	}
+	perms := collect(BuildPermutations(NewGraphPermutation(start...)))
+	withD := 0
+	for _, perm := range perms {
+		if !before(perm, "A", "B") || !before(perm, "A", "C") {
+			t.Fatalf("%q: B and C must follow A", perm)
+		}
+		if strings.Contains(perm, "D") {
+			withD++
+			if !before(perm, "B", "D") || !before(perm, "C", "D") || !before(perm, "D", "E") {
+				t.Fatalf("%q: D must follow B and C, and precede E", perm)
+			}
+		} else if !strings.Contains(perm, "E") {
+			t.Fatalf("%q: D is missing although E did not inhibit it", perm)
+		}
+	}
+	// With D: A, then B and C in either order, then D, with E last:
+	// 2. Without: E anywhere amongst A, then B and C: 8.
+	if withD != 2 || len(perms) != 2+8 {
+		t.Fatalf("got %d permutations, %d with D: %q", len(perms), withD, perms)
+	}
+}
@@ -0,0 +1,95 @@
+package gsim
+
+import (
+	"errors"
+)
+
+// WireFIFOChannel adds the edges and callbacks which model a FIFO
+// channel: sends[i] is the sending of the i-th message and
+// receives[i] its receipt. Receive i then requires both send i and
+// receive i-1, so messages are received in the order they are sent.
+// If capacity is greater than 0, the channel is bounded: send i also
+// requires receive i-capacity, so no more than capacity messages are
+// ever in flight. There may be fewer receives than sends, in which
+// case the remaining messages are never received.
+//
+// The nodes may have other edges and callbacks too, such as those
+// ordering the sends within the sending process: the channel's
+// requirements are added to the existing callback rather than
+// replacing it. As the callback of a starting node is never invoked,
+// neither the receives nor the sends which are subject to the
+// capacity may be starting nodes.
+func WireFIFOChannel(sends, receives []*GraphNode, capacity int) error {
+	if len(receives) > len(sends) {
+		return errors.New("more receives than sends")
+	} else if capacity < 0 {
+		return errors.New("negative capacity")
+	}
+	for idx, recv := range receives {
+		required := []*GraphNode{sends[idx]}
+		if idx > 0 {
+			required = append(required, receives[idx-1])
+		}
+		requireNodes(recv, required...)
+	}
+	if capacity > 0 {
+		for idx := capacity; idx < len(sends) && idx-capacity < len(receives); idx++ {
+			requireNodes(sends[idx], receives[idx-capacity])
+		}
+	}
+	return nil
+}
+
+// requireNodes adds edges from each of required to gn, and wraps gn's
+// callback so that gn can only become available once they have all
+// been reached.
+func requireNodes(gn *GraphNode, required ...*GraphNode) {
+	rc, ok := gn.Callback.(*requireCallback)
+	if !ok {
+		rc = &requireCallback{inner: gn.Callback}
+		gn.Callback = rc
+	}
+	for _, req := range required {
+		req.AddEdgeTo(gn)
+		if !containsGraphNode(rc.required, req) {
+			rc.required = append(rc.required, req)
+		}
+	}
+}
+
+// requireCallback hides its required nodes from the inner callback,
+// and holds back MakeAvailable until they have all been reached. If
+// the node has no incoming edges other than from required nodes, it
+// becomes available as soon as they have all been reached.
+type requireCallback struct {
+	inner    GraphNodeCallback
+	required []*GraphNode
+}
+
+func (rc *requireCallback) IncomingEdgesReached(node *GraphNode, reached []*GraphNode) GraphNodeStateChange {
+	others := make([]*GraphNode, 0, len(reached))
+	count := 0
+	for _, gn := range reached {
+		if containsGraphNode(rc.required, gn) {
+			count++
+		} else {
+			others = append(others, gn)
+		}
+	}
+
+	result := GraphNodeStateChange(MakeAvailable)
+	if len(others) != 0 {
+		result = rc.inner.IncomingEdgesReached(node, others)
+	} else {
+		for _, in := range node.In {
+			if !containsGraphNode(rc.required, in) {
+				result = NoChange // wait for the other edges
+				break
+			}
+		}
+	}
+	if result == MakeAvailable && count < len(rc.required) {
+		return NoChange
+	}
+	return result
+}
@@ -0,0 +1,31 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestWireFIFOChannel(t *testing.T) {
+	build := func(capacity int) []string {
+		g := nodes("s1", "s2", "r1", "r2")
+		g[0].AddEdgeTo(g[1])
+		if err := WireFIFOChannel(g[:2], g[2:], capacity); err != nil {
+			t.Fatal(err)
+		}
+		return collectSorted(BuildPermutations(NewGraphPermutation(g[0])))
+	}
+	checkPerms(t, build(0), []string{
+		"s1 r1 s2 r2",
+		"s1 s2 r1 r2",
+	})
+	checkPerms(t, build(1), []string{
+		"s1 r1 s2 r2",
+	})
+
+	g := nodes("s1", "r1", "r2")
+	if err := WireFIFOChannel(g[:1], g[1:], 0); err == nil {
+		t.Fatal("more receives than sends accepted")
+	}
+	if err := WireFIFOChannel(g[:2], g[2:], -1); err == nil {
+		t.Fatal("negative capacity accepted")
+	}
+}
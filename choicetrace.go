@@ -0,0 +1,64 @@
+package gsim
+
+import (
+	"math/big"
+)
+
+// A ChoicePoint describes one step of a permutation: the index of the
+// option chosen, and the number of options there were to choose
+// from. The permutation number is built from its choices, the first
+// being the least significant digit: each Index is a digit in base
+// Options.
+type ChoicePoint struct {
+	Index   int
+	Options int
+}
+
+// A ChoiceConsumer is a TypedPermutationConsumer or
+// TypedPermutationChecker which wishes to know the decision path of
+// each permutation, for example to compute branching statistics or to
+// replay permutations without big.Int arithmetic (see
+// DrawPermutation). Choices is called immediately before Consume (or
+// Check, or Deadlocked) with one ChoicePoint for each element of the
+// permutation. Steps with a single option are included. As with
+// Consume, choices must not be retained or mutated.
+//
+// Choices is called by the sequential iteration functions: ForEach,
+// ForEachCheck, ForEachRange, ForEachRangeCheck and RunFor. It is not
+// called by the parallel iteration functions, and WithStateMerging is
+// disabled for consumers which implement it.
+type ChoiceConsumer interface {
+	Choices(choices []ChoicePoint)
+}
+
+// choiceConsumer finds the ChoiceConsumer behind f, if there is one.
+func choiceConsumer[T any](f TypedPermutationChecker[T]) (ChoiceConsumer, bool) {
+	if cc, ok := f.(consumerChecker[T]); ok {
+		chc, ok := cc.TypedPermutationConsumer.(ChoiceConsumer)
+		return chc, ok
+	}
+	chc, ok := f.(ChoiceConsumer)
+	return chc, ok
+}
+
+// choicesTo returns the choices made to reach the node with the given
+// number and depth, appended to choices[:0].
+func (p *TypedPermutations[T]) choicesTo(choices []ChoicePoint, n *big.Int, depth int) []ChoicePoint {
+	choices = choices[:0]
+	remaining := new(big.Int).Set(n)
+	choiceBig := new(big.Int)
+	path := make([]T, 0, depth)
+	gen := p.root.generator.Clone()
+	val := p.root.value
+	for d := 0; d < depth; d++ {
+		options, _ := p.generate(gen, val, path)
+		optionCount := len(options)
+		choiceBig.SetInt64(int64(optionCount))
+		remaining.QuoRem(remaining, choiceBig, choiceBig)
+		idx := int(choiceBig.Int64())
+		choices = append(choices, ChoicePoint{Index: idx, Options: optionCount})
+		val = options[idx]
+		path = append(path, val)
+	}
+	return choices
+}
@@ -0,0 +1,55 @@
+package gsim
+
+import (
+	"math/big"
+	"testing"
+)
+
+// choiceChecker checks that the choices of each permutation give its
+// number.
+type choiceChecker struct {
+	t       *testing.T
+	choices []ChoicePoint
+	checked int
+}
+
+func (cc *choiceChecker) Clone() PermutationConsumer {
+	return cc
+}
+
+func (cc *choiceChecker) Choices(choices []ChoicePoint) {
+	cc.choices = append(cc.choices[:0], choices...)
+}
+
+func (cc *choiceChecker) Consume(n *big.Int, perm []interface{}) {
+	if len(cc.choices) != len(perm) {
+		cc.t.Fatalf("%d choices for %q", len(cc.choices), permString(perm))
+	}
+	got, base := new(big.Int), big.NewInt(1)
+	for _, choice := range cc.choices {
+		if choice.Index < 0 || choice.Index >= choice.Options {
+			cc.t.Fatalf("choice %+v for %q", choice, permString(perm))
+		}
+		got.Add(got, new(big.Int).Mul(big.NewInt(int64(choice.Index)), base))
+		base.Mul(base, big.NewInt(int64(choice.Options)))
+	}
+	if got.Cmp(n) != 0 {
+		cc.t.Fatalf("choices %+v give %v for permutation %v", cc.choices, got, n)
+	}
+	cc.choices = cc.choices[:0]
+	cc.checked++
+}
+
+func TestChoiceConsumer(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(diamonds(3)...))
+	cc := &choiceChecker{t: t}
+	p.ForEach(cc)
+	if want := len(collect(p)); cc.checked != want {
+		t.Fatalf("checked %d permutations, want %d", cc.checked, want)
+	}
+	cc.checked = 0
+	p.ForEachRange(big.NewInt(2), big.NewInt(5), cc)
+	if cc.checked != 3 {
+		t.Fatalf("checked %d permutations in range, want 3", cc.checked)
+	}
+}
@@ -0,0 +1,208 @@
+// Command gsim runs the gsim permutation engine over a graph defined
+// in a file, so that the engine can be used without writing Go.
+//
+// Usage:
+//
+//	gsim count [flags] graph
+//	gsim enumerate [flags] graph
+//	gsim sample [flags] graph
+//	gsim replay [flags] graph n...
+//
+// The graph file is read with gsim.ReadGraphJSON if its name ends in
+// .json, and with gsim.ReadDOT otherwise. Permutations are written to
+// stdout one per line: the permutation number, a tab, and then the
+// values of the nodes separated by spaces. With -json, each line is
+// instead a JSON object with fields n and perm.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/msackman/gsim"
+)
+
+type permutationWriter struct {
+	w      *bufio.Writer
+	asJSON bool
+	// err is the first error writing to w. Once it is set, further
+	// permutations are dropped.
+	err error
+}
+
+func (pw *permutationWriter) Clone() gsim.PermutationConsumer {
+	return pw
+}
+
+func (pw *permutationWriter) Consume(n *big.Int, perm []interface{}) {
+	if pw.err != nil {
+		return
+	}
+	values := make([]interface{}, len(perm))
+	for idx, elem := range perm {
+		values[idx] = elem.(*gsim.GraphNode).Value
+	}
+	if pw.asJSON {
+		line, err := json.Marshal(struct {
+			N    string        `json:"n"`
+			Perm []interface{} `json:"perm"`
+		}{N: n.String(), Perm: values})
+		if err != nil {
+			panic(err)
+		}
+		if _, pw.err = pw.w.Write(line); pw.err == nil {
+			pw.err = pw.w.WriteByte('\n')
+		}
+		return
+	}
+	strs := make([]string, len(values))
+	for idx, value := range values {
+		strs[idx] = fmt.Sprint(value)
+	}
+	_, pw.err = fmt.Fprintf(pw.w, "%v\t%s\n", n, strings.Join(strs, " "))
+}
+
+func loadGraph(path string) ([]*gsim.GraphNode, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var read func(io.Reader) ([]*gsim.GraphNode, error) = gsim.ReadDOT
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		read = gsim.ReadGraphJSON
+	}
+	return read(bufio.NewReader(file))
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: gsim command [flags] graph [args]
+
+Commands:
+  count      print the number of permutations
+  enumerate  print every permutation
+  sample     print a uniform random sample of permutations
+  replay     print the permutations with the given numbers
+
+Run "gsim command -h" for the flags of each command.`)
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	opts := options{command: command}
+	flags.IntVar(&opts.maxDepth, "max-depth", 0, "only generate prefixes of at most this length (0 is unbounded)")
+	minArgs := 1
+	switch command {
+	case "count":
+	case "enumerate":
+		flags.BoolVar(&opts.asJSON, "json", false, "write permutations as JSON objects")
+		flags.StringVar(&opts.from, "from", "", "only permutations numbered at least this")
+		flags.StringVar(&opts.to, "to", "", "only permutations numbered less than this")
+	case "sample":
+		flags.BoolVar(&opts.asJSON, "json", false, "write permutations as JSON objects")
+		flags.IntVar(&opts.count, "n", 10, "the number of permutations to sample")
+		flags.Int64Var(&opts.seed, "seed", 1, "the random seed")
+	case "replay":
+		flags.BoolVar(&opts.asJSON, "json", false, "write permutations as JSON objects")
+		minArgs = 2
+	default:
+		usage()
+	}
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gsim %s [flags] graph", command)
+		if command == "replay" {
+			fmt.Fprint(os.Stderr, " n...")
+		}
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[2:])
+	if flags.NArg() < minArgs {
+		flags.Usage()
+		os.Exit(2)
+	}
+	opts.args = flags.Args()
+	if err := run(os.Stdout, opts); err != nil {
+		fmt.Fprintln(os.Stderr, "gsim:", err)
+		os.Exit(1)
+	}
+}
+
+func parseNumber(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok || n.Sign() < 0 {
+		return nil, fmt.Errorf("invalid permutation number %q", s)
+	}
+	return n, nil
+}
+
+// options are the command and arguments given to gsim, along with
+// its flags. Flags which the command does not take are left zero.
+type options struct {
+	command  string
+	args     []string
+	maxDepth int
+	asJSON   bool
+	from, to string
+	count    int
+	seed     int64
+}
+
+func run(w io.Writer, opts options) error {
+	start, err := loadGraph(opts.args[0])
+	if err != nil {
+		return err
+	}
+	perms := gsim.BuildPermutations(gsim.NewGraphPermutation(start...)).WithMaxDepth(opts.maxDepth)
+	if opts.command == "count" {
+		_, err := fmt.Fprintln(w, perms.Count())
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	pw := &permutationWriter{w: out, asJSON: opts.asJSON}
+	switch opts.command {
+	case "enumerate":
+		fromN, err := parseNumber(opts.from)
+		if err != nil {
+			return err
+		}
+		toN, err := parseNumber(opts.to)
+		if err != nil {
+			return err
+		}
+		perms.ForEachRange(fromN, toN, pw)
+	case "sample":
+		perms.Sample(opts.count, opts.seed, pw)
+	case "replay":
+		nums := make([]*big.Int, len(opts.args)-1)
+		for idx, arg := range opts.args[1:] {
+			if nums[idx], err = parseNumber(arg); err != nil {
+				return err
+			}
+		}
+		err = perms.Replay(nums, pw)
+	}
+	if err == nil {
+		err = pw.err
+	}
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "graph.dot")
+	if err := os.WriteFile(path, []byte(`digraph { a -> c; b -> c; c [require="all"] }`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		command string
+		args    []string
+		asJSON  bool
+		want    string
+	}{
+		{"count", nil, false, "2\n"},
+		{"enumerate", nil, false, "1\tb a c\n0\ta b c\n"},
+		{"enumerate", nil, true, `{"n":"1","perm":["b","a","c"]}` + "\n" + `{"n":"0","perm":["a","b","c"]}` + "\n"},
+		{"replay", []string{"1"}, false, "1\tb a c\n"},
+	} {
+		var buf bytes.Buffer
+		opts := options{command: test.command, args: append([]string{path}, test.args...), asJSON: test.asJSON}
+		if err := run(&buf, opts); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.want {
+			t.Errorf("%s %v: got %q, want %q", test.command, test.args, buf.String(), test.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := run(&buf, options{command: "sample", args: []string{path}, count: 3, seed: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(buf.Bytes(), []byte("\n")); lines != 3 {
+		t.Fatalf("sampled %d permutations, want 3", lines)
+	}
+	if err := run(&buf, options{command: "replay", args: []string{path, "-1"}}); err == nil {
+		t.Fatal("negative permutation number replayed without error")
+	}
+
+	// Write errors, such as those of a full disk, are reported.
+	for _, asJSON := range []bool{false, true} {
+		opts := options{command: "enumerate", args: []string{path}, asJSON: asJSON}
+		if err := run(failingWriter{}, opts); !errors.Is(err, errWriteFailed) {
+			t.Fatalf("got %v, want %v", err, errWriteFailed)
+		}
+	}
+}
+
+var errWriteFailed = errors.New("write failed")
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errWriteFailed
+}
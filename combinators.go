@@ -0,0 +1,130 @@
+package gsim
+
+// The combinators in this file compose OptionGenerators. Each
+// combinator must be able to tell which of its generators an option
+// came from, so the options of the composed generators must be
+// distinct: comparing equal (with ==) to an option of the other
+// generator is an error, as is using option values which cannot be
+// compared. GraphNodes are always distinct, so graphs may be freely
+// composed.
+
+// interleaving is the OptionGenerator returned by Interleave.
+type interleaving[T any] struct {
+	started      bool
+	g1, g2       TypedOptionGenerator[T]
+	opts1, opts2 []T
+}
+
+// Interleave returns an OptionGenerator which freely shuffles the
+// options of g1 and g2: at every step either generator may advance.
+// This models two independent subsystems without merging them into
+// one graph by hand.
+func Interleave[T any](g1, g2 TypedOptionGenerator[T]) TypedOptionGenerator[T] {
+	return &interleaving[T]{g1: g1, g2: g2}
+}
+
+func (il *interleaving[T]) Clone() TypedOptionGenerator[T] {
+	return &interleaving[T]{
+		started: il.started,
+		g1:      il.g1.Clone(),
+		g2:      il.g2.Clone(),
+		opts1:   il.opts1,
+		opts2:   il.opts2,
+	}
+}
+
+func (il *interleaving[T]) Generate(lastChosen T) []T {
+	switch {
+	case !il.started:
+		il.started = true
+		il.opts1 = Retain(il.g1.Generate(lastChosen))
+		il.opts2 = Retain(il.g2.Generate(lastChosen))
+	case containsOption(il.opts1, lastChosen):
+		il.opts1 = Retain(il.g1.Generate(lastChosen))
+	default:
+		il.opts2 = Retain(il.g2.Generate(lastChosen))
+	}
+	options := make([]T, 0, len(il.opts1)+len(il.opts2))
+	return append(append(options, il.opts1...), il.opts2...)
+}
+
+// sequence is the OptionGenerator returned by Sequence.
+type sequence[T any] struct {
+	second bool
+	g1, g2 TypedOptionGenerator[T]
+}
+
+// Sequence returns an OptionGenerator which generates the options of
+// g1 until it is exhausted, and then those of g2. g2 is started (its
+// Generate is called for the first time) with the zero value of T, as
+// if it were the root.
+func Sequence[T any](g1, g2 TypedOptionGenerator[T]) TypedOptionGenerator[T] {
+	return &sequence[T]{g1: g1, g2: g2}
+}
+
+func (sq *sequence[T]) Clone() TypedOptionGenerator[T] {
+	return &sequence[T]{
+		second: sq.second,
+		g1:     sq.g1.Clone(),
+		g2:     sq.g2.Clone(),
+	}
+}
+
+func (sq *sequence[T]) Generate(lastChosen T) []T {
+	if sq.second {
+		return sq.g2.Generate(lastChosen)
+	}
+	if options := sq.g1.Generate(lastChosen); len(options) != 0 {
+		return options
+	}
+	sq.second = true
+	var zero T
+	return sq.g2.Generate(zero)
+}
+
+// choice is the OptionGenerator returned by Choice.
+type choice[T any] struct {
+	started bool
+	chosen  TypedOptionGenerator[T]
+	g1, g2  TypedOptionGenerator[T]
+	opts1   []T
+}
+
+// Choice returns an OptionGenerator which explores both alternatives:
+// the first option chosen decides between g1 and g2, and from then on
+// only the chosen generator advances. The permutations generated are
+// thus those of g1 followed by those of g2.
+func Choice[T any](g1, g2 TypedOptionGenerator[T]) TypedOptionGenerator[T] {
+	return &choice[T]{g1: g1, g2: g2}
+}
+
+func (ch *choice[T]) Clone() TypedOptionGenerator[T] {
+	if ch.chosen != nil {
+		return &choice[T]{started: true, chosen: ch.chosen.Clone()}
+	}
+	return &choice[T]{
+		started: ch.started,
+		g1:      ch.g1.Clone(),
+		g2:      ch.g2.Clone(),
+		opts1:   ch.opts1,
+	}
+}
+
+func (ch *choice[T]) Generate(lastChosen T) []T {
+	switch {
+	case ch.chosen != nil:
+		return ch.chosen.Generate(lastChosen)
+	case !ch.started:
+		ch.started = true
+		ch.opts1 = Retain(ch.g1.Generate(lastChosen))
+		opts2 := ch.g2.Generate(lastChosen)
+		options := make([]T, 0, len(ch.opts1)+len(opts2))
+		return append(append(options, ch.opts1...), opts2...)
+	case containsOption(ch.opts1, lastChosen):
+		ch.chosen = ch.g1
+	default:
+		ch.chosen = ch.g2
+	}
+	ch.g1, ch.g2, ch.opts1 = nil, nil, nil
+	return ch.chosen.Generate(lastChosen)
+}
@@ -0,0 +1,38 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestCombinators(t *testing.T) {
+	ab := func() OptionGenerator { return NewSimplePermutation([]interface{}{"a", "b"}) }
+	xy := func() OptionGenerator { return NewSimplePermutation([]interface{}{"x", "y"}) }
+
+	checkPerms(t, collectSorted(BuildPermutations(Sequence(ab(), xy()))), []string{
+		"a b x y",
+		"a b y x",
+		"b a x y",
+		"b a y x",
+	})
+	checkPerms(t, collectSorted(BuildPermutations(Choice(ab(), xy()))), []string{
+		"a b",
+		"b a",
+		"x y",
+		"y x",
+	})
+	// Any interleaving of an ordering of a and b with one of x and y:
+	// 4!, as every element is distinct.
+	interleaved := collectSorted(BuildPermutations(Interleave(ab(), xy())))
+	if len(interleaved) != 24 {
+		t.Fatalf("got %d interleavings, want 24", len(interleaved))
+	}
+	checkPerms(t, interleaved, collectSorted(BuildPermutations(NewSimplePermutation([]interface{}{"a", "b", "x", "y"}))))
+
+	// Graphs compose too: a1 before a2, interleaved with b1 before b2.
+	g := nodes("a1", "a2", "b1", "b2")
+	g[0].AddEdgeTo(g[1])
+	g[2].AddEdgeTo(g[3])
+	checkPerms(t,
+		collectSorted(BuildPermutations(Interleave(NewGraphPermutation(g[0]), NewGraphPermutation(g[2])))),
+		collectSorted(BuildPermutations(NewGraphPermutation(g[0], g[2]))))
+}
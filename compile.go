@@ -0,0 +1,115 @@
+package gsim
+
+import (
+	"sync/atomic"
+)
+
+// CompiledGraph is the immutable compiled form of the graph reachable
+// from a set of starting nodes, produced by Compile. Every node is
+// given a small integer id, its index in Nodes, and the edges and
+// callback of each node are recorded by id, along with some analysis
+// of the graph. The graph OptionGenerators it creates all execute
+// against this one structure, so a CompiledGraph may be shared by any
+// number of concurrent runs, and compiling once saves each of them
+// from doing so.
+//
+// NewGraphPermutation compiles the graph in just the same way, but
+// lazily, when the OptionGenerator is first used. Either way, edges,
+// callbacks and so on must not be changed once the graph has been
+// compiled: changes are not seen by its OptionGenerators.
+type CompiledGraph struct {
+	info *graphInfo
+}
+
+// Compile compiles the graph reachable from the given starting nodes.
+func Compile(start ...*GraphNode) *CompiledGraph {
+	info := newGraphInfo(start)
+	info.build()
+	return &CompiledGraph{info: info}
+}
+
+// NewGraphPermutation creates an OptionGenerator for the graph, which
+// is exactly as that created by NewGraphPermutation from the same
+// starting nodes.
+func (cg *CompiledGraph) NewGraphPermutation() OptionGenerator {
+	current := make([]interface{}, len(cg.info.start))
+	for idx, gn := range cg.info.start {
+		current[idx] = gn
+	}
+	return &graphPermutation{
+		graph:   cg.info,
+		current: current,
+	}
+}
+
+// Len returns the number of nodes in the graph.
+func (cg *CompiledGraph) Len() int {
+	return len(cg.info.nodes)
+}
+
+// Nodes returns every node of the graph, in order of id: the order in
+// which they are reachable (breadth first) from the starting nodes,
+// starting nodes first.
+func (cg *CompiledGraph) Nodes() []*GraphNode {
+	return append([]*GraphNode(nil), cg.info.nodes...)
+}
+
+// Node returns the node with the given id.
+func (cg *CompiledGraph) Node(id int) *GraphNode {
+	return cg.info.nodes[id]
+}
+
+// ID returns the id of the node, and true, if it belongs to the
+// graph. See also GraphNode's ID.
+func (cg *CompiledGraph) ID(gn *GraphNode) (int, bool) {
+	id, found := cg.info.index[gn]
+	return id, found
+}
+
+// Out returns the ids of the targets of the outgoing edges of the
+// node with the given id, in the order of its Out field. The slice
+// must not be modified.
+func (cg *CompiledGraph) Out(id int) []int {
+	return cg.info.out[id]
+}
+
+// In returns the ids of the sources of the incoming edges of the node
+// with the given id, in order of id. Edges from nodes which are not
+// reachable are omitted. The slice must not be modified.
+func (cg *CompiledGraph) In(id int) []int {
+	return cg.info.in[id]
+}
+
+// Callback returns the callback of the node with the given id, as it
+// was when the graph was compiled.
+func (cg *CompiledGraph) Callback(id int) GraphNodeCallback {
+	return cg.info.callbacks[id]
+}
+
+// Cyclic reports whether the node with the given id lies on a cycle.
+// See FindCycles.
+func (cg *CompiledGraph) Cyclic(id int) bool {
+	return cg.info.cyclic[cg.info.nodes[id]]
+}
+
+// Timed reports whether any node has timing constraints. See
+// AddTimedEdgeTo and SetDeadline.
+func (cg *CompiledGraph) Timed() bool {
+	return cg.info.timed
+}
+
+// ID returns the node's id, and true, once the node has been compiled
+// (by Compile, or by first use of a graph OptionGenerator), or false
+// before then. Ids are small integers, so consumers may use them to
+// index slices rather than keying maps by node.
+//
+// The id is that given by the first graph compiled which contains
+// the node. Graphs compiled from the same starting nodes always give
+// the same ids (which are also those used by PermutationCodec), so
+// this matters only when a node is shared between graphs with
+// different starting nodes, in which case CompiledGraph's ID gives
+// the node's id in each.
+func (gn *GraphNode) ID() (int, bool) {
+	id := atomic.LoadInt64(&gn.id)
+	return int(id - 1), id != 0
+}
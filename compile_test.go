@@ -0,0 +1,76 @@
+package gsim
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	start := egraph()
+	want := newCollector()
+	BuildPermutations(NewGraphPermutation(egraph()...)).ForEach(want)
+
+	cg := Compile(start...)
+	// The compiled graph does not see later changes.
+	start[0].AddEdgeTo(NewGraphNode("late"))
+	if cg.Len() != 4 || len(cg.Nodes()) != 4 || cg.Timed() {
+		t.Fatalf("compiled %v", cg.Nodes())
+	}
+	var wg sync.WaitGroup
+	for run := 0; run < 4; run++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got := newCollector()
+			BuildPermutations(cg.NewGraphPermutation()).ForEach(got)
+			for n, perm := range want.numbered() {
+				if got.numbered()[n] != perm {
+					t.Errorf("permutation %s is %q, want %q", n, got.numbered()[n], perm)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for id, gn := range cg.Nodes() {
+		if got, found := cg.ID(gn); !found || got != id || cg.Node(id) != gn || cg.Cyclic(id) {
+			t.Fatalf("node %v has id %d, %v", gn, got, found)
+		}
+		for _, out := range cg.Out(id) {
+			if !containsInt(cg.In(out), id) {
+				t.Fatalf("edge from %v to %v missing from In", gn, cg.Node(out))
+			}
+		}
+	}
+	if len(cg.Out(0)) != 2 || cg.Callback(3) != start[0].Out[1].Callback {
+		t.Fatalf("node 0 has edges to %v", cg.Out(0))
+	}
+	if _, found := cg.ID(NewGraphNode("E1")); found {
+		t.Fatal("foreign node has an id")
+	}
+}
+
+func TestGraphNodeID(t *testing.T) {
+	start := egraph()
+	if _, found := start[0].ID(); found {
+		t.Fatal("uncompiled node has an id")
+	}
+	gen := NewGraphPermutation(start...)
+	gen.Generate(nil)
+	cg := Compile(start...)
+	for _, gn := range cg.Nodes() {
+		id, found := gn.ID()
+		if want, _ := cg.ID(gn); !found || id != want {
+			t.Fatalf("node %v has id %d, %v, want %d", gn, id, found, want)
+		}
+	}
+
+	// A node keeps the id of the first graph compiled.
+	e3 := start[0].Out[0]
+	if id, _ := Compile(e3).ID(e3); id != 0 {
+		t.Fatalf("E3 has id %d in its own graph", id)
+	}
+	if id, _ := e3.ID(); id != 2 {
+		t.Fatalf("E3 has id %d, want 2", id)
+	}
+}
@@ -0,0 +1,345 @@
+package gsim
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// The functions in this file compose whole graphs, each given by its
+// starting nodes, into one. Unlike the combinators of OptionGenerators
+// (Interleave, Sequence and so on), the result is an ordinary graph,
+// which can be drawn, validated, fingerprinted and passed to
+// NewGraphPermutation like any other. The graphs are composed in
+// place: their nodes are reused, and edges and callbacks are added to
+// them, so the arguments should not be used on their own afterwards.
+
+// DisjointUnion returns the starting nodes of a graph in which the
+// given graphs run side by side, independently of one another. It is
+// an error if any node is reachable from more than one of the graphs.
+func DisjointUnion(graphs ...[]*GraphNode) ([]*GraphNode, error) {
+	owner := make(map[*GraphNode]int)
+	var start []*GraphNode
+	for idx, g := range graphs {
+		for _, gn := range reachableGraphNodes(g...) {
+			if other, found := owner[gn]; found {
+				return nil, fmt.Errorf("node %v is in graphs %d and %d", gn, other, idx)
+			}
+			owner[gn] = idx
+		}
+		start = append(start, g...)
+	}
+	return start, nil
+}
+
+// SequentialCompose returns the starting nodes of a graph in which g2
+// follows g1: an edge is added from every sink of g1 (every node with
+// no outgoing edges) to every starting node of g2, and each starting
+// node of g2 becomes available only once every sink of g1 has been
+// reached. Any inhibitors of the starting nodes of g2 still apply. If
+// a sink of g1 may be inhibited, g2 will then never start, so such
+// graphs should end in a single node which is always reached. It is an
+// error if g1 has no sinks, or if any node is reachable from both g1
+// and g2.
+func SequentialCompose(g1, g2 []*GraphNode) ([]*GraphNode, error) {
+	if _, err := DisjointUnion(g1, g2); err != nil {
+		return nil, err
+	}
+	var sinks []*GraphNode
+	for _, gn := range reachableGraphNodes(g1...) {
+		if len(gn.Out) == 0 {
+			sinks = append(sinks, gn)
+		}
+	}
+	if len(sinks) == 0 {
+		return nil, errors.New("first graph has no sinks")
+	}
+	for _, source := range g2 {
+		for _, sink := range sinks {
+			sink.AddEdgeTo(source)
+		}
+		source.Callback = &sequentialCallback{sinks: sinks, callback: source.Callback}
+	}
+	return g1, nil
+}
+
+// sequentialCallback is the callback of a starting node of the second
+// graph passed to SequentialCompose.
+type sequentialCallback struct {
+	sinks    []*GraphNode
+	callback GraphNodeCallback
+}
+
+func (sc *sequentialCallback) IncomingEdgesReached(node *GraphNode, reached []*GraphNode) GraphNodeStateChange {
+	others := make([]*GraphNode, 0, len(reached))
+	sinks := 0
+	for _, gn := range reached {
+		if containsGraphNode(sc.sinks, gn) {
+			sinks++
+		} else {
+			others = append(others, gn)
+		}
+	}
+	// The original callback only ever saw inhibitors.
+	if len(others) != 0 && sc.callback.IncomingEdgesReached(node, others) == Inhibit {
+		return Inhibit
+	}
+	if sinks == len(sc.sinks) {
+		return MakeAvailable
+	}
+	return NoChange
+}
+
+// SynchronousProduct returns the starting nodes of a graph in which g1
+// and g2 run side by side but synchronise on their shared labels: a
+// node of g2 whose Value equals (with ==) the Value of a node of g1 is
+// merged into that node, which then becomes available only once it
+// would have become available in both graphs, and is inhibited if it
+// would have been inhibited in either. Nodes with labels which are not
+// shared interleave freely, as with DisjointUnion.
+//
+// The edges of a merged node of g2 are moved to the node of g1, and
+// the callbacks of the nodes of g2 which follow it are wrapped so that
+// they still see the node of g2 as reached. Other settings of the
+// merged nodes of g2 (SetMaxVisits, guards, delays, atomic blocks and
+// so on) cannot be merged, so they are errors. It is also an error if
+// a label is not comparable, if a shared label belongs to more than
+// one node of either graph, or if any node is reachable from both g1
+// and g2.
+func SynchronousProduct(g1, g2 []*GraphNode) ([]*GraphNode, error) {
+	if _, err := DisjointUnion(g1, g2); err != nil {
+		return nil, err
+	}
+	nodes1 := reachableGraphNodes(g1...)
+	nodes2 := reachableGraphNodes(g2...)
+	byLabel, err := nodesByLabel(nodes1)
+	if err != nil {
+		return nil, err
+	}
+	labels2, err := nodesByLabel(nodes2)
+	if err != nil {
+		return nil, err
+	}
+	// merged maps each shared node of g2 to its node of g1, and
+	// unmerged is the inverse.
+	merged := make(map[*GraphNode]*GraphNode)
+	unmerged := make(map[*GraphNode]*GraphNode)
+	for _, gn2 := range nodes2 {
+		if gn1, found := byLabel[gn2.Value]; found {
+			if len(labels2[gn2.Value]) > 1 || len(byLabel[gn2.Value]) > 1 {
+				return nil, fmt.Errorf("label %v is shared by more than one node", gn2.Value)
+			}
+			merged[gn2] = gn1[0]
+			unmerged[gn1[0]] = gn2
+		}
+	}
+	for _, gn := range nodes2 {
+		if err := checkMergeable(gn, merged); err != nil {
+			return nil, err
+		}
+	}
+
+	isStart1 := make(map[*GraphNode]bool, len(g1))
+	for _, gn := range g1 {
+		isStart1[gn] = true
+	}
+	isStart2 := make(map[*GraphNode]bool, len(g2))
+	for _, gn := range g2 {
+		isStart2[gn] = true
+	}
+
+	// Wrap the callbacks before any edges move.
+	for _, gn2 := range nodes2 {
+		if gn1, found := merged[gn2]; found {
+			gn1.Callback = &synchronousCallback{
+				node1:     gn1,
+				node2:     gn2,
+				in1:       append([]*GraphNode(nil), gn1.In...),
+				in2:       append([]*GraphNode(nil), gn2.In...),
+				start1:    isStart1[gn1],
+				start2:    isStart2[gn2],
+				callback1: gn1.Callback,
+				callback2: gn2.Callback,
+				unmerged:  unmerged,
+			}
+			continue
+		}
+		for _, in := range gn2.In {
+			if _, found := merged[in]; found {
+				gn2.Callback = &unmergingCallback{callback: gn2.Callback, unmerged: unmerged}
+				break
+			}
+		}
+	}
+
+	// Move the edges of the merged nodes of g2.
+	canonical := func(gn *GraphNode) *GraphNode {
+		if gn1, found := merged[gn]; found {
+			return gn1
+		}
+		return gn
+	}
+	for _, gn2 := range nodes2 {
+		gn1, found := merged[gn2]
+		if !found {
+			continue
+		}
+		for _, in := range gn2.In {
+			in.Out = removeGraphNode(in.Out, gn2)
+			canonical(in).AddEdgeTo(gn1)
+		}
+		for _, out := range gn2.Out {
+			out.In = removeGraphNode(out.In, gn2)
+			gn1.AddEdgeTo(canonical(out))
+		}
+		gn2.In = []*GraphNode{}
+		gn2.Out = []*GraphNode{}
+	}
+
+	var start []*GraphNode
+	for _, gn := range g1 {
+		if gn2, found := unmerged[gn]; !found || isStart2[gn2] {
+			start = append(start, gn)
+		}
+	}
+	for _, gn := range g2 {
+		if _, found := merged[gn]; !found {
+			start = append(start, gn)
+		}
+	}
+	return start, nil
+}
+
+// nodesByLabel indexes nodes by their values, which must be
+// comparable.
+func nodesByLabel(nodes []*GraphNode) (map[interface{}][]*GraphNode, error) {
+	byLabel := make(map[interface{}][]*GraphNode, len(nodes))
+	for _, gn := range nodes {
+		if gn.Value == nil || !reflect.TypeOf(gn.Value).Comparable() {
+			return nil, fmt.Errorf("label of node %v is not comparable", gn)
+		}
+		byLabel[gn.Value] = append(byLabel[gn.Value], gn)
+	}
+	return byLabel, nil
+}
+
+// checkMergeable returns an error if gn, a node of the second graph
+// passed to SynchronousProduct, is merged or refers to a merged node
+// in any way other than by a plain edge.
+func checkMergeable(gn *GraphNode, merged map[*GraphNode]*GraphNode) error {
+	if _, found := merged[gn]; found {
+		if gn.maxVisits != 0 || gn.hasDeadline || gn.atomic != nil || gn.section != nil || gn.acquires != nil || gn.releases != nil || gn.onVisit != nil ||
+			gn.symmetryPred != nil || len(gn.kills) != 0 || len(gn.outGuards) != 0 || len(gn.inDelays) != 0 {
+			return fmt.Errorf("shared node %v has settings which cannot be merged", gn)
+		}
+	}
+	refersTo := func(gn2 *GraphNode) bool {
+		_, found := merged[gn2]
+		return found
+	}
+	if gn.symmetryPred != nil && refersTo(gn.symmetryPred) {
+		return fmt.Errorf("node %v is symmetric with a shared node", gn)
+	}
+	for _, killed := range gn.kills {
+		if refersTo(killed) {
+			return fmt.Errorf("node %v kills shared node %v", gn, killed)
+		}
+	}
+	for out := range gn.outGuards {
+		if refersTo(out) {
+			return fmt.Errorf("node %v has a guarded edge to shared node %v", gn, out)
+		}
+	}
+	for in := range gn.inDelays {
+		if refersTo(in) {
+			return fmt.Errorf("node %v has a timed edge from shared node %v", gn, in)
+		}
+	}
+	return nil
+}
+
+func removeGraphNode(gns []*GraphNode, gn *GraphNode) []*GraphNode {
+	for idx, elem := range gns {
+		if elem == gn {
+			return append(gns[:idx:idx], gns[idx+1:]...)
+		}
+	}
+	return gns
+}
+
+// unmergingCallback wraps the callback of a node of the second graph
+// passed to SynchronousProduct which follows a merged node, such that
+// it sees the node of the second graph reached instead of the node of
+// the first.
+type unmergingCallback struct {
+	callback GraphNodeCallback
+	unmerged map[*GraphNode]*GraphNode
+}
+
+func (uc *unmergingCallback) IncomingEdgesReached(node *GraphNode, reached []*GraphNode) GraphNodeStateChange {
+	return uc.callback.IncomingEdgesReached(node, unmergeReached(reached, uc.unmerged, nil))
+}
+
+// unmergeReached replaces each merged node in reached with its node
+// of the second graph, keeping only the nodes in in, if in is
+// non-nil.
+func unmergeReached(reached []*GraphNode, unmerged map[*GraphNode]*GraphNode, in []*GraphNode) []*GraphNode {
+	result := make([]*GraphNode, 0, len(reached))
+	for _, gn := range reached {
+		if gn2, found := unmerged[gn]; found {
+			gn = gn2
+		}
+		if in == nil || containsGraphNode(in, gn) {
+			result = append(result, gn)
+		}
+	}
+	return result
+}
+
+// synchronousCallback is the callback of a merged node of
+// SynchronousProduct. It consults the callback of each of the two
+// original nodes with those of their original incoming edges which
+// have been reached.
+type synchronousCallback struct {
+	node1, node2         *GraphNode
+	in1, in2             []*GraphNode
+	start1, start2       bool
+	callback1, callback2 GraphNodeCallback
+	unmerged             map[*GraphNode]*GraphNode
+}
+
+func (sc *synchronousCallback) IncomingEdgesReached(node *GraphNode, reached []*GraphNode) GraphNodeStateChange {
+	reached1 := make([]*GraphNode, 0, len(reached))
+	for _, gn := range reached {
+		if containsGraphNode(sc.in1, gn) {
+			reached1 = append(reached1, gn)
+		}
+	}
+	reached2 := unmergeReached(reached, sc.unmerged, sc.in2)
+	inhibited1, available1 := synchronousSide(sc.callback1, sc.node1, reached1, sc.start1)
+	inhibited2, available2 := synchronousSide(sc.callback2, sc.node2, reached2, sc.start2)
+	switch {
+	case inhibited1 || inhibited2:
+		return Inhibit
+	case available1 && available2:
+		return MakeAvailable
+	default:
+		return NoChange
+	}
+}
+
+// synchronousSide reports what would have become of a node in its
+// original graph, given the incoming edges reached.
+func synchronousSide(callback GraphNodeCallback, node *GraphNode, reached []*GraphNode, start bool) (inhibited, available bool) {
+	if len(reached) == 0 {
+		return false, start
+	}
+	switch callback.IncomingEdgesReached(node, reached) {
+	case Inhibit:
+		return true, false
+	case MakeAvailable:
+		return false, true
+	default:
+		return false, start
+	}
+}
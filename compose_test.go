@@ -0,0 +1,64 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestDisjointUnion(t *testing.T) {
+	a, b := nodes("a1", "a2"), nodes("b1")
+	a[0].AddEdgeTo(a[1])
+	start, err := DisjointUnion(a[:1], b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPerms(t, collectSorted(BuildPermutations(NewGraphPermutation(start...))), []string{
+		"a1 a2 b1",
+		"a1 b1 a2",
+		"b1 a1 a2",
+	})
+	if _, err := DisjointUnion(a[:1], a[1:]); err == nil {
+		t.Fatal("overlapping graphs accepted")
+	}
+}
+
+func TestSequentialCompose(t *testing.T) {
+	g1, g2 := nodes("a1", "a2", "b1"), nodes("c1", "c2")
+	g1[0].AddEdgeTo(g1[1])
+	start, err := SequentialCompose([]*GraphNode{g1[0], g1[2]}, g2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPerms(t, collectSorted(BuildPermutations(NewGraphPermutation(start...))), []string{
+		"a1 a2 b1 c1 c2",
+		"a1 a2 b1 c2 c1",
+		"a1 b1 a2 c1 c2",
+		"a1 b1 a2 c2 c1",
+		"b1 a1 a2 c1 c2",
+		"b1 a1 a2 c2 c1",
+	})
+	if _, err := SequentialCompose(g1[:1], g1[1:2]); err == nil {
+		t.Fatal("overlapping graphs accepted")
+	}
+}
+
+func TestSynchronousProduct(t *testing.T) {
+	g1, g2 := nodes("x", "sync", "after"), nodes("y", "sync")
+	g1[0].AddEdgeTo(g1[1])
+	g1[1].AddEdgeTo(g1[2])
+	g2[0].AddEdgeTo(g2[1])
+	start, err := SynchronousProduct(g1[:1], g2[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPerms(t, collectSorted(BuildPermutations(NewGraphPermutation(start...))), []string{
+		"x y sync after",
+		"y x sync after",
+	})
+
+	// A shared label must belong to one node of each graph.
+	g1, g2 = nodes("sync", "sync"), nodes("sync")
+	g1[0].AddEdgeTo(g1[1])
+	if _, err := SynchronousProduct(g1[:1], g2); err == nil {
+		t.Fatal("duplicated label accepted")
+	}
+}
@@ -0,0 +1,138 @@
+package gsim
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Condition is a boolean expression over the incoming edges of a
+// node which have been reached, built with After, And, Or and Not.
+// A Condition is itself a GraphNodeCallback, which makes the node
+// available once the condition holds and otherwise makes no change,
+// so for example:
+//
+//	d.Callback = gsim.And(gsim.After(b), gsim.Or(gsim.After(c), gsim.Not(gsim.After(e))))
+//
+// is more readable than the equivalent CombinationCallback. To
+// inhibit nodes as well, see InhibitWhen.
+type Condition struct {
+	holds func(reached []*GraphNode) bool
+	desc  string
+}
+
+// After returns a Condition which holds once every one of the given
+// nodes has been reached along an edge to the node.
+func After(nodes ...*GraphNode) *Condition {
+	descs := make([]string, len(nodes))
+	for idx, gn := range nodes {
+		descs[idx] = fmt.Sprint(gn.Value)
+	}
+	return &Condition{
+		holds: func(reached []*GraphNode) bool {
+			for _, gn := range nodes {
+				if !containsGraphNode(reached, gn) {
+					return false
+				}
+			}
+			return true
+		},
+		desc: fmt.Sprintf("After(%s)", strings.Join(descs, ", ")),
+	}
+}
+
+// And returns a Condition which holds when all of the given
+// conditions hold. With no conditions, it always holds.
+func And(conds ...*Condition) *Condition {
+	return &Condition{
+		holds: func(reached []*GraphNode) bool {
+			for _, cond := range conds {
+				if !cond.holds(reached) {
+					return false
+				}
+			}
+			return true
+		},
+		desc: describeConditions("And", conds),
+	}
+}
+
+// Or returns a Condition which holds when any of the given conditions
+// holds. With no conditions, it never holds.
+func Or(conds ...*Condition) *Condition {
+	return &Condition{
+		holds: func(reached []*GraphNode) bool {
+			for _, cond := range conds {
+				if cond.holds(reached) {
+					return true
+				}
+			}
+			return false
+		},
+		desc: describeConditions("Or", conds),
+	}
+}
+
+// Not returns a Condition which holds when cond does not.
+func Not(cond *Condition) *Condition {
+	return &Condition{
+		holds: func(reached []*GraphNode) bool { return !cond.holds(reached) },
+		desc:  describeConditions("Not", []*Condition{cond}),
+	}
+}
+
+func describeConditions(op string, conds []*Condition) string {
+	descs := make([]string, len(conds))
+	for idx, cond := range conds {
+		descs[idx] = cond.desc
+	}
+	return fmt.Sprintf("%s(%s)", op, strings.Join(descs, ", "))
+}
+
+// Holds reports whether the condition holds, given the incoming edges
+// reached.
+func (c *Condition) Holds(reached []*GraphNode) bool {
+	return c.holds(reached)
+}
+
+// IncomingEdgesReached returns MakeAvailable if the condition holds,
+// and NoChange otherwise.
+func (c *Condition) IncomingEdgesReached(node *GraphNode, reached []*GraphNode) GraphNodeStateChange {
+	if c.holds(reached) {
+		return MakeAvailable
+	}
+	return NoChange
+}
+
+func (c *Condition) String() string {
+	return c.desc
+}
+
+type conditionCallback struct {
+	inhibit, available *Condition
+}
+
+// InhibitWhen returns a GraphNodeCallback which inhibits the node once
+// inhibit holds, and otherwise makes the node available once available
+// holds. available may be nil, in which case the callback never makes
+// the node available.
+func InhibitWhen(inhibit, available *Condition) GraphNodeCallback {
+	return &conditionCallback{inhibit: inhibit, available: available}
+}
+
+func (cc *conditionCallback) IncomingEdgesReached(node *GraphNode, reached []*GraphNode) GraphNodeStateChange {
+	switch {
+	case cc.inhibit.holds(reached):
+		return Inhibit
+	case cc.available != nil && cc.available.holds(reached):
+		return MakeAvailable
+	default:
+		return NoChange
+	}
+}
+
+func (cc *conditionCallback) String() string {
+	if cc.available == nil {
+		return fmt.Sprintf("InhibitWhen(%v)", cc.inhibit)
+	}
+	return fmt.Sprintf("InhibitWhen(%v, %v)", cc.inhibit, cc.available)
+}
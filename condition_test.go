@@ -0,0 +1,41 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestConditionHolds(t *testing.T) {
+	g := nodes("a", "b", "c")
+	a, b, c := g[0], g[1], g[2]
+	cond := And(After(a), Or(After(b), Not(After(c))))
+	for _, tc := range []struct {
+		reached []*GraphNode
+		want    bool
+	}{
+		{nil, false},
+		{[]*GraphNode{a}, true},
+		{[]*GraphNode{a, c}, false},
+		{[]*GraphNode{a, b, c}, true},
+		{[]*GraphNode{b, c}, false},
+	} {
+		if got := cond.Holds(tc.reached); got != tc.want {
+			t.Errorf("%v holds for %v: %v, want %v", cond, tc.reached, got, tc.want)
+		}
+	}
+	if And().Holds(nil) != true || Or().Holds(nil) != false {
+		t.Fatal("empty And or Or")
+	}
+}
+
+func TestInhibitWhen(t *testing.T) {
+	g := nodes("a", "c", "d")
+	a, c, d := g[0], g[1], g[2]
+	a.AddEdgeTo(d)
+	c.AddEdgeTo(d)
+	d.Callback = InhibitWhen(After(c), After(a))
+	checkPerms(t, collectSorted(BuildPermutations(NewGraphPermutation(a, c))), []string{
+		"a c",
+		"a d c",
+		"c a",
+	})
+}
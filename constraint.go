@@ -0,0 +1,123 @@
+package gsim
+
+import (
+	"fmt"
+)
+
+// A TypedConstraint restricts the permutations generated, without
+// modifying the OptionGenerator: see WithConstraint. Constraints are
+// built with TypedBefore, TypedNotBoth and TypedNever, or their
+// interface{} equivalents Before, NotBoth and Never. Elements are
+// compared with ==, so they must be comparable.
+type TypedConstraint[T any] struct {
+	// allows reports whether a prefix, every shorter prefix of which
+	// is allowed, is allowed.
+	allows func(prefix []T) bool
+	desc   string
+}
+
+// Constraint is the interface{} instantiation of TypedConstraint.
+type Constraint = TypedConstraint[interface{}]
+
+func (c *TypedConstraint[T]) String() string {
+	return c.desc
+}
+
+// TypedBefore returns a constraint which only allows b to appear once
+// a has appeared. Permutations in which b appears without a are thus
+// excluded too.
+func TypedBefore[T any](a, b T) *TypedConstraint[T] {
+	return &TypedConstraint[T]{
+		allows: func(prefix []T) bool {
+			return !equalElements(prefix[len(prefix)-1], b) || containsElement(prefix[:len(prefix)-1], a)
+		},
+		desc: fmt.Sprintf("Before(%v, %v)", stringifyElement(a), stringifyElement(b)),
+	}
+}
+
+// Before is the interface{} instantiation of TypedBefore. For
+// example, to consider only the schedules in which a crash happens
+// before a commit:
+//
+//	p = p.WithConstraint(gsim.Before(crash, commit))
+func Before(a, b interface{}) *Constraint {
+	return TypedBefore(a, b)
+}
+
+// TypedNotBoth returns a constraint which excludes every permutation
+// in which both a and b appear.
+func TypedNotBoth[T any](a, b T) *TypedConstraint[T] {
+	return &TypedConstraint[T]{
+		allows: func(prefix []T) bool {
+			last, rest := prefix[len(prefix)-1], prefix[:len(prefix)-1]
+			return !(equalElements(last, a) && containsElement(rest, b)) && !(equalElements(last, b) && containsElement(rest, a))
+		},
+		desc: fmt.Sprintf("NotBoth(%v, %v)", stringifyElement(a), stringifyElement(b)),
+	}
+}
+
+// NotBoth is the interface{} instantiation of TypedNotBoth.
+func NotBoth(a, b interface{}) *Constraint {
+	return TypedNotBoth(a, b)
+}
+
+// TypedNever returns a constraint which excludes every permutation in
+// which a appears.
+func TypedNever[T any](a T) *TypedConstraint[T] {
+	return &TypedConstraint[T]{
+		allows: func(prefix []T) bool { return !equalElements(prefix[len(prefix)-1], a) },
+		desc:   fmt.Sprintf("Never(%v)", stringifyElement(a)),
+	}
+}
+
+// Never is the interface{} instantiation of TypedNever.
+func Never(a interface{}) *Constraint {
+	return TypedNever(a)
+}
+
+// WithConstraint returns a copy of the receiver which only generates
+// the permutations allowed by every one of the given constraints, in
+// addition to those of the receiver. As with WithPrune, each
+// constraint is checked as each prefix is generated, so excluded
+// subtrees are never explored; Count and Sample respect the
+// constraints, and permutation numbers are unaffected by them. This
+// allows the permutation space to be sliced for a targeted
+// investigation without modifying the graph.
+func (p *TypedPermutations[T]) WithConstraint(constraints ...*TypedConstraint[T]) *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) {
+		p2.constraints = append(append([]*TypedConstraint[T](nil), p.constraints...), constraints...)
+	})
+}
+
+// allowed reports whether the prefix is allowed by the constraints of
+// p.
+func (p *TypedPermutations[T]) allowed(prefix []T) bool {
+	if len(prefix) == 0 {
+		return true
+	}
+	for _, c := range p.constraints {
+		if !c.allows(prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// prefixDependent reports whether generation depends on the whole
+// prefix rather than just the state of the OptionGenerator.
+func (p *TypedPermutations[T]) prefixDependent() bool {
+	return p.prune != nil || len(p.constraints) != 0
+}
+
+func equalElements[T any](a, b T) bool {
+	return interface{}(a) == interface{}(b)
+}
+
+func containsElement[T any](elems []T, elem T) bool {
+	for _, e := range elems {
+		if equalElements(e, elem) {
+			return true
+		}
+	}
+	return false
+}
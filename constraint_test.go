@@ -0,0 +1,44 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestWithConstraint(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3}))
+	all := newCollector()
+	p.ForEach(all)
+	for _, tc := range []struct {
+		constraints []*Constraint
+		want        []string
+	}{
+		{[]*Constraint{Before(3, 1)}, []string{"2 3 1", "3 1 2", "3 2 1"}},
+		{[]*Constraint{Before(3, 1), Before(2, 3)}, []string{"2 3 1"}},
+		{[]*Constraint{Never(2)}, nil},
+	} {
+		constrained := p.WithConstraint(tc.constraints...)
+		got := newCollector()
+		constrained.ForEach(got)
+		checkPerms(t, got.sorted(), tc.want)
+		for n, perm := range got.numbered() {
+			if all.numbered()[n] != perm {
+				t.Fatalf("%v renumbered %q as %s", tc.constraints, perm, n)
+			}
+		}
+		if count := constrained.Count(); count.Int64() != int64(len(tc.want)) {
+			t.Fatalf("%v: Count is %v, want %d", tc.constraints, count, len(tc.want))
+		}
+	}
+
+	g := nodes("a", "b", "c")
+	g[0].AddEdgeTo(g[1])
+	gp := BuildPermutations(NewGraphPermutation(g[0], g[2]))
+	checkPerms(t, collectSorted(gp.WithConstraint(NotBoth(g[1], g[2]))), nil)
+	checkPerms(t, collectSorted(gp.WithConstraint(Before(g[2], g[1]))), []string{
+		"a c b",
+		"c a b",
+	})
+	if got := Before(1, 2).String() + " " + NotBoth(1, 2).String() + " " + Never(g[0]).String(); got != "Before(1, 2) NotBoth(1, 2) Never(a)" {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -0,0 +1,88 @@
+package gsim
+
+// DeclareCrash makes crash a crash node: when it is chosen, each of
+// the killed nodes which has not yet been chosen is inhibited, so it
+// can never be chosen, and an edge to recovery (if it is not nil)
+// makes the recovery sub-graph available in their place. Killed nodes
+// which are available at the time of the crash cease to be. This is
+// the basis of fault injection; see also Actor.CrashPoints.
+func DeclareCrash(crash, recovery *GraphNode, killed ...*GraphNode) {
+	if recovery != nil {
+		crash.AddEdgeTo(recovery)
+	}
+	crash.addKills(killed...)
+}
+
+func (gn *GraphNode) addKills(killed ...*GraphNode) {
+	for _, gn2 := range killed {
+		if !containsGraphNode(gn.kills, gn2) {
+			gn.kills = append(gn.kills, gn2)
+		}
+	}
+}
+
+// kill inhibits gn, removing it from the available nodes if
+// necessary.
+func (gp *graphPermutation) kill(gn *GraphNode) {
+	id := gp.id(gn, true)
+	nodeState, found := gp.stateAt(id, true)
+	if !found {
+		nodeState = &graphNodeState{
+			GraphNode:       gn,
+			id:              id,
+			permutation:     gp,
+			incomingVisited: []*GraphNode{},
+		}
+		gp.nodeState.set(gp, id, nodeState)
+	}
+	if nodeState.available {
+		nodeState.available = false
+		for idx, node := range gp.current {
+			if node == gn {
+				gp.current = append(gp.current[:idx], gp.current[idx+1:]...)
+				break
+			}
+		}
+	}
+	nodeState.inhibited = true
+	nodeState.blocked = false
+}
+
+// CrashPoint is the value of the crash nodes created by
+// Actor.CrashPoints: the actor crashes after its event with index
+// After.
+type CrashPoint struct {
+	Actor *Actor
+	After int
+}
+
+// CrashPoints inserts a crash point between every pair of consecutive
+// events of the actor, so that the actor may crash at any point,
+// after its first event. The crash point after event i becomes
+// available once event i has been chosen, and is killed by event i+1;
+// if it is chosen, it kills events i+1 onwards instead. For each
+// crash point, recovery is called with the index of the event it
+// follows and the crash node, and may return the entry node of a
+// recovery sub-graph, or nil. The crash nodes are returned in order;
+// their values are CrashPoints.
+//
+// Call CrashPoints once all the actor's events have been added. The
+// crash nodes do not belong to the actor.
+func (a *Actor) CrashPoints(recovery func(after int, crash *GraphNode) *GraphNode) []*GraphNode {
+	if len(a.events) < 2 {
+		return nil
+	}
+	crashes := make([]*GraphNode, len(a.events)-1)
+	for idx := range crashes {
+		crash := NewGraphNode(&CrashPoint{Actor: a, After: idx})
+		a.events[idx].AddEdgeTo(crash)
+		a.events[idx+1].addKills(crash)
+		var rec *GraphNode
+		if recovery != nil {
+			rec = recovery(idx, crash)
+		}
+		DeclareCrash(crash, rec, a.events[idx+1:]...)
+		crashes[idx] = crash
+	}
+	return crashes
+}
@@ -0,0 +1,54 @@
+package gsim
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"testing"
+)
+
+func TestDeclareCrash(t *testing.T) {
+	g := nodes("a", "b", "crash", "recover")
+	g[0].AddEdgeTo(g[1])
+	DeclareCrash(g[2], g[3], g[1])
+	checkPerms(t, collectSorted(BuildPermutations(NewGraphPermutation(g[0], g[2]))), []string{
+		"a b crash recover",
+		"a crash recover",
+		"crash a recover",
+		"crash recover a",
+	})
+}
+
+func TestCrashPoints(t *testing.T) {
+	m := NewActorModel()
+	a := m.Actor("a")
+	a.Step("e1")
+	a.Step("e2")
+	a.Step("e3")
+	crashes := a.CrashPoints(func(after int, crash *GraphNode) *GraphNode {
+		return NewGraphNode(fmt.Sprint("recover", after))
+	})
+	if len(crashes) != 2 {
+		t.Fatalf("got %d crash points", len(crashes))
+	}
+	var got []string
+	BuildPermutations(m.NewGraphPermutation()).ForEach(consumerFunc(func(n *big.Int, perm []interface{}) {
+		values := make([]interface{}, len(perm))
+		for idx, elem := range perm {
+			values[idx] = elem
+			if cp, ok := elem.(*GraphNode).Value.(*CrashPoint); ok {
+				if cp.Actor != a {
+					t.Fatalf("crash point of %v", cp.Actor)
+				}
+				values[idx] = fmt.Sprint("crash", cp.After)
+			}
+		}
+		got = append(got, permString(values))
+	}))
+	sort.Strings(got)
+	checkPerms(t, got, []string{
+		"e1 crash0 recover0",
+		"e1 e2 crash1 recover1",
+		"e1 e2 e3",
+	})
+}
@@ -0,0 +1,135 @@
+package gsim
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A GraphCycle is a path through a graph which returns to where it
+// started: each node has an edge to the next, and the last node has
+// an edge to the first. No node appears twice.
+type GraphCycle []*GraphNode
+
+func (gc GraphCycle) String() string {
+	if len(gc) == 0 {
+		return ""
+	}
+	values := make([]string, len(gc)+1)
+	for idx, gn := range gc {
+		values[idx] = fmt.Sprint(gn.Value)
+	}
+	values[len(gc)] = values[0]
+	return strings.Join(values, " -> ")
+}
+
+// FindCycles returns the cycles of the graph reachable from the given
+// starting nodes, each as the path of nodes around it. Graph
+// OptionGenerators never follow an edge back to a node which has
+// already been chosen (unless SetMaxVisits permits it), so the edges
+// which close these cycles are never used, and a node whose callback
+// waits for such an edge never appears in any permutation. Whereas
+// ValidateGraph reports only which nodes lie on cycles, FindCycles
+// lists every distinct cycle, which shows the edges responsible.
+//
+// Each cycle starts at its node which is reachable soonest from the
+// starting nodes, and the cycles are ordered by that node. A graph
+// can have exponentially many cycles, so if limit is positive, at
+// most limit cycles are returned.
+func FindCycles(limit int, start ...*GraphNode) []GraphCycle {
+	nodes := reachableGraphNodes(start...)
+	index := make(map[*GraphNode]int, len(nodes))
+	for idx, gn := range nodes {
+		index[gn] = idx
+	}
+	// A cycle never leaves its strongly connected component.
+	component := make([]int, len(nodes))
+	for idx := range component {
+		component[idx] = -1
+	}
+	for c, members := range graphCycles(nodes) {
+		for _, gn := range members {
+			component[index[gn]] = c
+		}
+	}
+
+	// Johnson's algorithm: find the cycles through each node in turn,
+	// ignoring the nodes before it, whose cycles have all been found.
+	var cycles []GraphCycle
+	blocked := make([]bool, len(nodes))
+	blockedBy := make([][]int, len(nodes))
+	var path []*GraphNode
+	full := func() bool { return limit > 0 && len(cycles) >= limit }
+
+	var unblock func(u int)
+	unblock = func(u int) {
+		blocked[u] = false
+		waiting := blockedBy[u]
+		blockedBy[u] = nil
+		for _, w := range waiting {
+			if blocked[w] {
+				unblock(w)
+			}
+		}
+	}
+	var circuit func(s, v int) bool
+	circuit = func(s, v int) bool {
+		found := false
+		path = append(path, nodes[v])
+		blocked[v] = true
+		for _, out := range nodes[v].Out {
+			if full() {
+				break
+			}
+			w := index[out]
+			if w < s || component[w] != component[s] {
+				continue
+			}
+			if w == s {
+				cycles = append(cycles, append(GraphCycle{}, path...))
+				found = true
+			} else if !blocked[w] && circuit(s, w) {
+				found = true
+			}
+		}
+		if found {
+			unblock(v)
+		} else {
+			for _, out := range nodes[v].Out {
+				if w := index[out]; !containsInt(blockedBy[w], v) {
+					blockedBy[w] = append(blockedBy[w], v)
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return found
+	}
+	for s := range nodes {
+		if full() {
+			break
+		}
+		if component[s] == -1 {
+			continue
+		}
+		for idx := s; idx < len(nodes); idx++ {
+			blocked[idx] = false
+			blockedBy[idx] = nil
+		}
+		circuit(s, s)
+	}
+	return cycles
+}
+
+func containsInt(ints []int, i int) bool {
+	for _, j := range ints {
+		if i == j {
+			return true
+		}
+	}
+	return false
+}
+
+// Cycles returns the cycles of the graph reachable from its starting
+// nodes, as FindCycles.
+func (g *Graph) Cycles(limit int) []GraphCycle {
+	return FindCycles(limit, g.StartNodes()...)
+}
@@ -0,0 +1,41 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestFindCycles(t *testing.T) {
+	g := nodes("a", "b", "c", "d")
+	a, b, c, d := g[0], g[1], g[2], g[3]
+	a.AddEdgeTo(b)
+	b.AddEdgeTo(c)
+	c.AddEdgeTo(b)
+	c.AddEdgeTo(d)
+	d.AddEdgeTo(a)
+	var got []string
+	for _, cycle := range FindCycles(0, a) {
+		got = append(got, cycle.String())
+	}
+	checkPerms(t, got, []string{
+		"a -> b -> c -> d -> a",
+		"b -> c -> b",
+	})
+	if cycles := FindCycles(1, a); len(cycles) != 1 {
+		t.Fatalf("limit of 1 gave %v", cycles)
+	}
+	if cycles := FindCycles(0, egraph()...); len(cycles) != 0 {
+		t.Fatalf("acyclic graph has cycles %v", cycles)
+	}
+
+	// Only cycles reachable from the starting nodes are found.
+	named := NewGraph()
+	named.AddNode("s", "s")
+	named.AddNode("x", "x")
+	named.AddNode("y", "y")
+	named.AddEdge("s", "x")
+	named.AddEdge("x", "y")
+	named.AddEdge("y", "x")
+	if cycles := named.Cycles(0); len(cycles) != 1 || cycles[0].String() != "x -> y -> x" {
+		t.Fatalf("got cycles %v", cycles)
+	}
+}
@@ -0,0 +1,158 @@
+package gsim
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// A TypedDeadlockDetector is a TypedOptionGenerator which can tell,
+// once Generate has returned no options, whether that is because
+// every option has been chosen or because some options can now never
+// become available. graphPermutation implements it.
+type TypedDeadlockDetector[T any] interface {
+	TypedOptionGenerator[T]
+	// Stuck is called after Generate has returned no options. It
+	// returns the options which have not been chosen and never can
+	// be, or nil if there are none.
+	Stuck() []T
+}
+
+// DeadlockDetector is the interface{} instantiation of
+// TypedDeadlockDetector.
+type DeadlockDetector = TypedDeadlockDetector[interface{}]
+
+// A TypedDeadlockConsumer is a TypedPermutationConsumer or
+// TypedPermutationChecker which wishes to be told about deadlocked
+// permutations under the DeadlockFlag policy.
+type TypedDeadlockConsumer[T any] interface {
+	// Deadlocked is called instead of Consume (or Check) with a
+	// permutation which ended because of deadlock, along with the
+	// options which were stuck. As with Consume, the arguments must
+	// not be retained or mutated.
+	Deadlocked(n *big.Int, perm []T, stuck []T)
+}
+
+// DeadlockConsumer is the interface{} instantiation of
+// TypedDeadlockConsumer.
+type DeadlockConsumer = TypedDeadlockConsumer[interface{}]
+
+// DeadlockPolicy determines what happens to permutations which end
+// because of deadlock: that is, Generate returned no options, but the
+// OptionGenerator is a TypedDeadlockDetector which reports some
+// options to be stuck.
+type DeadlockPolicy int
+
+const (
+	// DeadlockIgnore treats deadlocked permutations as any other:
+	// they are supplied to Consume (or Check). This is the default.
+	DeadlockIgnore DeadlockPolicy = iota
+	// DeadlockFlag supplies deadlocked permutations to Deadlocked if
+	// the consumer is a TypedDeadlockConsumer, and to Consume (or
+	// Check) otherwise.
+	DeadlockFlag
+	// DeadlockAbort stops iteration at the first deadlocked
+	// permutation, returning a *PermutationError whose Err is a
+	// *TypedDeadlockError.
+	DeadlockAbort
+)
+
+// TypedDeadlockError is the error with which iteration stops under
+// the DeadlockAbort policy. It is always wrapped in a
+// *PermutationError identifying the deadlocked permutation.
+type TypedDeadlockError[T any] struct {
+	// Stuck holds the options which can never be chosen.
+	Stuck []T
+}
+
+// DeadlockError is the interface{} instantiation of
+// TypedDeadlockError.
+type DeadlockError = TypedDeadlockError[interface{}]
+
+func (de *TypedDeadlockError[T]) Error() string {
+	return fmt.Sprintf("deadlock: %v options can never be chosen: %v", len(de.Stuck), de.Stuck)
+}
+
+// WithDeadlockPolicy returns a copy of the receiver which deals with
+// deadlocked permutations according to policy. This affects every
+// iteration function, but not Count, Permutation and the like.
+func (p *TypedPermutations[T]) WithDeadlockPolicy(policy DeadlockPolicy) *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) { p2.deadlockPolicy = policy })
+}
+
+// deadlocked applies the deadlock policy, and then the milestone
+// policy, to the permutation perm, whose generator has just returned
+// no options. It reports whether the permutation has been dealt with,
+// in which case f.Check must not be called, along with any error with
+// which iteration must stop.
+func (p *TypedPermutations[T]) deadlocked(f TypedPermutationChecker[T], gen TypedOptionGenerator[T], n *big.Int, perm []T) (bool, error) {
+	if p.deadlockPolicy == DeadlockIgnore && p.milestonePolicy == MilestoneIgnore {
+		return false, nil
+	}
+	return p.handleIncomplete(f, p.stuck(gen), p.missed(gen), n, perm)
+}
+
+// handleIncomplete is deadlocked for a permutation whose stuck and
+// missed options are already known.
+func (p *TypedPermutations[T]) handleIncomplete(f TypedPermutationChecker[T], stuck, missed []T, n *big.Int, perm []T) (bool, error) {
+	if handled, err := p.handleStuck(f, stuck, n, perm); handled || err != nil {
+		return handled, err
+	}
+	return p.handleMissed(f, missed, n, perm)
+}
+
+// stuck returns the stuck options of gen, if it is a
+// TypedDeadlockDetector and deadlocks are not ignored.
+func (p *TypedPermutations[T]) stuck(gen TypedOptionGenerator[T]) []T {
+	if p.deadlockPolicy == DeadlockIgnore {
+		return nil
+	}
+	if detector, ok := gen.(TypedDeadlockDetector[T]); ok {
+		return detector.Stuck()
+	}
+	return nil
+}
+
+// handleStuck is deadlocked for a permutation whose stuck options are
+// already known.
+func (p *TypedPermutations[T]) handleStuck(f TypedPermutationChecker[T], stuck []T, n *big.Int, perm []T) (bool, error) {
+	if len(stuck) == 0 {
+		return false, nil
+	}
+	if p.deadlockPolicy == DeadlockAbort {
+		return true, &TypedDeadlockError[T]{Stuck: stuck}
+	}
+	if ppc, ok := f.(*parPermutationConsumer[T]); ok {
+		return true, ppc.add(n, perm, stuck, nil)
+	}
+	if dc, ok := deadlockConsumer(f); ok {
+		dc.Deadlocked(n, perm, stuck)
+		return true, nil
+	}
+	return false, nil
+}
+
+// deadlockConsumer finds the TypedDeadlockConsumer behind f, if there
+// is one.
+func deadlockConsumer[T any](f TypedPermutationChecker[T]) (TypedDeadlockConsumer[T], bool) {
+	if cc, ok := f.(consumerChecker[T]); ok {
+		dc, ok := cc.TypedPermutationConsumer.(TypedDeadlockConsumer[T])
+		return dc, ok
+	}
+	dc, ok := f.(TypedDeadlockConsumer[T])
+	return dc, ok
+}
+
+// Stuck returns every node which has been reached along at least one
+// incoming edge, or is a starting node, but which has been neither
+// chosen nor permanently inhibited: nodes awaiting release by a
+// ReleasingCallback are stuck. Nodes which may be visited several
+// times are not stuck once they have been visited at least once.
+func (gp *graphPermutation) Stuck() []interface{} {
+	var stuck []interface{}
+	for id, gn := range gp.allNodes() {
+		if gns, found := gp.stateAt(id, false); found && (!gns.inhibited || gns.blocked) && gns.visits == 0 {
+			stuck = append(stuck, gn)
+		}
+	}
+	return stuck
+}
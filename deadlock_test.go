@@ -0,0 +1,64 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// deadlockCollector records deadlocked permutations separately from
+// the others.
+type deadlockCollector struct {
+	*collector
+	deadlocked []string
+	stuck      []string
+}
+
+func (dc *deadlockCollector) Deadlocked(n *big.Int, perm []interface{}, stuck []interface{}) {
+	dc.deadlocked = append(dc.deadlocked, permString(perm))
+	dc.stuck = append(dc.stuck, permString(stuck))
+}
+
+// joinOrInhibit builds a graph in which x requires both a and b, but
+// c, if it comes first, inhibits b.
+func joinOrInhibit() []*GraphNode {
+	g := nodes("a", "b", "c", "x")
+	a, b, c, x := g[0], g[1], g[2], g[3]
+	a.AddEdgeTo(x)
+	b.AddEdgeTo(x)
+	x.Callback = NewAvailableAllCallback(a, b)
+	c.AddEdgeTo(b)
+	b.Callback = InhibitAnyCallback
+	return g[:3]
+}
+
+func TestDeadlockPolicies(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(joinOrInhibit()...))
+	all := collectSorted(p)
+
+	dc := &deadlockCollector{collector: newCollector()}
+	p.WithDeadlockPolicy(DeadlockFlag).ForEach(dc)
+	if len(dc.deadlocked) == 0 || len(dc.deadlocked)+len(*dc.perms) != len(all) {
+		t.Fatalf("%d deadlocked and %d other permutations, of %d", len(dc.deadlocked), len(*dc.perms), len(all))
+	}
+	for idx, perm := range dc.deadlocked {
+		if strings.Contains(perm, "b") || dc.stuck[idx] != "x" {
+			t.Fatalf("%q deadlocked with %q stuck", perm, dc.stuck[idx])
+		}
+	}
+	for _, perm := range *dc.perms {
+		if strings.HasPrefix(perm, "c") {
+			t.Fatalf("%q was not flagged", perm)
+		}
+	}
+
+	// Consumers which are not DeadlockConsumers see every permutation.
+	checkPerms(t, collectSorted(p.WithDeadlockPolicy(DeadlockFlag)), all)
+
+	err := p.WithDeadlockPolicy(DeadlockAbort).ForEachCheck(checkerFunc(func(*big.Int, []interface{}) error { return nil }))
+	var de *DeadlockError
+	if !errors.As(err, &de) || permString(de.Stuck) != "x" {
+		t.Fatalf("got %v, want x stuck", err)
+	}
+}
@@ -0,0 +1,164 @@
+package gsim
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"sort"
+)
+
+// A StateHasher is an OptionGenerator (of any type) which can hash
+// its current state. Two generators with equal hashes must generate
+// the same set of permutations from then on (though not necessarily
+// in the same order). graphPermutation implements StateHasher.
+type StateHasher interface {
+	StateHash() uint64
+}
+
+// A TypedDuplicateFunc is called when state deduplication skips a
+// prefix. n is the number of the prefix skipped, and original is the
+// number of the prefix which reached the same state first, and whose
+// continuations have been (or are being) explored.
+type TypedDuplicateFunc[T any] func(prefix []T, n, original *big.Int)
+
+// DuplicateFunc is the interface{} instantiation of
+// TypedDuplicateFunc.
+type DuplicateFunc = TypedDuplicateFunc[interface{}]
+
+// WithStateDeduplication returns a copy of the receiver which, during
+// iteration with ForEach, ForEachPar and their variants, explores the
+// continuations of each distinct generator state only once. After
+// each prefix is generated, if the OptionGenerator implements
+// StateHasher, its hash is looked up: if an earlier prefix reached the
+// same state, the prefix and all its continuations are skipped, and
+// onDuplicate (if not nil) is called instead. The number of times
+// onDuplicate is called for a given original is the multiplicity of
+// that state, less one.
+//
+// Because the continuations of an explored state are identical for
+// all prefixes reaching that state, this turns many exponential
+// explorations into polynomial ones, at the cost of remembering every
+// state seen. Hash collisions, though unlikely, will cause
+// continuations to be wrongly skipped. Count, Sample and the like
+// are not affected by deduplication. ForEachParGen does not support
+// deduplication, and returns ErrParGenUnsupported.
+func (p *TypedPermutations[T]) WithStateDeduplication(onDuplicate TypedDuplicateFunc[T]) *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) {
+		p2.dedup = true
+		p2.onDuplicate = onDuplicate
+	})
+}
+
+// tracksStates reports whether walks must call stateSeen: that is,
+// whether deduplication or bitstate hashing is on.
+func (p *TypedPermutations[T]) tracksStates() bool {
+	return p.dedup || p.bitstate != nil
+}
+
+// stateSeen is used by walk to record the states seen, in seen if
+// deduplication is on, and in the Bitstate if bitstate hashing is on.
+// It reports whether the state of gen has been seen before.
+func (p *TypedPermutations[T]) stateSeen(seen map[uint64]*big.Int, gen TypedOptionGenerator[T], prefix []T, n *big.Int) bool {
+	hasher, ok := gen.(StateHasher)
+	if !ok {
+		return false
+	}
+	hash := hasher.StateHash()
+	if seen != nil {
+		if original, found := seen[hash]; found {
+			if p.onDuplicate != nil {
+				p.onDuplicate(prefix, n, original)
+			}
+			return true
+		}
+		seen[hash] = n
+	}
+	return p.bitstate != nil && p.bitstate.seen(hash)
+}
+
+// StateHash hashes the state of every node in the graph. The order of
+// the incoming edges which have been reached is not significant, so
+// callbacks must treat them as a set (as all of the provided
+// callbacks do) for deduplication to be sound.
+func (gp *graphPermutation) StateHash() uint64 {
+	h := fnv.New64a()
+	h.Write(gp.stateKey(false))
+	return h.Sum64()
+}
+
+// stateKey produces a canonical encoding of the state of every node
+// in the graph. If ordered, the order of the available nodes, which
+// determines the order of the options, is included too.
+func (gp *graphPermutation) stateKey(ordered bool) []byte {
+	nodes := gp.allNodes()
+	index := gp.graph.index
+	key := make([]byte, 0, 8*len(nodes))
+	key = binary.AppendVarint(key, gp.clock)
+	if len(gp.spawned) != 0 {
+		// Spawned nodes differ between branches, so they are
+		// identified by their position, value and outgoing edges.
+		index = make(map[*GraphNode]int, len(nodes))
+		for idx, gn := range nodes {
+			index[gn] = idx
+		}
+		key = binary.AppendUvarint(key, uint64(len(gp.spawned)))
+		for _, gn := range gp.spawned {
+			key = append(fmt.Appendf(key, "%v", gn.Value), 0)
+			key = binary.AppendUvarint(key, uint64(len(gn.Out)))
+			for _, out := range gn.Out {
+				key = binary.AppendUvarint(key, uint64(index[out]))
+			}
+		}
+	}
+	if gp.atomicNext == nil {
+		key = binary.AppendUvarint(key, 0)
+	} else {
+		key = binary.AppendUvarint(key, uint64(index[gp.atomicNext])+1)
+	}
+	if ordered {
+		key = binary.AppendUvarint(key, uint64(len(gp.current)))
+		for _, node := range gp.current {
+			key = binary.AppendUvarint(key, uint64(index[node.(*GraphNode)]))
+		}
+	}
+	visited := []int{}
+	for idx := range nodes {
+		gns, found := gp.stateAt(idx, false)
+		if !found {
+			continue
+		}
+		flags := uint64(0)
+		if gns.inhibited {
+			flags |= 1
+		}
+		if gns.available {
+			flags |= 2
+		}
+		if gns.blocked {
+			flags |= 4
+		}
+		key = binary.AppendUvarint(key, uint64(idx))
+		key = binary.AppendUvarint(key, flags)
+		key = binary.AppendUvarint(key, uint64(gns.visits))
+		key = binary.AppendVarint(key, gns.time)
+		visited = visited[:0]
+		for _, in := range gns.incomingVisited {
+			visited = append(visited, index[in])
+		}
+		sort.Ints(visited)
+		key = binary.AppendUvarint(key, uint64(len(visited)))
+		for _, in := range visited {
+			key = binary.AppendUvarint(key, uint64(in))
+		}
+	}
+	if gp.graph.history || hasHistoryCallback(gp.spawned) {
+		// HistoryCallbacks may depend on everything chosen, in order.
+		history := VisitHistory{gp.history}.Nodes()
+		key = binary.AppendUvarint(key, uint64(len(history)))
+		for _, gn := range history {
+			key = binary.AppendUvarint(key, uint64(index[gn]))
+		}
+	}
+	return key
+}
@@ -0,0 +1,44 @@
+package gsim
+
+import (
+	"math/big"
+	"sort"
+	"testing"
+)
+
+func TestWithStateDeduplication(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(processes()...))
+	all := make(map[string]bool)
+	for _, perm := range collect(p) {
+		all[perm] = true
+	}
+	duplicates := 0
+	deduped := p.WithStateDeduplication(func(prefix []interface{}, n, original *big.Int) {
+		duplicates++
+		originalPrefix := p.Permutation(original)[:len(prefix)]
+		if sortedString(prefix) != sortedString(originalPrefix) {
+			t.Errorf("%q reported as a duplicate of %q", permString(prefix), permString(originalPrefix))
+		}
+	})
+	got := collect(deduped)
+	for _, perm := range got {
+		if !all[perm] {
+			t.Fatalf("generated %q, which is not a permutation", perm)
+		}
+	}
+	// Once a1 and b1 have both been chosen, in either order, the
+	// state is the same, and likewise for every other pair.
+	if duplicates == 0 || len(got) >= len(all) {
+		t.Fatalf("got %d of %d permutations, with %d duplicates", len(got), len(all), duplicates)
+	}
+	if count := deduped.Count(); count.Int64() != int64(len(all)) {
+		t.Fatalf("Count is %v, want %d", count, len(all))
+	}
+}
+
+// sortedString renders the elements of perm, sorted.
+func sortedString(perm []interface{}) string {
+	sorted := append([]interface{}{}, perm...)
+	sort.Slice(sorted, func(i, j int) bool { return permString(sorted[i:i+1]) < permString(sorted[j:j+1]) })
+	return permString(sorted)
+}
@@ -0,0 +1,62 @@
+package gsim
+
+// A TypedDeltaDecoder rebuilds a sequence of permutations from their
+// delta encoding, in which each permutation is given as the number of
+// elements it shares with the start of the previous permutation, and
+// the suffix which follows them. Permutations generated in order
+// share long prefixes, so this is far more compact than copying every
+// permutation in full, which is why ForEachPar and ForEachParBounded
+// hand permutations to their consuming go-routines in this form. The
+// encoding can be used wherever permutations are stored or shipped in
+// bulk: the first permutation, and any which share nothing, are
+// encoded with 0 shared elements.
+//
+// The zero value is ready to use.
+type TypedDeltaDecoder[T any] struct {
+	perm []T
+}
+
+// DeltaDecoder is the interface{} instantiation of TypedDeltaDecoder.
+type DeltaDecoder = TypedDeltaDecoder[interface{}]
+
+// Decode returns the permutation which shares its first shared
+// elements with the permutation previously decoded, and then
+// continues with suffix. The permutation's backing array is reused by
+// the next call to Decode, so take a copy with Retain if it must be
+// kept.
+func (dd *TypedDeltaDecoder[T]) Decode(shared int, suffix []T) []T {
+	dd.perm = append(dd.perm[:shared], suffix...)
+	return dd.perm
+}
+
+// Reset forgets the permutation previously decoded, so that the next
+// must share no elements with it.
+func (dd *TypedDeltaDecoder[T]) Reset() {
+	var zero T
+	for idx := range dd.perm {
+		dd.perm[idx] = zero // don't keep values alive
+	}
+	dd.perm = dd.perm[:0]
+}
+
+// deltaEncode returns the number of elements of perm which may be
+// shared with the permutation previously added to the batch, given
+// that the walk has kept the first kept elements of its prefix
+// unchanged since then. The first permutation of every batch shares
+// nothing, so that batches can be decoded independently.
+func (ppc *parPermutationConsumer[T]) deltaEncode(perm []T) int {
+	shared := ppc.kept
+	if len(ppc.batch.perms) == 0 || shared > len(perm) {
+		shared = 0
+	}
+	ppc.kept = len(perm)
+	return shared
+}
+
+// truncate records that the walk has kept only the first kept
+// elements of its prefix unchanged.
+func (ppc *parPermutationConsumer[T]) truncate(kept int) {
+	if kept < ppc.kept {
+		ppc.kept = kept
+	}
+}
@@ -0,0 +1,62 @@
+package gsim
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDeltaDecoder(t *testing.T) {
+	var dd TypedDeltaDecoder[int]
+	for _, step := range []struct {
+		shared int
+		suffix []int
+		want   string
+	}{
+		{0, []int{1, 2, 3}, "[1 2 3]"},
+		{2, []int{4}, "[1 2 4]"},
+		{1, []int{5, 6, 7}, "[1 5 6 7]"},
+		{4, nil, "[1 5 6 7]"},
+		{0, []int{8}, "[8]"},
+	} {
+		if got := fmt.Sprint(dd.Decode(step.shared, step.suffix)); got != step.want {
+			t.Fatalf("Decode(%d, %v) gave %s, want %s", step.shared, step.suffix, got, step.want)
+		}
+	}
+	dd.Reset()
+	if got := fmt.Sprint(dd.Decode(0, []int{9})); got != "[9]" {
+		t.Fatalf("after Reset, got %s", got)
+	}
+}
+
+func TestForEachParDeltaBatches(t *testing.T) {
+	// Pruning and WithMaxDepth cut the walk's prefix back in ways
+	// plain iteration does not, so the shared elements must follow.
+	simple := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5, 6}))
+	for idx, p := range []*Permutations{
+		simple,
+		simple.WithMaxDepth(3),
+		simple.WithPrune(func(prefix []interface{}) bool {
+			return len(prefix) > 1 && prefix[len(prefix)-1] == 1
+		}),
+		BuildPermutations(NewGraphPermutation(egraph()...)),
+		BuildPermutations(NewGraphPermutation(diamonds(3)...)),
+	} {
+		want := newCollector()
+		p.ForEach(want)
+		for _, batch := range []int{1, 7, 64} {
+			got := newCollector()
+			if err := p.WithWorkers(3).ForEachPar(batch, got); err != nil {
+				t.Fatal(err)
+			}
+			wantNumbered, gotNumbered := want.numbered(), got.numbered()
+			if len(gotNumbered) != len(wantNumbered) || len(*got.perms) != len(*want.perms) {
+				t.Fatalf("generator %d, batch %d: got %d permutations, want %d", idx, batch, len(*got.perms), len(*want.perms))
+			}
+			for n, perm := range wantNumbered {
+				if gotNumbered[n] != perm {
+					t.Fatalf("generator %d, batch %d: %s is %q, want %q", idx, batch, n, gotNumbered[n], perm)
+				}
+			}
+		}
+	}
+}
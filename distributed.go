@@ -0,0 +1,305 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"net"
+	"net/rpc"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Lease is a unit of work handed out by a Coordinator: a subtree of
+// the permutation tree, encoded as a snapshot.
+type Lease struct {
+	ID       int
+	Snapshot []byte
+	// HeartbeatInterval is how often the worker must send heartbeats
+	// for the lease not to expire.
+	HeartbeatInterval time.Duration
+	// Wait is set if there is no work available now, but there may be
+	// later, should a lease expire.
+	Wait bool
+	// Done is set once every lease has been completed.
+	Done bool
+}
+
+// LeaseFailure records a permutation which failed.
+type LeaseFailure struct {
+	N   *big.Int
+	Err string
+}
+
+// LeaseResult is reported by a worker when it completes a lease.
+type LeaseResult struct {
+	ID           int
+	Worker       string
+	Permutations uint64
+	Failures     []LeaseFailure
+}
+
+// DistributedResult is the combined result of every lease.
+type DistributedResult struct {
+	Permutations uint64
+	Failures     []LeaseFailure
+}
+
+// AcquireArgs are the arguments to Coordinator.Acquire.
+type AcquireArgs struct {
+	Worker string
+}
+
+// HeartbeatArgs are the arguments to Coordinator.Heartbeat.
+type HeartbeatArgs struct {
+	Worker string
+	ID     int
+}
+
+type coordinatorLease struct {
+	snapshot []byte
+	worker   string
+	deadline time.Time
+	leased   bool
+	done     bool
+}
+
+// Coordinator splits the permutations of a TypedPermutations into
+// leases, each a disjoint subtree, and hands them out over TCP (using
+// net/rpc) to workers started with RunWorker, possibly on other
+// machines, so that exhaustive runs can use more than one box.
+// Workers send heartbeats whilst they work on a lease; a lease whose
+// heartbeats stop (because its worker died) expires and is handed out
+// again, after which only its new worker may complete it.
+type Coordinator struct {
+	lock      sync.Mutex
+	leases    []*coordinatorLease
+	pending   []int
+	timeout   time.Duration
+	remaining int
+	result    DistributedResult
+	done      chan struct{}
+}
+
+// NewCoordinator creates a Coordinator which splits the permutations
+// of p into (at least, where possible) the given number of leases. A
+// lease expires if no heartbeat is received for timeout, which must be
+// at least 3ns as workers send heartbeats three times as often. Every
+// worker must use a TypedPermutations identical to p, including its
+// options.
+func NewCoordinator[T any](p *TypedPermutations[T], leases int, timeout time.Duration) *Coordinator {
+	if timeout < 3 {
+		panic("NewCoordinator requires a timeout of at least 3ns")
+	}
+	frontier := p.frontier(leases)
+	c := &Coordinator{
+		leases:    make([]*coordinatorLease, len(frontier)),
+		pending:   make([]int, len(frontier)),
+		timeout:   timeout,
+		remaining: len(frontier),
+		done:      make(chan struct{}),
+	}
+	for idx, n := range frontier {
+		c.leases[idx] = &coordinatorLease{snapshot: encodeSnapshot(nil, 0, []*node[T]{n})}
+		c.pending[idx] = idx
+	}
+	if c.remaining == 0 {
+		close(c.done)
+	}
+	return c
+}
+
+// Serve accepts connections from workers on l until l is closed.
+func (c *Coordinator) Serve(l net.Listener) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName("Coordinator", &coordinatorService{c: c}); err != nil {
+		return err
+	}
+	server.Accept(l)
+	return nil
+}
+
+// Wait blocks until every lease has been completed, and returns the
+// combined result.
+func (c *Coordinator) Wait() *DistributedResult {
+	<-c.done
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	result := c.result
+	return &result
+}
+
+// coordinatorService holds the methods exposed over net/rpc.
+type coordinatorService struct {
+	c *Coordinator
+}
+
+func (cs *coordinatorService) Acquire(args AcquireArgs, reply *Lease) error {
+	c := cs.c
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	for idx, l := range c.leases {
+		if l.leased && !l.done && now.After(l.deadline) {
+			l.leased = false
+			c.pending = append(c.pending, idx)
+		}
+	}
+	*reply = Lease{HeartbeatInterval: c.timeout / 3}
+	switch {
+	case c.remaining == 0:
+		reply.Done = true
+	case len(c.pending) == 0:
+		reply.Wait = true
+	default:
+		idx := c.pending[0]
+		c.pending = c.pending[1:]
+		l := c.leases[idx]
+		l.leased, l.worker, l.deadline = true, args.Worker, now.Add(c.timeout)
+		reply.ID, reply.Snapshot = idx, l.snapshot
+	}
+	return nil
+}
+
+func (cs *coordinatorService) Heartbeat(args HeartbeatArgs, valid *bool) error {
+	c := cs.c
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if args.ID < 0 || args.ID >= len(c.leases) {
+		return errors.New("unknown lease")
+	}
+	l := c.leases[args.ID]
+	*valid = l.leased && !l.done && l.worker == args.Worker
+	if *valid {
+		l.deadline = time.Now().Add(c.timeout)
+	}
+	return nil
+}
+
+func (cs *coordinatorService) Complete(result LeaseResult, accepted *bool) error {
+	c := cs.c
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if result.ID < 0 || result.ID >= len(c.leases) {
+		return errors.New("unknown lease")
+	}
+	l := c.leases[result.ID]
+	// Only the worker holding the lease may complete it: once it has
+	// expired and been handed to another, its first worker's result is
+	// rejected, as the heartbeats of that worker are.
+	if *accepted = l.leased && !l.done && l.worker == result.Worker; !*accepted {
+		return nil
+	}
+	l.done = true
+	c.result.Permutations += result.Permutations
+	c.result.Failures = append(c.result.Failures, result.Failures...)
+	if c.remaining--; c.remaining == 0 {
+		close(c.done)
+	}
+	return nil
+}
+
+// errLeaseLost stops the walk of a lease which has expired and may
+// have been handed to another worker.
+var errLeaseLost = errors.New("lease lost")
+
+// leaseChecker wraps the worker's checker, recording failures rather
+// than stopping, so that every permutation of the lease is checked,
+// unless the lease is lost. Its clones share its result.
+type leaseChecker[T any] struct {
+	f      TypedPermutationChecker[T]
+	lock   *sync.Mutex
+	result *LeaseResult
+	lost   *atomic.Bool
+}
+
+func (lc *leaseChecker[T]) Clone() TypedPermutationChecker[T] {
+	return &leaseChecker[T]{f: lc.f.Clone(), lock: lc.lock, result: lc.result, lost: lc.lost}
+}
+
+func (lc *leaseChecker[T]) Check(n *big.Int, perm []T) (err error) {
+	if lc.lost.Load() {
+		return errLeaseLost
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoverPermutation(r, n).Err
+		}
+		lc.lock.Lock()
+		defer lc.lock.Unlock()
+		lc.result.Permutations++
+		if err != nil {
+			lc.result.Failures = append(lc.result.Failures, LeaseFailure{N: new(big.Int).Set(n), Err: err.Error()})
+		}
+		err = nil
+	}()
+	return lc.f.Check(n, perm)
+}
+
+// RunWorker connects to the Coordinator at addr, and repeatedly
+// acquires a lease, checks every permutation of its subtree with f,
+// and reports the result, until the coordinator has no more work.
+// Failures (errors and panics) do not stop the worker: they are
+// reported to the coordinator. Should the coordinator reject a
+// heartbeat, because the lease expired and may have been handed to
+// another worker, the worker abandons the lease and acquires another.
+// p must be identical to the TypedPermutations given to
+// NewCoordinator. name identifies the worker and must be unique.
+func RunWorker[T any](addr, name string, p *TypedPermutations[T], f TypedPermutationChecker[T]) error {
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	for {
+		var lease Lease
+		if err := client.Call("Coordinator.Acquire", AcquireArgs{Worker: name}, &lease); err != nil {
+			return err
+		}
+		if lease.Done {
+			return nil
+		} else if lease.Wait {
+			time.Sleep(lease.HeartbeatInterval)
+			continue
+		}
+		shard, err := p.resumeSnapshot(lease.Snapshot)
+		if err != nil {
+			return err
+		}
+
+		lost := new(atomic.Bool)
+		stop := make(chan struct{})
+		heartbeats := make(chan error, 1)
+		go func() {
+			ticker := time.NewTicker(lease.HeartbeatInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					heartbeats <- nil
+					return
+				case <-ticker.C:
+					var valid bool
+					err := client.Call("Coordinator.Heartbeat", HeartbeatArgs{Worker: name, ID: lease.ID}, &valid)
+					if err != nil || !valid {
+						lost.Store(true)
+						heartbeats <- err
+						return
+					}
+				}
+			}
+		}()
+		result := LeaseResult{ID: lease.ID, Worker: name}
+		shard.ForEachCheck(&leaseChecker[T]{f: f, lock: new(sync.Mutex), result: &result, lost: lost})
+		close(stop)
+		if err := <-heartbeats; err != nil {
+			return err
+		} else if lost.Load() {
+			continue
+		}
+		var accepted bool
+		if err := client.Call("Coordinator.Complete", result, &accepted); err != nil {
+			return err
+		}
+	}
+}
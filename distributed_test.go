@@ -0,0 +1,185 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"net"
+	"net/rpc"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDistributed(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{"a", "b", "c", "d", "e"}))
+	c := NewCoordinator(p, 8, time.Second)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go c.Serve(l)
+
+	// Permutations starting with "a" fail.
+	f := checkerFunc(func(n *big.Int, perm []interface{}) error {
+		if perm[0] == "a" {
+			return errors.New("starts with a")
+		}
+		return nil
+	})
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for idx := range errs {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			errs[idx] = RunWorker(l.Addr().String(), string(rune('x'+idx)), p, f)
+		}(idx)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	result := c.Wait()
+	if result.Permutations != 120 || len(result.Failures) != 24 {
+		t.Fatalf("got %d permutations and %d failures, want 120 and 24", result.Permutations, len(result.Failures))
+	}
+	for _, failure := range result.Failures {
+		if perm := p.Permutation(failure.N); perm[0] != "a" {
+			t.Fatalf("permutation %v reported failing: %v", failure.N, perm)
+		}
+	}
+}
+
+// lostLeaseCoordinator hands out a single lease, and then rejects
+// every heartbeat for it.
+type lostLeaseCoordinator struct {
+	snapshot  []byte
+	acquired  bool
+	completed atomic.Bool
+}
+
+func (llc *lostLeaseCoordinator) Acquire(args AcquireArgs, reply *Lease) error {
+	*reply = Lease{HeartbeatInterval: time.Millisecond, Done: llc.acquired, Snapshot: llc.snapshot}
+	llc.acquired = true
+	return nil
+}
+
+func (llc *lostLeaseCoordinator) Heartbeat(args HeartbeatArgs, valid *bool) error {
+	*valid = false
+	return nil
+}
+
+func (llc *lostLeaseCoordinator) Complete(result LeaseResult, accepted *bool) error {
+	llc.completed.Store(true)
+	return nil
+}
+
+func TestWorkerAbandonsLostLease(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5, 6, 7, 8}))
+	llc := &lostLeaseCoordinator{snapshot: NewCoordinator(p, 1, time.Second).leases[0].snapshot}
+	server := rpc.NewServer()
+	if err := server.RegisterName("Coordinator", llc); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go server.Accept(l)
+
+	checked := new(atomic.Int64)
+	f := checkerFunc(func(*big.Int, []interface{}) error {
+		checked.Add(1)
+		time.Sleep(100 * time.Microsecond)
+		return nil
+	})
+	if err := RunWorker(l.Addr().String(), "w", p, f); err != nil {
+		t.Fatal(err)
+	}
+	if llc.completed.Load() {
+		t.Fatal("lost lease completed")
+	}
+	if n := checked.Load(); n >= 40320 {
+		t.Fatalf("checked all %d permutations of a lost lease", n)
+	}
+}
+
+func TestLeaseCheckerClone(t *testing.T) {
+	result := &LeaseResult{}
+	lc := &leaseChecker[interface{}]{
+		f:      checkerFunc(func(*big.Int, []interface{}) error { panic("boom") }),
+		lock:   new(sync.Mutex),
+		result: result,
+		lost:   new(atomic.Bool),
+	}
+	clone := lc.Clone()
+	for _, c := range []PermutationChecker{lc, clone} {
+		if err := c.Check(big.NewInt(1), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if result.Permutations != 2 || len(result.Failures) != 2 {
+		t.Fatalf("got %d permutations and %d failures, want 2 and 2", result.Permutations, len(result.Failures))
+	}
+}
+
+func TestNewCoordinatorRequiresTimeout(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic")
+		}
+	}()
+	NewCoordinator(BuildPermutations(NewSimplePermutation([]interface{}{1})), 1, 2)
+}
+
+func TestExpiredLeaseReassigned(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3}))
+	timeout := 50 * time.Millisecond
+	c := NewCoordinator(p, 1, timeout)
+	cs := &coordinatorService{c: c}
+
+	var first, second Lease
+	if err := cs.Acquire(AcquireArgs{Worker: "w1"}, &first); err != nil || first.Wait || first.Done {
+		t.Fatalf("got lease %+v and error %v", first, err)
+	}
+	var valid bool
+	if err := cs.Heartbeat(HeartbeatArgs{Worker: "w1", ID: first.ID}, &valid); err != nil || !valid {
+		t.Fatalf("heartbeat rejected: %v", err)
+	}
+	// While w1's lease is live, there is nothing for w2 to do.
+	if err := cs.Acquire(AcquireArgs{Worker: "w2"}, &second); err != nil || !second.Wait {
+		t.Fatalf("got lease %+v and error %v, want to wait", second, err)
+	}
+
+	// w1 stops sending heartbeats, so its lease expires and is handed
+	// to w2.
+	time.Sleep(2 * timeout)
+	if err := cs.Acquire(AcquireArgs{Worker: "w2"}, &second); err != nil || second.Wait || second.ID != first.ID {
+		t.Fatalf("got lease %+v and error %v, want lease %d", second, err, first.ID)
+	}
+	if err := cs.Heartbeat(HeartbeatArgs{Worker: "w1", ID: first.ID}, &valid); err != nil || valid {
+		t.Fatalf("heartbeat of expired lease accepted: %v", err)
+	}
+	if err := cs.Heartbeat(HeartbeatArgs{Worker: "w2", ID: second.ID}, &valid); err != nil || !valid {
+		t.Fatalf("heartbeat of reassigned lease rejected: %v", err)
+	}
+
+	var accepted bool
+	if err := cs.Complete(LeaseResult{ID: first.ID, Worker: "w1", Permutations: 1}, &accepted); err != nil || accepted {
+		t.Fatalf("result of expired lease accepted: %v", err)
+	}
+	if err := cs.Complete(LeaseResult{ID: second.ID, Worker: "w2", Permutations: 6}, &accepted); err != nil || !accepted {
+		t.Fatalf("result of reassigned lease rejected: %v", err)
+	}
+	if err := cs.Complete(LeaseResult{ID: second.ID, Worker: "w2", Permutations: 6}, &accepted); err != nil || accepted {
+		t.Fatalf("lease completed twice: %v", err)
+	}
+	if result := c.Wait(); result.Permutations != 6 {
+		t.Fatalf("got %d permutations, want 6", result.Permutations)
+	}
+}
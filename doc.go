@@ -14,7 +14,9 @@
 // check to see if goals have been met and invariants kept. If they
 // have been, you have performed a model check that with any valid
 // sequence of instructions as generated from the graph, your
-// algorithm is correct.
+// algorithm is correct. NewInterpreter provides the framework for
+// such an interpreter: you supply the state, the transitions and the
+// invariants.
 //
 // An alternative use is for testing: the permutation represents the
 // order of events which you send to some black-box system to be
@@ -29,6 +31,12 @@
 // there'll be less of a gap between your model code and your real
 // implementation.
 //
+// Permutations are, by default, lists of interface{}. If the elements
+// of your permutations are all of one concrete type then you can use
+// the Typed variants (TypedOptionGenerator, TypedPermutations and so
+// on) to avoid boxing and type assertions. The untyped names are
+// simply the interface{} instantiations of the typed ones.
+//
 // See https://github.com/msackman/gsim/blob/master/main/main.go for
 // examples.
 package gsim
@@ -0,0 +1,163 @@
+package gsim
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// dotNode describes a node as ReadDOT would build it: inhibited once
+// any of inhibitors is reached, and otherwise available once any (or,
+// if requireAll, every) other predecessor is. If the node cannot be so
+// described, custom is set.
+type dotNode struct {
+	requireAll bool
+	inhibitors []*GraphNode
+	custom     bool
+}
+
+// describeDOTNode finds the description of gn, by comparing its
+// callback with those ReadDOT builds for every combination of its
+// incoming edges. Callbacks must treat the incoming edges reached as
+// a set. Nodes with too many incoming edges to compare, and nodes with
+// settings which ReadDOT does not understand, are custom.
+func describeDOTNode(gn *GraphNode) dotNode {
+	if gn.symmetryPred != nil || gn.atomic != nil || gn.outGuards != nil || gn.onVisit != nil ||
+		gn.section != nil || gn.acquires != nil || gn.releases != nil || gn.kills != nil {
+		return dotNode{custom: true}
+	}
+	if gn.Callback == AvailableAnyCallback {
+		return dotNode{}
+	}
+	if _, ok := gn.Callback.(HistoryCallback); ok || mayRelease(gn.Callback) || len(gn.In) > maxValidateIncoming {
+		return dotNode{custom: true}
+	}
+	var inhibitors []*GraphNode
+	for _, in := range gn.In {
+		if gn.Callback.IncomingEdgesReached(gn, []*GraphNode{in}) == Inhibit {
+			inhibitors = append(inhibitors, in)
+		}
+	}
+	for _, requireAll := range []bool{false, true} {
+		if candidate, _ := builtCallback(gn, requireAll, inhibitors); equivalentCallbacks(gn, gn.Callback, candidate) {
+			return dotNode{requireAll: requireAll, inhibitors: inhibitors}
+		}
+	}
+	return dotNode{custom: true}
+}
+
+// equivalentCallbacks reports whether a and b, callbacks for gn, return
+// the same result for every non-empty subset of gn's incoming edges.
+func equivalentCallbacks(gn *GraphNode, a, b GraphNodeCallback) bool {
+	reached := make([]*GraphNode, 0, len(gn.In))
+	for bits := 1; bits < 1<<len(gn.In); bits++ {
+		reached = reached[:0]
+		for pos, in := range gn.In {
+			if bits&(1<<pos) != 0 {
+				reached = append(reached, in)
+			}
+		}
+		if a.IncomingEdgesReached(gn, reached) != b.IncomingEdgesReached(gn, reached) {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteDOT renders the graph reachable from the starting nodes in the
+// Graphviz DOT language, so that it can be checked visually against
+// the system it is meant to model. Starting nodes are drawn with a
+// double outline; nodes which require all of their predecessors
+// (AND-joins) are boxes; nodes which can be inhibited are octagons,
+// and the edges which inhibit them are red and dashed; nodes with
+// callbacks or settings which ReadDOT cannot express are notes. Nodes
+// which are predecessors of reachable nodes, but which are not
+// themselves reachable, are grey. Edge delays, deadlines and maximum
+// visits are shown too.
+//
+// The output also carries attributes (start, require, inhibit,
+// delay, deadline and maxvisits) which ReadDOT understands, so graphs
+// whose callbacks behave as those ReadDOT builds can be written and
+// read back, with the same permutations. Other nodes are marked with
+// custom="true", which ReadDOT rejects, rather than reading back a
+// graph with different permutations.
+func WriteDOT(w io.Writer, start ...*GraphNode) error {
+	nodes := reachableGraphNodes(start...)
+	reachable := len(nodes)
+	ids := make(map[*GraphNode]int, len(nodes))
+	for idx, gn := range nodes {
+		ids[gn] = idx
+	}
+	for idx := 0; idx < len(nodes); idx++ {
+		for _, in := range nodes[idx].In {
+			if _, found := ids[in]; !found {
+				ids[in] = len(nodes)
+				nodes = append(nodes, in)
+			}
+		}
+	}
+	isStart := make(map[*GraphNode]bool, len(start))
+	for _, gn := range start {
+		isStart[gn] = true
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph gsim {")
+	descs := make([]dotNode, len(nodes))
+	for idx, gn := range nodes {
+		desc := describeDOTNode(gn)
+		descs[idx] = desc
+		fmt.Fprintf(bw, "\tn%d [label=%s", idx, strconv.Quote(fmt.Sprint(gn.Value)))
+		switch {
+		case desc.custom:
+			fmt.Fprint(bw, `, shape=note, custom="true"`)
+		case len(desc.inhibitors) > 0:
+			fmt.Fprint(bw, ", shape=octagon")
+		case desc.requireAll:
+			fmt.Fprint(bw, ", shape=box")
+		}
+		if desc.requireAll {
+			fmt.Fprint(bw, `, require="all"`)
+		}
+		if isStart[gn] {
+			fmt.Fprint(bw, `, peripheries=2, start="true"`)
+		}
+		if idx >= reachable {
+			fmt.Fprint(bw, ", color=grey, fontcolor=grey")
+		}
+		if gn.maxVisits > 1 {
+			fmt.Fprintf(bw, ", maxvisits=%d, xlabel=\"×%d\"", gn.maxVisits, gn.maxVisits)
+		}
+		if gn.hasDeadline {
+			fmt.Fprintf(bw, ", deadline=%d", gn.deadline)
+		}
+		fmt.Fprintln(bw, "];")
+	}
+	for idx, gn := range nodes {
+		for _, in := range gn.In {
+			fmt.Fprintf(bw, "\tn%d -> n%d", ids[in], idx)
+			attrs := []string{}
+			if containsGraphNode(descs[idx].inhibitors, in) {
+				attrs = append(attrs, `inhibit="true"`, "color=red", "style=dashed")
+			}
+			if delay, found := gn.inDelays[in]; found {
+				attrs = append(attrs, fmt.Sprintf("delay=%d, label=\"%d\"", delay, delay))
+			}
+			for aidx, attr := range attrs {
+				if aidx == 0 {
+					fmt.Fprint(bw, " [")
+				} else {
+					fmt.Fprint(bw, ", ")
+				}
+				fmt.Fprint(bw, attr)
+			}
+			if len(attrs) > 0 {
+				fmt.Fprint(bw, "]")
+			}
+			fmt.Fprintln(bw, ";")
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
@@ -0,0 +1,74 @@
+package gsim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// roundTripDOT writes the graph as DOT and reads it back.
+func roundTripDOT(t *testing.T, start []*GraphNode) []*GraphNode {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteDOT(&buf, start...); err != nil {
+		t.Fatal(err)
+	}
+	start2, err := ReadDOT(&buf)
+	if err != nil {
+		t.Fatalf("%v reading:\n%s", err, buf.String())
+	}
+	return start2
+}
+
+func TestDOTRoundTrip(t *testing.T) {
+	inhibited := nodes("x", "y", "z")
+	inhibited[0].AddEdgeTo(inhibited[2])
+	inhibited[1].AddEdgeTo(inhibited[2])
+	inhibited[2].Callback = InhibitWhen(After(inhibited[1]), After(inhibited[0]))
+
+	timed := nodes("t1", "t2", "t3")
+	timed[0].AddTimedEdgeTo(timed[1], 2)
+	timed[0].AddEdgeTo(timed[2])
+	timed[2].SetMaxVisits(2)
+	timed[1].SetDeadline(3)
+
+	for _, start := range [][]*GraphNode{egraph(), joins(), inhibited[:2], timed[:1], diamonds(2)} {
+		want := collectSorted(BuildPermutations(NewGraphPermutation(start...)))
+		got := collectSorted(BuildPermutations(NewGraphPermutation(roundTripDOT(t, start)...)))
+		checkPerms(t, got, want)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	g := nodes("start", "join", "other", "inhibitor", "late", "orphan")
+	start, join, other, inhibitor, late, orphan := g[0], g[1], g[2], g[3], g[4], g[5]
+	start.AddEdgeTo(join)
+	other.AddEdgeTo(join)
+	join.Callback = NewAvailableAllCallback(start, other)
+	start.AddTimedEdgeTo(late, 3)
+	inhibitor.AddEdgeTo(late)
+	cc := NewCombinationCallback(InhibitThenAvailableCombiner)
+	cc.AddCallback(NewInhibitAllCallback(inhibitor))
+	cc.AddCallback(NewAvailableAllCallback(start))
+	late.Callback = cc
+	late.SetMaxVisits(2)
+	orphan.AddEdgeTo(other)
+
+	var buf bytes.Buffer
+	if err := WriteDOT(&buf, start, other, inhibitor); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	for _, want := range []string{
+		`n0 [label="start", peripheries=2, start="true"];`,
+		`[label="join", shape=box, require="all"];`,
+		`[label="late", shape=octagon, maxvisits=2, xlabel="×2"];`,
+		`[label="orphan", color=grey, fontcolor=grey];`,
+		`[inhibit="true", color=red, style=dashed];`,
+		`[delay=3, label="3"];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("missing %s in:\n%s", want, dot)
+		}
+	}
+}
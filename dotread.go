@@ -0,0 +1,490 @@
+package gsim
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ReadDOT builds a graph from a restricted dialect of the Graphviz DOT
+// language, returning the starting nodes, so that models can be
+// authored and reviewed as text files. The input must be a single
+// digraph containing only node statements, edge statements (which
+// may be chained: a -> b -> c) and attribute statements, which are
+// ignored; subgraphs are not supported. Comments are permitted.
+//
+// The value of each node is its label attribute if it has one, and
+// otherwise its ID. The following attributes are understood; all
+// others are ignored, so the output of WriteDOT can be read back:
+//
+//	node start="true"    the node is a starting node
+//	node require="all"   the node requires all of its predecessors
+//	                     (other than inhibitors), rather than any
+//	node maxvisits=k     see SetMaxVisits
+//	node deadline=d      see SetDeadline
+//	edge inhibit="true"  reaching the edge inhibits its target
+//	edge delay=d         see AddTimedEdgeTo
+//
+// A node with custom="true", which WriteDOT emits for nodes whose
+// callbacks or settings this dialect cannot express, is an error.
+//
+// If no node is marked as a starting node, the starting nodes are
+// those with no predecessors other than inhibitors. Starting nodes
+// are returned in the order in which their IDs first appear.
+func ReadDOT(r io.Reader) ([]*GraphNode, error) {
+	lexer := &dotLexer{r: bufio.NewReader(r), line: 1}
+	parser := &dotParser{
+		lexer:      lexer,
+		nodes:      make(map[string]*GraphNode),
+		requireAll: make(map[*GraphNode]bool),
+		inhibitors: make(map[*GraphNode][]*GraphNode),
+		start:      make(map[*GraphNode]bool),
+	}
+	if err := parser.parse(); err != nil {
+		return nil, err
+	}
+	var start, implicitStart []*GraphNode
+	for _, gn := range parser.order {
+		if setBuiltCallback(gn, parser.requireAll[gn], parser.inhibitors[gn]) {
+			implicitStart = append(implicitStart, gn)
+		}
+		if parser.start[gn] {
+			start = append(start, gn)
+		}
+	}
+	if len(parser.start) == 0 {
+		start = implicitStart
+	}
+	return start, nil
+}
+
+type dotToken struct {
+	text   string
+	quoted bool
+}
+
+type dotLexer struct {
+	r    *bufio.Reader
+	line int
+	peek *dotToken
+	err  error
+}
+
+func (l *dotLexer) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("dot: line %d: %s", l.line, fmt.Sprintf(format, args...))
+}
+
+func (l *dotLexer) readRune() (rune, bool) {
+	r, _, err := l.r.ReadRune()
+	if err != nil {
+		if err != io.EOF {
+			l.err = err
+		}
+		return 0, false
+	}
+	if r == '\n' {
+		l.line++
+	}
+	return r, true
+}
+
+func (l *dotLexer) unreadRune(r rune) {
+	l.r.UnreadRune()
+	if r == '\n' {
+		l.line--
+	}
+}
+
+// next returns the next token, or nil at the end of the input.
+func (l *dotLexer) next() (*dotToken, error) {
+	if tok := l.peek; tok != nil {
+		l.peek = nil
+		return tok, nil
+	}
+	for {
+		r, ok := l.readRune()
+		switch {
+		case !ok:
+			return nil, l.err
+		case unicode.IsSpace(r):
+			continue
+		case r == '#':
+			l.skipLine()
+			continue
+		case r == '/':
+			r2, _ := l.readRune()
+			switch r2 {
+			case '/':
+				l.skipLine()
+			case '*':
+				if err := l.skipBlockComment(); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, l.errorf("unexpected %q", r)
+			}
+			continue
+		case r == '"':
+			return l.quoted()
+		case strings.ContainsRune("{}[];,=", r):
+			return &dotToken{text: string(r)}, nil
+		case r == '-':
+			r2, ok := l.readRune()
+			if ok && r2 == '>' {
+				return &dotToken{text: "->"}, nil
+			} else if ok && r2 == '-' {
+				return nil, l.errorf("undirected edges are not supported")
+			} else if ok {
+				l.unreadRune(r2)
+			}
+			return l.id(r)
+		case r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			return l.id(r)
+		default:
+			return nil, l.errorf("unexpected %q", r)
+		}
+	}
+}
+
+func (l *dotLexer) peekToken() (*dotToken, error) {
+	if l.peek == nil {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		l.peek = tok
+	}
+	return l.peek, nil
+}
+
+func (l *dotLexer) skipLine() {
+	for {
+		if r, ok := l.readRune(); !ok || r == '\n' {
+			return
+		}
+	}
+}
+
+func (l *dotLexer) skipBlockComment() error {
+	star := false
+	for {
+		r, ok := l.readRune()
+		if !ok {
+			return l.errorf("unterminated comment")
+		} else if star && r == '/' {
+			return nil
+		}
+		star = r == '*'
+	}
+}
+
+func (l *dotLexer) quoted() (*dotToken, error) {
+	var sb strings.Builder
+	for {
+		r, ok := l.readRune()
+		switch {
+		case !ok:
+			return nil, l.errorf("unterminated string")
+		case r == '"':
+			return &dotToken{text: sb.String(), quoted: true}, nil
+		case r == '\\':
+			r2, ok := l.readRune()
+			if !ok {
+				return nil, l.errorf("unterminated string")
+			}
+			switch r2 {
+			case 'n':
+				sb.WriteRune('\n')
+			case 't':
+				sb.WriteRune('\t')
+			case '\n': // line continuation
+			default:
+				sb.WriteRune(r2)
+			}
+		default:
+			sb.WriteRune(r)
+		}
+	}
+}
+
+func (l *dotLexer) id(first rune) (*dotToken, error) {
+	var sb strings.Builder
+	sb.WriteRune(first)
+	for {
+		r, ok := l.readRune()
+		if !ok {
+			break
+		}
+		if r != '_' && r != '.' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			l.unreadRune(r)
+			break
+		}
+		sb.WriteRune(r)
+	}
+	return &dotToken{text: sb.String()}, l.err
+}
+
+type dotParser struct {
+	lexer      *dotLexer
+	nodes      map[string]*GraphNode
+	order      []*GraphNode
+	requireAll map[*GraphNode]bool
+	inhibitors map[*GraphNode][]*GraphNode
+	start      map[*GraphNode]bool
+}
+
+// expect consumes the next token, which must be one of the given
+// punctuation tokens (or, if none are given, any unquoted or quoted
+// ID).
+func (p *dotParser) expect(texts ...string) (*dotToken, error) {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return nil, err
+	} else if tok == nil {
+		return nil, p.lexer.errorf("unexpected end of input")
+	}
+	if len(texts) == 0 {
+		if !tok.quoted && strings.ContainsAny(tok.text, "{}[];,=") || tok.text == "->" {
+			return nil, p.lexer.errorf("expected an ID, found %q", tok.text)
+		}
+		return tok, nil
+	}
+	for _, text := range texts {
+		if !tok.quoted && tok.text == text {
+			return tok, nil
+		}
+	}
+	return nil, p.lexer.errorf("expected %s, found %q", strings.Join(texts, " or "), tok.text)
+}
+
+// peekIs reports whether the next token is the given punctuation.
+func (p *dotParser) peekIs(text string) (bool, error) {
+	tok, err := p.lexer.peekToken()
+	if err != nil {
+		return false, err
+	}
+	return tok != nil && !tok.quoted && tok.text == text, nil
+}
+
+func (p *dotParser) parse() error {
+	tok, err := p.expect()
+	if err != nil {
+		return err
+	}
+	if tok.text == "strict" {
+		if tok, err = p.expect(); err != nil {
+			return err
+		}
+	}
+	if tok.text != "digraph" {
+		return p.lexer.errorf("expected digraph, found %q", tok.text)
+	}
+	if isBrace, err := p.peekIs("{"); err != nil {
+		return err
+	} else if !isBrace {
+		if _, err := p.expect(); err != nil {
+			return err
+		}
+	}
+	if _, err := p.expect("{"); err != nil {
+		return err
+	}
+	for {
+		if isEnd, err := p.peekIs("}"); err != nil {
+			return err
+		} else if isEnd {
+			p.lexer.next()
+			break
+		}
+		if isSep, err := p.peekIs(";"); err != nil {
+			return err
+		} else if isSep {
+			p.lexer.next()
+			continue
+		}
+		tok, err := p.expect()
+		if err != nil {
+			return err
+		}
+		if err := p.statement(tok); err != nil {
+			return err
+		}
+	}
+	if tok, err := p.lexer.next(); err != nil {
+		return err
+	} else if tok != nil {
+		return p.lexer.errorf("unexpected %q after digraph", tok.text)
+	}
+	return nil
+}
+
+func (p *dotParser) statement(first *dotToken) error {
+	if !first.quoted && (first.text == "subgraph" || first.text == "{") {
+		return p.lexer.errorf("subgraphs are not supported")
+	}
+	if isAssign, err := p.peekIs("="); err != nil {
+		return err
+	} else if isAssign { // graph attribute
+		p.lexer.next()
+		_, err := p.expect()
+		return err
+	}
+	if !first.quoted && (first.text == "graph" || first.text == "node" || first.text == "edge") {
+		_, err := p.attributes()
+		return err
+	}
+
+	ids := []string{first.text}
+	for {
+		isEdge, err := p.peekIs("->")
+		if err != nil {
+			return err
+		} else if !isEdge {
+			break
+		}
+		p.lexer.next()
+		tok, err := p.expect()
+		if err != nil {
+			return err
+		}
+		ids = append(ids, tok.text)
+	}
+	attrs, err := p.attributes()
+	if err != nil {
+		return err
+	}
+
+	if len(ids) == 1 {
+		return p.nodeAttributes(p.node(ids[0]), attrs)
+	}
+	for idx := 1; idx < len(ids); idx++ {
+		from, to := p.node(ids[idx-1]), p.node(ids[idx])
+		from.AddEdgeTo(to)
+		for key, value := range attrs {
+			switch key {
+			case "inhibit":
+				if inhibit, err := strconv.ParseBool(value); err != nil {
+					return p.lexer.errorf("invalid inhibit %q", value)
+				} else if inhibit && !containsGraphNode(p.inhibitors[to], from) {
+					p.inhibitors[to] = append(p.inhibitors[to], from)
+				}
+			case "delay":
+				delay, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return p.lexer.errorf("invalid delay %q", value)
+				}
+				from.AddTimedEdgeTo(to, delay)
+			}
+		}
+	}
+	return nil
+}
+
+// attributes parses an optional attribute list.
+func (p *dotParser) attributes() (map[string]string, error) {
+	attrs := make(map[string]string)
+	for {
+		isList, err := p.peekIs("[")
+		if err != nil || !isList {
+			return attrs, err
+		}
+		p.lexer.next()
+		for {
+			if isEnd, err := p.peekIs("]"); err != nil {
+				return nil, err
+			} else if isEnd {
+				p.lexer.next()
+				break
+			}
+			key, err := p.expect()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect("="); err != nil {
+				return nil, err
+			}
+			value, err := p.expect()
+			if err != nil {
+				return nil, err
+			}
+			attrs[key.text] = value.text
+			for _, sep := range []string{",", ";"} {
+				if isSep, err := p.peekIs(sep); err != nil {
+					return nil, err
+				} else if isSep {
+					p.lexer.next()
+				}
+			}
+		}
+	}
+}
+
+func (p *dotParser) node(id string) *GraphNode {
+	gn, found := p.nodes[id]
+	if !found {
+		gn = NewGraphNode(id)
+		p.nodes[id] = gn
+		p.order = append(p.order, gn)
+	}
+	return gn
+}
+
+func (p *dotParser) nodeAttributes(gn *GraphNode, attrs map[string]string) error {
+	// The label is applied first, so that errors name the node by it,
+	// and then the other attributes in order, so that the error
+	// reported for a node with several bad attributes is always the
+	// same.
+	if label, found := attrs["label"]; found {
+		gn.Value = label
+	}
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := attrs[key]
+		switch key {
+		case "start":
+			start, err := strconv.ParseBool(value)
+			if err != nil {
+				return p.lexer.errorf("invalid start %q", value)
+			}
+			if start {
+				p.start[gn] = true
+			}
+		case "require":
+			switch value {
+			case "all":
+				p.requireAll[gn] = true
+			case "any":
+				p.requireAll[gn] = false
+			default:
+				return p.lexer.errorf("invalid require %q", value)
+			}
+		case "custom":
+			if custom, err := strconv.ParseBool(value); err != nil {
+				return p.lexer.errorf("invalid custom %q", value)
+			} else if custom {
+				return p.lexer.errorf("node %q has a custom callback or settings, which cannot be read", gn.Value)
+			}
+		case "maxvisits":
+			k, err := strconv.Atoi(value)
+			if err != nil {
+				return p.lexer.errorf("invalid maxvisits %q", value)
+			}
+			gn.SetMaxVisits(k)
+		case "deadline":
+			deadline, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return p.lexer.errorf("invalid deadline %q", value)
+			}
+			gn.SetDeadline(deadline)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package gsim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadDOT(t *testing.T) {
+	start, err := ReadDOT(strings.NewReader(`
+		// c follows both a and b, unless d comes first.
+		digraph model {
+			node [shape=box];
+			a -> c [color=blue];
+			b -> c;
+			c [require="all"];
+			/* d inhibits c */
+			d -> c [inhibit="true"];
+		}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPerms(t, collectSorted(BuildPermutations(NewGraphPermutation(start...))), []string{
+		"a b c d",
+		"a b d",
+		"a d b",
+		"b a c d",
+		"b a d",
+		"b d a",
+		"d a b",
+		"d b a",
+	})
+
+	for _, input := range []string{
+		"graph g { a -- b }",
+		"digraph { subgraph s { a } }",
+		`digraph { a [require="some"] }`,
+		"digraph { a -> }",
+	} {
+		if _, err := ReadDOT(strings.NewReader(input)); err == nil {
+			t.Errorf("%q read without error", input)
+		}
+	}
+}
+
+func TestReadDOTReportsFirstBadAttribute(t *testing.T) {
+	// Attributes are checked in order, so deadline is reported first
+	// however the attributes are stored.
+	input := `digraph { a [require="some", maxvisits="x", deadline="y", label="A"] }`
+	for i := 0; i < 20; i++ {
+		_, err := ReadDOT(strings.NewReader(input))
+		if err == nil || !strings.Contains(err.Error(), `invalid deadline "y"`) {
+			t.Fatalf("got %v, want the invalid deadline", err)
+		}
+	}
+}
+
+func TestReadDOTRejectsCustom(t *testing.T) {
+	// z is inhibited only once both x and y have been reached, which
+	// the dialect cannot express.
+	g := nodes("x", "y", "z")
+	g[0].AddEdgeTo(g[2])
+	g[1].AddEdgeTo(g[2])
+	g[2].Callback = NewInhibitAllCallback(g[0], g[1])
+
+	symmetric := nodes("a", "b")
+	DeclareSymmetric(symmetric...)
+
+	for _, start := range [][]*GraphNode{g[:2], symmetric} {
+		var buf bytes.Buffer
+		if err := WriteDOT(&buf, start...); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), `custom="true"`) {
+			t.Fatalf("custom node not marked:\n%s", buf.String())
+		}
+		if _, err := ReadDOT(&buf); err == nil {
+			t.Fatal("custom node read without error")
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package gsim
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+)
+
+// A TypedSystem is one of the two systems driven by an
+// EquivalenceHarness: either an adapter for the real, black-box,
+// system under test, or a reference interpreter.
+type TypedSystem[T any] interface {
+	// Reset returns the system to its initial state, ready for a new
+	// permutation.
+	Reset() error
+	// Apply sends one event to the system, and returns whatever
+	// output of the system is observable as a result.
+	Apply(event T) (interface{}, error)
+	// State returns the observable state of the system, once every
+	// event of a permutation has been applied.
+	State() (interface{}, error)
+}
+
+// System is the interface{} instantiation of TypedSystem.
+type System = TypedSystem[interface{}]
+
+// Divergence is the error returned by an EquivalenceHarness when the
+// real system and the reference disagree.
+type Divergence struct {
+	// Step is the number of events which had been applied: the
+	// outputs of the Step-th event differ, or, if Final, the final
+	// states differ.
+	Step  int
+	Final bool
+	// Event is the event whose outputs differ. It is nil if Final.
+	Event interface{}
+	// Real and Reference are the differing outputs or states.
+	Real, Reference interface{}
+}
+
+func (d *Divergence) Error() string {
+	if d.Final {
+		return fmt.Sprintf("final states diverge: real %v, reference %v", d.Real, d.Reference)
+	}
+	return fmt.Sprintf("outputs of event %v (step %d) diverge: real %v, reference %v", d.Event, d.Step, d.Real, d.Reference)
+}
+
+// TypedEquivalenceHarness is a TypedPermutationChecker which drives
+// both a real system and a reference interpreter with each
+// permutation, comparing their outputs after every event, and their
+// final states, as described in the package documentation. Passing it
+// to ForEachCheck (or any other checking iteration function) thus
+// reports the first divergence as a *PermutationError, identifying
+// the permutation, wrapping a *Divergence, or the error of either
+// system.
+type TypedEquivalenceHarness[T any] struct {
+	newReal, newReference func() TypedSystem[T]
+	real, reference       TypedSystem[T]
+	equal                 func(real, reference interface{}) bool
+}
+
+// EquivalenceHarness is the interface{} instantiation of
+// TypedEquivalenceHarness.
+type EquivalenceHarness = TypedEquivalenceHarness[interface{}]
+
+// NewEquivalenceHarness creates an EquivalenceHarness. See
+// NewTypedEquivalenceHarness.
+func NewEquivalenceHarness(newReal, newReference func() System, equal func(real, reference interface{}) bool) *EquivalenceHarness {
+	return NewTypedEquivalenceHarness(newReal, newReference, equal)
+}
+
+// NewTypedEquivalenceHarness creates a TypedEquivalenceHarness. The
+// functions newReal and newReference create the systems; they are
+// called once per clone of the harness, so the parallel iteration
+// functions can be used if the real system can be instantiated
+// several times. Outputs and states are compared with equal, or with
+// reflect.DeepEqual if equal is nil.
+func NewTypedEquivalenceHarness[T any](newReal, newReference func() TypedSystem[T], equal func(real, reference interface{}) bool) *TypedEquivalenceHarness[T] {
+	if equal == nil {
+		equal = reflect.DeepEqual
+	}
+	return &TypedEquivalenceHarness[T]{
+		newReal:      newReal,
+		newReference: newReference,
+		real:         newReal(),
+		reference:    newReference(),
+		equal:        equal,
+	}
+}
+
+func (eh *TypedEquivalenceHarness[T]) Clone() TypedPermutationChecker[T] {
+	return NewTypedEquivalenceHarness(eh.newReal, eh.newReference, eh.equal)
+}
+
+func (eh *TypedEquivalenceHarness[T]) Check(n *big.Int, perm []T) error {
+	if err := eh.real.Reset(); err != nil {
+		return fmt.Errorf("real system: %w", err)
+	}
+	if err := eh.reference.Reset(); err != nil {
+		return fmt.Errorf("reference: %w", err)
+	}
+	for idx, event := range perm {
+		realOut, err := eh.real.Apply(event)
+		if err != nil {
+			return fmt.Errorf("real system: event %v (step %d): %w", event, idx+1, err)
+		}
+		refOut, err := eh.reference.Apply(event)
+		if err != nil {
+			return fmt.Errorf("reference: event %v (step %d): %w", event, idx+1, err)
+		}
+		if !eh.equal(realOut, refOut) {
+			return &Divergence{Step: idx + 1, Event: event, Real: realOut, Reference: refOut}
+		}
+	}
+	realState, err := eh.real.State()
+	if err != nil {
+		return fmt.Errorf("real system: %w", err)
+	}
+	refState, err := eh.reference.State()
+	if err != nil {
+		return fmt.Errorf("reference: %w", err)
+	}
+	if !eh.equal(realState, refState) {
+		return &Divergence{Step: len(perm), Final: true, Real: realState, Reference: refState}
+	}
+	return nil
+}
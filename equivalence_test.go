@@ -0,0 +1,63 @@
+package gsim
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// counter is a System which increments and doubles a value. If buggy,
+// doubling 1 gives 3.
+type counter struct {
+	value int
+	buggy bool
+}
+
+func (c *counter) Reset() error {
+	c.value = 0
+	return nil
+}
+
+func (c *counter) Apply(event interface{}) (interface{}, error) {
+	switch value := event.(*GraphNode).Value.(string); {
+	case strings.HasPrefix(value, "inc"):
+		c.value++
+	case c.buggy && c.value == 1:
+		c.value = 3
+	default:
+		c.value *= 2
+	}
+	return c.value, nil
+}
+
+func (c *counter) State() (interface{}, error) {
+	return c.value, nil
+}
+
+func TestEquivalenceHarness(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(nodes("inc1", "inc2", "double")...))
+	reference := func() System { return &counter{} }
+	if err := p.ForEachCheck(NewEquivalenceHarness(reference, reference, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	buggy := func() System { return &counter{buggy: true} }
+	err := p.ForEachCheck(NewEquivalenceHarness(buggy, reference, nil))
+	var pe *PermutationError
+	var d *Divergence
+	if !errors.As(err, &pe) || !errors.As(err, &d) {
+		t.Fatalf("got %v, want a Divergence", err)
+	}
+	if d.Final || d.Step != 2 || d.Event.(*GraphNode).Value != "double" || d.Real != 3 || d.Reference != 2 {
+		t.Fatalf("got %+v", d)
+	}
+	if perm := p.Permutation(pe.N); perm[1].(*GraphNode).Value != "double" {
+		t.Fatalf("divergence attributed to %v", permString(perm))
+	}
+
+	// Differences which equal regards as unobservable are ignored.
+	always := func(real, reference interface{}) bool { return true }
+	if err := p.ForEachCheck(NewEquivalenceHarness(buggy, reference, always)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,159 @@
+package gsim
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+)
+
+// CountEstimate is an estimate of the number of permutations, as
+// returned by EstimateCount.
+type CountEstimate struct {
+	// Probes is the number of random descents made.
+	Probes int
+	// Mean is the estimated number of permutations.
+	Mean float64
+	// StdErr is the standard error of Mean.
+	StdErr float64
+	// Low and High bound the approximate 95% confidence interval for
+	// the number of permutations. Low is never negative.
+	Low, High float64
+}
+
+func (ce *CountEstimate) String() string {
+	return fmt.Sprintf("%.4g permutations (95%% CI %.4g to %.4g, %d probes)", ce.Mean, ce.Low, ce.High, ce.Probes)
+}
+
+// EstimateCount estimates the number of permutations, as Count would
+// return, using Knuth's random probing: each of the probes descends
+// from the root to a leaf, choosing uniformly at random at every
+// step, and the product of the numbers of options along the way is an
+// unbiased estimate of the number of leaves. A probe which is pruned
+// estimates 0. The same seed always produces the same estimate.
+//
+// Each probe costs about the same as generating one permutation, so
+// this is far faster than Count on large trees, and is useful for
+// deciding whether a run is feasible at all. The estimates of
+// individual probes are heavily skewed on unbalanced trees, so the
+// confidence interval is only approximate, and can be too narrow
+// unless there are plenty of probes: a few thousand is a reasonable
+// start. Estimates beyond the range of a float64 are infinite.
+func (p *TypedPermutations[T]) EstimateCount(probes int, seed int64) *CountEstimate {
+	ce := &CountEstimate{Probes: probes}
+	if probes <= 0 {
+		return ce
+	}
+	mean, variance := p.probe(p.root, probes, rand.New(rand.NewSource(seed)))
+	ce.set(mean, variance)
+	return ce
+}
+
+// EstimateSize estimates the number of permutations which iteration
+// of the receiver will supply: for a part returned by Split or Shard,
+// or a Permutations resumed from a Snapshot, just those of the
+// subtrees which remain, rather than of the whole tree as with
+// EstimateCount. Schedulers can thus assign parts to workers in
+// proportion to their size, rather than suffering the skew of
+// splitting by the number of subtrees alone.
+//
+// If WithStateMerging is in use and the OptionGenerator implements
+// StateKeyer (and neither WithPrune nor WithConstraint is in use), the
+// size is counted exactly, by building the DAG of states below each
+// subtree, and StdErr is 0. Otherwise the probes are divided between
+// the subtrees, each of which is estimated as by EstimateCount, and
+// the estimates are summed. The same seed always produces the same
+// estimate. As with Count, deduplication and the like are ignored.
+func (p *TypedPermutations[T]) EstimateSize(probes int, seed int64) *CountEstimate {
+	subtrees := p.resume
+	if subtrees == nil {
+		subtrees = []*node[T]{p.root}
+	}
+	ce := &CountEstimate{}
+	if _, ok := p.root.generator.(StateKeyer); ok && p.merge && !p.prefixDependent() {
+		dag := &stateDAG[T]{p: p, states: make(map[string]*dagState[T])}
+		count := new(big.Int)
+		for _, subtree := range subtrees {
+			dag.perm = dag.perm[:0]
+			if subtree.depth > 0 {
+				dag.perm = append(dag.perm, subtree.prefix[1:]...)
+			}
+			count.Add(count, dag.build(subtree.generator.Clone(), subtree.value, subtree.depth).count)
+		}
+		mean, _ := new(big.Float).SetInt(count).Float64()
+		ce.set(mean, 0)
+		return ce
+	}
+	if len(subtrees) == 0 || probes <= 0 {
+		return ce
+	}
+	rng := rand.New(rand.NewSource(seed))
+	mean, variance := 0.0, 0.0
+	for idx, subtree := range subtrees {
+		// Divide the probes as evenly as possible, giving every
+		// subtree at least one.
+		subtreeProbes := (idx+1)*probes/len(subtrees) - idx*probes/len(subtrees)
+		if subtreeProbes < 1 {
+			subtreeProbes = 1
+		}
+		ce.Probes += subtreeProbes
+		subtreeMean, subtreeVariance := p.probe(subtree, subtreeProbes, rng)
+		mean += subtreeMean
+		variance += subtreeVariance
+	}
+	ce.set(mean, variance)
+	return ce
+}
+
+// probe estimates the number of permutations in the subtree of n with
+// Knuth's random probing, returning the mean of the probes' estimates
+// and the variance of that mean.
+func (p *TypedPermutations[T]) probe(n *node[T], probes int, rng *rand.Rand) (float64, float64) {
+	// Welford's algorithm, for a numerically stable variance.
+	mean, m2 := 0.0, 0.0
+	perm := []T{}
+	base := 0
+	if n.depth > 0 {
+		perm = append(perm, n.prefix[1:]...)
+		base = len(perm)
+	}
+
+	for k := 1; k <= probes; k++ {
+		estimate := 1.0
+		perm = perm[:base]
+		gen := n.generator.Clone()
+		val := n.value
+		if n.depth > 0 {
+			perm = append(perm, val)
+		}
+		for {
+			options, ok := p.generate(gen, val, perm)
+			if !ok {
+				estimate = 0
+				break
+			}
+			optionCount := len(options)
+			if optionCount == 0 {
+				break
+			}
+			estimate *= float64(optionCount)
+			val = options[rng.Intn(optionCount)]
+			perm = append(perm, val)
+		}
+		delta := estimate - mean
+		mean += delta / float64(k)
+		m2 += delta * (estimate - mean)
+	}
+	if probes < 2 {
+		return mean, 0
+	}
+	return mean, m2 / float64(probes-1) / float64(probes)
+}
+
+// set sets the estimate from the mean and its variance.
+func (ce *CountEstimate) set(mean, variance float64) {
+	ce.Mean = mean
+	ce.StdErr = math.Sqrt(variance)
+	ce.Low = math.Max(0, mean-1.96*ce.StdErr)
+	ce.High = mean + 1.96*ce.StdErr
+}
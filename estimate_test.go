@@ -0,0 +1,49 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestEstimateCount(t *testing.T) {
+	// Every probe of a balanced tree is exact.
+	ce := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5})).EstimateCount(10, 1)
+	if ce.Probes != 10 || ce.Mean != 120 || ce.StdErr != 0 || ce.Low != 120 || ce.High != 120 {
+		t.Fatalf("got %v", ce)
+	}
+
+	p := BuildPermutations(NewGraphPermutation(egraph()...))
+	ce = p.EstimateCount(2000, 1)
+	want := float64(p.Count().Int64())
+	if ce.Low > want || ce.High < want || ce.Low < 0 || ce.StdErr <= 0 {
+		t.Fatalf("got %v, want about %v", ce, want)
+	}
+	if again := p.EstimateCount(2000, 1); *again != *ce {
+		t.Fatalf("same seed gave %v and %v", ce, again)
+	}
+}
+
+func TestEstimateSize(t *testing.T) {
+	// The size of each part of a balanced tree is estimated exactly.
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5}))
+	total := 0.0
+	for _, part := range p.Split(4) {
+		size := len(collect(part))
+		ce := part.EstimateSize(100, 1)
+		if ce.Mean != float64(size) || ce.StdErr != 0 {
+			t.Fatalf("part of %d permutations estimated as %v", size, ce)
+		}
+		total += ce.Mean
+	}
+	if total != 120 {
+		t.Fatalf("parts estimated as %v permutations, want 120", total)
+	}
+
+	// With state merging, the size is counted exactly.
+	p = BuildPermutations(NewGraphPermutation(diamonds(3)...)).WithStateMerging()
+	for _, part := range p.Split(3) {
+		size := len(collect(part))
+		if ce := part.EstimateSize(10, 1); ce.Mean != float64(size) || ce.StdErr != 0 {
+			t.Fatalf("part of %d permutations estimated as %v", size, ce)
+		}
+	}
+}
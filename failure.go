@@ -0,0 +1,74 @@
+package gsim
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// ConsumerPanic is the error recorded when a consumer (or generator)
+// panics in one of the go-routines of the parallel iteration
+// functions. It is always wrapped in a *PermutationError identifying
+// the permutation being worked on at the time.
+type ConsumerPanic struct {
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the panicking go-routine.
+	Stack []byte
+}
+
+func (cp *ConsumerPanic) Error() string {
+	return fmt.Sprintf("panic: %v\n\n%s", cp.Value, cp.Stack)
+}
+
+// recoverPermutation converts a recovered panic into a
+// *PermutationError for the permutation n. It must be called
+// directly from a deferred function.
+func recoverPermutation(r interface{}, n *big.Int) *PermutationError {
+	return &PermutationError{N: n, Err: &ConsumerPanic{Value: r, Stack: debug.Stack()}}
+}
+
+// failureCollector gathers the failures of the go-routines of a
+// parallel iteration, and signals them all to stop as soon as the
+// first failure occurs.
+type failureCollector struct {
+	lock     sync.Mutex
+	failures []error
+	stopped  int32
+	stop     chan struct{}
+}
+
+func newFailureCollector() *failureCollector {
+	return &failureCollector{stop: make(chan struct{})}
+}
+
+func (fc *failureCollector) fail(pe *PermutationError) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	fc.failures = append(fc.failures, pe)
+	if atomic.CompareAndSwapInt32(&fc.stopped, 0, 1) {
+		close(fc.stop)
+	}
+}
+
+func (fc *failureCollector) isStopped() bool {
+	return atomic.LoadInt32(&fc.stopped) != 0
+}
+
+// err returns nil if there were no failures, the *PermutationError if
+// there was exactly one, and otherwise all of them joined together.
+func (fc *failureCollector) err() error {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	switch len(fc.failures) {
+	case 0:
+		return nil
+	case 1:
+		return fc.failures[0]
+	default:
+		return errors.Join(fc.failures...)
+	}
+}
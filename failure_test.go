@@ -0,0 +1,44 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestParallelPanicsAreReturned(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5, 6})).WithWorkers(4)
+	boom := consumerFunc(func(n *big.Int, perm []interface{}) {
+		if perm[0] == 3 {
+			panic("boom")
+		}
+	})
+	for name, run := range map[string]func() error{
+		"ForEachPar":    func() error { return p.ForEachPar(8, boom) },
+		"ForEachParGen": func() error { return p.ForEachParGen(boom) },
+	} {
+		err := run()
+		var pe *PermutationError
+		var cp *ConsumerPanic
+		if !errors.As(err, &pe) || !errors.As(err, &cp) {
+			t.Fatalf("%s: got %v, want a PermutationError wrapping a ConsumerPanic", name, err)
+		}
+		if cp.Value != "boom" || len(cp.Stack) == 0 {
+			t.Fatalf("%s: got panic %v with %d bytes of stack", name, cp.Value, len(cp.Stack))
+		}
+		if pe.N != nil && p.Permutation(pe.N)[0] != 3 {
+			t.Fatalf("%s: panic attributed to %v", name, p.Permutation(pe.N))
+		}
+	}
+}
+
+func TestForEachParMatchesForEach(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(diamonds(4)...)).WithWorkers(3)
+	want := newCollector()
+	p.ForEach(want)
+	got := newCollector()
+	if err := p.ForEachPar(3, got); err != nil {
+		t.Fatal(err)
+	}
+	checkPerms(t, got.sorted(), want.sorted())
+}
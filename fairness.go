@@ -0,0 +1,99 @@
+package gsim
+
+// fairGenerator is the OptionGenerator returned by Fair.
+type fairGenerator[T any] struct {
+	gen          TypedOptionGenerator[T]
+	bound        int
+	weak, strong []T
+	// weakCount holds, for each of weak, the number of consecutive
+	// steps for which it has been available but not chosen.
+	weakCount []int
+	// strongCount holds, for each of strong, the number of steps
+	// (not necessarily consecutive) for which it has been available
+	// but not chosen, since it was last chosen.
+	strongCount []int
+	available   []T
+}
+
+// Fair returns an OptionGenerator which only generates the
+// permutations of gen which are fair to the given options, so that
+// liveness-style checks are not drowned in unfair schedules which no
+// real scheduler would produce. Permutations are finite, so fairness
+// is bounded:
+//
+//   - weak fairness: an option in weak may not remain continuously
+//     available for more than bound steps without being chosen;
+//   - strong fairness: an option in strong may not be available in
+//     more than bound steps, consecutive or not, without being chosen.
+//
+// Whenever an option is due (it has been passed over bound times),
+// only the options which are due are offered, so the unfair
+// continuations are never explored. A bound of 0 requires the options
+// to be chosen as soon as they are available. Options are compared
+// with ==.
+func Fair[T any](gen TypedOptionGenerator[T], bound int, weak, strong []T) TypedOptionGenerator[T] {
+	return &fairGenerator[T]{
+		gen:         gen,
+		bound:       bound,
+		weak:        weak,
+		strong:      strong,
+		weakCount:   make([]int, len(weak)),
+		strongCount: make([]int, len(strong)),
+	}
+}
+
+func (fg *fairGenerator[T]) Clone() TypedOptionGenerator[T] {
+	return &fairGenerator[T]{
+		gen:         fg.gen.Clone(),
+		bound:       fg.bound,
+		weak:        fg.weak,
+		strong:      fg.strong,
+		weakCount:   append([]int(nil), fg.weakCount...),
+		strongCount: append([]int(nil), fg.strongCount...),
+		available:   fg.available,
+	}
+}
+
+func (fg *fairGenerator[T]) Generate(lastChosen T) []T {
+	if fg.available != nil {
+		fg.count(fg.weak, fg.weakCount, lastChosen, true)
+		fg.count(fg.strong, fg.strongCount, lastChosen, false)
+	}
+	options := fg.gen.Generate(lastChosen)
+	fg.available = Retain(options)
+
+	var due []T
+	for _, option := range options {
+		if fg.isDue(fg.weak, fg.weakCount, option) || fg.isDue(fg.strong, fg.strongCount, option) {
+			due = append(due, option)
+		}
+	}
+	if due != nil {
+		return due
+	}
+	return options
+}
+
+// count updates the counters of the designated options for the step
+// which has just chosen lastChosen.
+func (fg *fairGenerator[T]) count(designated []T, counts []int, lastChosen T, weak bool) {
+	for idx, option := range designated {
+		switch {
+		case interface{}(option) == interface{}(lastChosen):
+			counts[idx] = 0
+		case containsOption(fg.available, option):
+			counts[idx]++
+		case weak:
+			counts[idx] = 0
+		}
+	}
+}
+
+func (fg *fairGenerator[T]) isDue(designated []T, counts []int, option T) bool {
+	for idx, d := range designated {
+		if interface{}(d) == interface{}(option) {
+			return counts[idx] >= fg.bound
+		}
+	}
+	return false
+}
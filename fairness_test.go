@@ -0,0 +1,30 @@
+package gsim
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFair(t *testing.T) {
+	elems := []interface{}{"a", "b", "c", "d"}
+	for _, test := range []struct {
+		bound        int
+		weak, strong []interface{}
+		want         int
+	}{
+		{0, []interface{}{"d"}, nil, 6},
+		{1, []interface{}{"d"}, nil, 12},
+		{1, nil, []interface{}{"d"}, 12},
+		{3, []interface{}{"d"}, nil, 24},
+	} {
+		perms := collect(BuildPermutations(Fair(NewSimplePermutation(elems), test.bound, test.weak, test.strong)))
+		if len(perms) != test.want {
+			t.Fatalf("bound %d: got %d permutations, want %d", test.bound, len(perms), test.want)
+		}
+		for _, perm := range perms {
+			if pos := strings.Index(perm, "d") / 2; pos > test.bound {
+				t.Fatalf("bound %d: %q passes over d %d times", test.bound, perm, pos)
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package gsim
+
+import (
+	"encoding/binary"
+	"math/big"
+)
+
+// FindContaining searches for a permutation in which the elements of
+// sub all appear, in the same relative order, though not necessarily
+// adjacently. If there is one, its number and the permutation itself
+// are returned, along with true. Otherwise, false is returned, which
+// proves that the order is not permitted at all. Elements are compared
+// with ==, so they must be comparable.
+//
+// The search abandons each subtree as soon as the remaining elements
+// of sub can no longer be found within it. Furthermore, when the
+// OptionGenerator implements StateKeyer (as graph OptionGenerators
+// do) and neither WithPrune nor WithConstraint is used, every state
+// from which the remainder of sub has been shown not to be found is
+// remembered, and never explored again, so proving that no
+// permutation exists is often far cheaper than iterating through
+// every permutation.
+func (p *TypedPermutations[T]) FindContaining(sub []T) (*big.Int, []T, bool) {
+	return p.FindContainingMatching(sub, func(elem, option T) bool {
+		return interface{}(elem) == interface{}(option)
+	})
+}
+
+// FindContainingMatching is the same as FindContaining, except that
+// match is used to decide whether an element of sub corresponds to an
+// option generated, as with NumberMatching.
+func (p *TypedPermutations[T]) FindContainingMatching(sub []T, match func(elem, option T) bool) (*big.Int, []T, bool) {
+	fs := &subsequenceSearch[T]{p: p, sub: sub, match: match}
+	if _, ok := p.root.generator.(StateKeyer); ok && !p.prefixDependent() {
+		fs.failed = make(map[string]bool)
+	}
+	if !fs.search(p.root.generator.Clone(), p.root.value, 0) {
+		return nil, nil, false
+	}
+	n := new(big.Int)
+	cumuOpts := big.NewInt(1)
+	choiceBig := new(big.Int)
+	for depth, choice := range fs.choices {
+		choiceBig.SetInt64(int64(choice))
+		n.Add(n, choiceBig.Mul(choiceBig, cumuOpts))
+		cumuOpts.Mul(cumuOpts, big.NewInt(int64(fs.optionCounts[depth])))
+	}
+	return n, append([]T(nil), fs.perm...), true
+}
+
+type subsequenceSearch[T any] struct {
+	p     *TypedPermutations[T]
+	sub   []T
+	match func(elem, option T) bool
+	// perm, choices and optionCounts describe the current prefix: its
+	// elements, the index of each among the options, and the number
+	// of those options.
+	perm         []T
+	choices      []int
+	optionCounts []int
+	// failed, if non-nil, holds the keys of the states (with the
+	// number of elements of sub found) from which no permutation
+	// containing the rest of sub can be reached.
+	failed map[string]bool
+}
+
+// search reports whether a permutation containing the remainder of
+// sub, of which found elements have already been found, follows the
+// node with the given value at the given depth, leaving the first
+// such permutation in fs.perm. gen is consumed.
+func (fs *subsequenceSearch[T]) search(gen TypedOptionGenerator[T], value T, found int) bool {
+	depth := len(fs.perm)
+	options, ok := fs.p.generate(gen, value, fs.perm)
+	if !ok {
+		return false
+	}
+	if len(options) == 0 {
+		return found == len(fs.sub)
+	}
+	var key string
+	if fs.failed != nil {
+		keyBytes := binary.AppendUvarint(gen.(StateKeyer).StateKey(), uint64(found))
+		if fs.p.maxDepth > 0 {
+			// The depth limits the options too.
+			keyBytes = binary.AppendUvarint(keyBytes, uint64(depth))
+		}
+		key = string(keyBytes)
+		if fs.failed[key] {
+			return false
+		}
+	}
+
+	// The generator may reuse the options slice once consumed, and is
+	// consumed by the last option.
+	options = Retain(options)
+	for idx, option := range options {
+		childGen := gen
+		if idx < len(options)-1 {
+			childGen = gen.Clone()
+		}
+		childFound := found
+		if found < len(fs.sub) && fs.match(fs.sub[found], option) {
+			childFound++
+		}
+		fs.perm = append(fs.perm, option)
+		fs.choices = append(fs.choices, idx)
+		fs.optionCounts = append(fs.optionCounts, len(options))
+		if fs.search(childGen, option, childFound) {
+			return true
+		}
+		fs.perm = fs.perm[:depth]
+		fs.choices = fs.choices[:depth]
+		fs.optionCounts = fs.optionCounts[:depth]
+	}
+	if fs.failed != nil {
+		fs.failed[key] = true
+	}
+	return false
+}
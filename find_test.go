@@ -0,0 +1,36 @@
+package gsim
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindContaining(t *testing.T) {
+	start := egraph()
+	p := BuildPermutations(NewGraphPermutation(start...))
+	e := reachableGraphNodes(start...)
+	byValue := make(map[string]*GraphNode)
+	for _, gn := range e {
+		byValue[gn.Value.(string)] = gn
+	}
+
+	n, perm, found := p.FindContaining([]interface{}{byValue["E2"], byValue["E4"], byValue["E3"]})
+	if !found || permString(p.Permutation(n)) != permString(perm) {
+		t.Fatalf("got %v %q, %v", n, permString(perm), found)
+	}
+	if s := permString(perm); !(strings.Index(s, "E2") < strings.Index(s, "E4") && strings.Index(s, "E4") < strings.Index(s, "E3")) {
+		t.Fatalf("%q does not contain E2 E4 E3", s)
+	}
+
+	// E4 is inhibited once E3 has been chosen.
+	if n, perm, found := p.FindContaining([]interface{}{byValue["E3"], byValue["E4"]}); found {
+		t.Fatalf("found %v %q", n, permString(perm))
+	}
+
+	_, perm, found = p.FindContainingMatching([]interface{}{"E3"}, func(elem, option interface{}) bool {
+		return elem == option.(*GraphNode).Value
+	})
+	if !found || !strings.Contains(permString(perm), "E3") {
+		t.Fatalf("got %q, %v", permString(perm), found)
+	}
+}
@@ -0,0 +1,93 @@
+package gsim
+
+import (
+	"math/big"
+)
+
+// expand generates the children of cur, leaving cur itself untouched
+// so that it can still be walked. Every child has its own clone of
+// the generator, so the children may be explored in any order, and
+// concurrently. If cur is a leaf then no children are returned; if
+// cur's subtree is pruned then false is returned.
+func (p *TypedPermutations[T]) expand(cur *node[T]) ([]*node[T], bool) {
+	prefix := make([]T, 0, cur.depth+1)
+	if cur.prefix != nil {
+		prefix = append(prefix, cur.prefix...)
+	} else if cur.depth != 0 {
+		panic("expand requires the prefix of every node below the root")
+	}
+	prefix = append(prefix, cur.value)
+
+	gen := cur.generator.Clone()
+	options, ok := p.generate(gen, cur.value, prefix[1:])
+	if !ok || len(options) == 0 {
+		return nil, ok
+	}
+	optionCount := len(options)
+	cumuOpts := new(big.Int).Mul(cur.cumuOpts, big.NewInt(int64(optionCount)))
+	weight := cur.weight / float64(optionCount)
+	children := make([]*node[T], optionCount)
+	for idx, option := range options {
+		childN := cur.n
+		if optionCount > 1 {
+			childN = big.NewInt(int64(idx))
+			childN.Mul(childN, cur.cumuOpts)
+			childN.Add(childN, cur.n)
+		}
+		children[idx] = &node[T]{
+			n:         childN,
+			depth:     cur.depth + 1,
+			value:     option,
+			generator: gen.Clone(),
+			cumuOpts:  cumuOpts,
+			weight:    weight,
+			prefix:    prefix,
+		}
+	}
+	return children, true
+}
+
+// frontier splits the work of the receiver (the whole tree, or the
+// nodes being resumed) into at least k disjoint subtrees if
+// possible, by repeatedly expanding the shallowest nodes. The
+// subtrees are returned in tree order; between them, they contain
+// every permutation exactly once. Each has its own generator and
+// prefix, so they can be walked independently.
+func (p *TypedPermutations[T]) frontier(k int) []*node[T] {
+	var nodes []*node[T]
+	if p.resume == nil {
+		nodes = []*node[T]{p.root.clone()}
+	} else {
+		nodes = make([]*node[T], len(p.resume))
+		for idx, resumed := range p.resume {
+			nodes[idx] = resumed.clone()
+		}
+	}
+	leaf := make(map[*node[T]]bool)
+	for len(nodes) < k {
+		next := make([]*node[T], 0, 2*len(nodes))
+		grew := false
+		for idx, cur := range nodes {
+			if leaf[cur] || len(next)+len(nodes)-idx >= k {
+				next = append(next, cur)
+				continue
+			}
+			children, ok := p.expand(cur)
+			switch {
+			case !ok:
+				grew = true // dropping a pruned subtree is progress too
+			case len(children) == 0:
+				leaf[cur] = true
+				next = append(next, cur)
+			default:
+				grew = true
+				next = append(next, children...)
+			}
+		}
+		nodes = next
+		if !grew {
+			break
+		}
+	}
+	return nodes
+}
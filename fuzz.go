@@ -0,0 +1,36 @@
+package gsim
+
+import "math/big"
+
+// DecodePermutation deterministically maps data to a permutation,
+// returning the permutation and its number. Bytes are consumed to
+// pick amongst the options at each step with more than one: as many
+// bytes as it takes to cover the number of options (so one byte for
+// up to 256), read big-endian and taken modulo the number of options.
+// Once data runs out the first option is always taken, so every
+// input, including the empty one, gives a permutation. This lets go
+// test's fuzzing, and external fuzzers, explore schedules, with the
+// corpus doubling as a regression suite:
+//
+//	func FuzzProtocol(f *testing.F) {
+//		p := gsim.BuildPermutations(gsim.NewGraphPermutation(start...))
+//		f.Fuzz(func(t *testing.T, data []byte) {
+//			n, perm := p.DecodePermutation(data)
+//			if err := interpret(perm); err != nil {
+//				t.Fatalf("permutation %v: %v", n, err)
+//			}
+//		})
+//	}
+//
+// If the permutation is cut short by WithPrune, DecodePermutation
+// returns nil, nil.
+func (p *TypedPermutations[T]) DecodePermutation(data []byte) (*big.Int, []T) {
+	return p.DrawPermutation(func(k int) int {
+		choice := 0
+		for width := 1; width < k && len(data) > 0; width <<= 8 {
+			choice = choice<<8 | int(data[0])
+			data = data[1:]
+		}
+		return choice % k
+	})
+}
@@ -0,0 +1,38 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestDecodePermutation(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(egraph()...))
+	if n, perm := p.DecodePermutation(nil); n.Sign() != 0 || permString(perm) != permString(p.Permutation(n)) {
+		t.Fatalf("decoded %v %q from nothing", n, permString(perm))
+	}
+	seen := make(map[string]bool)
+	for _, data := range [][]byte{{0}, {1}, {2}, {1, 1}, {2, 1}, {255, 255, 255}} {
+		n, perm := p.DecodePermutation(data)
+		if permString(perm) != permString(p.Permutation(n)) {
+			t.Fatalf("decoded %v %q from %v", n, permString(perm), data)
+		}
+		if n2, _ := p.DecodePermutation(data); n2.Cmp(n) != 0 {
+			t.Fatalf("decoded %v and then %v from %v", n, n2, data)
+		}
+		seen[n.String()] = true
+	}
+	if len(seen) < 3 {
+		t.Fatalf("decoded only %d permutations", len(seen))
+	}
+}
+
+func FuzzDecodePermutation(f *testing.F) {
+	p := BuildPermutations(NewGraphPermutation(diamonds(3)...))
+	f.Add([]byte{})
+	f.Add([]byte{1, 0, 1})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		n, perm := p.DecodePermutation(data)
+		if permString(perm) != permString(p.Permutation(n)) {
+			t.Fatalf("decoded %v %q", n, permString(perm))
+		}
+	})
+}
@@ -1 +1,4 @@
 module "github.com/msackman/gsim"
+
+// log/slog and the clear builtin need Go 1.21.
+go 1.21
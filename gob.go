@@ -0,0 +1,103 @@
+package gsim
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+// GraphNodes is a list of GraphNodes, typically the starting nodes of
+// a graph, which can be encoded with encoding/gob. The whole graph
+// reachable from the nodes is encoded, as by WriteGraphJSON, so
+// decoding reconstructs it with every edge and callback referring to
+// the right nodes, and with the same permutation numbers. Values are
+// encoded by gob as interface{}s, so their types must be registered
+// with gob.Register (other than the basic types, which gob registers
+// itself). Together with a Snapshot, which is already just bytes, this
+// lets an iteration be persisted, or moved to another process, and
+// then resumed with ResumePermutations:
+//
+//	start := gsim.GraphNodes(b.Build())
+//	...
+//	enc.Encode(start)
+//	enc.Encode(snapshot)
+//	...
+//	var start gsim.GraphNodes
+//	var snapshot []byte
+//	dec.Decode(&start)
+//	dec.Decode(&snapshot)
+//	p, err := gsim.ResumePermutations(snapshot, gsim.NewGraphPermutation(start...))
+type GraphNodes []*GraphNode
+
+func (gns GraphNodes) GobEncode() ([]byte, error) {
+	graph, err := encodeGraph(gns...)
+	if err != nil {
+		return nil, err
+	}
+	return gobEncode(graph)
+}
+
+func (gns *GraphNodes) GobDecode(data []byte) error {
+	graph := &jsonGraph{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(graph); err != nil {
+		return err
+	}
+	nodes, err := decodeGraph(graph)
+	if err != nil {
+		return err
+	}
+	*gns = nodes
+	return nil
+}
+
+func gobEncode(e interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(e); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gobGraph is the form in which a Graph is encoded: every registered
+// node is a starting node of the encoded graph, in order of
+// registration.
+type gobGraph struct {
+	Graph *jsonGraph
+	Names []string
+}
+
+// GobEncode encodes the Graph, with all of its nodes and their names,
+// as GraphNodes.GobEncode.
+func (g *Graph) GobEncode() ([]byte, error) {
+	graph, err := encodeGraph(g.nodes...)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(g.nodes))
+	for idx, gn := range g.nodes {
+		names[idx] = g.index[gn]
+	}
+	return gobEncode(&gobGraph{Graph: graph, Names: names})
+}
+
+func (g *Graph) GobDecode(data []byte) error {
+	gg := &gobGraph{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(gg); err != nil {
+		return err
+	} else if gg.Graph == nil {
+		return fmt.Errorf("graph missing")
+	}
+	nodes, err := decodeGraph(gg.Graph)
+	if err != nil {
+		return err
+	} else if len(nodes) != len(gg.Names) {
+		return fmt.Errorf("graph has %d nodes but %d names", len(nodes), len(gg.Names))
+	}
+	*g = *NewGraph()
+	for idx, gn := range nodes {
+		g.nodes = append(g.nodes, gn)
+		g.names[gg.Names[idx]] = gn
+		g.index[gn] = gg.Names[idx]
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package gsim
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+)
+
+func TestGraphNodesGob(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(GraphNodes(egraph())); err != nil {
+		t.Fatal(err)
+	}
+	var start GraphNodes
+	if err := gob.NewDecoder(&buf).Decode(&start); err != nil {
+		t.Fatal(err)
+	}
+	want := newCollector()
+	BuildPermutations(NewGraphPermutation(egraph()...)).ForEach(want)
+	got := newCollector()
+	BuildPermutations(NewGraphPermutation(start...)).ForEach(got)
+	checkPerms(t, *got.perms, *want.perms)
+	for idx, n := range *got.nums {
+		if n.Cmp((*want.nums)[idx]) != 0 {
+			t.Fatalf("%q numbered %v, want %v", (*got.perms)[idx], n, (*want.nums)[idx])
+		}
+	}
+}
+
+func TestGraphGob(t *testing.T) {
+	g := NewGraph()
+	for _, name := range []string{"start", "left", "right"} {
+		if _, err := g.AddNode(name, name+"!"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.AddEdge("start", "left")
+	g.AddEdge("start", "right")
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(g); err != nil {
+		t.Fatal(err)
+	}
+	g2 := &Graph{}
+	if err := gob.NewDecoder(&buf).Decode(g2); err != nil {
+		t.Fatal(err)
+	}
+	left, found := g2.GetNode("left")
+	if !found || left.Value != "left!" || len(g2.Nodes()) != 3 {
+		t.Fatalf("decoded %v", g2.Nodes())
+	}
+	checkPerms(t, collectSorted(BuildPermutations(g2.NewGraphPermutation())), collectSorted(BuildPermutations(g.NewGraphPermutation())))
+}
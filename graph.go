@@ -13,9 +13,9 @@ import (
 // value you supplied through the Value field.
 //
 // Each generated permutation will contain each node no more than
-// once. Cycles in the graph are eliminated. Edges between nodes can
-// make the target node eligible for selection in the permutation, or
-// excluded from selection.
+// once, unless SetMaxVisits has been used. Cycles in the graph are
+// eliminated. Edges between nodes can make the target node eligible
+// for selection in the permutation, or excluded from selection.
 //
 // When generating the graph programmatically, you must also ensure
 // even your generation of the graph is deterministic - i.e. the order
@@ -36,6 +36,52 @@ type GraphNode struct {
 	// the node becomes eligible for selection in the permutation, and
 	// when it is excluded from selection.
 	Callback GraphNodeCallback
+	// symmetryPred is the previous node in this node's symmetry
+	// group. See DeclareSymmetric.
+	symmetryPred *GraphNode
+	// maxVisits is the number of times the node may appear in a
+	// permutation. Zero means once. See SetMaxVisits.
+	maxVisits int
+	// priority is used by GraphPriorityOrder. See SetPriority.
+	priority int
+	// inDelays holds the minimum logical delays of incoming edges
+	// added with AddTimedEdgeTo.
+	inDelays map[*GraphNode]int64
+	// deadline is the maximum logical delay, if hasDeadline. See
+	// SetDeadline.
+	deadline    int64
+	hasDeadline bool
+	// atomic is the atomic block the node belongs to, if any, and
+	// atomicIdx its position within it. See DeclareAtomic.
+	atomic    *AtomicBlock
+	atomicIdx int
+	// outGuards holds the guards of outgoing edges added with
+	// AddGuardedEdgeTo.
+	outGuards map[*GraphNode]EdgeGuard
+	// onVisit is called whenever the node is chosen. See OnVisit.
+	onVisit VisitHook
+	// section is the critical section the node is in, if any. See
+	// Mutex.
+	section *criticalSection
+	// acquires and releases are the Semaphores whose tokens the node
+	// takes and returns. See Semaphore.
+	acquires []*Semaphore
+	releases []*Semaphore
+	// kills holds the nodes which are inhibited when the node is
+	// chosen. See DeclareCrash.
+	kills []*GraphNode
+	// weight is used by GraphNodeWeight, if hasWeight. See SetWeight.
+	weight    float64
+	hasWeight bool
+	// observers are called whenever the node is chosen. See
+	// AddObserver.
+	observers []VisitObserver
+	// mandatory is set if every permutation should visit the node. See
+	// SetMandatory.
+	mandatory bool
+	// id is one more than the node's id, or zero if the node has not
+	// been compiled. It is accessed atomically. See ID.
+	id int64
 }
 
 type GraphNodeCallback interface {
@@ -158,11 +204,15 @@ func (cc *CombinationCallback) IncomingEdgesReached(node *GraphNode, reached []*
 // semantics are that if any callback returns Inhibit, then the result
 // is Inhibit. If no callback returns Inhibit, and at least one
 // callback returns MakeAvailable then the result in
-// MakeAvailable. Otherwise the result is NoChange.
+// MakeAvailable, unless any callback returns Release, in which case
+// the result is Release. Otherwise the result is NoChange.
 func InhibitThenAvailableCombiner(node *GraphNode, reached []*GraphNode, acc GraphNodeStateChange, curCallback GraphNodeCallback, callbackResult GraphNodeStateChange) (newAcc GraphNodeStateChange, stop bool) {
 	if callbackResult == Inhibit {
 		return Inhibit, true
 	}
+	if acc == Release || callbackResult == Release {
+		return Release, false
+	}
 	if acc == MakeAvailable || callbackResult == MakeAvailable {
 		return MakeAvailable, false
 	}
@@ -225,17 +275,42 @@ func containsGraphNode(gns []*GraphNode, gn *GraphNode) bool {
 }
 
 type graphPermutation struct {
-	parent    *graphPermutation
-	current   []interface{}
-	nodeState map[interface{}]*graphNodeState
+	graph   *graphInfo
+	current []interface{}
+	// nodeState is indexed by node id (see graphInfo), and holds nil
+	// for nodes which have not yet been reached. It is empty until
+	// the generator is first used, so that edges may still be added
+	// after NewGraphPermutation.
+	nodeState nodeStates
+	// clock is the logical time of the most recently chosen node.
+	clock int64
+	// atomicNext is the next node of the atomic block in progress, if
+	// any. See DeclareAtomic.
+	atomicNext *GraphNode
+	// spawned holds the nodes which are not reachable from the
+	// starting nodes, and so have no id in the graphInfo: those
+	// created by VisitHooks (see OnVisit), and those reached only
+	// from them. They are given ids following the graphInfo's, in the
+	// order they were found.
+	spawned []*GraphNode
+	// history holds the nodes chosen so far, for HistoryCallbacks.
+	history *historyEntry
 }
 
 type graphNodeState struct {
 	*GraphNode
+	id              int
 	permutation     *graphPermutation
 	inhibited       bool
 	available       bool
 	incomingVisited []*GraphNode
+	// blocked is set if the node was inhibited by a callback which may
+	// yet release it. See ReleasingCallback.
+	blocked bool
+	visits  int
+	// time is the logical time at which the node is ready, while it
+	// is available, and at which it was last chosen thereafter.
+	time int64
 }
 
 func (gns *graphNodeState) Clone(gp *graphPermutation) *graphNodeState {
@@ -244,13 +319,17 @@ func (gns *graphNodeState) Clone(gp *graphPermutation) *graphNodeState {
 	}
 	gns2 := &graphNodeState{
 		GraphNode:       gns.GraphNode,
+		id:              gns.id,
 		permutation:     gp,
 		inhibited:       gns.inhibited,
 		available:       gns.available,
 		incomingVisited: make([]*GraphNode, len(gns.incomingVisited)),
+		blocked:         gns.blocked,
+		visits:          gns.visits,
+		time:            gns.time,
 	}
 	copy(gns2.incomingVisited, gns.incomingVisited)
-	gp.nodeState[gns2.GraphNode] = gns2
+	gp.nodeState.set(gp, gns2.id, gns2)
 	return gns2
 }
 
@@ -260,119 +339,271 @@ func (gns *graphNodeState) Clone(gp *graphPermutation) *graphNodeState {
 // any combination.
 func NewGraphPermutation(startingNode ...*GraphNode) OptionGenerator {
 	current := make([]interface{}, len(startingNode))
-	nodeState := make(map[interface{}]*graphNodeState, len(startingNode))
-	gp := &graphPermutation{
-		current:   current,
-		nodeState: nodeState,
-	}
 	for idx, gn := range startingNode {
 		current[idx] = gn
-		nodeState[gn] = &graphNodeState{
+	}
+	return &graphPermutation{
+		graph:   newGraphInfo(startingNode),
+		current: current,
+	}
+}
+
+// init builds the graph, and the state of the starting nodes, if that
+// has not yet been done.
+func (gp *graphPermutation) init() {
+	if gp.nodeState.root != nil {
+		return
+	}
+	gp.graph.build()
+	gp.nodeState = newNodeStates(gp, len(gp.graph.nodes))
+	for _, node := range gp.current {
+		gn := node.(*GraphNode)
+		id := gp.graph.index[gn]
+		gp.nodeState.set(gp, id, &graphNodeState{
 			GraphNode:       gn,
+			id:              id,
 			permutation:     gp,
 			inhibited:       false,
 			available:       true,
 			incomingVisited: make([]*GraphNode, 0, len(gn.In)),
-		}
+		})
 	}
-	return gp
 }
 
+// Clone does not initialise the receiver, so that the original
+// generator, which is shared, is never modified. The node states are
+// shared with the receiver until either modifies them.
 func (gp *graphPermutation) Clone() OptionGenerator {
 	current := make([]interface{}, len(gp.current))
 	copy(current, gp.current)
 	return &graphPermutation{
-		parent:    gp,
-		current:   current,
-		nodeState: make(map[interface{}]*graphNodeState, len(gp.nodeState)),
-	}
-}
-
-func (gp *graphPermutation) getNodeState(node interface{}, cloneToLocal bool) (*graphNodeState, bool) {
-	if gns, found := gp.nodeState[node]; found {
-		return gns.Clone(gp), found
-	} else if gp.parent == nil {
-		return nil, found
-	} else if gns, found = gp.parent.getNodeState(node, false); found && cloneToLocal {
-		return gns.Clone(gp), found
-	} else if found {
-		gp.nodeState[node] = gns
-		return gns, found
-	} else {
+		graph:      gp.graph,
+		current:    current,
+		nodeState:  gp.nodeState,
+		clock:      gp.clock,
+		atomicNext: gp.atomicNext,
+		spawned:    gp.spawned[:len(gp.spawned):len(gp.spawned)],
+		history:    gp.history,
+	}
+}
+
+// id returns the id of the node. Nodes not reachable from the
+// starting nodes are added to gp.spawned if add is true; otherwise
+// -1 is returned for them.
+func (gp *graphPermutation) id(gn *GraphNode, add bool) int {
+	gp.init()
+	if id, found := gp.graph.index[gn]; found {
+		return id
+	}
+	for idx, spawned := range gp.spawned {
+		if spawned == gn {
+			return len(gp.graph.nodes) + idx
+		}
+	}
+	if !add {
+		return -1
+	}
+	gp.spawned = append(gp.spawned, gn)
+	return gp.nodeState.grow(gp)
+}
+
+// node returns the node with the given id.
+func (gp *graphPermutation) node(id int) *GraphNode {
+	if id < len(gp.graph.nodes) {
+		return gp.graph.nodes[id]
+	}
+	return gp.spawned[id-len(gp.graph.nodes)]
+}
+
+// out returns the ids of the targets of the outgoing edges of the
+// node with the given id.
+func (gp *graphPermutation) out(id int) []int {
+	if id < len(gp.graph.nodes) {
+		return gp.graph.out[id]
+	}
+	gn := gp.node(id)
+	out := make([]int, len(gn.Out))
+	for idx, gn2 := range gn.Out {
+		out[idx] = gp.id(gn2, true)
+	}
+	return out
+}
+
+// getNodeState returns the state of the node, if it has been reached.
+// If cloneToLocal is true, the state is first copied into the
+// receiver if it belongs to another generator, so that it can be
+// modified.
+func (gp *graphPermutation) getNodeState(gn *GraphNode, cloneToLocal bool) (*graphNodeState, bool) {
+	id := gp.id(gn, false)
+	if id == -1 {
 		return nil, false
 	}
+	return gp.stateAt(id, cloneToLocal)
+}
+
+// stateAt is getNodeState for a node id.
+func (gp *graphPermutation) stateAt(id int, cloneToLocal bool) (*graphNodeState, bool) {
+	gns := gp.nodeState.get(id)
+	if gns == nil {
+		return nil, false
+	} else if cloneToLocal {
+		gns = gns.Clone(gp)
+	}
+	return gns, true
 }
 
 func (gp *graphPermutation) Generate(lastChosen interface{}) []interface{} {
 	if lastChosen != nil {
-		lastChosenState, _ := gp.getNodeState(lastChosen, true)
-		lastChosenState.inhibited = true
-		for idx, node := range gp.current {
-			if node == lastChosen {
-				gp.current = append(gp.current[:idx], gp.current[idx+1:]...)
-				break
-			}
+		if gn := lastChosen.(*GraphNode); gn.atomic != nil && gn == gn.atomic.composite {
+			gp.visitAtomic(gn.atomic)
+		} else {
+			gp.visit(gn)
+			gp.atomicNext = gn.atomicNext()
 		}
+	}
+	return gp.options()
+}
 
-		for _, gn := range lastChosenState.Out {
-			nodeState, found := gp.getNodeState(gn, false)
+// visit updates the state after lastChosen has been chosen.
+func (gp *graphPermutation) visit(lastChosen *GraphNode) {
+	lastChosenState, _ := gp.stateAt(gp.id(lastChosen, true), true)
+	gp.recordVisit(lastChosen)
+	if lastChosen.observers != nil {
+		gp.observe(lastChosen)
+	}
+	lastChosenState.visits++
+	gp.tick(lastChosenState)
+	rearm := lastChosenState.visits < gp.maxVisits(lastChosenState.GraphNode)
+	lastChosenState.inhibited = !rearm
+	for idx, node := range gp.current {
+		if node == lastChosen {
+			gp.current = append(gp.current[:idx], gp.current[idx+1:]...)
+			break
+		}
+	}
+	if rearm {
+		gp.rearm(lastChosenState)
+	}
 
-			dirty := false
-			switch {
-			case found && nodeState.inhibited:
-				continue
+	for _, id := range gp.out(lastChosenState.id) {
+		gn := gp.node(id)
+		if !gp.traversable(lastChosen, gn) {
+			continue
+		}
+		nodeState, found := gp.stateAt(id, false)
 
-			case found:
-				found = false
-				for _, node := range nodeState.incomingVisited {
-					if found = node == lastChosenState.GraphNode; found {
-						break
-					}
-				}
-				if !found {
-					dirty = true
-					nodeState = nodeState.Clone(gp)
-					nodeState.incomingVisited = append(nodeState.incomingVisited, lastChosenState.GraphNode)
-				}
+		dirty := false
+		switch {
+		case found && nodeState.inhibited && !nodeState.blocked:
+			continue
 
-			default:
-				dirty = true
-				nodeState = &graphNodeState{
-					GraphNode:       gn,
-					permutation:     gp,
-					inhibited:       false,
-					available:       false,
-					incomingVisited: make([]*GraphNode, 1, len(gn.In)),
+		case found:
+			found = false
+			for _, node := range nodeState.incomingVisited {
+				if found = node == lastChosenState.GraphNode; found {
+					break
 				}
-				nodeState.incomingVisited[0] = lastChosenState.GraphNode
-				gp.nodeState[gn] = nodeState
 			}
+			if !found {
+				dirty = true
+				nodeState = nodeState.Clone(gp)
+				nodeState.incomingVisited = append(nodeState.incomingVisited, lastChosenState.GraphNode)
+			}
+
+		default:
+			dirty = true
+			nodeState = &graphNodeState{
+				GraphNode:   gn,
+				id:          id,
+				permutation: gp,
+				inhibited:   false,
+				available:   false,
+				// Edges from spawned nodes are not in gn.In.
+				incomingVisited: append(make([]*GraphNode, 0, len(gn.In)+1), lastChosenState.GraphNode),
+			}
+			gp.nodeState.set(gp, id, nodeState)
+		}
+
+		if !dirty {
+			continue
+		}
 
-			if !dirty {
+		result := gp.consult(nodeState)
+		if nodeState.blocked {
+			if result != Release {
 				continue
 			}
+			nodeState.inhibited = false
+			nodeState.blocked = false
+		}
+		gp.applyStateChange(nodeState, result)
+	}
+	for _, gn := range lastChosen.kills {
+		gp.kill(gn)
+	}
+	if lastChosen.onVisit != nil {
+		gp.spawn(lastChosen)
+	}
+}
 
-			switch nodeState.Callback.IncomingEdgesReached(nodeState.GraphNode, nodeState.incomingVisited) {
-			case Inhibit:
-				if nodeState.available {
-					nodeState.available = false
-					for idx, node := range gp.current {
-						if node == nodeState.GraphNode {
-							gp.current = append(gp.current[:idx], gp.current[idx+1:]...)
-							break
-						}
-					}
-				}
-				nodeState.inhibited = true
-			case MakeAvailable:
-				if !nodeState.available {
-					nodeState.available = true
-					gp.current = append(gp.current, nodeState.GraphNode)
+// applyStateChange applies the result of the callback of a node which
+// is not inhibited, or has just been released. nodeState must be
+// local to gp.
+func (gp *graphPermutation) applyStateChange(nodeState *graphNodeState, result GraphNodeStateChange) {
+	switch result {
+	case Inhibit:
+		nodeState.blocked = gp.mayRelease(nodeState.id)
+		if nodeState.available {
+			nodeState.available = false
+			for idx, node := range gp.current {
+				if node == nodeState.GraphNode {
+					gp.current = append(gp.current[:idx], gp.current[idx+1:]...)
+					break
 				}
 			}
 		}
+		nodeState.inhibited = true
+	case MakeAvailable, Release:
+		if !nodeState.available {
+			nodeState.available = true
+			nodeState.time = gp.readyTime(nodeState)
+			gp.current = append(gp.current, nodeState.GraphNode)
+		}
+	}
+}
+
+// options filters gp.current down to the nodes which may be chosen
+// next. If nothing is filtered out, gp.current itself is returned.
+func (gp *graphPermutation) options() []interface{} {
+	if gp.atomicNext != nil && containsOption(gp.current, interface{}(gp.atomicNext)) {
+		return []interface{}{gp.atomicNext}
+	}
+	options := filterGraphNodes(gp.current, gp.symmetryEligible)
+	options = filterGraphNodes(options, gp.mutexEligible)
+	options = filterGraphNodes(options, gp.semaphoreEligible)
+	if gp.graph.isTimed() {
+		options = filterGraphNodes(options, gp.timely(gp.deadline()))
+	}
+	return collapseAtomic(options)
+}
+
+// filterGraphNodes returns the nodes for which keep returns true. If
+// that is all of them, nodes itself is returned.
+func filterGraphNodes(nodes []interface{}, keep func(*GraphNode) bool) []interface{} {
+	for idx, node := range nodes {
+		if keep(node.(*GraphNode)) {
+			continue
+		}
+		kept := make([]interface{}, idx, len(nodes)-1)
+		copy(kept, nodes[:idx])
+		for _, node := range nodes[idx+1:] {
+			if keep(node.(*GraphNode)) {
+				kept = append(kept, node)
+			}
+		}
+		return kept
 	}
-	return gp.current
+	return nodes
 }
 
 func (gn *GraphNode) String() string {
@@ -0,0 +1,35 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestGraphPermutationEdgesAfterConstruction(t *testing.T) {
+	g := nodes("a", "b", "c")
+	gen := NewGraphPermutation(g[0], g[2])
+	// Edges may still be added until the generator is first used.
+	g[0].AddEdgeTo(g[1])
+	checkPerms(t, collectSorted(BuildPermutations(gen)), []string{
+		"a b c",
+		"a c b",
+		"c a b",
+	})
+}
+
+func TestGraphPermutationClonesAreIndependent(t *testing.T) {
+	g := nodes("a", "b", "c")
+	g[0].AddEdgeTo(g[1])
+	gen := NewGraphPermutation(g[0], g[2])
+	gen.Generate(nil)
+	// As in the walk, the clone is explored before the original.
+	clone := gen.Clone()
+	if options := clone.Generate(g[2]); len(options) != 1 || options[0] != g[0] {
+		t.Fatalf("clone offers %v after c", options)
+	}
+	if options := clone.Generate(g[0]); len(options) != 1 || options[0] != g[1] {
+		t.Fatalf("clone offers %v after c a", options)
+	}
+	if options := gen.Generate(g[0]); len(options) != 2 {
+		t.Fatalf("got options %v after a", options)
+	}
+}
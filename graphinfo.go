@@ -0,0 +1,98 @@
+package gsim
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// graphInfo holds information about the graph as a whole, shared
+// between a graphPermutation and all of its clones. It is built
+// lazily, the first time it is needed. Building it compiles the
+// graph: every node reachable from the starting nodes is given an id,
+// its index in nodes, and the edges and callback of each node are
+// recorded by id, so that the state of the nodes can be held in
+// slices rather than maps. Once built, it is never modified.
+type graphInfo struct {
+	start   []*GraphNode
+	once    sync.Once
+	nodes   []*GraphNode
+	index   map[*GraphNode]int
+	out, in [][]int
+	// callbacks holds the callback of each node, and historyCallbacks
+	// the same where it is a HistoryCallback, and nil otherwise.
+	callbacks        []GraphNodeCallback
+	historyCallbacks []HistoryCallback
+	// releasing is set for each node whose callback may release it
+	// once inhibited. See ReleasingCallback.
+	releasing []bool
+	// unroll is the number of visits allowed to nodes on cycles. See
+	// NewUnrolledGraphPermutation.
+	unroll int
+	// cyclic holds the nodes which lie on cycles.
+	cyclic map[*GraphNode]bool
+	// timed is set if any node has timing constraints.
+	timed bool
+	// history is set if any node has a HistoryCallback.
+	history bool
+}
+
+func newGraphInfo(start []*GraphNode) *graphInfo {
+	return &graphInfo{start: start}
+}
+
+func (gi *graphInfo) build() {
+	gi.once.Do(func() {
+		gi.nodes = reachableGraphNodes(gi.start...)
+		gi.index = make(map[*GraphNode]int, len(gi.nodes))
+		for idx, gn := range gi.nodes {
+			gi.index[gn] = idx
+			atomic.CompareAndSwapInt64(&gn.id, 0, int64(idx)+1)
+			gi.timed = gi.timed || gn.inDelays != nil || gn.hasDeadline
+		}
+		gi.history = hasHistoryCallback(gi.nodes)
+		gi.out = make([][]int, len(gi.nodes))
+		gi.in = make([][]int, len(gi.nodes))
+		gi.callbacks = make([]GraphNodeCallback, len(gi.nodes))
+		gi.historyCallbacks = make([]HistoryCallback, len(gi.nodes))
+		gi.releasing = make([]bool, len(gi.nodes))
+		for idx, gn := range gi.nodes {
+			gi.out[idx] = make([]int, len(gn.Out))
+			for idx2, gn2 := range gn.Out {
+				gi.out[idx][idx2] = gi.index[gn2]
+				gi.in[gi.index[gn2]] = append(gi.in[gi.index[gn2]], idx)
+			}
+			gi.callbacks[idx] = gn.Callback
+			gi.historyCallbacks[idx], _ = gn.Callback.(HistoryCallback)
+			gi.releasing[idx] = mayRelease(gn.Callback)
+		}
+		gi.cyclic = make(map[*GraphNode]bool)
+		for _, component := range graphCycles(gi.nodes) {
+			for _, gn := range component {
+				gi.cyclic[gn] = true
+			}
+		}
+	})
+}
+
+// reachableGraphNodes returns every node reachable from the starting
+// nodes by following outgoing edges, in a deterministic (breadth
+// first) order, starting nodes first.
+func reachableGraphNodes(start ...*GraphNode) []*GraphNode {
+	nodes := make([]*GraphNode, 0, len(start))
+	seen := make(map[*GraphNode]bool, len(start))
+	for _, gn := range start {
+		if !seen[gn] {
+			seen[gn] = true
+			nodes = append(nodes, gn)
+		}
+	}
+	for idx := 0; idx < len(nodes); idx++ {
+		for _, gn := range nodes[idx].Out {
+			if !seen[gn] {
+				seen[gn] = true
+				nodes = append(nodes, gn)
+			}
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,260 @@
+package gsim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+const graphJSONVersion = 1
+
+type jsonGraph struct {
+	Version int             `json:"version"`
+	Start   []int           `json:"start"`
+	Nodes   []jsonGraphNode `json:"nodes"`
+}
+
+type jsonGraphNode struct {
+	Value        interface{}   `json:"value"`
+	Out          []int         `json:"out,omitempty"`
+	In           []int         `json:"in,omitempty"`
+	Callback     *jsonCallback `json:"callback,omitempty"`
+	Delays       []jsonDelay   `json:"delays,omitempty"`
+	Deadline     *int64        `json:"deadline,omitempty"`
+	MaxVisits    int           `json:"maxVisits,omitempty"`
+	Priority     int           `json:"priority,omitempty"`
+	SymmetryPred *int          `json:"symmetryPred,omitempty"`
+}
+
+type jsonDelay struct {
+	From  int   `json:"from"`
+	Delay int64 `json:"delay"`
+}
+
+// jsonCallback encodes one of the provided callbacks. Type is one of
+// "availableAny", "inhibitAny", "availableAll", "inhibitAll" and
+// "combination".
+type jsonCallback struct {
+	Type      string         `json:"type"`
+	Required  []int          `json:"required,omitempty"`
+	Combiner  string         `json:"combiner,omitempty"`
+	Callbacks []jsonCallback `json:"callbacks,omitempty"`
+}
+
+// WriteGraphJSON encodes the graph reachable from the starting nodes
+// as JSON, including node values, edges (in order, so permutation
+// numbers are preserved), callbacks, and all other node settings,
+// such that ReadGraphJSON can reconstruct it. Graphs can thus be kept
+// in version control, or built by other languages and tools. Values
+// are encoded with encoding/json. Only the provided callbacks and
+// combiners can be encoded: any other results in an error.
+func WriteGraphJSON(w io.Writer, start ...*GraphNode) error {
+	graph, err := encodeGraph(start...)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(graph)
+}
+
+// encodeGraph converts the graph reachable from the starting nodes
+// into the form in which it is serialised. Nodes are numbered in the
+// order they are first found, starting nodes first.
+func encodeGraph(start ...*GraphNode) (*jsonGraph, error) {
+	var nodes []*GraphNode
+	ids := make(map[*GraphNode]int)
+	add := func(gn *GraphNode) int {
+		id, found := ids[gn]
+		if !found {
+			id = len(nodes)
+			ids[gn] = id
+			nodes = append(nodes, gn)
+		}
+		return id
+	}
+	graph := &jsonGraph{Version: graphJSONVersion}
+	for _, gn := range start {
+		graph.Start = append(graph.Start, add(gn))
+	}
+	for idx := 0; idx < len(nodes); idx++ {
+		gn := nodes[idx]
+		jgn := jsonGraphNode{
+			Value:     gn.Value,
+			MaxVisits: gn.maxVisits,
+			Priority:  gn.priority,
+		}
+		for _, out := range gn.Out {
+			jgn.Out = append(jgn.Out, add(out))
+		}
+		for _, in := range gn.In {
+			jgn.In = append(jgn.In, add(in))
+			if delay, found := gn.inDelays[in]; found {
+				jgn.Delays = append(jgn.Delays, jsonDelay{From: ids[in], Delay: delay})
+			}
+		}
+		if gn.hasDeadline {
+			deadline := gn.deadline
+			jgn.Deadline = &deadline
+		}
+		if gn.symmetryPred != nil {
+			pred := add(gn.symmetryPred)
+			jgn.SymmetryPred = &pred
+		}
+		if gn.Callback != AvailableAnyCallback {
+			cb, err := encodeCallback(gn.Callback, add)
+			if err != nil {
+				return nil, fmt.Errorf("node %v: %v", gn.Value, err)
+			}
+			jgn.Callback = &cb
+		}
+		graph.Nodes = append(graph.Nodes, jgn)
+	}
+	return graph, nil
+}
+
+func encodeCallback(cb GraphNodeCallback, add func(*GraphNode) int) (jsonCallback, error) {
+	switch cb := cb.(type) {
+	case *availableAnyCallback:
+		return jsonCallback{Type: "availableAny"}, nil
+	case *inhibitAnyCallback:
+		return jsonCallback{Type: "inhibitAny"}, nil
+	case *allCallback:
+		jcb := jsonCallback{Type: "availableAll"}
+		if cb.result == Inhibit {
+			jcb.Type = "inhibitAll"
+		}
+		for _, gn := range cb.required {
+			jcb.Required = append(jcb.Required, add(gn))
+		}
+		return jcb, nil
+	case *CombinationCallback:
+		if reflect.ValueOf(cb.combiner).Pointer() != reflect.ValueOf(InhibitThenAvailableCombiner).Pointer() {
+			return jsonCallback{}, fmt.Errorf("unsupported combiner")
+		}
+		jcb := jsonCallback{Type: "combination", Combiner: "inhibitThenAvailable"}
+		for _, cb2 := range cb.callbacks {
+			jcb2, err := encodeCallback(cb2, add)
+			if err != nil {
+				return jsonCallback{}, err
+			}
+			jcb.Callbacks = append(jcb.Callbacks, jcb2)
+		}
+		return jcb, nil
+	default:
+		return jsonCallback{}, fmt.Errorf("unsupported callback %T", cb)
+	}
+}
+
+// ReadGraphJSON decodes a graph written by WriteGraphJSON, returning
+// its starting nodes. Values are decoded by encoding/json into an
+// interface{}, so, for example, numbers become float64s.
+func ReadGraphJSON(r io.Reader) ([]*GraphNode, error) {
+	var graph jsonGraph
+	if err := json.NewDecoder(r).Decode(&graph); err != nil {
+		return nil, err
+	}
+	return decodeGraph(&graph)
+}
+
+// decodeGraph reconstructs a graph converted by encodeGraph, returning
+// its starting nodes.
+func decodeGraph(graph *jsonGraph) ([]*GraphNode, error) {
+	if graph.Version != graphJSONVersion {
+		return nil, fmt.Errorf("unsupported graph version %v", graph.Version)
+	}
+	nodes := make([]*GraphNode, len(graph.Nodes))
+	for idx, jgn := range graph.Nodes {
+		nodes[idx] = NewGraphNode(jgn.Value)
+	}
+	node := func(id int) (*GraphNode, error) {
+		if id < 0 || id >= len(nodes) {
+			return nil, fmt.Errorf("invalid node id %v", id)
+		}
+		return nodes[id], nil
+	}
+	nodeList := func(ids []int) ([]*GraphNode, error) {
+		gns := make([]*GraphNode, len(ids))
+		for idx, id := range ids {
+			gn, err := node(id)
+			if err != nil {
+				return nil, err
+			}
+			gns[idx] = gn
+		}
+		return gns, nil
+	}
+
+	for idx, jgn := range graph.Nodes {
+		gn := nodes[idx]
+		var err error
+		if gn.Out, err = nodeList(jgn.Out); err != nil {
+			return nil, err
+		}
+		if gn.In, err = nodeList(jgn.In); err != nil {
+			return nil, err
+		}
+		for _, jd := range jgn.Delays {
+			from, err := node(jd.From)
+			if err != nil {
+				return nil, err
+			}
+			if gn.inDelays == nil {
+				gn.inDelays = make(map[*GraphNode]int64)
+			}
+			gn.inDelays[from] = jd.Delay
+		}
+		if jgn.Deadline != nil {
+			gn.SetDeadline(*jgn.Deadline)
+		}
+		if jgn.MaxVisits != 0 {
+			gn.SetMaxVisits(jgn.MaxVisits)
+		}
+		gn.priority = jgn.Priority
+		if jgn.SymmetryPred != nil {
+			if gn.symmetryPred, err = node(*jgn.SymmetryPred); err != nil {
+				return nil, err
+			}
+		}
+		if jgn.Callback != nil {
+			if gn.Callback, err = decodeCallback(*jgn.Callback, nodeList); err != nil {
+				return nil, fmt.Errorf("node %v: %v", gn.Value, err)
+			}
+		}
+	}
+	return nodeList(graph.Start)
+}
+
+func decodeCallback(jcb jsonCallback, nodeList func([]int) ([]*GraphNode, error)) (GraphNodeCallback, error) {
+	switch jcb.Type {
+	case "availableAny":
+		return AvailableAnyCallback, nil
+	case "inhibitAny":
+		return InhibitAnyCallback, nil
+	case "availableAll", "inhibitAll":
+		required, err := nodeList(jcb.Required)
+		if err != nil {
+			return nil, err
+		}
+		if jcb.Type == "inhibitAll" {
+			return NewInhibitAllCallback(required...), nil
+		}
+		return NewAvailableAllCallback(required...), nil
+	case "combination":
+		if jcb.Combiner != "inhibitThenAvailable" {
+			return nil, fmt.Errorf("unsupported combiner %q", jcb.Combiner)
+		}
+		cc := NewCombinationCallback(InhibitThenAvailableCombiner)
+		for _, jcb2 := range jcb.Callbacks {
+			cb, err := decodeCallback(jcb2, nodeList)
+			if err != nil {
+				return nil, err
+			}
+			cc.AddCallback(cb)
+		}
+		return cc, nil
+	default:
+		return nil, fmt.Errorf("unsupported callback type %q", jcb.Type)
+	}
+}
@@ -0,0 +1,52 @@
+package gsim
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGraphJSONRoundTrip(t *testing.T) {
+	timed := nodes("t1", "t2", "t3")
+	timed[0].AddTimedEdgeTo(timed[1], 2)
+	timed[0].AddEdgeTo(timed[2])
+	timed[2].SetMaxVisits(2)
+	timed[1].SetDeadline(3)
+
+	symmetric := nodes("c1", "s1", "c2", "s2")
+	symmetric[0].AddEdgeTo(symmetric[1])
+	symmetric[2].AddEdgeTo(symmetric[3])
+	DeclareSymmetric(symmetric[0], symmetric[2])
+
+	for _, start := range [][]*GraphNode{egraph(), joins(), timed[:1], {symmetric[0], symmetric[2]}, diamonds(2)} {
+		var buf bytes.Buffer
+		if err := WriteGraphJSON(&buf, start...); err != nil {
+			t.Fatal(err)
+		}
+		start2, err := ReadGraphJSON(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := newCollector()
+		BuildPermutations(NewGraphPermutation(start...)).ForEach(want)
+		got := newCollector()
+		BuildPermutations(NewGraphPermutation(start2...)).ForEach(got)
+		checkPerms(t, *got.perms, *want.perms)
+		for idx, n := range *got.nums {
+			if n.Cmp((*want.nums)[idx]) != 0 {
+				t.Fatalf("%q numbered %v, want %v", (*got.perms)[idx], n, (*want.nums)[idx])
+			}
+		}
+	}
+}
+
+func TestGraphJSONRejectsCustomCallbacks(t *testing.T) {
+	g := nodes("a", "b")
+	g[0].AddEdgeTo(g[1])
+	g[1].Callback = NewBlockedUntilCallback(g[0], g[0], AvailableAnyCallback)
+	if err := WriteGraphJSON(&bytes.Buffer{}, g[0]); err == nil {
+		t.Fatal("custom callback encoded without error")
+	}
+	if _, err := ReadGraphJSON(bytes.NewBufferString(`{"version": 99}`)); err == nil {
+		t.Fatal("unknown version read without error")
+	}
+}
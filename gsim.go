@@ -1,58 +1,275 @@
 package gsim
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
 	"math/big"
+	"math/rand"
 	"runtime"
 	"sync"
+	"time"
 )
 
-// The OptionGenerator is responsible for generating the next
-// available possible paths from each permutation prefix. Two
-// implementations of OptionGenerator are provided: simplePermutation
-// and graphPermutation. If neither are sufficient for your needs then
-// you'll want to implement OptionGenerator yourself.
+// The TypedOptionGenerator is responsible for generating the next
+// available possible paths from each permutation prefix, where every
+// element of a permutation is of type T. Using a concrete T (for
+// example a struct describing the events of your model) avoids boxing
+// every element into an interface{} and type-asserting it again in
+// your consumer.
 //
-// If you do implement OptionGenerator yourself, you must ensure it is
-// entirely deterministic. So do not rely on iteration order of maps
-// and so forth.
-type OptionGenerator interface {
+// If you do implement TypedOptionGenerator yourself, you must ensure
+// it is entirely deterministic. So do not rely on iteration order of
+// maps and so forth.
+type TypedOptionGenerator[T any] interface {
 	// Generate is provided with the previously-chosen option, and is
 	// required to return the set of options now available as the next
-	// element in the permutation. OptionGenerators are expected to be
-	// stateful. Generate must return an empty list for permutation
-	// generation to terminate.
-	Generate(interface{}) []interface{}
+	// element in the permutation. The very first call to Generate is
+	// provided with the zero value of T. TypedOptionGenerators are
+	// expected to be stateful. Generate must return an empty list for
+	// permutation generation to terminate.
+	Generate(T) []T
 	// Clone is used during permutation generation. If the
-	// OptionGenerator is stateful then Clone must return a fresh
-	// OptionGenerator which shares no mutable state with the receiver
-	// of Clone.
-	Clone() OptionGenerator
+	// TypedOptionGenerator is stateful then Clone must return a fresh
+	// TypedOptionGenerator which shares no mutable state with the
+	// receiver of Clone.
+	Clone() TypedOptionGenerator[T]
 }
 
-type node struct {
+// The OptionGenerator is the interface{} instantiation of
+// TypedOptionGenerator. Two implementations of OptionGenerator are
+// provided: simplePermutation and graphPermutation. If neither are
+// sufficient for your needs then you'll want to implement
+// OptionGenerator (or TypedOptionGenerator) yourself.
+type OptionGenerator = TypedOptionGenerator[interface{}]
+
+type node[T any] struct {
 	n         *big.Int
 	depth     int
-	value     interface{}
-	generator OptionGenerator
+	value     T
+	generator TypedOptionGenerator[T]
 	cumuOpts  *big.Int
+	// weight is the fraction of the entire tree which this node's
+	// subtree is estimated to occupy.
+	weight float64
+	// prefix is only set on nodes which have been rebuilt by
+	// replaying from the root (e.g. on resumption), and holds the
+	// values of all the node's ancestors, root first.
+	prefix []T
+	// sleep holds the options which need not be explored from this
+	// node, when sleep sets are in use.
+	sleep []T
+	// choice is the choice made by the node's parent to reach it.
+	choice ChoicePoint
+	// pooled is set if n was allocated by a walkArena, and so may be
+	// recycled.
+	pooled bool
+}
+
+// Instances of TypedPermutationConsumer may be supplied to the
+// TypedPermutations iteration functions: ForEach and ForEachPar.
+type TypedPermutationConsumer[T any] interface {
+	// Clone is used only by ForEachPar and is called once for each
+	// go-routine which will be supplying permutations to the
+	// TypedPermutationConsumer. Through this, state can be duplicated
+	// so that the consumer can be stateful and safe to drive from
+	// multiple go-routines.
+	Clone() TypedPermutationConsumer[T]
+	// This function called once for each permutation generated. The
+	// permutation's backing array is reused once Consume returns, so
+	// if you need to keep the permutation, take a copy with Retain.
+	Consume(*big.Int, []T)
+}
+
+// PermutationConsumer is the interface{} instantiation of
+// TypedPermutationConsumer.
+type PermutationConsumer = TypedPermutationConsumer[interface{}]
+
+// Instances of TypedPermutationChecker may be supplied to the
+// TypedPermutations checking iteration functions: ForEachCheck and
+// ForEachParCheck. They are identical to TypedPermutationConsumer
+// except that Check may return an error, which stops the iteration.
+type TypedPermutationChecker[T any] interface {
+	// Clone is used only by ForEachParCheck, in the same way as
+	// TypedPermutationConsumer.Clone.
+	Clone() TypedPermutationChecker[T]
+	// This function is called once for each permutation generated. If
+	// it returns a non-nil error then no further permutations are
+	// generated, and the error is returned, wrapped in a
+	// PermutationError, from the iteration function. As with
+	// Consume, the permutation must not be kept once Check returns.
+	Check(*big.Int, []T) error
+}
+
+// PermutationChecker is the interface{} instantiation of
+// TypedPermutationChecker.
+type PermutationChecker = TypedPermutationChecker[interface{}]
+
+// PermutationError is returned by the checking iteration functions
+// when a PermutationChecker fails. N is the number of the
+// permutation which failed, and can be passed to
+// Permutations.Permutation to regenerate it.
+type PermutationError struct {
+	N   *big.Int
+	Err error
+}
+
+func (pe *PermutationError) Error() string {
+	return fmt.Sprintf("permutation %v: %v", pe.N, pe.Err)
+}
+
+func (pe *PermutationError) Unwrap() error {
+	return pe.Err
+}
+
+// errStopped is used internally to halt generation once some other
+// go-routine has already reported a failure.
+var errStopped = errors.New("permutation generation stopped")
+
+// errBudgetExpired is used internally to halt a sequential walk once
+// the budget given to RunFor has expired.
+var errBudgetExpired = errors.New("time budget expired")
+
+type consumerChecker[T any] struct {
+	TypedPermutationConsumer[T]
+}
+
+func (cc consumerChecker[T]) Clone() TypedPermutationChecker[T] {
+	return consumerChecker[T]{TypedPermutationConsumer: cc.TypedPermutationConsumer.Clone()}
 }
 
-// Instances of PermutationConsumer may be supplied to the
-// Permutations iteration functions: ForEach and ForEachPar.
-type PermutationConsumer interface {
-	// Clone is used only by Permutations.ForEachPar and is called
-	// once for each go-routine which will be supplying permutations
-	// to the PermutationConsumer. Through this, state can be
-	// duplicated so that the consumer can be stateful and safe to
-	// drive from multiple go-routines.
-	Clone() PermutationConsumer
-	// This function called once for each permutation generated.
-	Consume(*big.Int, []interface{})
+func (cc consumerChecker[T]) Check(n *big.Int, perm []T) error {
+	cc.Consume(n, perm)
+	return nil
 }
 
-// Permutations allows you to interate through the available
+// TypedPermutations allows you to interate through the available
 // permutations, and extract specific permutations.
-type Permutations node
+type TypedPermutations[T any] struct {
+	root *node[T]
+	// resume, if non-nil, is the worklist that iteration starts from,
+	// as restored by ResumeTypedPermutations.
+	resume []*node[T]
+	cursor *walkCursor[T]
+	// maxDepth, if positive, bounds the length of permutations.
+	maxDepth         int
+	prune            TypedPruneFunc[T]
+	constraints      []*TypedConstraint[T]
+	progress         func(Progress)
+	progressInterval time.Duration
+	// budget, if positive, is how long a sequential walk may run
+	// before stopping. See RunFor.
+	budget         time.Duration
+	independent    TypedIndependenceFunc[T]
+	order          TypedOrderFunc[T]
+	sleepSets      bool
+	deadlockPolicy DeadlockPolicy
+	dedup          bool
+	onDuplicate    TypedDuplicateFunc[T]
+	bitstate       *Bitstate
+	merge          bool
+	// milestonePolicy deals with permutations which miss mandatory
+	// nodes. See WithMilestonePolicy.
+	milestonePolicy MilestonePolicy
+	// shuffle, if non-nil, is the seed of the order in which
+	// children are explored. See WithShuffle.
+	shuffle *int64
+	// workers, if positive, is the number of go-routines used by the
+	// parallel iteration functions. See WithWorkers.
+	workers int
+	metrics *Metrics
+	// logger, if non-nil, receives lifecycle records, each carrying
+	// fingerprint. See WithLogger.
+	logger      *slog.Logger
+	fingerprint string
+	// memoryBudget, if positive, bounds the memory held by the
+	// worklist, which spills to a file in spillDir. See
+	// WithMemoryBudget.
+	memoryBudget int64
+	spillDir     string
+}
+
+// A TypedPruneFunc is consulted with every permutation prefix as it
+// is generated. Returning true abandons the prefix: neither it nor
+// any permutation which extends it will be supplied to the consumer.
+// The prefix must be treated as read-only.
+type TypedPruneFunc[T any] func(prefix []T) bool
+
+// PruneFunc is the interface{} instantiation of TypedPruneFunc.
+type PruneFunc = TypedPruneFunc[interface{}]
+
+// with returns a copy of p, modified by f, which does not share the
+// iteration position of p.
+func (p *TypedPermutations[T]) with(f func(*TypedPermutations[T])) *TypedPermutations[T] {
+	p2 := *p
+	p2.cursor = &walkCursor[T]{}
+	f(&p2)
+	return &p2
+}
+
+// WithMaxDepth returns a copy of the receiver in which only
+// permutation prefixes of length at most k are generated: any
+// permutation longer than k is truncated to its first k elements, and
+// the remainder of its subtree is never explored. Each prefix is
+// supplied to the consumer exactly once, with its own unique number;
+// Permutation and Count likewise respect the bound. A k of 0 removes
+// the bound. Many bugs show up in short schedules, and bounding the
+// depth can make an otherwise intractable space feasible.
+func (p *TypedPermutations[T]) WithMaxDepth(k int) *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) { p2.maxDepth = k })
+}
+
+// WithPrune returns a copy of the receiver which consults prune with
+// every prefix generated, including complete permutations. This
+// allows domain-specific reductions of the permutation space (for
+// example "never more than two crashes") without having to write a
+// new OptionGenerator. Count and Sample respect the prune function,
+// and permutation numbers are unaffected by it.
+func (p *TypedPermutations[T]) WithPrune(prune TypedPruneFunc[T]) *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) { p2.prune = prune })
+}
+
+// generate returns the options available from the node with the given
+// value and prefix (which ends with value, unless the node is the
+// root), taking into account the configuration of p. If the node's
+// entire subtree is to be abandoned then false is returned.
+func (p *TypedPermutations[T]) generate(gen TypedOptionGenerator[T], value T, prefix []T) ([]T, bool) {
+	if p.prune != nil && p.prune(prefix) {
+		return nil, false
+	}
+	if p.constraints != nil && !p.allowed(prefix) {
+		return nil, false
+	}
+	if p.maxDepth > 0 && len(prefix) >= p.maxDepth {
+		return nil, true
+	}
+	options := gen.Generate(value)
+	if len(options) == 0 && truncated(gen) {
+		return nil, false
+	}
+	if p.independent != nil {
+		options = p.ampleSet(gen, options)
+	}
+	if p.order != nil {
+		options = p.orderOptions(options)
+	}
+	return options, true
+}
+
+// walkCursor records the worklist of the most recent sequential
+// iteration, so that Snapshot can find it.
+type walkCursor[T any] struct {
+	lock     sync.Mutex
+	worklist *[]*node[T]
+	// spill holds any nodes of the worklist spilled to disk. See
+	// WithMemoryBudget.
+	spill    *worklistSpill[T]
+	parallel bool
+}
+
+// Permutations is the interface{} instantiation of
+// TypedPermutations, and is what BuildPermutations returns.
+type Permutations = TypedPermutations[interface{}]
 
 var (
 	bigIntZero = big.NewInt(0)
@@ -61,60 +278,164 @@ var (
 
 // Construct a Permutations from an OptionGenerator.
 func BuildPermutations(gen OptionGenerator) *Permutations {
-	return (*Permutations)(&node{
-		n:         bigIntZero,
-		depth:     0,
-		generator: gen,
-		cumuOpts:  bigIntOne,
-	})
+	return BuildTypedPermutations[interface{}](gen)
+}
+
+// Construct a TypedPermutations from a TypedOptionGenerator.
+func BuildTypedPermutations[T any](gen TypedOptionGenerator[T]) *TypedPermutations[T] {
+	return &TypedPermutations[T]{
+		root: &node[T]{
+			n:         bigIntZero,
+			depth:     0,
+			generator: gen,
+			cumuOpts:  bigIntOne,
+			weight:    1,
+		},
+		cursor: &walkCursor[T]{},
+	}
 }
 
-type permN struct {
-	perm []interface{}
-	n    *big.Int
+type permN[T any] struct {
+	// perm is delta encoded: it holds only the elements which follow
+	// the first shared elements of the previous permutation in the
+	// batch. See TypedDeltaDecoder.
+	perm   []T
+	shared int
+	n      *big.Int
+	// stuck is only set on deadlocked permutations, under the
+	// DeadlockFlag policy, and missed on permutations which missed
+	// milestones, under the MilestoneFlag policy.
+	stuck  []T
+	missed []T
 }
 
-type parPermutationConsumer struct {
-	ch        chan<- []permN
-	batch     []permN
-	batchIdx  int
+// permBatch is a batch of permutations sent from the generating
+// go-routine to the consuming go-routines. The permutations are delta
+// encoded, and share the elems backing array. Batches are recycled
+// through a sync.Pool once they have been consumed.
+type permBatch[T any] struct {
+	perms []permN[T]
+	elems []T
+	// reserved is the number of permutations reserved for the batch
+	// from the flowControl, if any.
+	reserved int
+}
+
+type parPermutationConsumer[T any] struct {
+	ch        chan<- *permBatch[T]
+	stop      <-chan struct{}
+	pool      *sync.Pool
+	batch     *permBatch[T]
 	batchSize int
+	// flow, if non-nil, bounds the permutations in flight and sizes
+	// the batches, in place of batchSize.
+	flow    *flowControl
+	metrics *Metrics
+	// kept is the number of elements of the permutation last added
+	// which the walk has since left unchanged. See deltaEncode.
+	kept int
 }
 
-func (ppc *parPermutationConsumer) Clone() PermutationConsumer {
-	return &parPermutationConsumer{
-		ch:        ppc.ch,
-		batch:     make([]permN, ppc.batchSize),
-		batchIdx:  0,
-		batchSize: ppc.batchSize,
+func newParPermutationConsumer[T any](ch chan<- *permBatch[T], stop <-chan struct{}, batchSize int, flow *flowControl) *parPermutationConsumer[T] {
+	pool := &sync.Pool{
+		New: func() interface{} {
+			return &permBatch[T]{perms: make([]permN[T], 0, batchSize)}
+		},
+	}
+	return &parPermutationConsumer[T]{
+		ch:        ch,
+		stop:      stop,
+		pool:      pool,
+		batch:     pool.Get().(*permBatch[T]),
+		batchSize: batchSize,
+		flow:      flow,
 	}
 }
 
-func (ppc *parPermutationConsumer) Consume(n *big.Int, perm []interface{}) {
-	permCopy := make([]interface{}, len(perm))
-	copy(permCopy, perm)
-	ppc.batch[ppc.batchIdx].n = n
-	ppc.batch[ppc.batchIdx].perm = permCopy
-	ppc.batchIdx++
-	if ppc.batchIdx == ppc.batchSize {
-		ppc.ch <- ppc.batch
-		ppc.batch = make([]permN, ppc.batchSize)
-		ppc.batchIdx = 0
+// recycle returns a consumed batch to the pool.
+func (ppc *parPermutationConsumer[T]) recycle(batch *permBatch[T]) {
+	var zero T
+	for idx := range batch.elems {
+		batch.elems[idx] = zero // don't keep values alive
+	}
+	for idx := range batch.perms {
+		batch.perms[idx] = permN[T]{}
+	}
+	batch.perms = batch.perms[:0]
+	batch.elems = batch.elems[:0]
+	batch.reserved = 0
+	ppc.pool.Put(batch)
+}
+
+func (ppc *parPermutationConsumer[T]) Clone() TypedPermutationChecker[T] {
+	clone := newParPermutationConsumer(ppc.ch, ppc.stop, ppc.batchSize, ppc.flow)
+	clone.metrics = ppc.metrics
+	return clone
+}
+
+func (ppc *parPermutationConsumer[T]) Check(n *big.Int, perm []T) error {
+	return ppc.add(n, perm, nil, nil)
+}
+
+func (ppc *parPermutationConsumer[T]) add(n *big.Int, perm []T, stuck, missed []T) error {
+	batch := ppc.batch
+	limit := ppc.batchSize
+	if ppc.flow != nil {
+		if batch.reserved == 0 {
+			if batch.reserved = ppc.flow.acquire(); batch.reserved == 0 {
+				return errStopped
+			}
+		}
+		limit = batch.reserved
 	}
+	shared := ppc.deltaEncode(perm)
+	start := len(batch.elems)
+	batch.elems = append(batch.elems, perm[shared:]...)
+	batch.perms = append(batch.perms, permN[T]{
+		n:      n,
+		perm:   batch.elems[start:len(batch.elems):len(batch.elems)],
+		shared: shared,
+		stuck:  stuck,
+		missed: missed,
+	})
+	if len(batch.perms) == limit {
+		select {
+		case ppc.ch <- batch:
+			ppc.metrics.recordGenerated(limit, false)
+		case <-ppc.stop:
+			return errStopped
+		}
+		ppc.batch = ppc.pool.Get().(*permBatch[T])
+	}
+	return nil
 }
 
-func (ppc *parPermutationConsumer) flush() {
-	if ppc.batchIdx > 0 {
-		ppc.ch <- ppc.batch[:ppc.batchIdx]
-		ppc.batch = make([]permN, ppc.batchSize)
-		ppc.batchIdx = 0
+func (ppc *parPermutationConsumer[T]) flush() {
+	if count := len(ppc.batch.perms); count > 0 {
+		select {
+		case ppc.ch <- ppc.batch:
+			ppc.metrics.recordGenerated(count, false)
+		case <-ppc.stop:
+		}
+		ppc.batch = ppc.pool.Get().(*permBatch[T])
 	}
 }
 
+// Retain returns a copy of perm. The permutations supplied to
+// consumers are only valid until Consume (or Check) returns, because
+// their backing arrays are reused. A consumer which needs to keep a
+// permutation must therefore call Retain on it.
+func Retain[T any](perm []T) []T {
+	retained := make([]T, len(perm))
+	copy(retained, perm)
+	return retained
+}
+
 // Iterate through every permutation and use concurrency. A number of
 // go-routines will be spawned appropriate for the current value of
-// GOMAXPROCS. These go-routines will be fed batches of permutations
-// and then invoke f.Consume for each permutation. It's your
+// GOMAXPROCS, unless set with WithWorkers. These go-routines will be
+// fed batches of permutations and then invoke f.Consume for each
+// permutation. It's your
 // responsibility to make sure f is safe to be run concurrently from
 // multiple go-routines (see PermutationConsumer.Clone to see how
 // stateful consumers can be built).
@@ -126,39 +447,141 @@ func (ppc *parPermutationConsumer) flush() {
 // each permutation is less quick then lower numbers will avoid memory
 // ballooning. Some trial and error may be worthwhile to find a good
 // number for your computer, but 2048 is a sensible place to start.
-func (p *Permutations) ForEachPar(batchSize int, f PermutationConsumer) {
-	par := runtime.GOMAXPROCS(0) // 0 gets the current count
+//
+// If f.Consume panics, the panic is recovered, no further
+// permutations are generated or consumed, and a *PermutationError is
+// returned whose Err is a *ConsumerPanic. Otherwise nil is returned.
+func (p *TypedPermutations[T]) ForEachPar(batchSize int, f TypedPermutationConsumer[T]) error {
+	return p.ForEachParCheck(batchSize, consumerChecker[T]{TypedPermutationConsumer: f})
+}
+
+// ForEachParCheck is the checking equivalent of ForEachPar. As soon
+// as any go-routine's f.Check returns an error (or panics),
+// generation of permutations stops, outstanding batches are
+// discarded, and once all go-routines have finished a
+// *PermutationError is returned. If several go-routines fail
+// concurrently, their *PermutationErrors are combined with
+// errors.Join. Note that because permutations are consumed
+// concurrently, the failing permutation is not necessarily the first
+// failing permutation in generation order.
+func (p *TypedPermutations[T]) ForEachParCheck(batchSize int, f TypedPermutationChecker[T]) error {
+	return p.forEachPar(f, batchSize, nil)
+}
+
+// WithWorkers returns a copy of the receiver whose parallel iteration
+// functions (ForEachPar, ForEachParBounded, ForEachParGen and their
+// checking equivalents) use n go-routines rather than one per
+// GOMAXPROCS. A single worker exercises the parallel code path
+// deterministically, which helps when debugging it, whereas
+// consumers which spend most of their time waiting on external
+// systems benefit from several workers per core. Values smaller than
+// 1 restore the default.
+func (p *TypedPermutations[T]) WithWorkers(n int) *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) { p2.workers = n })
+}
+
+// parallelism returns the number of go-routines to be used by the
+// parallel iteration functions.
+func (p *TypedPermutations[T]) parallelism() int {
+	if p.workers > 0 {
+		return p.workers
+	}
+	return runtime.GOMAXPROCS(0) // 0 gets the current count
+}
+
+// forEachPar implements ForEachParCheck, and ForEachParBoundedCheck
+// if flow is non-nil.
+func (p *TypedPermutations[T]) forEachPar(f TypedPermutationChecker[T], batchSize int, flow *flowControl) error {
+	par := p.parallelism()
 	var wg sync.WaitGroup
 	wg.Add(par)
-	ch := make(chan []permN, par*par)
+	ch := make(chan *permBatch[T], par*par)
+	failures := newFailureCollector()
+	ppc := newParPermutationConsumer[T](ch, failures.stop, batchSize, flow)
+	ppc.metrics = p.metrics
+	if flow != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-failures.stop:
+				flow.stop()
+			case <-done:
+			}
+		}()
+	}
 
+	p.metrics.recordWorkers(par)
+	defer p.metrics.recordWorkers(-par)
 	for idx := 0; idx < par; idx++ {
 		go func() {
 			defer wg.Done()
 			g := f.Clone()
+			var decoder TypedDeltaDecoder[T]
 			for {
-				perms, ok := <-ch
+				batch, ok := <-ch
 				if !ok {
 					return
 				}
-				for _, perm := range perms {
-					g.Consume(perm.n, perm.perm)
+				start := time.Now()
+				if !failures.isStopped() { // otherwise drain without checking
+					done := p.metrics.recordBusy()
+					if pe := checkBatch(g, batch.perms, &decoder); pe != nil {
+						p.failed(pe)
+						failures.fail(pe)
+					}
+					done()
+				}
+				p.metrics.recordConsumed(len(batch.perms))
+				if flow != nil {
+					flow.release(batch.reserved, len(batch.perms), time.Since(start))
 				}
+				ppc.recycle(batch)
 				runtime.Gosched()
 			}
 		}()
 	}
 
-	ppc := &parPermutationConsumer{
-		ch:        ch,
-		batch:     make([]permN, batchSize),
-		batchIdx:  0,
-		batchSize: batchSize,
+	p.cursor.lock.Lock()
+	p.cursor.worklist = nil
+	p.cursor.spill = nil
+	p.cursor.parallel = true
+	p.cursor.lock.Unlock()
+	if p.walk(ppc, nil, nil) == nil {
+		ppc.flush()
 	}
-	p.ForEach(ppc)
-	ppc.flush()
 	close(ch)
 	wg.Wait()
+	return failures.err()
+}
+
+// checkBatch supplies each permutation in perms to g, decoded with
+// decoder, stopping at the first failure or panic.
+func checkBatch[T any](g TypedPermutationChecker[T], perms []permN[T], decoder *TypedDeltaDecoder[T]) (pe *PermutationError) {
+	var n *big.Int
+	defer func() {
+		if r := recover(); r != nil {
+			pe = recoverPermutation(r, n)
+		}
+	}()
+	dc, isDC := deadlockConsumer(g)
+	mc, isMC := milestoneConsumer(g)
+	for _, encoded := range perms {
+		n = encoded.n
+		perm := decoder.Decode(encoded.shared, encoded.perm)
+		if encoded.stuck != nil && isDC {
+			dc.Deadlocked(n, perm, encoded.stuck)
+			continue
+		}
+		if encoded.missed != nil && isMC {
+			mc.MissedMilestones(n, perm, encoded.missed)
+			continue
+		}
+		if err := g.Check(n, perm); err != nil {
+			return &PermutationError{N: n, Err: err}
+		}
+	}
+	return nil
 }
 
 // Iterate through every permutation in the current go-routine. No
@@ -167,58 +590,271 @@ func (p *Permutations) ForEachPar(batchSize int, f PermutationConsumer) {
 // the permutation itself. These arguments should be considered
 // read-only. If you mutate the permutation number or permutation then
 // behaviour is undefined.
-func (p *Permutations) ForEach(f PermutationConsumer) {
-	perm := []interface{}{}
+func (p *TypedPermutations[T]) ForEach(f TypedPermutationConsumer[T]) {
+	p.ForEachCheck(consumerChecker[T]{TypedPermutationConsumer: f})
+}
+
+// ForEachCheck is the checking equivalent of ForEach. Permutations
+// are supplied to f.Check in exactly the same order as ForEach would
+// supply them to f.Consume. If f.Check returns an error, no further
+// permutations are generated and a *PermutationError is returned
+// identifying the failing permutation. If every permutation passes
+// then nil is returned.
+func (p *TypedPermutations[T]) ForEachCheck(f TypedPermutationChecker[T]) error {
+	if pe := p.walk(f, nil, nil); pe != nil {
+		return pe
+	}
+	return nil
+}
+
+// Iterate through only those permutations whose numbers fall in the
+// half-open range [from, to), in the current go-routine. Either bound
+// may be nil, meaning unbounded. Permutations are supplied to
+// f.Consume in the same order as ForEach would supply them. This is
+// useful for sharding work across machines, or for resuming an
+// interrupted run.
+//
+// Note that permutation numbers are not necessarily dense: not every
+// number in the range need correspond to a permutation. Subtrees
+// which can only contain numbers at or above to are never explored,
+// but the tree must still be walked to find the permutations at or
+// above from.
+func (p *TypedPermutations[T]) ForEachRange(from, to *big.Int, f TypedPermutationConsumer[T]) {
+	p.ForEachRangeCheck(from, to, consumerChecker[T]{TypedPermutationConsumer: f})
+}
 
-	worklist := []*node{&node{
-		n:         p.n,
-		depth:     p.depth,
-		generator: p.generator.Clone(),
-		cumuOpts:  p.cumuOpts,
-	}}
+// ForEachRangeCheck is the checking equivalent of ForEachRange.
+func (p *TypedPermutations[T]) ForEachRangeCheck(from, to *big.Int, f TypedPermutationChecker[T]) error {
+	if pe := p.walk(f, from, to); pe != nil {
+		return pe
+	}
+	return nil
+}
+
+// walk drives the worklist, invoking f.Check for each permutation
+// with a number in [from, to). Nil bounds are unbounded. It returns a
+// non-nil *PermutationError as soon as f.Check fails.
+func (p *TypedPermutations[T]) walk(f TypedPermutationChecker[T], from, to *big.Int) *PermutationError {
+	ppc, isPar := f.(*parPermutationConsumer[T])
+	p.logRunStarted(from, to, isPar)
+	var path *incrementalPath[T]
+	chc, hasChoices := choiceConsumer(f)
+	var choices []ChoicePoint
+	if ic, ok := incrementalConsumer(f); ok {
+		path = &incrementalPath[T]{consumer: ic}
+	} else if !hasChoices {
+		// Merged walks track neither prefixes nor choices.
+		if dag := p.stateDAG(); dag != nil {
+			return dag.walk(f, from, to)
+		}
+	}
+	perm := []T{}
 
-	for l := len(worklist) - 1; l != -1; l-- {
+	var worklist []*node[T]
+	if p.resume == nil {
+		worklist = []*node[T]{&node[T]{
+			n:         p.root.n,
+			depth:     p.root.depth,
+			generator: p.root.generator.Clone(),
+			cumuOpts:  p.root.cumuOpts,
+			weight:    p.root.weight,
+		}}
+	} else {
+		worklist = make([]*node[T], len(p.resume))
+		for idx, resumed := range p.resume {
+			worklist[idx] = resumed.clone()
+		}
+	}
+	spill := newWorklistSpill(p)
+	defer spill.close()
+	if !isPar {
+		p.cursor.lock.Lock()
+		p.cursor.worklist = &worklist
+		p.cursor.spill = spill
+		p.cursor.parallel = false
+		p.cursor.lock.Unlock()
+	}
+	progress := newProgressTracker(p, worklist)
+	var rng *rand.Rand
+	if p.shuffle != nil {
+		rng = rand.New(rand.NewSource(*p.shuffle))
+	}
+	var seen map[uint64]*big.Int
+	if p.dedup {
+		seen = make(map[uint64]*big.Int)
+	}
+	arena := &walkArena[T]{keepNums: seen != nil}
+
+	for l := len(worklist) - 1; ; l-- {
+		if l == -1 {
+			refilled, more, err := spill.refill(worklist)
+			if err != nil {
+				return &PermutationError{Err: err}
+			} else if !more {
+				break
+			}
+			worklist = refilled
+			l = len(worklist) - 1
+		}
 		cur := worklist[l]
 		worklist = worklist[:l]
+		if progress.visit(cur.depth, cur.n) {
+			// The budget has expired: leave cur for Snapshot.
+			worklist = append(worklist, cur)
+			if path != nil {
+				path.backtrackTo(0)
+			}
+			progress.finish()
+			return &PermutationError{N: cur.n, Err: errBudgetExpired}
+		}
 
-		perm = append(perm[:cur.depth], cur.value)
+		// Every permutation within the subtree of cur has a number no
+		// smaller than cur.n.
+		if to != nil && cur.n.Cmp(to) >= 0 {
+			progress.explored(cur.weight)
+			arena.release(cur, true)
+			continue
+		}
 
-		options := cur.generator.Generate(cur.value)
+		kept := 0
+		if cur.prefix == nil {
+			perm = append(perm[:cur.depth], cur.value)
+			kept = cur.depth - 1
+		} else {
+			perm = append(append(perm[:0], cur.prefix...), cur.value)
+		}
+		if isPar && kept >= 0 {
+			ppc.truncate(kept)
+		}
+		if path != nil {
+			path.moveTo(perm[1:], cur.prefix != nil)
+		}
+		if hasChoices {
+			if cur.prefix == nil {
+				if cur.depth > 0 {
+					choices = append(choices[:cur.depth-1], cur.choice)
+				}
+			} else {
+				choices = p.choicesTo(choices, cur.n, cur.depth)
+			}
+		}
+
+		options, ok := p.generate(cur.generator, cur.value, perm[1:])
+		if !ok || (p.tracksStates() && p.stateSeen(seen, cur.generator, perm[1:], cur.n)) {
+			progress.explored(cur.weight)
+			arena.release(cur, true)
+			continue
+		}
 		optionCount := len(options)
 
 		if optionCount == 0 {
-			f.Consume(cur.n, perm[1:])
+			progress.explored(cur.weight)
+			if from != nil && cur.n.Cmp(from) < 0 {
+				arena.release(cur, true)
+				continue
+			}
+			progress.generated()
+			if !isPar {
+				// Parallel batches are recorded as they are queued.
+				p.metrics.recordGenerated(1, true)
+			}
+			if hasChoices {
+				chc.Choices(choices[:cur.depth])
+			}
+			if handled, err := p.deadlocked(f, cur.generator, cur.n, perm[1:]); err != nil {
+				pe := &PermutationError{N: cur.n, Err: err}
+				p.failed(pe)
+				return pe
+			} else if handled {
+				arena.release(cur, false)
+				continue
+			}
+			if err := f.Check(cur.n, perm[1:]); err != nil {
+				pe := &PermutationError{N: cur.n, Err: err}
+				if !isPar {
+					p.failed(pe)
+				}
+				return pe
+			}
+			// The consumer may have retained cur.n.
+			arena.release(cur, false)
 
 		} else {
 			cumuOpts := big.NewInt(int64(optionCount))
 			cumuOpts.Mul(cur.cumuOpts, cumuOpts)
-			for idx, option := range options {
+			weight := cur.weight / float64(optionCount)
+			var awake []bool
+			if p.sleepSets && p.independent != nil {
+				awake = p.awake(cur.sleep, options)
+			}
+			var order []int
+			if rng != nil {
+				order = rng.Perm(optionCount)
+			}
+			pushed := 0
+			shared := false
+			for pos := range options {
+				idx := pos
+				if order != nil {
+					idx = order[pos]
+				}
+				option := options[idx]
+				if awake != nil && !awake[idx] {
+					progress.explored(weight)
+					continue
+				}
 				var childN *big.Int
+				pooled := true
 				if optionCount == 1 {
-					childN = cur.n
+					// The child takes over cur's number.
+					childN, pooled, shared = cur.n, cur.pooled, true
 				} else {
-					childN = big.NewInt(int64(idx))
+					childN = arena.num().SetInt64(int64(idx))
 					childN.Mul(childN, cur.cumuOpts)
 					childN.Add(childN, cur.n)
 				}
-				var gen OptionGenerator
-				if idx == 0 {
+				// The child pushed first is explored last, so only it
+				// may modify the parent's generator.
+				var gen TypedOptionGenerator[T]
+				if pushed == 0 {
 					gen = cur.generator
 				} else {
 					gen = cur.generator.Clone()
 				}
-				child := &node{
+				child := arena.node()
+				*child = node[T]{
 					n:         childN,
 					depth:     cur.depth + 1,
 					value:     option,
 					generator: gen,
 					cumuOpts:  cumuOpts,
+					weight:    weight,
+					choice:    ChoicePoint{Index: idx, Options: optionCount},
+					pooled:    pooled,
+				}
+				if awake != nil {
+					child.sleep = p.childSleep(cur.sleep, options, awake, order, pos)
 				}
 				worklist = append(worklist, child)
+				pushed++
+			}
+			l += pushed
+			arena.release(cur, !shared)
+			if spill != nil && len(worklist) > spill.maxNodes {
+				spilled, err := spill.spill(worklist, arena)
+				if err != nil {
+					return &PermutationError{N: worklist[l-1].n, Err: err}
+				}
+				worklist = spilled
+				l = len(worklist)
 			}
-			l += optionCount
 		}
 	}
+	if path != nil {
+		path.backtrackTo(0)
+	}
+	progress.finish()
+	return nil
 }
 
 // Every permutation has a unique number, which is supplied to the
@@ -228,15 +864,15 @@ func (p *Permutations) ForEach(f PermutationConsumer) {
 // exact same permutation. Note that iterating through a range of
 // permutation numbers and repeatedly calling Permutation is slower
 // than using either of the iterator functions.
-func (p *Permutations) Permutation(permNum *big.Int) []interface{} {
+func (p *TypedPermutations[T]) Permutation(permNum *big.Int) []T {
 	n := new(big.Int).Set(permNum)
-	perm := []interface{}{}
+	perm := []T{}
 	choiceBig := new(big.Int)
 
-	gen := p.generator.Clone()
-	val := p.value
+	gen := p.root.generator.Clone()
+	val := p.root.value
 	for {
-		options := gen.Generate(val)
+		options, _ := p.generate(gen, val, perm)
 		optionCount := len(options)
 		if optionCount == 0 {
 			return perm
@@ -247,5 +883,67 @@ func (p *Permutations) Permutation(permNum *big.Int) []interface{} {
 		perm = append(perm, val)
 		gen = gen.Clone()
 	}
-	return perm
+}
+
+// Count returns the total number of permutations. It has to walk the
+// entire tree of options, calling Generate and Clone exactly as the
+// iteration functions do, but it does no work to track permutation
+// numbers or the permutations themselves, so it is considerably
+// cheaper than iterating with a consumer that does nothing. It is
+// intended to let you decide whether exhaustive iteration is
+// feasible before committing to it.
+//
+// For graphs in which every node has either the default
+// AvailableAnyCallback or an AvailableAllCallback, and no other
+// constraints, Count does not walk the tree at all: the permutations
+// are counted exactly, by summing over the sets of nodes which can
+// have been chosen, which is far faster for all but the smallest
+// graphs.
+func (p *TypedPermutations[T]) Count() *big.Int {
+	if count := p.countExtensions(); count != nil {
+		return count
+	}
+	if dag := p.stateDAG(); dag != nil {
+		return new(big.Int).Set(dag.root.count)
+	}
+	return new(big.Int).SetUint64(p.countFrom(p.root.value, p.root.generator.Clone(), nil))
+}
+
+// countFrom counts the permutations in the subtree of a node with
+// the given value, generator and prefix (as for generate). The
+// generator is consumed.
+func (p *TypedPermutations[T]) countFrom(value T, generator TypedOptionGenerator[T], prefix []T) uint64 {
+	type countNode struct {
+		value     T
+		generator TypedOptionGenerator[T]
+		depth     int
+	}
+	base := len(prefix)
+	perm := append([]T{}, prefix...)
+	count := uint64(0)
+	worklist := []countNode{{value: value, generator: generator, depth: base}}
+
+	for l := len(worklist) - 1; l != -1; l = len(worklist) - 1 {
+		cur := worklist[l]
+		worklist = worklist[:l]
+
+		if cur.depth > base {
+			perm = append(perm[:cur.depth-1], cur.value)
+		}
+		options, ok := p.generate(cur.generator, cur.value, perm)
+		if !ok {
+			continue
+		} else if len(options) == 0 {
+			count++
+			continue
+		}
+		for idx, option := range options {
+			gen := cur.generator
+			if idx != 0 {
+				gen = gen.Clone()
+			}
+			worklist = append(worklist, countNode{value: option, generator: gen, depth: cur.depth + 1})
+		}
+	}
+	return count
 }
@@ -0,0 +1,254 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEachCheckStopsAtFailure(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4}))
+	all := collect(p)
+	failed := errors.New("failed")
+	var checked []string
+	err := p.ForEachCheck(checkerFunc(func(n *big.Int, perm []interface{}) error {
+		checked = append(checked, permString(perm))
+		if len(checked) == 3 {
+			return failed
+		}
+		return nil
+	}))
+	checkPerms(t, checked, all[:3])
+	var pe *PermutationError
+	if !errors.As(err, &pe) || !errors.Is(err, failed) {
+		t.Fatalf("got %v, want a PermutationError wrapping %v", err, failed)
+	}
+	if got := permString(p.Permutation(pe.N)); got != all[2] {
+		t.Fatalf("failure identifies %q, want %q", got, all[2])
+	}
+	if err := p.ForEachCheck(checkerFunc(func(*big.Int, []interface{}) error { return nil })); err != nil {
+		t.Fatalf("passing run returned %v", err)
+	}
+}
+
+func TestForEachParCheckStopsAtFailure(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5, 6, 7})).WithWorkers(4)
+	failed := errors.New("failed")
+	checked := new(atomic.Int64)
+	err := p.ForEachParCheck(4, checkerFunc(func(n *big.Int, perm []interface{}) error {
+		checked.Add(1)
+		if perm[0] == 1 {
+			return failed
+		}
+		return nil
+	}))
+	var pe *PermutationError
+	if !errors.As(err, &pe) || !errors.Is(err, failed) {
+		t.Fatalf("got %v, want a PermutationError wrapping %v", err, failed)
+	}
+	if p.Permutation(pe.N)[0] != 1 {
+		t.Fatalf("failure identifies %v", p.Permutation(pe.N))
+	}
+	if n := checked.Load(); n == 5040 {
+		t.Fatal("every permutation was checked")
+	}
+}
+
+// typedCollector records every permutation it is given. It must not
+// be used with the parallel iterators.
+type typedCollector[T any] struct {
+	perms [][]T
+	nums  []*big.Int
+}
+
+func (tc *typedCollector[T]) Clone() TypedPermutationConsumer[T] {
+	return tc
+}
+
+func (tc *typedCollector[T]) Consume(n *big.Int, perm []T) {
+	tc.perms = append(tc.perms, append([]T{}, perm...))
+	tc.nums = append(tc.nums, new(big.Int).Set(n))
+}
+
+func TestTypedPermutations(t *testing.T) {
+	p := BuildTypedPermutations(NewTypedSimplePermutation([]int{1, 2, 3}))
+	tc := &typedCollector[int]{}
+	p.ForEach(tc)
+	if len(tc.perms) != 6 {
+		t.Fatalf("got %d permutations, want 6", len(tc.perms))
+	}
+	seen := make(map[[3]int]bool)
+	for idx, perm := range tc.perms {
+		if len(perm) != 3 {
+			t.Fatalf("permutation %v has %d elements", perm, len(perm))
+		}
+		key := [3]int{perm[0], perm[1], perm[2]}
+		if seen[key] || perm[0]+perm[1]+perm[2] != 6 {
+			t.Fatalf("unexpected permutation %v", perm)
+		}
+		seen[key] = true
+		if got := p.Permutation(tc.nums[idx]); len(got) != 3 || [3]int{got[0], got[1], got[2]} != key {
+			t.Fatalf("Permutation(%v) is %v, want %v", tc.nums[idx], got, perm)
+		}
+	}
+}
+
+func TestCountMatchesForEach(t *testing.T) {
+	for idx, p := range []*Permutations{
+		BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5})),
+		BuildPermutations(NewGraphPermutation(egraph()...)),
+		BuildPermutations(NewGraphPermutation(joins()...)),
+		BuildPermutations(NewGraphPermutation(diamonds(3)...)),
+	} {
+		want := len(collect(p))
+		if got := p.Count(); got.Cmp(big.NewInt(int64(want))) != 0 {
+			t.Errorf("generator %d: Count is %v, want %d", idx, got, want)
+		}
+	}
+}
+
+func TestForEachRange(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(diamonds(2)...))
+	all := newCollector()
+	p.ForEach(all)
+	from, to := big.NewInt(3), big.NewInt(11)
+	var want []string
+	for idx, n := range *all.nums {
+		if n.Cmp(from) >= 0 && n.Cmp(to) < 0 {
+			want = append(want, (*all.perms)[idx])
+		}
+	}
+	if len(want) == 0 || len(want) == len(*all.perms) {
+		t.Fatalf("range holds %d of %d permutations", len(want), len(*all.perms))
+	}
+	got := newCollector()
+	p.ForEachRange(from, to, got)
+	checkPerms(t, *got.perms, want)
+
+	got = newCollector()
+	p.ForEachRange(nil, nil, got)
+	checkPerms(t, *got.perms, *all.perms)
+}
+
+func TestWithMaxDepth(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4})).WithMaxDepth(2)
+	c := newCollector()
+	p.ForEach(c)
+	if len(*c.perms) != 12 {
+		t.Fatalf("got %d prefixes, want 12: %q", len(*c.perms), *c.perms)
+	}
+	seen := make(map[string]bool)
+	for idx, perm := range *c.perms {
+		if len(strings.Fields(perm)) != 2 || seen[perm] {
+			t.Fatalf("unexpected prefix %q", perm)
+		}
+		seen[perm] = true
+		if got := permString(p.Permutation((*c.nums)[idx])); got != perm {
+			t.Fatalf("prefix %q numbered as %q", perm, got)
+		}
+	}
+	if count := p.Count(); count.Int64() != 12 {
+		t.Fatalf("Count is %v, want 12", count)
+	}
+	checkPerms(t, collect(p.WithMaxDepth(0)), collect(BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4}))))
+}
+
+func TestWithPrune(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4}))
+	all := newCollector()
+	p.ForEach(all)
+	// Abandon every prefix in which 2 precedes 1.
+	pruned := p.WithPrune(func(prefix []interface{}) bool {
+		return len(prefix) > 0 && prefix[len(prefix)-1] == 1 && containsValue(prefix, 2)
+	})
+	var want []string
+	for _, perm := range *all.perms {
+		if strings.Index(perm, "1") < strings.Index(perm, "2") {
+			want = append(want, perm)
+		}
+	}
+	got := newCollector()
+	pruned.ForEach(got)
+	checkPerms(t, *got.perms, want)
+	for idx, perm := range *got.perms {
+		if n := (*got.nums)[idx]; permString(p.Permutation(n)) != perm {
+			t.Fatalf("pruning renumbered %q as %v", perm, n)
+		}
+	}
+	if count := pruned.Count(); count.Int64() != 12 {
+		t.Fatalf("Count is %v, want 12", count)
+	}
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// retainer keeps every permutation it is given, with Retain.
+type retainer struct {
+	lock  *sync.Mutex
+	perms *[][]interface{}
+}
+
+func (r retainer) Clone() PermutationConsumer {
+	return r
+}
+
+func (r retainer) Consume(n *big.Int, perm []interface{}) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	*r.perms = append(*r.perms, Retain(perm))
+}
+
+func TestRetainSurvivesBatchReuse(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5, 6})).WithWorkers(4)
+	r := retainer{lock: new(sync.Mutex), perms: new([][]interface{})}
+	if err := p.ForEachPar(16, r); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, perm := range *r.perms {
+		seen[permString(perm)] = true
+	}
+	if len(*r.perms) != 720 || len(seen) != 720 {
+		t.Fatalf("retained %d permutations, %d distinct, want 720", len(*r.perms), len(seen))
+	}
+}
+
+func TestWithWorkers(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5}))
+	if got := p.WithWorkers(0).parallelism(); got != runtime.GOMAXPROCS(0) {
+		t.Fatalf("default parallelism %d, want GOMAXPROCS", got)
+	}
+	for _, workers := range []int{1, 3} {
+		var lock sync.Mutex
+		active, most := 0, 0
+		err := p.WithWorkers(workers).ForEachPar(1, consumerFunc(func(n *big.Int, perm []interface{}) {
+			lock.Lock()
+			if active++; active > most {
+				most = active
+			}
+			lock.Unlock()
+			time.Sleep(50 * time.Microsecond)
+			lock.Lock()
+			active--
+			lock.Unlock()
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if most < 1 || most > workers {
+			t.Fatalf("%d workers: %d consumed at once", workers, most)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package gsimsched
+
+import (
+	"fmt"
+	"time"
+)
+
+// Epoch is the time at which the virtual clock of every schedule
+// starts.
+var Epoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// timer is a pending firing of the virtual clock: a Timer, Ticker,
+// AfterFunc or Sleep.
+type timer struct {
+	id int
+	// when is the time, since Epoch, at which the timer fires, and
+	// period, if positive, the interval at which a Ticker fires again.
+	when   time.Duration
+	period time.Duration
+	// On firing, the time is sent to ch if there is room, f is started
+	// in a new goroutine, or g wakes from Sleep.
+	ch *chanState
+	f  func()
+	g  *goroutine
+}
+
+// addTimer makes t pending, firing after d.
+func (e *execution) addTimer(t *timer, d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	t.when = e.now + d
+	e.timers = append(e.timers, t)
+}
+
+// removeTimer stops t, reporting whether it was pending.
+func (e *execution) removeTimer(t *timer) bool {
+	for idx, pending := range e.timers {
+		if pending == t {
+			e.timers = append(e.timers[:idx], e.timers[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// earliest returns the time at which the next timer fires, and false
+// if no timer is pending.
+func (e *execution) earliest() (time.Duration, bool) {
+	if len(e.timers) == 0 {
+		return 0, false
+	}
+	earliest := e.timers[0].when
+	for _, t := range e.timers[1:] {
+		if t.when < earliest {
+			earliest = t.when
+		}
+	}
+	return earliest, true
+}
+
+// appendFirings appends a Step for each timer, other than Sleeps,
+// which may fire next: those due earliest.
+func (e *execution) appendFirings(options []Step) []Step {
+	earliest, found := e.earliest()
+	if !found {
+		return options
+	}
+	for _, t := range e.timers {
+		if t.when == earliest && t.g == nil {
+			options = append(options, Step{Goroutine: -1, Op: fmt.Sprintf("fire timer %d at %v", t.id, t.when), Peer: -1, Timer: t.id})
+		}
+	}
+	return options
+}
+
+// fire fires the timer with the given id, reporting false if it is
+// not pending.
+func (e *execution) fire(id int) bool {
+	var t *timer
+	for _, pending := range e.timers {
+		if pending.id == id {
+			t = pending
+		}
+	}
+	if t == nil || t.g != nil {
+		return false
+	}
+	e.now = t.when
+	if t.period > 0 {
+		t.when += t.period
+	} else {
+		e.removeTimer(t)
+	}
+	switch {
+	case t.ch != nil:
+		// As with time.Timer, a value is dropped if the last has not
+		// been received.
+		if len(t.ch.buf) < t.ch.capacity {
+			t.ch.buf = append(t.ch.buf, Epoch.Add(e.now))
+		}
+	case t.f != nil:
+		e.spawn(t.f)
+	}
+	return true
+}
+
+// Now returns the current time of the virtual clock, which starts at
+// Epoch and only advances as timers fire.
+func (s *Scheduler) Now() time.Time {
+	return Epoch.Add(s.e.now)
+}
+
+// Since returns the time elapsed on the virtual clock since t.
+func (s *Scheduler) Since(t time.Time) time.Duration {
+	return s.Now().Sub(t)
+}
+
+// Sleep pauses the calling goroutine until the virtual clock has
+// advanced by at least d. Waking is a decision point, taken once no
+// other timer is due earlier.
+func (s *Scheduler) Sleep(d time.Duration) {
+	e := s.e
+	g := e.current
+	t := &timer{id: e.newTimerID(), g: g}
+	e.addTimer(t, d)
+	g.timer = t
+	e.park(g, opSleep, fmt.Sprintf("sleep until %v", t.when))
+	g.timer = nil
+}
+
+// After returns a Chan on which the time is sent once d has elapsed
+// on the virtual clock, as time.After.
+func (s *Scheduler) After(d time.Duration) *Chan[time.Time] {
+	return s.NewTimer(d).C
+}
+
+// AfterFunc starts f in a new goroutine once d has elapsed on the
+// virtual clock, as time.AfterFunc. The returned Timer's C is nil;
+// Stop prevents f from starting.
+func (s *Scheduler) AfterFunc(d time.Duration, f func()) *Timer {
+	t := &timer{id: s.e.newTimerID(), f: f}
+	s.e.addTimer(t, d)
+	return &Timer{e: s.e, t: t}
+}
+
+// Timer is a timer of the virtual clock, as time.Timer. Its firing is
+// a decision point of the scheduler, so every placement of a timeout
+// among the other goroutines' steps is explored (see SetIdleClock).
+type Timer struct {
+	C *Chan[time.Time]
+	e *execution
+	t *timer
+}
+
+// NewTimer creates a Timer which sends the time on its C once d has
+// elapsed on the virtual clock.
+func (s *Scheduler) NewTimer(d time.Duration) *Timer {
+	c := NewChan[time.Time](s, 1)
+	t := &timer{id: s.e.newTimerID(), ch: c.state}
+	s.e.addTimer(t, d)
+	return &Timer{C: c, e: s.e, t: t}
+}
+
+// Stop prevents the Timer from firing, reporting whether it had been
+// pending.
+func (tm *Timer) Stop() bool {
+	return tm.e.removeTimer(tm.t)
+}
+
+// Reset makes the Timer fire once d has elapsed from now, reporting
+// whether it had been pending.
+func (tm *Timer) Reset(d time.Duration) bool {
+	pending := tm.e.removeTimer(tm.t)
+	tm.e.addTimer(tm.t, d)
+	return pending
+}
+
+// Ticker is a ticker of the virtual clock, as time.Ticker. Its ticks
+// never end so, unless the clock is idle (see SetIdleClock), it may
+// tick at every decision point and the schedules are bounded only by
+// the step limit: keep that low (see SetMaxSteps).
+type Ticker struct {
+	C *Chan[time.Time]
+	e *execution
+	t *timer
+}
+
+// NewTicker creates a Ticker which sends the time on its C every d on
+// the virtual clock. d must be positive.
+func (s *Scheduler) NewTicker(d time.Duration) *Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	c := NewChan[time.Time](s, 1)
+	t := &timer{id: s.e.newTimerID(), ch: c.state, period: d}
+	s.e.addTimer(t, d)
+	return &Ticker{C: c, e: s.e, t: t}
+}
+
+// Stop stops the Ticker.
+func (tk *Ticker) Stop() {
+	tk.e.removeTimer(tk.t)
+}
+
+func (e *execution) newTimerID() int {
+	e.timerIDs++
+	return e.timerIDs - 1
+}
@@ -0,0 +1,101 @@
+package gsimsched
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSleep(t *testing.T) {
+	h := New(func(s *Scheduler) error {
+		errs := NewChan[error](s, 2)
+		for _, d := range []time.Duration{time.Second, 2 * time.Second} {
+			d := d
+			s.Go(func() {
+				before := s.Now()
+				s.Sleep(d)
+				if got := s.Since(before); got != d {
+					errs.Send(fmt.Errorf("sleep of %v took %v", d, got))
+				} else {
+					errs.Send(nil)
+				}
+			})
+		}
+		for i := 0; i < 2; i++ {
+			if err, _ := errs.Recv(); err != nil {
+				return err
+			}
+		}
+		s.Sleep(3 * time.Second)
+		if now := s.Now(); now.Before(Epoch.Add(4 * time.Second)) {
+			return fmt.Errorf("woke at %v", now)
+		}
+		return nil
+	})
+	if err := h.Explore(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTimers(t *testing.T) {
+	h := New(func(s *Scheduler) error {
+		if v, _ := s.After(time.Second).Recv(); !v.Equal(Epoch.Add(time.Second)) {
+			return fmt.Errorf("After sent %v", v)
+		}
+		stopped := s.NewTimer(time.Second)
+		if !stopped.Stop() || stopped.Stop() {
+			return fmt.Errorf("Stop did not report the Timer pending once")
+		}
+		reset := s.NewTimer(time.Hour)
+		reset.Reset(time.Second)
+		ticker := s.NewTicker(time.Second)
+		s.Sleep(3 * time.Second)
+		ticker.Stop()
+		if stopped.C.Len() != 0 || reset.C.Len() != 1 || ticker.C.Len() != 1 {
+			return fmt.Errorf("timers sent %d, %d and %d values", stopped.C.Len(), reset.C.Len(), ticker.C.Len())
+		}
+		if v, _ := reset.C.Recv(); !v.Equal(Epoch.Add(2 * time.Second)) {
+			return fmt.Errorf("Reset Timer sent %v", v)
+		}
+		return nil
+	})
+	h.SetIdleClock(true)
+	if err := h.Explore(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// timeout runs a goroutine which takes two steps, and an AfterFunc
+// which records how many it has taken, returning the numbers recorded
+// across every schedule.
+func timeout(t *testing.T, idle bool) map[int]bool {
+	t.Helper()
+	seen := make(map[int]bool)
+	h := New(func(s *Scheduler) error {
+		steps := 0
+		s.Go(func() {
+			steps++
+			s.Yield()
+			steps++
+		})
+		s.AfterFunc(time.Second, func() { seen[steps] = true })
+		s.Sleep(2 * time.Second)
+		return nil
+	})
+	h.SetIdleClock(idle)
+	if err := h.Explore(); err != nil {
+		t.Fatal(err)
+	}
+	return seen
+}
+
+func TestIdleClock(t *testing.T) {
+	// Every placement of the timeout among the goroutine's steps is
+	// explored, unless the clock is idle.
+	if got := timeout(t, false); len(got) != 3 {
+		t.Fatalf("timeout saw %v steps", got)
+	}
+	if got := timeout(t, true); len(got) != 1 || !got[2] {
+		t.Fatalf("with an idle clock, timeout saw %v steps", got)
+	}
+}
@@ -0,0 +1,290 @@
+package gsimsched
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+type opKind int
+
+const (
+	opStart opKind = iota
+	opYield
+	// opContinue follows a send to an unbuffered Chan which a
+	// receiver has taken.
+	opContinue
+	opLock
+	opSend
+	opRecv
+	// opSleep waits for the goroutine's timer to be the next to fire.
+	opSleep
+)
+
+// goroutine is a goroutine run by an execution. Its fields are only
+// accessed by whichever of the goroutines and the controller is
+// running, and control is handed over through channels, so no locks
+// are needed.
+type goroutine struct {
+	id int
+	// op is the operation at which the goroutine is waiting, desc its
+	// description, and mutex, ch or timer its object.
+	op    opKind
+	desc  string
+	mutex *Mutex
+	ch    *chanState
+	timer *timer
+	// value is the value being sent, and taken is set once a receiver
+	// has taken it from an unbuffered Chan.
+	value interface{}
+	taken bool
+	// peer is the Peer of the Step which resumed the goroutine.
+	peer int
+	done bool
+	// resume is sent true when the goroutine is chosen to proceed, and
+	// false when it must exit.
+	resume chan bool
+}
+
+// execution is one run of the root function of a Harness.
+type execution struct {
+	h          *Harness
+	goroutines []*goroutine
+	current    *goroutine
+	// parked is sent to when the current goroutine reaches a decision
+	// point, or exits.
+	parked chan struct{}
+	steps  int
+	// err is the outcome, once known, and finished is set then.
+	err      error
+	finished bool
+	aborted  bool
+	mutexes  int
+	chans    int
+	// now is the time of the virtual clock, since Epoch, and timers
+	// those pending, in the order they were set.
+	now      time.Duration
+	timers   []*timer
+	timerIDs int
+}
+
+// newExecution starts the root function of h, which is left waiting
+// to start.
+func newExecution(h *Harness) *execution {
+	e := &execution{h: h, parked: make(chan struct{})}
+	s := &Scheduler{e: e}
+	e.spawn(func() {
+		if err := h.root(s); err != nil {
+			e.finish(err)
+		}
+		e.finish(nil)
+	})
+	return e
+}
+
+// spawn creates a goroutine, waiting to start f.
+func (e *execution) spawn(f func()) {
+	g := &goroutine{
+		id:     len(e.goroutines),
+		op:     opStart,
+		desc:   "start",
+		resume: make(chan bool, 1),
+	}
+	e.goroutines = append(e.goroutines, g)
+	go func() {
+		defer func() {
+			if e.aborted {
+				return
+			}
+			if r := recover(); r != nil {
+				e.finish(&PanicError{Goroutine: g.id, Value: r, Stack: debug.Stack()})
+			}
+			g.done = true
+			e.parked <- struct{}{}
+		}()
+		if !<-g.resume {
+			runtime.Goexit()
+		}
+		f()
+	}()
+}
+
+// finish records the outcome, unless one is already known.
+func (e *execution) finish(err error) {
+	if !e.finished {
+		e.finished = true
+		e.err = err
+	}
+}
+
+// park makes g wait at a decision point until it is chosen.
+func (e *execution) park(g *goroutine, op opKind, desc string) {
+	if e.aborted {
+		runtime.Goexit()
+	}
+	g.op, g.desc = op, desc
+	e.parked <- struct{}{}
+	if !<-g.resume {
+		runtime.Goexit()
+	}
+}
+
+// options returns the Steps which may be taken next, or the outcome,
+// and true, once the execution has finished.
+func (e *execution) options() ([]Step, error, bool) {
+	if e.finished {
+		return nil, e.err, true
+	}
+	options, blocked := e.enabled()
+	if len(options) == 0 {
+		e.finish(&DeadlockError{Blocked: blocked})
+		return nil, e.err, true
+	}
+	return options, nil, false
+}
+
+// enabled returns the Steps which may be taken next, and descriptions
+// of the goroutines which are blocked. Of the timers, only those due
+// earliest may fire, and then, with an idle clock, only if no
+// goroutine can otherwise proceed.
+func (e *execution) enabled() ([]Step, []string) {
+	var options, timed []Step
+	var blocked []string
+	earliest, _ := e.earliest()
+	for _, g := range e.goroutines {
+		switch {
+		case g.done:
+		case g.op == opSleep:
+			if g.timer.when == earliest {
+				timed = append(timed, Step{Goroutine: g.id, Op: g.desc, Peer: -1, Timer: -1})
+			}
+		default:
+			before := len(options)
+			options = e.appendOptions(options, g)
+			if len(options) == before {
+				blocked = append(blocked, fmt.Sprintf("g%d: %s", g.id, g.desc))
+			}
+		}
+	}
+	if !e.h.idleClock || len(options) == 0 {
+		options = append(options, e.appendFirings(timed)...)
+	}
+	return options, blocked
+}
+
+// appendOptions appends the Steps g may take.
+func (e *execution) appendOptions(options []Step, g *goroutine) []Step {
+	step := Step{Goroutine: g.id, Op: g.desc, Peer: -1, Timer: -1}
+	switch g.op {
+	case opStart, opYield, opContinue:
+		return append(options, step)
+	case opLock:
+		if !g.mutex.locked {
+			return append(options, step)
+		}
+	case opSend:
+		ch := g.ch
+		if ch.closed || len(ch.buf) < ch.capacity {
+			return append(options, step)
+		}
+	case opRecv:
+		ch := g.ch
+		if ch.capacity > 0 {
+			if len(ch.buf) > 0 || ch.closed {
+				return append(options, step)
+			}
+			return options
+		}
+		// Each sender waiting on an unbuffered Chan is a different
+		// choice.
+		found := false
+		for _, sender := range e.goroutines {
+			if !sender.done && sender.op == opSend && sender.ch == ch {
+				step.Peer = sender.id
+				options = append(options, step)
+				found = true
+			}
+		}
+		if !found && ch.closed {
+			return append(options, step)
+		}
+	}
+	return options
+}
+
+// step fires the timer, or resumes the goroutine, chosen by the Step,
+// and waits until the goroutine reaches its next decision point. It
+// reports false if the Step was not possible, in which case the
+// execution has finished.
+func (e *execution) step(chosen Step) bool {
+	if e.finished {
+		return false
+	}
+	options, _ := e.enabled()
+	possible := false
+	for _, option := range options {
+		possible = possible || option.same(chosen)
+	}
+	if !possible {
+		e.finish(ErrNondeterministic)
+		return false
+	}
+	e.steps++
+	if e.steps > e.h.maxSteps {
+		e.finish(ErrStepLimit)
+		return false
+	}
+	if chosen.Timer >= 0 {
+		return e.fire(chosen.Timer)
+	}
+	g := e.goroutines[chosen.Goroutine]
+	if g.op == opSleep {
+		e.now = g.timer.when
+		e.removeTimer(g.timer)
+	}
+	g.peer = chosen.Peer
+	e.current = g
+	g.resume <- true
+	<-e.parked
+	return !e.finished
+}
+
+// abort stops every goroutine which has not finished. It must only be
+// called when no goroutine is running.
+func (e *execution) abort() {
+	if e.aborted {
+		return
+	}
+	e.aborted = true
+	for _, g := range e.goroutines {
+		if !g.done {
+			g.resume <- false
+		}
+	}
+}
+
+// Scheduler is the interface through which the code under test
+// creates goroutines and synchronisation primitives, and yields.
+type Scheduler struct {
+	e *execution
+}
+
+// Go starts f in a new goroutine, run by the scheduler. It does not
+// itself yield: the new goroutine waits to start until the scheduler
+// chooses it.
+func (s *Scheduler) Go(f func()) {
+	s.e.spawn(f)
+}
+
+// Yield is a decision point at which any other goroutine may run
+// first. Use it to mark where accesses to shared memory may
+// interleave.
+func (s *Scheduler) Yield() {
+	s.e.park(s.e.current, opYield, "yield")
+}
+
+// Goroutine returns the id of the calling goroutine.
+func (s *Scheduler) Goroutine() int {
+	return s.e.current.id
+}
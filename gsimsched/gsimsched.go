@@ -0,0 +1,299 @@
+// Package gsimsched runs real concurrent Go code under a cooperative
+// scheduler whose decisions are driven by gsim, so that every
+// interleaving of the code's goroutines, at the points where they
+// synchronise, is explored exhaustively. The permutations thus
+// exercise the real implementation rather than a hand-written model
+// of it. For example:
+//
+//	h := gsimsched.New(func(s *gsimsched.Scheduler) error {
+//		mu := s.NewMutex()
+//		done := gsimsched.NewChan[bool](s, 0)
+//		counter := 0
+//		for i := 0; i < 2; i++ {
+//			s.Go(func() {
+//				mu.Lock()
+//				v := counter
+//				mu.Unlock()
+//				s.Yield()
+//				mu.Lock()
+//				counter = v + 1
+//				mu.Unlock()
+//				done.Send(true)
+//			})
+//		}
+//		done.Recv()
+//		done.Recv()
+//		if counter != 2 {
+//			return fmt.Errorf("lost update: counter is %d", counter)
+//		}
+//		return nil
+//	})
+//	err := h.Explore()
+//
+// Explore returns a *gsim.PermutationError identifying the first
+// schedule which fails, and Schedule recreates that schedule from its
+// number for debugging.
+//
+// Only one goroutine runs at a time. Each runs until it reaches a
+// decision point: starting, Yield, locking a Mutex, sending to or
+// receiving from a Chan, and Sleep. The scheduler then chooses which
+// of the goroutines able to proceed does so, and each choice is an
+// element, a Step, of the permutation. Every permutation ends with a
+// final Step which records the outcome of the schedule: whether the
+// root function returned an error, a goroutine panicked, or the
+// goroutines deadlocked.
+//
+// Time is virtual: Scheduler.Now starts at Epoch, and advances only as
+// the timers created by Sleep, After, AfterFunc, NewTimer and
+// NewTicker fire, in order of their deadlines. Each firing is a Step
+// of its own, so timeouts are explored as just another interleaving
+// (see SetIdleClock).
+//
+// The code must be deterministic given the schedule, must create
+// goroutines only with Scheduler.Go, and must synchronise only with
+// the primitives of this package (or through memory, between decision
+// points): blocking on anything else blocks the scheduler. Each
+// schedule is run afresh from the root function, so the root function
+// must create all the state it uses.
+package gsimsched
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"runtime"
+
+	"github.com/msackman/gsim"
+)
+
+// DefaultMaxSteps is the number of Steps after which a schedule is
+// abandoned, with ErrStepLimit, unless set with SetMaxSteps.
+const DefaultMaxSteps = 10000
+
+var (
+	// ErrStepLimit is the outcome of a schedule which exceeded the
+	// maximum number of Steps: for example, because goroutines Yield
+	// in a loop waiting for each other.
+	ErrStepLimit = errors.New("step limit exceeded")
+	// ErrNondeterministic is the outcome of a schedule which could not
+	// be replayed, because the code behaved differently given the
+	// same decisions.
+	ErrNondeterministic = errors.New("code is not deterministic given the schedule")
+)
+
+// PanicError is the outcome of a schedule in which a goroutine
+// panicked.
+type PanicError struct {
+	// Goroutine is the id of the goroutine which panicked.
+	Goroutine int
+	// Value is the value passed to panic, and Stack the goroutine's
+	// stack at the time.
+	Value interface{}
+	Stack []byte
+}
+
+func (pe *PanicError) Error() string {
+	return fmt.Sprintf("goroutine %d panicked: %v", pe.Goroutine, pe.Value)
+}
+
+// DeadlockError is the outcome of a schedule in which no goroutine
+// could proceed before the root function returned.
+type DeadlockError struct {
+	// Blocked describes the operation on which each goroutine which
+	// had not finished was blocked.
+	Blocked []string
+}
+
+func (de *DeadlockError) Error() string {
+	return fmt.Sprintf("deadlock: %v", de.Blocked)
+}
+
+// Step is a decision of the scheduler, and the element of
+// permutations. Goroutines are identified by the order in which they
+// were created: the root function runs as goroutine 0.
+type Step struct {
+	// Goroutine is the goroutine which proceeds, and Op describes the
+	// operation at which it was waiting.
+	Goroutine int
+	Op        string
+	// Peer, unless -1, is the goroutine whose send to an unbuffered
+	// Chan the receive takes.
+	Peer int
+	// Timer, unless -1, is the timer of the virtual clock which fires,
+	// in which case Goroutine is -1.
+	Timer int
+	// End is set on the final Step of every permutation, whose Err is
+	// the outcome of the schedule: nil if the root function returned
+	// nil.
+	End bool
+	Err error
+}
+
+func (s Step) String() string {
+	switch {
+	case s.End && s.Err == nil:
+		return "end"
+	case s.End:
+		return fmt.Sprintf("end: %v", s.Err)
+	case s.Timer >= 0:
+		return fmt.Sprintf("clock: %s", s.Op)
+	case s.Peer >= 0:
+		return fmt.Sprintf("g%d: %s from g%d", s.Goroutine, s.Op, s.Peer)
+	default:
+		return fmt.Sprintf("g%d: %s", s.Goroutine, s.Op)
+	}
+}
+
+// same reports whether s and s2 are the same decision.
+func (s Step) same(s2 Step) bool {
+	return s.Goroutine == s2.Goroutine && s.Op == s2.Op && s.Peer == s2.Peer && s.Timer == s2.Timer && s.End == s2.End
+}
+
+// Harness explores the schedules of a root function. See New.
+type Harness struct {
+	root      func(s *Scheduler) error
+	maxSteps  int
+	idleClock bool
+}
+
+// New creates a Harness which explores the schedules of root, which
+// runs as goroutine 0. As with main, the schedule ends once root
+// returns, whatever the other goroutines are doing.
+func New(root func(s *Scheduler) error) *Harness {
+	return &Harness{root: root, maxSteps: DefaultMaxSteps}
+}
+
+// SetMaxSteps sets the number of Steps after which a schedule is
+// abandoned, with ErrStepLimit. This must be done before the Harness
+// is used.
+func (h *Harness) SetMaxSteps(n int) {
+	h.maxSteps = n
+}
+
+// SetIdleClock sets whether timers of the virtual clock fire only
+// when no goroutine can otherwise proceed, as though the code took no
+// time to run. By default, the firing of a timer due next is a choice
+// at every decision point, so every placement of a timeout among the
+// other goroutines' steps is explored; with an idle clock, there are
+// far fewer schedules, but a timeout never preempts work which could
+// proceed. This must be done before the Harness is used.
+func (h *Harness) SetIdleClock(idle bool) {
+	h.idleClock = idle
+}
+
+// NewGenerator creates an OptionGenerator whose permutations are the
+// schedules of the root function.
+func (h *Harness) NewGenerator() gsim.TypedOptionGenerator[Step] {
+	return &generator{h: h}
+}
+
+// Permutations returns the permutations of NewGenerator, ready for
+// any of the gsim iteration functions, and options such as
+// WithMaxDepth.
+func (h *Harness) Permutations() *gsim.TypedPermutations[Step] {
+	return gsim.BuildTypedPermutations(h.NewGenerator())
+}
+
+// Explore runs every schedule, returning a *gsim.PermutationError
+// wrapping the outcome of the first which fails, or nil if none does.
+func (h *Harness) Explore() error {
+	return h.Permutations().ForEachCheck(Checker{})
+}
+
+// Schedule returns the permutation with the given number, whose last
+// Step holds its outcome.
+func (h *Harness) Schedule(n *big.Int) []Step {
+	return h.Permutations().Permutation(n)
+}
+
+// Checker is a gsim.TypedPermutationChecker which fails the
+// permutations whose outcome is an error. It may be used with any of
+// the checking iteration functions, such as ForEachParCheck.
+type Checker struct{}
+
+func (Checker) Clone() gsim.TypedPermutationChecker[Step] {
+	return Checker{}
+}
+
+func (Checker) Check(n *big.Int, perm []Step) error {
+	return Outcome(perm)
+}
+
+// Outcome returns the outcome of the schedule: the Err of its final
+// Step.
+func Outcome(perm []Step) error {
+	if len(perm) == 0 {
+		return nil
+	}
+	return perm[len(perm)-1].Err
+}
+
+// generator is the OptionGenerator of a Harness. It holds the Steps
+// chosen so far and, unless it is a clone which has not yet been
+// used, an execution which has followed them. Clones replay the
+// Steps afresh, so, as the walk hands each generator on to one child
+// and clones it for the rest, each schedule costs about one run of
+// the root function.
+type generator struct {
+	h       *Harness
+	started bool
+	prefix  []Step
+	exec    *execution
+}
+
+func (g *generator) Clone() gsim.TypedOptionGenerator[Step] {
+	return &generator{
+		h:       g.h,
+		started: g.started,
+		prefix:  append([]Step(nil), g.prefix...),
+	}
+}
+
+func (g *generator) Generate(chosen Step) []Step {
+	if !g.started {
+		g.started = true
+		g.startExecution()
+		return g.options()
+	}
+	if chosen.End {
+		return nil
+	}
+	if g.exec == nil {
+		g.startExecution()
+		for _, step := range g.prefix {
+			if !g.exec.step(step) {
+				// The steps were followed once without finishing.
+				g.exec.err = ErrNondeterministic
+				break
+			}
+		}
+	}
+	g.prefix = append(g.prefix, chosen)
+	g.exec.step(chosen)
+	return g.options()
+}
+
+// startExecution starts a new execution of the root function. Should
+// the generator be abandoned with the execution unfinished (as it is
+// when a subtree is pruned, for example), its goroutines are stopped
+// once the generator is garbage collected.
+func (g *generator) startExecution() {
+	g.exec = newExecution(g.h)
+	runtime.SetFinalizer(g, func(g *generator) {
+		if g.exec != nil {
+			g.exec.abort()
+		}
+	})
+}
+
+// options returns the Steps which may follow, or the final Step if
+// the execution has finished, in which case it is discarded.
+func (g *generator) options() []Step {
+	options, err, finished := g.exec.options()
+	if !finished {
+		return options
+	}
+	g.exec.abort()
+	g.exec = nil
+	return []Step{{Goroutine: -1, Op: "end", Peer: -1, Timer: -1, End: true, Err: err}}
+}
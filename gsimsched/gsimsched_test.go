@@ -0,0 +1,174 @@
+package gsimsched
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/msackman/gsim"
+)
+
+// outcomes returns the outcome of every schedule of h, as strings,
+// with the number of schedules with each.
+func outcomes(h *Harness) map[string]int {
+	seen := make(map[string]int)
+	h.Permutations().ForEach(consumerFunc(func(n *big.Int, perm []Step) {
+		seen[fmt.Sprint(Outcome(perm))]++
+	}))
+	return seen
+}
+
+// consumerFunc is a TypedPermutationConsumer which calls a function.
+type consumerFunc func(n *big.Int, perm []Step)
+
+func (cf consumerFunc) Clone() gsim.TypedPermutationConsumer[Step] {
+	return cf
+}
+
+func (cf consumerFunc) Consume(n *big.Int, perm []Step) {
+	cf(n, perm)
+}
+
+// counter increments a counter from two goroutines, with the read and
+// the write in separate critical sections unless atomic is set.
+func counter(atomic bool) *Harness {
+	return New(func(s *Scheduler) error {
+		mu := s.NewMutex()
+		done := NewChan[bool](s, 0)
+		counter := 0
+		for i := 0; i < 2; i++ {
+			s.Go(func() {
+				mu.Lock()
+				v := counter
+				if !atomic {
+					mu.Unlock()
+					s.Yield()
+					mu.Lock()
+				}
+				counter = v + 1
+				mu.Unlock()
+				done.Send(true)
+			})
+		}
+		done.Recv()
+		done.Recv()
+		if counter != 2 {
+			return fmt.Errorf("lost update: counter is %d", counter)
+		}
+		return nil
+	})
+}
+
+func TestExploreFindsLostUpdate(t *testing.T) {
+	h := counter(false)
+	err := h.Explore()
+	var pe *gsim.PermutationError
+	if !errors.As(err, &pe) {
+		t.Fatalf("got %v, want a PermutationError", err)
+	}
+	schedule := h.Schedule(pe.N)
+	if got := fmt.Sprint(Outcome(schedule)); got != "lost update: counter is 1" {
+		t.Fatalf("schedule %v ended with %q", schedule, got)
+	}
+	if last := schedule[len(schedule)-1]; !last.End || last.String() != "end: lost update: counter is 1" {
+		t.Fatalf("final step is %v", last)
+	}
+	seen := outcomes(h)
+	if seen["<nil>"] == 0 || seen["lost update: counter is 1"] == 0 || len(seen) != 2 {
+		t.Fatalf("got outcomes %v", seen)
+	}
+}
+
+func TestExplorePasses(t *testing.T) {
+	h := counter(true)
+	if err := h.Explore(); err != nil {
+		t.Fatal(err)
+	}
+	if seen := outcomes(h); len(seen) != 1 || seen["<nil>"] < 2 {
+		t.Fatalf("got outcomes %v", seen)
+	}
+	if err := h.Permutations().WithWorkers(2).ForEachParCheck(4, Checker{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeadlock(t *testing.T) {
+	h := New(func(s *Scheduler) error {
+		a, b := s.NewMutex(), s.NewMutex()
+		done := NewChan[bool](s, 2)
+		s.Go(func() {
+			a.Lock()
+			b.Lock()
+			b.Unlock()
+			a.Unlock()
+			done.Send(true)
+		})
+		s.Go(func() {
+			b.Lock()
+			a.Lock()
+			a.Unlock()
+			b.Unlock()
+			done.Send(true)
+		})
+		done.Recv()
+		done.Recv()
+		return nil
+	})
+	err := h.Explore()
+	var de *DeadlockError
+	if !errors.As(err, &de) || len(de.Blocked) != 3 {
+		t.Fatalf("got %v, want a deadlock of 3 goroutines", err)
+	}
+	if seen := outcomes(h); seen["<nil>"] == 0 {
+		t.Fatalf("no schedule passed: %v", seen)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	h := New(func(s *Scheduler) error {
+		c := NewChan[int](s, 0)
+		s.Go(func() { c.Send(1) })
+		s.Go(func() { c.Send(2) })
+		if v, _ := c.Recv(); v == 2 {
+			panic("received 2 first")
+		}
+		c.Recv()
+		return nil
+	})
+	err := h.Explore()
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe.Goroutine != 0 || pe.Value != "received 2 first" {
+		t.Fatalf("got %v, want a panic of goroutine 0", err)
+	}
+	// The receive takes from each sender in turn.
+	peers := make(map[int]bool)
+	h.Permutations().ForEach(consumerFunc(func(n *big.Int, perm []Step) {
+		for _, step := range perm {
+			if step.Peer >= 0 {
+				peers[step.Peer] = true
+			}
+		}
+	}))
+	if !peers[1] || !peers[2] {
+		t.Fatalf("received from %v", peers)
+	}
+}
+
+func TestStepLimit(t *testing.T) {
+	h := New(func(s *Scheduler) error {
+		ready := false
+		s.Go(func() {
+			for !ready {
+				s.Yield()
+			}
+		})
+		for {
+			s.Yield()
+		}
+	})
+	h.SetMaxSteps(8)
+	if err := h.Explore(); !errors.Is(err, ErrStepLimit) {
+		t.Fatalf("got %v, want %v", err, ErrStepLimit)
+	}
+}
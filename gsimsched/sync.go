@@ -0,0 +1,127 @@
+package gsimsched
+
+import (
+	"fmt"
+)
+
+// Mutex is a mutual exclusion lock, as sync.Mutex, whose Lock is a
+// decision point: when several goroutines are waiting for it, each
+// order in which they acquire it is explored. Unlock is not a
+// decision point.
+type Mutex struct {
+	e      *execution
+	id     int
+	locked bool
+}
+
+// NewMutex creates an unlocked Mutex.
+func (s *Scheduler) NewMutex() *Mutex {
+	m := &Mutex{e: s.e, id: s.e.mutexes}
+	s.e.mutexes++
+	return m
+}
+
+// Lock waits until the Mutex is unlocked, and then locks it.
+func (m *Mutex) Lock() {
+	g := m.e.current
+	g.mutex = m
+	m.e.park(g, opLock, fmt.Sprintf("lock mutex %d", m.id))
+	g.mutex = nil
+	m.locked = true
+}
+
+// Unlock unlocks the Mutex. As with sync.Mutex, it is a run-time
+// error (a panic, reported as the schedule's outcome) if the Mutex is
+// not locked.
+func (m *Mutex) Unlock() {
+	if !m.locked {
+		panic(fmt.Sprintf("unlock of unlocked mutex %d", m.id))
+	}
+	m.locked = false
+}
+
+// chanState is the untyped state of a Chan.
+type chanState struct {
+	id       int
+	capacity int
+	buf      []interface{}
+	closed   bool
+}
+
+// Chan is a channel, as a Go chan of V with the given capacity, whose
+// Send and Recv are decision points. A receive from an unbuffered
+// Chan with several senders waiting explores taking from each of
+// them.
+type Chan[V any] struct {
+	e     *execution
+	state *chanState
+}
+
+// NewChan creates a Chan with the given capacity: 0 for an unbuffered
+// Chan.
+func NewChan[V any](s *Scheduler, capacity int) *Chan[V] {
+	c := &Chan[V]{e: s.e, state: &chanState{id: s.e.chans, capacity: capacity}}
+	s.e.chans++
+	return c
+}
+
+// Send sends v, waiting until there is room in the buffer or, if the
+// Chan is unbuffered, until a receiver takes it. As with a Go chan,
+// sending on a closed Chan panics.
+func (c *Chan[V]) Send(v V) {
+	g := c.e.current
+	ch := c.state
+	g.ch, g.value, g.taken = ch, v, false
+	c.e.park(g, opSend, fmt.Sprintf("send chan %d", ch.id))
+	// An unbuffered Chan's sender only proceeds once a receiver has
+	// taken the value, or the Chan is closed.
+	taken := g.taken
+	g.ch, g.value, g.taken = nil, nil, false
+	switch {
+	case taken:
+	case ch.closed:
+		panic(fmt.Sprintf("send on closed chan %d", ch.id))
+	default:
+		ch.buf = append(ch.buf, v)
+	}
+}
+
+// Recv receives a value, waiting until one is available. As with a
+// Go chan, ok is false if the Chan is closed and empty.
+func (c *Chan[V]) Recv() (v V, ok bool) {
+	g := c.e.current
+	ch := c.state
+	g.ch = ch
+	c.e.park(g, opRecv, fmt.Sprintf("recv chan %d", ch.id))
+	g.ch = nil
+	switch {
+	case g.peer >= 0:
+		sender := c.e.goroutines[g.peer]
+		value := sender.value
+		sender.taken = true
+		sender.op, sender.desc = opContinue, fmt.Sprintf("continue after send chan %d", ch.id)
+		v, _ = value.(V) // a nil interface fails the assertion
+		return v, true
+	case len(ch.buf) > 0:
+		value := ch.buf[0]
+		ch.buf[0] = nil
+		ch.buf = ch.buf[1:]
+		v, _ = value.(V)
+		return v, true
+	}
+	return v, false
+}
+
+// Close closes the Chan. It is not a decision point. As with a Go
+// chan, closing a closed Chan panics.
+func (c *Chan[V]) Close() {
+	if c.state.closed {
+		panic(fmt.Sprintf("close of closed chan %d", c.state.id))
+	}
+	c.state.closed = true
+}
+
+// Len returns the number of values buffered.
+func (c *Chan[V]) Len() int {
+	return len(c.state.buf)
+}
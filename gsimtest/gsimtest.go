@@ -0,0 +1,106 @@
+// Package gsimtest integrates gsim with go test, running every
+// permutation as a subtest named after its permutation number. For
+// example:
+//
+//	func TestProtocol(t *testing.T) {
+//		gsimtest.Run(t, gsim.NewGraphPermutation(start...), func(t *testing.T, n *big.Int, perm []interface{}) {
+//			if err := interpret(perm); err != nil {
+//				t.Fatal(err)
+//			}
+//		})
+//	}
+//
+// A failing permutation is reported as, for example,
+// TestProtocol/1234, along with how to re-run it alone. As the
+// subtests are named by number, go test's -run flag selects them as
+// usual, but that still generates every permutation; two environment
+// variables restrict generation instead:
+//
+//	GSIM_REPLAY=1234,5678   runs only the permutations with those numbers
+//	GSIM_SHARD=2/8          runs only the third of eight shards (see Shard)
+package gsimtest
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/msackman/gsim"
+)
+
+// Run runs f, as a subtest of t, for every permutation generated by
+// gen. See RunPermutations.
+func Run(t *testing.T, gen gsim.OptionGenerator, f func(t *testing.T, n *big.Int, perm []interface{})) {
+	t.Helper()
+	RunPermutations(t, gsim.BuildPermutations(gen), f)
+}
+
+// RunPermutations runs f, as a subtest of t named after the
+// permutation number, for every permutation of p, subject to the
+// GSIM_REPLAY and GSIM_SHARD environment variables. The permutation
+// belongs to f, so the subtest may call t.Parallel.
+func RunPermutations[T any](t *testing.T, p *gsim.TypedPermutations[T], f func(t *testing.T, n *big.Int, perm []T)) {
+	t.Helper()
+	c := &consumer[T]{t: t, f: f}
+	if replay := os.Getenv("GSIM_REPLAY"); replay != "" {
+		var nums []*big.Int
+		for _, field := range strings.Split(replay, ",") {
+			n, ok := new(big.Int).SetString(strings.TrimSpace(field), 10)
+			if !ok {
+				t.Fatalf("GSIM_REPLAY: malformed permutation number %q", field)
+			}
+			nums = append(nums, n)
+		}
+		if err := p.Replay(nums, c); err != nil {
+			t.Fatalf("GSIM_REPLAY: %v", err)
+		}
+		return
+	}
+	if shard := os.Getenv("GSIM_SHARD"); shard != "" {
+		i, n, err := parseShard(shard)
+		if err != nil {
+			t.Fatalf("GSIM_SHARD: %v", err)
+		}
+		p = p.Shard(i, n)
+	}
+	p.ForEach(c)
+}
+
+// parseShard parses "i/n", where 0 <= i < n.
+func parseShard(shard string) (int, int, error) {
+	iStr, nStr, found := strings.Cut(shard, "/")
+	i, err := strconv.Atoi(iStr)
+	if err != nil || !found {
+		return 0, 0, fmt.Errorf("malformed shard %q: expected i/n", shard)
+	}
+	n, err := strconv.Atoi(nStr)
+	if err != nil || i < 0 || i >= n {
+		return 0, 0, fmt.Errorf("malformed shard %q: expected i/n with 0 <= i < n", shard)
+	}
+	return i, n, nil
+}
+
+type consumer[T any] struct {
+	t *testing.T
+	f func(t *testing.T, n *big.Int, perm []T)
+}
+
+func (c *consumer[T]) Clone() gsim.TypedPermutationConsumer[T] {
+	return c
+}
+
+func (c *consumer[T]) Consume(n *big.Int, perm []T) {
+	n = new(big.Int).Set(n)
+	perm = gsim.Retain(perm)
+	c.t.Run(n.String(), func(t *testing.T) {
+		defer func() {
+			if t.Failed() {
+				t.Logf("re-run with GSIM_REPLAY=%v", n)
+			}
+		}()
+		c.f(t, n, perm)
+	})
+}
@@ -0,0 +1,81 @@
+package gsimtest
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/msackman/gsim"
+)
+
+// run runs the permutations of 1, 2, 3 with RunPermutations, as
+// parallel subtests of a subtest of t, and returns the numbers of
+// those which ran, sorted.
+func run(t *testing.T) []string {
+	p := gsim.BuildPermutations(gsim.NewSimplePermutation([]interface{}{1, 2, 3}))
+	var lock sync.Mutex
+	var ran []string
+	t.Run("run", func(t *testing.T) {
+		RunPermutations(t, p, func(t *testing.T, n *big.Int, perm []interface{}) {
+			t.Parallel()
+			if !strings.HasSuffix(t.Name(), "/"+n.String()) {
+				t.Errorf("subtest %s runs permutation %v", t.Name(), n)
+			}
+			if got := p.Permutation(n); fmt.Sprint(got) != fmt.Sprint(perm) {
+				t.Errorf("%v is not permutation %v", perm, got)
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			ran = append(ran, n.String())
+		})
+	})
+	sort.Strings(ran)
+	return ran
+}
+
+func TestRunPermutations(t *testing.T) {
+	if ran := run(t); strings.Join(ran, " ") != "0 1 2 3 4 5" {
+		t.Fatalf("ran %q", ran)
+	}
+}
+
+func TestRunPermutationsReplay(t *testing.T) {
+	t.Setenv("GSIM_REPLAY", "4, 1")
+	if ran := run(t); strings.Join(ran, " ") != "1 4" {
+		t.Fatalf("ran %q", ran)
+	}
+}
+
+func TestRunPermutationsShard(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, shard := range []string{"0/2", "1/2"} {
+		t.Setenv("GSIM_SHARD", shard)
+		ran := run(t)
+		if len(ran) == 0 || len(ran) == 6 {
+			t.Fatalf("shard %s ran %q", shard, ran)
+		}
+		for _, name := range ran {
+			if seen[name] {
+				t.Fatalf("%s ran twice", name)
+			}
+			seen[name] = true
+		}
+	}
+	if len(seen) != 6 {
+		t.Fatalf("shards ran %d permutations, want 6", len(seen))
+	}
+}
+
+func TestParseShard(t *testing.T) {
+	if i, n, err := parseShard("2/8"); err != nil || i != 2 || n != 8 {
+		t.Fatalf("got %d/%d, %v", i, n, err)
+	}
+	for _, shard := range []string{"", "2", "a/8", "2/b", "8/8", "-1/8"} {
+		if _, _, err := parseShard(shard); err == nil {
+			t.Errorf("%q parsed", shard)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+// Package gsimtrace builds gsim graphs from real executions. Code
+// under test synchronises through the wrapped channels, mutexes and
+// wait groups of a Recorder, which record each synchronisation event
+// as it happens, along with the happens-before edges between events
+// of different threads. Graph then emits a graph whose permutations
+// are every alternative schedule of the recorded execution: every
+// order of its events which preserves the causality observed. This
+// builds the model of a system automatically, from one run of the
+// real thing. For example:
+//
+//	r := gsimtrace.NewRecorder()
+//	main := r.Thread("main")
+//	mu := r.NewMutex("mu")
+//	wg := r.NewWaitGroup("wg")
+//	wg.Add(main, 2)
+//	for _, name := range []string{"a", "b"} {
+//		main.Go(name, func(t *gsimtrace.Thread) {
+//			mu.Lock(t)
+//			t.Note("increment")
+//			mu.Unlock(t)
+//			wg.Done(t)
+//		})
+//	}
+//	wg.Wait(main)
+//	nodes, start, err := r.Graph()
+//
+// As with Go's memory model, the happens-before edges are those of
+// program order, go statements, each unlock of a Mutex and the lock
+// which follows it, each send on a Chan and the receive which takes
+// it, the capacity of a Chan, closing a Chan, and WaitGroup's Done and
+// Wait. The schedules therefore acquire each Mutex in the recorded
+// order and match the same sends to receives: they explore how
+// independent events interleave, not how the code would have behaved
+// had it synchronised differently, for which see gsimsched.
+//
+// As goroutines have no identity in Go, each is represented by a
+// Thread, which the code passes to every operation it performs.
+package gsimtrace
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/msackman/gsim"
+)
+
+// Event is an event of the recorded execution, and the value of its
+// GraphNode.
+type Event struct {
+	// Thread is the name of the thread which performed the event, and
+	// Op describes it: for example, "lock mu" or "send ch".
+	Thread string
+	Op     string
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%s: %s", e.Thread, e.Op)
+}
+
+type eventKind int
+
+const (
+	eventNote eventKind = iota
+	eventGo
+	eventLock
+	eventUnlock
+	eventSend
+	eventRecv
+	eventClose
+	eventDone
+	eventWait
+)
+
+// event is an Event with what the Recorder needs to find its edges.
+type event struct {
+	Event
+	kind   eventKind
+	thread *Thread
+	// obj is the Mutex, chanState or WaitGroup of the event.
+	obj interface{}
+	// send is the event index of the send a receive took, or -1 if the
+	// Chan was closed.
+	send int
+}
+
+// Recorder records the synchronisation events of an execution. Its
+// methods are safe for concurrent use.
+type Recorder struct {
+	lock   sync.Mutex
+	events []*event
+}
+
+// NewRecorder creates a Recorder with no events.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// record appends an event, returning its index.
+func (r *Recorder) record(e *event) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, e)
+	return len(r.events) - 1
+}
+
+// Events returns the events recorded so far, in the order they were
+// recorded.
+func (r *Recorder) Events() []Event {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	events := make([]Event, len(r.events))
+	for idx, e := range r.events {
+		events[idx] = e.Event
+	}
+	return events
+}
+
+// Thread is a thread of the recorded execution: a goroutine, passed
+// to each operation it performs. A Thread must only be used by one
+// goroutine at a time.
+type Thread struct {
+	r    *Recorder
+	name string
+	// spawn is the index of the go event which started the thread, or
+	// -1 for a Thread created with Recorder.Thread.
+	spawn int
+}
+
+// Thread creates a Thread which, unlike those started with Go, follows
+// no other: typically the goroutine in which recording starts.
+func (r *Recorder) Thread(name string) *Thread {
+	return &Thread{r: r, name: name, spawn: -1}
+}
+
+// Name returns the name of the Thread.
+func (t *Thread) Name() string {
+	return t.name
+}
+
+// Go starts f in a new goroutine, as the Thread with the given name,
+// recording the go statement as an event of t.
+func (t *Thread) Go(name string, f func(t *Thread)) {
+	spawn := t.r.record(&event{Event: Event{Thread: t.name, Op: "go " + name}, kind: eventGo, thread: t})
+	child := &Thread{r: t.r, name: name, spawn: spawn}
+	go f(child)
+}
+
+// Note records an event of the Thread other than synchronisation,
+// such as an access to shared state, so that schedules place it too.
+func (t *Thread) Note(op string) {
+	t.r.record(&event{Event: Event{Thread: t.name, Op: op}, kind: eventNote, thread: t})
+}
+
+// Mutex is a sync.Mutex whose Lock and Unlock are recorded.
+type Mutex struct {
+	r    *Recorder
+	name string
+	mu   sync.Mutex
+}
+
+// NewMutex creates an unlocked Mutex with the given name.
+func (r *Recorder) NewMutex(name string) *Mutex {
+	return &Mutex{r: r, name: name}
+}
+
+// Lock locks the Mutex, as the Thread t.
+func (m *Mutex) Lock(t *Thread) {
+	m.mu.Lock()
+	m.r.record(&event{Event: Event{Thread: t.name, Op: "lock " + m.name}, kind: eventLock, thread: t, obj: m})
+}
+
+// Unlock unlocks the Mutex, as the Thread t.
+func (m *Mutex) Unlock(t *Thread) {
+	m.r.record(&event{Event: Event{Thread: t.name, Op: "unlock " + m.name}, kind: eventUnlock, thread: t, obj: m})
+	m.mu.Unlock()
+}
+
+// chanState is the untyped state of a Chan.
+type chanState struct {
+	name     string
+	capacity int
+}
+
+// item is a value sent on a Chan, with the index of its send event.
+type item[V any] struct {
+	value V
+	send  int
+}
+
+// Chan is a Go chan of V whose sends, receives and close are
+// recorded.
+type Chan[V any] struct {
+	r     *Recorder
+	state *chanState
+	ch    chan item[V]
+}
+
+// NewChan creates a Chan with the given name and capacity: 0 for an
+// unbuffered Chan.
+func NewChan[V any](r *Recorder, name string, capacity int) *Chan[V] {
+	return &Chan[V]{
+		r:     r,
+		state: &chanState{name: name, capacity: capacity},
+		ch:    make(chan item[V], capacity),
+	}
+}
+
+// Send sends v, as the Thread t.
+func (c *Chan[V]) Send(t *Thread, v V) {
+	send := c.r.record(&event{Event: Event{Thread: t.name, Op: "send " + c.state.name}, kind: eventSend, thread: t, obj: c.state})
+	c.ch <- item[V]{value: v, send: send}
+}
+
+// Recv receives a value, as the Thread t. As with a Go chan, ok is
+// false if the Chan is closed and empty.
+func (c *Chan[V]) Recv(t *Thread) (v V, ok bool) {
+	it, ok := <-c.ch
+	e := &event{Event: Event{Thread: t.name, Op: "recv " + c.state.name}, kind: eventRecv, thread: t, obj: c.state, send: it.send}
+	if !ok {
+		e.Op, e.send = "recv closed "+c.state.name, -1
+	}
+	c.r.record(e)
+	return it.value, ok
+}
+
+// Close closes the Chan, as the Thread t.
+func (c *Chan[V]) Close(t *Thread) {
+	c.r.record(&event{Event: Event{Thread: t.name, Op: "close " + c.state.name}, kind: eventClose, thread: t, obj: c.state})
+	close(c.ch)
+}
+
+// WaitGroup is a sync.WaitGroup whose Add, Done and Wait are
+// recorded.
+type WaitGroup struct {
+	r    *Recorder
+	name string
+	wg   sync.WaitGroup
+}
+
+// NewWaitGroup creates a WaitGroup with the given name.
+func (r *Recorder) NewWaitGroup(name string) *WaitGroup {
+	return &WaitGroup{r: r, name: name}
+}
+
+// Add adds delta to the counter, as the Thread t.
+func (wg *WaitGroup) Add(t *Thread, delta int) {
+	wg.r.record(&event{Event: Event{Thread: t.name, Op: fmt.Sprintf("add %s %d", wg.name, delta)}, kind: eventNote, thread: t, obj: wg})
+	wg.wg.Add(delta)
+}
+
+// Done decrements the counter, as the Thread t.
+func (wg *WaitGroup) Done(t *Thread) {
+	wg.r.record(&event{Event: Event{Thread: t.name, Op: "done " + wg.name}, kind: eventDone, thread: t, obj: wg})
+	wg.wg.Done()
+}
+
+// Wait waits until the counter is zero, as the Thread t.
+func (wg *WaitGroup) Wait(t *Thread) {
+	wg.wg.Wait()
+	wg.r.record(&event{Event: Event{Thread: t.name, Op: "wait " + wg.name}, kind: eventWait, thread: t, obj: wg})
+}
+
+// HappensBefore returns the happens-before edges between the events
+// recorded so far, as pairs of indices into Events: the first of each
+// pair happens before the second. Edges implied by others are not
+// necessarily omitted.
+func (r *Recorder) HappensBefore() [][2]int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.happensBefore()
+}
+
+func (r *Recorder) happensBefore() [][2]int {
+	var before [][2]int
+	edge := func(i, j int) {
+		if i >= 0 && j >= 0 {
+			before = append(before, [2]int{i, j})
+		}
+	}
+	// next holds the index of each event's successor in its thread.
+	next := make([]int, len(r.events))
+	last := make(map[*Thread]int)
+	unlocked := make(map[*Mutex]int)
+	type chanOrder struct {
+		state        *chanState
+		sends, recvs []int
+		closed       int
+	}
+	// chans are in order of first use, so that the edges, and hence
+	// the permutation numbers, are deterministic.
+	chans := make(map[*chanState]*chanOrder)
+	var chanOrders []*chanOrder
+	chanOrderOf := func(cs *chanState) *chanOrder {
+		co, found := chans[cs]
+		if !found {
+			co = &chanOrder{state: cs, closed: -1}
+			chans[cs] = co
+			chanOrders = append(chanOrders, co)
+		}
+		return co
+	}
+	received := make(map[int]bool)
+	var unreceived []int
+	done := make(map[*WaitGroup][]int)
+	for idx, e := range r.events {
+		next[idx] = -1
+		if prev, found := last[e.thread]; found {
+			edge(prev, idx)
+			next[prev] = idx
+		} else {
+			edge(e.thread.spawn, idx)
+		}
+		last[e.thread] = idx
+		switch e.kind {
+		case eventLock:
+			if unlock, found := unlocked[e.obj.(*Mutex)]; found {
+				edge(unlock, idx)
+			}
+		case eventUnlock:
+			unlocked[e.obj.(*Mutex)] = idx
+		case eventSend, eventRecv, eventClose:
+			co := chanOrderOf(e.obj.(*chanState))
+			switch {
+			case e.kind == eventClose:
+				co.closed = idx
+			case e.kind == eventSend:
+				unreceived = append(unreceived, idx)
+			case e.send < 0:
+				edge(co.closed, idx)
+			default:
+				// The chan is FIFO, so the sends entered it in the
+				// order the receives took them.
+				co.sends = append(co.sends, e.send)
+				co.recvs = append(co.recvs, idx)
+				received[e.send] = true
+			}
+		case eventDone:
+			wg := e.obj.(*WaitGroup)
+			done[wg] = append(done[wg], idx)
+		case eventWait:
+			for _, d := range done[e.obj.(*WaitGroup)] {
+				edge(d, idx)
+			}
+		}
+	}
+	// Sends never received are still in the chan, after those which
+	// were.
+	for _, send := range unreceived {
+		if !received[send] {
+			co := chanOrderOf(r.events[send].obj.(*chanState))
+			co.sends = append(co.sends, send)
+		}
+	}
+	for _, co := range chanOrders {
+		cs := co.state
+		for idx, send := range co.sends {
+			if idx > 0 {
+				edge(co.sends[idx-1], send)
+			}
+			if idx >= len(co.recvs) {
+				continue
+			}
+			recv := co.recvs[idx]
+			edge(send, recv)
+			if idx > 0 {
+				edge(co.recvs[idx-1], recv)
+			}
+			if cs.capacity == 0 {
+				// An unbuffered send completes only once received.
+				edge(recv, next[send])
+			} else if idx+cs.capacity < len(co.sends) {
+				edge(recv, co.sends[idx+cs.capacity])
+			}
+		}
+		if len(co.sends) > 0 {
+			edge(co.sends[len(co.sends)-1], co.closed)
+		}
+	}
+	return before
+}
+
+// Graph returns a graph whose permutations are every schedule of the
+// events recorded so far which respects their happens-before edges.
+// The nodes are in the same order as Events, and each node's Value is
+// its Event. The recording should be complete: no goroutine should
+// still be synchronising through the Recorder.
+func (r *Recorder) Graph() (nodes, start []*gsim.GraphNode, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	values := make([]interface{}, len(r.events))
+	for idx, e := range r.events {
+		values[idx] = e.Event
+	}
+	return gsim.GraphFromHappensBefore(values, r.happensBefore())
+}
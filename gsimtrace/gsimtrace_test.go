@@ -0,0 +1,128 @@
+package gsimtrace
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/msackman/gsim"
+)
+
+// schedules returns every schedule of the events recorded by r, each
+// as its events separated by "|", failing the test unless each
+// respects every happens-before edge.
+func schedules(t *testing.T, r *Recorder) []string {
+	t.Helper()
+	events := r.Events()
+	before := r.HappensBefore()
+	nodes, start, err := r.Graph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	gsim.BuildPermutations(gsim.NewGraphPermutation(start...)).ForEach(consumerFunc(func(n *big.Int, perm []interface{}) {
+		if len(perm) != len(events) {
+			t.Fatalf("schedule %v has %d of %d events", perm, len(perm), len(events))
+		}
+		pos := make(map[*gsim.GraphNode]int, len(perm))
+		for idx, elem := range perm {
+			pos[elem.(*gsim.GraphNode)] = idx
+		}
+		for _, edge := range before {
+			if pos[nodes[edge[0]]] > pos[nodes[edge[1]]] {
+				t.Fatalf("schedule %v puts %v after %v", perm, events[edge[0]], events[edge[1]])
+			}
+		}
+		elems := make([]string, len(perm))
+		for idx, elem := range perm {
+			elems[idx] = elem.(*gsim.GraphNode).Value.(Event).String()
+		}
+		got = append(got, strings.Join(elems, "|"))
+	}))
+	return got
+}
+
+// consumerFunc is a PermutationConsumer which calls a function.
+type consumerFunc func(n *big.Int, perm []interface{})
+
+func (cf consumerFunc) Clone() gsim.PermutationConsumer {
+	return cf
+}
+
+func (cf consumerFunc) Consume(n *big.Int, perm []interface{}) {
+	cf(n, perm)
+}
+
+func TestMutexAndWaitGroup(t *testing.T) {
+	r := NewRecorder()
+	main := r.Thread("main")
+	mu := r.NewMutex("mu")
+	wg := r.NewWaitGroup("wg")
+	wg.Add(main, 2)
+	for _, name := range []string{"a", "b"} {
+		main.Go(name, func(t *Thread) {
+			mu.Lock(t)
+			t.Note("increment")
+			mu.Unlock(t)
+			wg.Done(t)
+		})
+	}
+	wg.Wait(main)
+	if n := len(r.Events()); n != 12 {
+		t.Fatalf("recorded %d events: %v", n, r.Events())
+	}
+	var lockers []string
+	for _, e := range r.Events() {
+		if strings.HasPrefix(e.Op, "lock") {
+			lockers = append(lockers, e.Thread)
+		}
+	}
+	got := schedules(t, r)
+	seen := make(map[string]bool)
+	for _, schedule := range got {
+		if seen[schedule] {
+			t.Fatalf("schedule %q is repeated", schedule)
+		}
+		seen[schedule] = true
+		// Every schedule locks the mutex in the recorded order, and
+		// waits for both threads.
+		if strings.Index(schedule, lockers[1]+": lock") < strings.Index(schedule, lockers[0]+": unlock") {
+			t.Fatalf("schedule %q does not lock first in %s", schedule, lockers[0])
+		}
+		if !strings.HasSuffix(schedule, "main: wait wg") {
+			t.Fatalf("schedule %q does not end with the wait", schedule)
+		}
+	}
+	if len(got) < 2 {
+		t.Fatalf("got %d schedules", len(got))
+	}
+}
+
+func TestChan(t *testing.T) {
+	r := NewRecorder()
+	main := r.Thread("main")
+	ch := NewChan[int](r, "ch", 0)
+	done := NewChan[bool](r, "done", 1)
+	main.Go("sender", func(t *Thread) {
+		ch.Send(t, 1)
+		t.Note("sent")
+		ch.Close(t)
+		done.Send(t, true)
+	})
+	if v, ok := ch.Recv(main); v != 1 || !ok {
+		t.Fatalf("received %v, %v", v, ok)
+	}
+	if _, ok := ch.Recv(main); ok {
+		t.Fatal("received from a closed chan")
+	}
+	done.Recv(main)
+	for _, schedule := range schedules(t, r) {
+		// The unbuffered send completes only once received.
+		if strings.Index(schedule, "sender: sent") < strings.Index(schedule, "main: recv ch") {
+			t.Fatalf("schedule %q continues the sender before the receive", schedule)
+		}
+		if strings.Index(schedule, "main: recv closed ch") < strings.Index(schedule, "sender: close ch") {
+			t.Fatalf("schedule %q receives the close before it", schedule)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package gsim
+
+// VisitedSet reports which nodes have been chosen so far in a
+// permutation.
+type VisitedSet interface {
+	// Visited reports whether the node has been chosen at least once.
+	Visited(*GraphNode) bool
+	// Visits returns the number of times the node has been chosen.
+	Visits(*GraphNode) int
+}
+
+// An EdgeGuard decides whether traversing a guarded edge counts
+// towards the target node's callback. It is called when the source
+// of the edge is chosen, with the nodes chosen so far, which include
+// the source itself. It must be deterministic and free of side
+// effects.
+type EdgeGuard func(visited VisitedSet) bool
+
+// AddGuardedEdgeTo adds an edge from the receiver to the argument, as
+// AddEdgeTo, which is only traversed if the guard returns true when
+// the receiver is chosen. If the guard returns false, it is as if the
+// edge did not exist for that visit: the argument's callback is not
+// invoked and the receiver is not included in its reached edges. This
+// models conditional flows, such as "only notify B if C has not
+// happened yet", without inhibitor wiring. Adding the same edge again
+// replaces the guard; a nil guard removes it. Guards, being
+// functions, are not saved by WriteDOT or WriteGraphJSON.
+func (gn *GraphNode) AddGuardedEdgeTo(gn2 *GraphNode, guard EdgeGuard) {
+	gn.AddEdgeTo(gn2)
+	if guard == nil {
+		delete(gn.outGuards, gn2)
+		return
+	}
+	if gn.outGuards == nil {
+		gn.outGuards = make(map[*GraphNode]EdgeGuard)
+	}
+	gn.outGuards[gn2] = guard
+}
+
+// traversable reports whether the edge from gn to gn2 is traversed
+// now that gn has been chosen.
+func (gp *graphPermutation) traversable(gn, gn2 *GraphNode) bool {
+	guard := gn.outGuards[gn2]
+	return guard == nil || guard(gp)
+}
+
+func (gp *graphPermutation) Visited(gn *GraphNode) bool {
+	return gp.Visits(gn) > 0
+}
+
+func (gp *graphPermutation) Visits(gn *GraphNode) int {
+	if gns, found := gp.getNodeState(gn, false); found {
+		return gns.visits
+	}
+	return 0
+}
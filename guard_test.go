@@ -0,0 +1,27 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestAddGuardedEdgeTo(t *testing.T) {
+	// a only notifies b if c has not happened yet.
+	g := nodes("a", "b", "c")
+	a, b, c := g[0], g[1], g[2]
+	a.AddGuardedEdgeTo(b, func(visited VisitedSet) bool {
+		return visited.Visited(a) && !visited.Visited(c)
+	})
+	checkPerms(t, collectSorted(BuildPermutations(NewGraphPermutation(a, c))), []string{
+		"a b c",
+		"a c b",
+		"c a",
+	})
+
+	// A nil guard removes it.
+	a.AddGuardedEdgeTo(b, nil)
+	checkPerms(t, collectSorted(BuildPermutations(NewGraphPermutation(a, c))), []string{
+		"a b c",
+		"a c b",
+		"c a b",
+	})
+}
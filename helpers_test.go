@@ -0,0 +1,207 @@
+package gsim
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// collector is a PermutationConsumer which records every permutation
+// it is given, as a string, along with its number. Its clones share
+// its records, so it may be used with the parallel iterators.
+type collector struct {
+	lock  *sync.Mutex
+	perms *[]string
+	nums  *[]*big.Int
+}
+
+func newCollector() *collector {
+	return &collector{lock: new(sync.Mutex), perms: new([]string), nums: new([]*big.Int)}
+}
+
+func (c *collector) Clone() PermutationConsumer {
+	return c
+}
+
+func (c *collector) Consume(n *big.Int, perm []interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	*c.perms = append(*c.perms, permString(perm))
+	*c.nums = append(*c.nums, new(big.Int).Set(n))
+}
+
+// sorted returns the permutations recorded, sorted.
+func (c *collector) sorted() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	perms := append([]string{}, *c.perms...)
+	sort.Strings(perms)
+	return perms
+}
+
+// numbered returns every permutation recorded by c, keyed by its
+// number.
+func (c *collector) numbered() map[string]string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	numbered := make(map[string]string, len(*c.perms))
+	for idx, perm := range *c.perms {
+		numbered[(*c.nums)[idx].String()] = perm
+	}
+	return numbered
+}
+
+// permString renders a permutation as its elements separated by
+// spaces, using the values of GraphNodes.
+func permString(perm []interface{}) string {
+	elems := make([]string, len(perm))
+	for idx, elem := range perm {
+		if gn, ok := elem.(*GraphNode); ok {
+			elem = gn.Value
+		}
+		elems[idx] = fmt.Sprint(elem)
+	}
+	return strings.Join(elems, " ")
+}
+
+// collect returns every permutation of p, as strings, in the order of
+// ForEach.
+func collect(p *Permutations) []string {
+	c := newCollector()
+	p.ForEach(c)
+	return *c.perms
+}
+
+// collectSorted returns every permutation of p, as strings, sorted.
+func collectSorted(p *Permutations) []string {
+	c := newCollector()
+	p.ForEach(c)
+	return c.sorted()
+}
+
+// checkPerms fails the test unless got and want hold the same
+// permutations, in the same order.
+func checkPerms(t *testing.T, got, want []string) {
+	t.Helper()
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("got %d permutations %q, want %d %q", len(got), got, len(want), want)
+	}
+}
+
+// checkerFunc is a PermutationChecker which calls a function.
+type checkerFunc func(n *big.Int, perm []interface{}) error
+
+func (cf checkerFunc) Clone() PermutationChecker {
+	return cf
+}
+
+func (cf checkerFunc) Check(n *big.Int, perm []interface{}) error {
+	return cf(n, perm)
+}
+
+// consumerFunc is a PermutationConsumer which calls a function. A
+// nil consumerFunc ignores every permutation.
+type consumerFunc func(n *big.Int, perm []interface{})
+
+func (cf consumerFunc) Clone() PermutationConsumer {
+	return cf
+}
+
+func (cf consumerFunc) Consume(n *big.Int, perm []interface{}) {
+	if cf != nil {
+		cf(n, perm)
+	}
+}
+
+// nodes creates a GraphNode for each value.
+func nodes(values ...interface{}) []*GraphNode {
+	gns := make([]*GraphNode, len(values))
+	for idx, value := range values {
+		gns[idx] = NewGraphNode(value)
+	}
+	return gns
+}
+
+// egraph builds the graph of main/main.go in which E3 follows E1 and
+// E2, and E4 follows either of them unless E3 comes first. It has 6
+// permutations.
+func egraph() []*GraphNode {
+	e := nodes("E1", "E2", "E3", "E4")
+	e[0].AddEdgeTo(e[2])
+	e[1].AddEdgeTo(e[2])
+	e[2].Callback = NewAvailableAllCallback(e[0], e[1])
+	e[0].AddEdgeTo(e[3])
+	e[1].AddEdgeTo(e[3])
+	e[2].AddEdgeTo(e[3])
+	cc := NewCombinationCallback(InhibitThenAvailableCombiner)
+	cc.AddCallback(NewInhibitAllCallback(e[2]))
+	cc.AddCallback(NewAvailableAllCallback(e[0]))
+	cc.AddCallback(NewAvailableAllCallback(e[1]))
+	e[3].Callback = cc
+	return e[:2]
+}
+
+// joins builds the graph of main/main.go in which A3 and A4 each
+// require A1 and A2, and A5 requires A3 and A4.
+func joins() []*GraphNode {
+	a := nodes("A1", "A2", "A3", "A4", "A5")
+	for _, from := range a[:2] {
+		for _, to := range a[2:4] {
+			from.AddEdgeTo(to)
+		}
+	}
+	a[2].AddEdgeTo(a[4])
+	a[3].AddEdgeTo(a[4])
+	a[2].Callback = NewAvailableAllCallback(a[0], a[1])
+	a[3].Callback = NewAvailableAllCallback(a[0], a[1])
+	a[4].Callback = NewAvailableAllCallback(a[2], a[3])
+	return a[:2]
+}
+
+// chains builds k independent chains of length n, the first node of
+// each chain being a starting node. The last node of the first chain
+// has a CombinationCallback, so that Count cannot count the
+// permutations without walking them.
+func chains(k, n int) []*GraphNode {
+	start := make([]*GraphNode, k)
+	for chain := 0; chain < k; chain++ {
+		var prev *GraphNode
+		for idx := 0; idx < n; idx++ {
+			gn := NewGraphNode([2]int{chain, idx})
+			if prev == nil {
+				start[chain] = gn
+			} else {
+				prev.AddEdgeTo(gn)
+			}
+			prev = gn
+		}
+		if chain == 0 {
+			cc := NewCombinationCallback(InhibitThenAvailableCombiner)
+			cc.AddCallback(AvailableAnyCallback)
+			prev.Callback = cc
+		}
+	}
+	return start
+}
+
+// diamonds builds a graph of n diamonds in sequence, each of which may
+// be traversed either way.
+func diamonds(n int) []*GraphNode {
+	start := NewGraphNode("start")
+	prev := start
+	for idx := 0; idx < n; idx++ {
+		g := nodes([2]int{idx, 0}, [2]int{idx, 1}, [2]int{idx, 2})
+		prev.AddEdgeTo(g[0])
+		prev.AddEdgeTo(g[1])
+		g[0].AddEdgeTo(g[2])
+		g[1].AddEdgeTo(g[2])
+		cc := NewCombinationCallback(InhibitThenAvailableCombiner)
+		cc.AddCallback(NewAvailableAllCallback(g[0], g[1]))
+		g[2].Callback = cc
+		prev = g[2]
+	}
+	return []*GraphNode{start}
+}
@@ -0,0 +1,116 @@
+package gsim
+
+// A HistoryCallback is a GraphNodeCallback which also needs to know
+// every node chosen so far, in order, rather than just which incoming
+// edges have been reached. This allows rules such as "only after at
+// least three events" or "not twice in a row". When the node's
+// Callback is a HistoryCallback, graph OptionGenerators invoke
+// IncomingEdgesReachedAfter in place of IncomingEdgesReached, whenever
+// an incoming edge is reached; IncomingEdgesReached is still used
+// where there is no history, such as by ValidateGraph. A
+// HistoryCallback nested within another callback, such as a
+// CombinationCallback, is only ever given no history.
+//
+// As the state of the graph then depends on the whole history, state
+// deduplication and merging (see WithStateDeduplication and
+// WithStateMerging) distinguish every distinct history, and so find
+// little to share.
+type HistoryCallback interface {
+	GraphNodeCallback
+	IncomingEdgesReachedAfter(node *GraphNode, reached []*GraphNode, history VisitHistory) GraphNodeStateChange
+}
+
+// VisitHistory is the sequence of nodes chosen so far, supplied to a
+// HistoryCallback. It is immutable, and may be retained.
+type VisitHistory struct {
+	last *historyEntry
+}
+
+// historyEntry is an element of a persistent linked list of the nodes
+// chosen, most recent first, shared between clones.
+type historyEntry struct {
+	gn    *GraphNode
+	prev  *historyEntry
+	depth int
+}
+
+// Depth returns the number of nodes chosen so far. Each node of an
+// atomic block (see DeclareAtomic) counts separately, so this may
+// exceed the length of the permutation.
+func (vh VisitHistory) Depth() int {
+	if vh.last == nil {
+		return 0
+	}
+	return vh.last.depth
+}
+
+// Last returns the most recently chosen node, or nil if none has been
+// chosen.
+func (vh VisitHistory) Last() *GraphNode {
+	if vh.last == nil {
+		return nil
+	}
+	return vh.last.gn
+}
+
+// Nodes returns the nodes chosen so far, in the order they were
+// chosen, in a new slice.
+func (vh VisitHistory) Nodes() []*GraphNode {
+	nodes := make([]*GraphNode, vh.Depth())
+	for entry := vh.last; entry != nil; entry = entry.prev {
+		nodes[entry.depth-1] = entry.gn
+	}
+	return nodes
+}
+
+// Visits returns the number of times gn has been chosen so far.
+func (vh VisitHistory) Visits(gn *GraphNode) int {
+	visits := 0
+	for entry := vh.last; entry != nil; entry = entry.prev {
+		if entry.gn == gn {
+			visits++
+		}
+	}
+	return visits
+}
+
+// recordVisit appends gn to the history of gp.
+func (gp *graphPermutation) recordVisit(gn *GraphNode) {
+	gp.history = &historyEntry{gn: gn, prev: gp.history, depth: VisitHistory{gp.history}.Depth() + 1}
+}
+
+// consult invokes the callback of the node, with the history if the
+// callback is a HistoryCallback.
+func (gp *graphPermutation) consult(gns *graphNodeState) GraphNodeStateChange {
+	if gns.id < len(gp.graph.nodes) {
+		// The callback was resolved when the graph was compiled.
+		if hc := gp.graph.historyCallbacks[gns.id]; hc != nil {
+			return hc.IncomingEdgesReachedAfter(gns.GraphNode, gns.incomingVisited, VisitHistory{gp.history})
+		}
+		return gp.graph.callbacks[gns.id].IncomingEdgesReached(gns.GraphNode, gns.incomingVisited)
+	}
+	if hc, ok := gns.Callback.(HistoryCallback); ok {
+		return hc.IncomingEdgesReachedAfter(gns.GraphNode, gns.incomingVisited, VisitHistory{gp.history})
+	}
+	return gns.Callback.IncomingEdgesReached(gns.GraphNode, gns.incomingVisited)
+}
+
+// mayRelease reports whether the callback of the node with the given
+// id may release it once inhibited.
+func (gp *graphPermutation) mayRelease(id int) bool {
+	if id < len(gp.graph.nodes) {
+		return gp.graph.releasing[id]
+	}
+	return mayRelease(gp.node(id).Callback)
+}
+
+// hasHistoryCallback reports whether any of the nodes has a
+// HistoryCallback.
+func hasHistoryCallback(nodes []*GraphNode) bool {
+	for _, gn := range nodes {
+		if _, ok := gn.Callback.(HistoryCallback); ok {
+			return true
+		}
+	}
+	return false
+}
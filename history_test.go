@@ -0,0 +1,67 @@
+package gsim
+
+import (
+	"testing"
+)
+
+// notFirst is a HistoryCallback which makes its node available once
+// an incoming edge is reached, unless the node the edge is from was
+// chosen first.
+type notFirst struct{}
+
+func (notFirst) IncomingEdgesReached(node *GraphNode, reached []*GraphNode) GraphNodeStateChange {
+	return MakeAvailable
+}
+
+func (notFirst) IncomingEdgesReachedAfter(node *GraphNode, reached []*GraphNode, history VisitHistory) GraphNodeStateChange {
+	if history.Depth() == 1 {
+		return NoChange
+	}
+	return MakeAvailable
+}
+
+func TestHistoryCallback(t *testing.T) {
+	g := nodes("a", "b", "d")
+	g[0].AddEdgeTo(g[2])
+	g[2].Callback = notFirst{}
+	checkPerms(t, collectSorted(BuildPermutations(NewGraphPermutation(g[0], g[1]))), []string{
+		"a b",
+		"b a d",
+	})
+}
+
+// lastHistory is a HistoryCallback which makes its node available,
+// and records the history it was last given.
+type lastHistory struct {
+	history *VisitHistory
+}
+
+func (lh lastHistory) IncomingEdgesReached(node *GraphNode, reached []*GraphNode) GraphNodeStateChange {
+	return MakeAvailable
+}
+
+func (lh lastHistory) IncomingEdgesReachedAfter(node *GraphNode, reached []*GraphNode, history VisitHistory) GraphNodeStateChange {
+	*lh.history = history
+	return MakeAvailable
+}
+
+func TestVisitHistory(t *testing.T) {
+	var history VisitHistory
+	if history.Depth() != 0 || history.Last() != nil || len(history.Nodes()) != 0 {
+		t.Fatal("empty history is not empty")
+	}
+	g := nodes("a", "b", "c")
+	g[0].AddEdgeTo(g[2])
+	g[1].AddEdgeTo(g[2])
+	g[2].Callback = lastHistory{history: &history}
+	gen := NewGraphPermutation(g[0], g[1])
+	gen.Generate(nil)
+	gen.Generate(g[1])
+	gen.Generate(g[0])
+	if history.Depth() != 2 || history.Last() != g[0] || history.Visits(g[1]) != 1 || history.Visits(g[2]) != 0 {
+		t.Fatalf("got history %v", history.Nodes())
+	}
+	if nodes := history.Nodes(); len(nodes) != 2 || nodes[0] != g[1] || nodes[1] != g[0] {
+		t.Fatalf("got history %v", nodes)
+	}
+}
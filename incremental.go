@@ -0,0 +1,74 @@
+package gsim
+
+// A TypedIncrementalConsumer is a TypedPermutationConsumer or
+// TypedPermutationChecker which wishes to follow the depth-first walk
+// through the permutations, rather than being handed each complete
+// permutation afresh. Permutations share long prefixes, so an
+// interpreter which maintains its state incrementally, applying each
+// element in OnChoose and undoing it in OnBacktrack, need only
+// process each prefix once rather than once per permutation.
+//
+// The events are delivered by the sequential iteration functions:
+// ForEach, ForEachCheck, ForEachRange and ForEachRangeCheck. When
+// Consume (or Check, or Deadlocked) is called, OnChoose has been
+// called for exactly the elements of the permutation, in order, and
+// not since undone. Elements of prefixes which turn out to lead to no
+// permutations (for example because of WithPrune) may also be chosen
+// and then backtracked. Once iteration completes without error, every
+// element has been backtracked. The events are not delivered by the
+// parallel iteration functions, and WithStateMerging is disabled for
+// incremental consumers.
+type TypedIncrementalConsumer[T any] interface {
+	// OnChoose is called as value is appended to the current prefix.
+	OnChoose(value T)
+	// OnBacktrack is called as the most recently chosen value is
+	// removed from the current prefix.
+	OnBacktrack()
+}
+
+// IncrementalConsumer is the interface{} instantiation of
+// TypedIncrementalConsumer.
+type IncrementalConsumer = TypedIncrementalConsumer[interface{}]
+
+// incrementalConsumer finds the TypedIncrementalConsumer behind f, if
+// there is one.
+func incrementalConsumer[T any](f TypedPermutationChecker[T]) (TypedIncrementalConsumer[T], bool) {
+	if cc, ok := f.(consumerChecker[T]); ok {
+		ic, ok := cc.TypedPermutationConsumer.(TypedIncrementalConsumer[T])
+		return ic, ok
+	}
+	ic, ok := f.(TypedIncrementalConsumer[T])
+	return ic, ok
+}
+
+// incrementalPath tracks the prefix which a TypedIncrementalConsumer
+// has been given.
+type incrementalPath[T any] struct {
+	consumer TypedIncrementalConsumer[T]
+	depth    int
+}
+
+// moveTo delivers the events which take the consumer from its current
+// prefix to perm. Unless replayed is true, perm shares every element
+// but its last with the prefix the consumer was last moved to.
+// Otherwise perm has been rebuilt from the root, and the consumer is
+// first taken back to the empty prefix.
+func (ip *incrementalPath[T]) moveTo(perm []T, replayed bool) {
+	keep := len(perm) - 1
+	if replayed || keep < 0 {
+		keep = 0
+	}
+	ip.backtrackTo(keep)
+	for _, value := range perm[ip.depth:] {
+		ip.consumer.OnChoose(value)
+	}
+	ip.depth = len(perm)
+}
+
+// backtrackTo backtracks until the prefix has no more than depth
+// elements.
+func (ip *incrementalPath[T]) backtrackTo(depth int) {
+	for ; ip.depth > depth; ip.depth-- {
+		ip.consumer.OnBacktrack()
+	}
+}
@@ -0,0 +1,48 @@
+package gsim
+
+import (
+	"math/big"
+	"testing"
+)
+
+// stack is an IncrementalConsumer which maintains the current prefix
+// from its events.
+type stack struct {
+	t        *testing.T
+	prefix   []interface{}
+	chosen   int
+	consumed int
+}
+
+func (s *stack) Clone() PermutationConsumer {
+	return s
+}
+
+func (s *stack) OnChoose(value interface{}) {
+	s.prefix = append(s.prefix, value)
+	s.chosen++
+}
+
+func (s *stack) OnBacktrack() {
+	s.prefix = s.prefix[:len(s.prefix)-1]
+}
+
+func (s *stack) Consume(n *big.Int, perm []interface{}) {
+	if permString(s.prefix) != permString(perm) {
+		s.t.Fatalf("prefix %q given permutation %q", permString(s.prefix), permString(perm))
+	}
+	s.consumed += len(perm)
+}
+
+func TestIncrementalConsumer(t *testing.T) {
+	s := &stack{t: t}
+	BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4})).ForEach(s)
+	if len(s.prefix) != 0 {
+		t.Fatalf("%q not backtracked", permString(s.prefix))
+	}
+	// Each of the 24 permutations has 4 elements, but prefixes are
+	// shared: 4 + 4*3 + 4*3*2 + 4*3*2*1 elements are chosen.
+	if s.consumed != 96 || s.chosen != 64 {
+		t.Fatalf("chose %d elements for %d consumed", s.chosen, s.consumed)
+	}
+}
@@ -0,0 +1,160 @@
+package gsim
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// TypedInterpreter runs a model over each permutation: starting from
+// an initial state, each element of the permutation is an event which
+// is applied to the state by the transition registered for it, and
+// after every event the registered invariants are checked. At the end
+// of the permutation the registered goals are checked. This is the
+// use described in the package documentation, so it need not be
+// written by hand.
+//
+// A TypedInterpreter is a TypedPermutationChecker, so it can be
+// passed to ForEachCheck, ForEachParCheck and so on, which then return
+// a *PermutationError identifying the permutation and wrapping an
+// *InvariantViolation, a *GoalFailure or the error of a transition.
+// Transitions, invariants and goals must all be registered before
+// iteration starts.
+type TypedInterpreter[S, T any] struct {
+	init        func() S
+	transitions map[interface{}]func(S, T) (S, error)
+	fallback    func(S, T) (S, error)
+	invariants  []namedPredicate[S]
+	goals       []namedPredicate[S]
+}
+
+type namedPredicate[S any] struct {
+	name string
+	pred func(S) bool
+}
+
+// InvariantViolation is the error returned by a TypedInterpreter when
+// an invariant does not hold.
+type InvariantViolation struct {
+	// Invariant is the name of the invariant.
+	Invariant string
+	// Step is the number of events which had been applied: 0 means
+	// the initial state violated the invariant.
+	Step int
+	// State is the state which violated the invariant.
+	State interface{}
+}
+
+func (iv *InvariantViolation) Error() string {
+	return fmt.Sprintf("invariant %q violated after %d events", iv.Invariant, iv.Step)
+}
+
+// GoalFailure is the error returned by a TypedInterpreter when a goal
+// is not met at the end of a permutation.
+type GoalFailure struct {
+	// Goal is the name of the goal.
+	Goal string
+	// State is the final state.
+	State interface{}
+}
+
+func (gf *GoalFailure) Error() string {
+	return fmt.Sprintf("goal %q not met", gf.Goal)
+}
+
+// NewInterpreter creates an interpreter for permutations of
+// interface{}, such as those of a graph. See NewTypedInterpreter.
+func NewInterpreter[S any](init func() S) *TypedInterpreter[S, interface{}] {
+	return NewTypedInterpreter[S, interface{}](init)
+}
+
+// NewTypedInterpreter creates an interpreter whose state, of type S,
+// is created afresh by init for each permutation.
+func NewTypedInterpreter[S, T any](init func() S) *TypedInterpreter[S, T] {
+	return &TypedInterpreter[S, T]{
+		init:        init,
+		transitions: make(map[interface{}]func(S, T) (S, error)),
+	}
+}
+
+// On registers the transition for events with the given key. The key
+// of a GraphNode is its Value; the key of anything else is itself.
+// The transition returns the new state, which may be the old state
+// mutated in place, and an error if the event is illegal in the given
+// state.
+func (ti *TypedInterpreter[S, T]) On(key interface{}, transition func(state S, event T) (S, error)) *TypedInterpreter[S, T] {
+	ti.transitions[key] = transition
+	return ti
+}
+
+// OnOther registers the transition for events whose keys have no
+// transition registered with On. Without it, such events are an
+// error.
+func (ti *TypedInterpreter[S, T]) OnOther(transition func(state S, event T) (S, error)) *TypedInterpreter[S, T] {
+	ti.fallback = transition
+	return ti
+}
+
+// Invariant registers a predicate which must hold of the initial
+// state and of the state after every event.
+func (ti *TypedInterpreter[S, T]) Invariant(name string, pred func(S) bool) *TypedInterpreter[S, T] {
+	ti.invariants = append(ti.invariants, namedPredicate[S]{name: name, pred: pred})
+	return ti
+}
+
+// Goal registers a predicate which must hold of the final state of
+// every permutation.
+func (ti *TypedInterpreter[S, T]) Goal(name string, pred func(S) bool) *TypedInterpreter[S, T] {
+	ti.goals = append(ti.goals, namedPredicate[S]{name: name, pred: pred})
+	return ti
+}
+
+func (ti *TypedInterpreter[S, T]) Clone() TypedPermutationChecker[T] {
+	return ti
+}
+
+func (ti *TypedInterpreter[S, T]) Check(n *big.Int, perm []T) error {
+	state := ti.init()
+	if err := ti.checkInvariants(state, 0); err != nil {
+		return err
+	}
+	for idx, event := range perm {
+		var key interface{} = event
+		if gn, ok := key.(*GraphNode); ok {
+			key = gn.Value
+		}
+		transition, found := ti.transitions[key]
+		if !found {
+			if transition = ti.fallback; transition == nil {
+				return fmt.Errorf("no transition for event %v", key)
+			}
+		}
+		var err error
+		if state, err = transition(state, event); err != nil {
+			return fmt.Errorf("event %v (step %d): %w", key, idx+1, err)
+		}
+		if err := ti.checkInvariants(state, idx+1); err != nil {
+			return err
+		}
+	}
+	for _, goal := range ti.goals {
+		if !goal.pred(state) {
+			return &GoalFailure{Goal: goal.name, State: state}
+		}
+	}
+	return nil
+}
+
+func (ti *TypedInterpreter[S, T]) checkInvariants(state S, step int) error {
+	for _, invariant := range ti.invariants {
+		if !invariant.pred(state) {
+			return &InvariantViolation{Invariant: invariant.name, Step: step, State: state}
+		}
+	}
+	return nil
+}
+
+// Run checks every permutation of p, in order, and returns the first
+// failure, as ForEachCheck does.
+func (ti *TypedInterpreter[S, T]) Run(p *TypedPermutations[T]) error {
+	return p.ForEachCheck(ti)
+}
@@ -0,0 +1,59 @@
+package gsim
+
+import (
+	"errors"
+	"testing"
+)
+
+// account returns an interpreter of deposits and withdrawals of 1.
+func account() *TypedInterpreter[int, interface{}] {
+	return NewInterpreter(func() int { return 0 }).
+		On("deposit", func(balance int, _ interface{}) (int, error) { return balance + 1, nil }).
+		On("withdraw", func(balance int, _ interface{}) (int, error) { return balance - 1, nil })
+}
+
+func TestInterpreterInvariant(t *testing.T) {
+	g := nodes("deposit", "withdraw")
+	p := BuildPermutations(NewGraphPermutation(g...))
+	ti := account().Invariant("solvent", func(balance int) bool { return balance >= 0 })
+	err := ti.Run(p)
+	var pe *PermutationError
+	var iv *InvariantViolation
+	if !errors.As(err, &pe) || !errors.As(err, &iv) {
+		t.Fatalf("got %v, want an InvariantViolation", err)
+	}
+	if iv.Invariant != "solvent" || iv.Step != 1 || iv.State != -1 || permString(p.Permutation(pe.N)) != "withdraw deposit" {
+		t.Fatalf("got %+v for %v", iv, p.Permutation(pe.N))
+	}
+
+	// With the withdrawal after the deposit, everything passes.
+	g = nodes("deposit", "withdraw")
+	g[0].AddEdgeTo(g[1])
+	if err := ti.Run(BuildPermutations(NewGraphPermutation(g[0]))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInterpreterGoal(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(nodes("deposit", "deposit")...))
+	err := account().Goal("rich", func(balance int) bool { return balance >= 3 }).Run(p)
+	var gf *GoalFailure
+	if !errors.As(err, &gf) || gf.Goal != "rich" || gf.State != 2 {
+		t.Fatalf("got %v, want the goal to fail with 2", err)
+	}
+}
+
+func TestInterpreterUnknownEvent(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(nodes("deposit", "audit")...))
+	if err := account().Run(p); err == nil {
+		t.Fatal("unknown event accepted")
+	}
+	audited := 0
+	ti := account().OnOther(func(balance int, event interface{}) (int, error) {
+		audited++
+		return balance, nil
+	})
+	if err := ti.Run(p); err != nil || audited != 2 {
+		t.Fatalf("got %v after %d audits", err, audited)
+	}
+}
@@ -0,0 +1,195 @@
+package gsim
+
+import (
+	"errors"
+)
+
+// ErrGraphCyclic is returned by the functions which only apply to
+// acyclic graphs, when given a graph with cycles. FindCycles lists
+// them.
+var ErrGraphCyclic = errors.New("graph has cycles")
+
+// TopologicalLayers divides the graph reachable from the given
+// starting nodes into layers: each node is in the layer numbered by
+// the length of the longest path to it from a node with no reachable
+// incoming edges, so every edge leads to a later layer. Within a
+// layer, nodes are in the order in which they are reachable from the
+// starting nodes. The nodes of a layer never depend upon one another,
+// so in a model whose events wait for all their predecessors, a
+// layer's events can happen in any order, and the number of layers is
+// the length of the longest chain of causally ordered events.
+// ErrGraphCyclic is returned if the graph has cycles.
+func TopologicalLayers(start ...*GraphNode) ([][]*GraphNode, error) {
+	nodes, order, err := topologicalOrder(start)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[*GraphNode]int, len(nodes))
+	for idx, gn := range nodes {
+		index[gn] = idx
+	}
+	layer := make([]int, len(nodes))
+	layerCount := 0
+	for _, idx := range order {
+		if layer[idx] >= layerCount {
+			layerCount = layer[idx] + 1
+		}
+		for _, out := range nodes[idx].Out {
+			if w := index[out]; layer[w] <= layer[idx] {
+				layer[w] = layer[idx] + 1
+			}
+		}
+	}
+	layers := make([][]*GraphNode, layerCount)
+	for idx, gn := range nodes {
+		layers[layer[idx]] = append(layers[layer[idx]], gn)
+	}
+	return layers, nil
+}
+
+// MaxAntichain returns a largest set of nodes, from the graph
+// reachable from the given starting nodes, no one of which can be
+// reached from another by following edges. Its size is the width of
+// the graph: in a model whose events wait for all their predecessors,
+// no more events than this can ever be available at once, so it
+// bounds the branching factor of the permutation tree, and gives an
+// immediate sense of how large the space will be. By Dilworth's
+// theorem, it is also the fewest chains of causally ordered events
+// which together cover the graph. The nodes are in the order in which
+// they are reachable from the starting nodes. ErrGraphCyclic is
+// returned if the graph has cycles.
+func MaxAntichain(start ...*GraphNode) ([]*GraphNode, error) {
+	nodes, order, err := topologicalOrder(start)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[*GraphNode]int, len(nodes))
+	for idx, gn := range nodes {
+		index[gn] = idx
+	}
+	// descendants[v] holds every node reachable from v, as a bitset.
+	words := (len(nodes) + 63) / 64
+	descendants := make([][]uint64, len(nodes))
+	for pos := len(order) - 1; pos >= 0; pos-- {
+		v := order[pos]
+		set := make([]uint64, words)
+		for _, out := range nodes[v].Out {
+			w := index[out]
+			set[w/64] |= 1 << (w % 64)
+			for word, bits := range descendants[w] {
+				set[word] |= bits
+			}
+		}
+		descendants[v] = set
+	}
+	reaches := func(v, w int) bool { return descendants[v][w/64]&(1<<(w%64)) != 0 }
+
+	// A maximum matching of the bipartite graph in which v, on the
+	// left, is joined to each of its descendants, on the right.
+	matchLeft := make([]int, len(nodes))
+	matchRight := make([]int, len(nodes))
+	for idx := range nodes {
+		matchLeft[idx], matchRight[idx] = -1, -1
+	}
+	var visited []bool
+	var augment func(v int) bool
+	augment = func(v int) bool {
+		for w := range nodes {
+			if !reaches(v, w) || visited[w] {
+				continue
+			}
+			visited[w] = true
+			if matchRight[w] == -1 || augment(matchRight[w]) {
+				matchLeft[v], matchRight[w] = w, v
+				return true
+			}
+		}
+		return false
+	}
+	for v := range nodes {
+		visited = make([]bool, len(nodes))
+		augment(v)
+	}
+
+	// By König's theorem, the nodes reachable from the unmatched left
+	// nodes along alternating paths give a minimum vertex cover, and
+	// the nodes whose left side is reachable but whose right side is
+	// not form a maximum antichain.
+	leftSeen := make([]bool, len(nodes))
+	rightSeen := make([]bool, len(nodes))
+	var queue []int
+	for v := range nodes {
+		if matchLeft[v] == -1 {
+			leftSeen[v] = true
+			queue = append(queue, v)
+		}
+	}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		for w := range nodes {
+			if !reaches(v, w) || rightSeen[w] || matchLeft[v] == w {
+				continue
+			}
+			rightSeen[w] = true
+			if u := matchRight[w]; u != -1 && !leftSeen[u] {
+				leftSeen[u] = true
+				queue = append(queue, u)
+			}
+		}
+	}
+	var antichain []*GraphNode
+	for idx, gn := range nodes {
+		if leftSeen[idx] && !rightSeen[idx] {
+			antichain = append(antichain, gn)
+		}
+	}
+	return antichain, nil
+}
+
+// topologicalOrder returns the nodes reachable from start, and the
+// indices of those nodes in a topological order, or ErrGraphCyclic.
+func topologicalOrder(start []*GraphNode) ([]*GraphNode, []int, error) {
+	nodes := reachableGraphNodes(start...)
+	index := make(map[*GraphNode]int, len(nodes))
+	for idx, gn := range nodes {
+		index[gn] = idx
+	}
+	inDegree := make([]int, len(nodes))
+	for _, gn := range nodes {
+		for _, out := range gn.Out {
+			inDegree[index[out]]++
+		}
+	}
+	order := make([]int, 0, len(nodes))
+	for idx, degree := range inDegree {
+		if degree == 0 {
+			order = append(order, idx)
+		}
+	}
+	for pos := 0; pos < len(order); pos++ {
+		for _, out := range nodes[order[pos]].Out {
+			w := index[out]
+			inDegree[w]--
+			if inDegree[w] == 0 {
+				order = append(order, w)
+			}
+		}
+	}
+	if len(order) != len(nodes) {
+		return nil, nil, ErrGraphCyclic
+	}
+	return nodes, order, nil
+}
+
+// Layers returns the topological layers of the graph reachable from
+// its starting nodes, as TopologicalLayers.
+func (g *Graph) Layers() ([][]*GraphNode, error) {
+	return TopologicalLayers(g.StartNodes()...)
+}
+
+// MaxAntichain returns a maximum antichain of the graph reachable
+// from its starting nodes, as the function MaxAntichain.
+func (g *Graph) MaxAntichain() ([]*GraphNode, error) {
+	return MaxAntichain(g.StartNodes()...)
+}
@@ -0,0 +1,73 @@
+package gsim
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// layerString renders layers of nodes by their values.
+func layerString(layers ...[]*GraphNode) string {
+	rendered := make([]string, len(layers))
+	for idx, layer := range layers {
+		values := make([]interface{}, len(layer))
+		for idx2, gn := range layer {
+			values[idx2] = gn
+		}
+		rendered[idx] = permString(values)
+	}
+	return strings.Join(rendered, " | ")
+}
+
+func TestTopologicalLayers(t *testing.T) {
+	g := nodes("a", "b", "c", "d")
+	a, b, c, d := g[0], g[1], g[2], g[3]
+	a.AddEdgeTo(c)
+	b.AddEdgeTo(c)
+	c.AddEdgeTo(d)
+	a.AddEdgeTo(d)
+	layers, err := TopologicalLayers(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := layerString(layers...); got != "a b | c | d" {
+		t.Fatalf("got layers %s", got)
+	}
+	antichain, err := MaxAntichain(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := layerString(antichain); got != "a b" {
+		t.Fatalf("got antichain %s", got)
+	}
+
+	d.AddEdgeTo(b)
+	if _, err := TopologicalLayers(a); !errors.Is(err, ErrGraphCyclic) {
+		t.Fatalf("cyclic graph gave %v", err)
+	}
+	if _, err := MaxAntichain(a); !errors.Is(err, ErrGraphCyclic) {
+		t.Fatalf("cyclic graph gave %v", err)
+	}
+}
+
+func TestGraphLayers(t *testing.T) {
+	named := NewGraph()
+	for _, name := range []string{"start", "left", "right", "stop"} {
+		named.AddNode(name, name)
+	}
+	named.AddEdge("start", "left")
+	named.AddEdge("start", "right")
+	named.AddEdge("left", "stop")
+	named.AddEdge("right", "stop")
+	layers, err := named.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	antichain, err := named.MaxAntichain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layerString(layers...) != "start | left right | stop" || layerString(antichain) != "left right" {
+		t.Fatalf("got layers %s and antichain %s", layerString(layers...), layerString(antichain))
+	}
+}
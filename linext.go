@@ -0,0 +1,163 @@
+package gsim
+
+import (
+	"math/big"
+)
+
+// extensionCounter counts the permutations of a graph in which each
+// node is chosen at most once and becomes available as soon as a
+// fixed set of the nodes has been chosen, never to be inhibited. The
+// state of such a graph is then just the set of nodes chosen so far,
+// so rather than walking the tree of permutations, the counter sums
+// over the (far fewer) reachable sets of chosen nodes: for a DAG in
+// which every node waits for all its predecessors, these are its
+// downsets, and the permutations its linear extensions.
+type extensionCounter struct {
+	nodes []*GraphNode
+	start []bool
+	// in holds the ids of the incoming edges of each node, and
+	// required those of the nodes which must have been chosen for it
+	// to become available. impossible is set for nodes which can
+	// never become available.
+	in, required [][]int
+	impossible   []bool
+	memo         map[string]*big.Int
+}
+
+// newExtensionCounter returns a counter for the permutations of gp,
+// or nil if gp is not of the form the counter requires: it must not
+// yet have been used, and every reachable node must have either the
+// default AvailableAnyCallback or an AvailableAllCallback, and no
+// other constraints (such as SetMaxVisits, timing, guards, atomic
+// blocks, mutexes, crashes, symmetry or VisitHooks).
+func newExtensionCounter(gp *graphPermutation) *extensionCounter {
+	if gp.nodeState.root != nil || gp.graph.unroll > 1 {
+		return nil
+	}
+	gp.graph.build()
+	nodes := gp.graph.nodes
+	index := gp.graph.index
+	ec := &extensionCounter{
+		nodes:      nodes,
+		start:      make([]bool, len(nodes)),
+		in:         make([][]int, len(nodes)),
+		required:   make([][]int, len(nodes)),
+		impossible: make([]bool, len(nodes)),
+		memo:       make(map[string]*big.Int),
+	}
+	for _, node := range gp.current {
+		id := index[node.(*GraphNode)]
+		if ec.start[id] {
+			return nil
+		}
+		ec.start[id] = true
+	}
+	for id, gn := range nodes {
+		if gn.maxVisits != 0 || gn.inDelays != nil || gn.hasDeadline || gn.outGuards != nil || gn.atomic != nil ||
+			gn.section != nil || gn.acquires != nil || gn.releases != nil || gn.kills != nil || gn.symmetryPred != nil || gn.onVisit != nil {
+			return nil
+		}
+		for _, in := range gn.In {
+			if inID, found := index[in]; found {
+				ec.in[id] = append(ec.in[id], inID)
+			}
+		}
+		switch cb := gn.Callback.(type) {
+		case *availableAnyCallback:
+		case *allCallback:
+			if cb.result != MakeAvailable {
+				return nil
+			}
+			for _, req := range cb.required {
+				// Only nodes with edges to gn are ever reached.
+				reqID, found := index[req]
+				if !found || !containsGraphNode(gn.In, req) {
+					ec.impossible[id] = true
+					break
+				}
+				ec.required[id] = append(ec.required[id], reqID)
+			}
+		default:
+			return nil
+		}
+	}
+	return ec
+}
+
+// available reports whether the node with the given id becomes
+// available once the nodes in chosen have been chosen.
+func (ec *extensionCounter) available(id int, chosen []uint64) bool {
+	if ec.start[id] {
+		return true
+	}
+	if ec.impossible[id] {
+		return false
+	}
+	reached := false
+	for _, in := range ec.in[id] {
+		if reached = chosen[in/64]&(1<<(in%64)) != 0; reached {
+			break
+		}
+	}
+	if !reached {
+		return false
+	}
+	for _, req := range ec.required[id] {
+		if chosen[req/64]&(1<<(req%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// count returns the number of permutations which follow the choice
+// of the nodes in chosen, which it leaves unmodified.
+func (ec *extensionCounter) count(chosen []uint64) *big.Int {
+	key := string(bitsetBytes(chosen))
+	if count, found := ec.memo[key]; found {
+		return count
+	}
+	count := new(big.Int)
+	for id := range ec.nodes {
+		word, bit := id/64, uint64(1)<<(id%64)
+		if chosen[word]&bit != 0 || !ec.available(id, chosen) {
+			continue
+		}
+		chosen[word] |= bit
+		count.Add(count, ec.count(chosen))
+		chosen[word] &^= bit
+	}
+	if count.Sign() == 0 {
+		// No node is available: the permutation is complete.
+		count.SetInt64(1)
+	}
+	ec.memo[key] = count
+	return count
+}
+
+func bitsetBytes(words []uint64) []byte {
+	buf := make([]byte, 0, len(words)*8)
+	for _, word := range words {
+		for shift := 0; shift < 64; shift += 8 {
+			buf = append(buf, byte(word>>shift))
+		}
+	}
+	return buf
+}
+
+// countExtensions returns the number of permutations of p, if it can
+// be found by an extensionCounter, or nil.
+func (p *TypedPermutations[T]) countExtensions() *big.Int {
+	if p.prefixDependent() || p.maxDepth > 0 || p.independent != nil {
+		return nil
+	}
+	gp, ok := interface{}(p.root.generator).(*graphPermutation)
+	if !ok {
+		return nil
+	}
+	ec := newExtensionCounter(gp)
+	if ec == nil {
+		return nil
+	}
+	return new(big.Int).Set(ec.count(make([]uint64, (len(ec.nodes)+63)/64)))
+}
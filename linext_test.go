@@ -0,0 +1,36 @@
+package gsim
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestCountExtensions(t *testing.T) {
+	for idx, start := range [][]*GraphNode{joins(), processes()} {
+		p := BuildPermutations(NewGraphPermutation(start...))
+		count := p.countExtensions()
+		if count == nil {
+			t.Fatalf("graph %d: not counted by extensions", idx)
+		}
+		if want := len(collect(p)); count.Cmp(big.NewInt(int64(want))) != 0 {
+			t.Fatalf("graph %d: counted %v, want %d", idx, count, want)
+		}
+	}
+	if count := BuildPermutations(NewGraphPermutation(egraph()...)).countExtensions(); count != nil {
+		t.Fatalf("graph with a CombinationCallback counted %v", count)
+	}
+
+	// Ten chains of two nodes are interleaved in 20!/2^10 ways, far
+	// too many to walk.
+	start := make([]*GraphNode, 10)
+	for idx := range start {
+		g := nodes(idx, -idx)
+		g[0].AddEdgeTo(g[1])
+		start[idx] = g[0]
+	}
+	want := new(big.Int).MulRange(1, 20)
+	want.Rsh(want, 10)
+	if got := BuildPermutations(NewGraphPermutation(start...)).Count(); got.Cmp(want) != 0 {
+		t.Fatalf("counted %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package gsim
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+)
+
+// WithLogger returns a copy of the receiver which logs the lifecycle
+// of its iteration to logger, so that the logs of long or automated
+// runs can be parsed. Each record carries the given fingerprint as
+// the "fingerprint" attribute, unless it is empty; for graphs, use
+// GraphFingerprint. The records are:
+//
+//   - "run started", at Info, when any iteration function starts,
+//     with "parallel", and "from" and "to" where a range is given;
+//   - "subtree completed", at Debug, whenever the subtree below an
+//     option of the root has been entirely explored (by ForEachPar,
+//     entirely generated), with its "subtree" index, in order of
+//     completion, and the "permutation" number of its root;
+//   - "consumer error", at Error, whenever a checker returns an error
+//     or panics, with the "permutation" number and the "error";
+//   - "checkpoint written", at Info, whenever Snapshot captures the
+//     position of the iteration, with the number of "pending" nodes
+//     and the lowest "permutation" number not yet consumed.
+//
+// Permutation numbers are logged as decimal strings, as they may
+// exceed any fixed-size integer. A nil logger disables logging.
+func (p *TypedPermutations[T]) WithLogger(logger *slog.Logger, fingerprint string) *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) {
+		p2.logger = logger
+		p2.fingerprint = fingerprint
+	})
+}
+
+// log writes a record to the logger of the receiver, if it has one.
+func (p *TypedPermutations[T]) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	if p.logger == nil {
+		return
+	}
+	if p.fingerprint != "" {
+		attrs = append(attrs, slog.String("fingerprint", p.fingerprint))
+	}
+	p.logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+func (p *TypedPermutations[T]) logRunStarted(from, to *big.Int, parallel bool) {
+	if p.logger == nil {
+		return
+	}
+	attrs := []slog.Attr{slog.Bool("parallel", parallel)}
+	if from != nil {
+		attrs = append(attrs, slog.String("from", from.String()))
+	}
+	if to != nil {
+		attrs = append(attrs, slog.String("to", to.String()))
+	}
+	p.log(slog.LevelInfo, "run started", attrs...)
+}
+
+func (p *TypedPermutations[T]) logSubtreeCompleted(subtree int, n *big.Int) {
+	p.log(slog.LevelDebug, "subtree completed", slog.Int("subtree", subtree), slog.String("permutation", n.String()))
+}
+
+// failed records that the permutation of pe has failed a check.
+func (p *TypedPermutations[T]) failed(pe *PermutationError) {
+	p.metrics.recordFailure()
+	p.log(slog.LevelError, "consumer error", slog.String("permutation", pe.N.String()), slog.String("error", pe.Err.Error()))
+}
+
+// logCheckpoint logs a snapshot of the worklist, below which count
+// records have been spilled.
+func (p *TypedPermutations[T]) logCheckpoint(worklist []*node[T], spilled []byte, count int) {
+	if p.logger == nil {
+		return
+	}
+	attrs := []slog.Attr{slog.Int("pending", len(worklist)+count)}
+	var lowest *big.Int
+	for _, n := range worklist {
+		if lowest == nil || n.n.Cmp(lowest) < 0 {
+			lowest = n.n
+		}
+	}
+	for ; count > 0; count-- {
+		n, _, rest, err := readNodeRecord(spilled)
+		if err != nil {
+			break
+		}
+		spilled = rest
+		if lowest == nil || n.Cmp(lowest) < 0 {
+			lowest = n
+		}
+	}
+	if lowest != nil {
+		attrs = append(attrs, slog.String("permutation", lowest.String()))
+	}
+	p.log(slog.LevelInfo, "checkpoint written", attrs...)
+}
@@ -0,0 +1,61 @@
+package gsim
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3})).WithLogger(logger, "abc")
+	failed := errors.New("failed")
+	err := p.ForEachCheck(checkerFunc(func(n *big.Int, perm []interface{}) error {
+		if perm[0] == 2 {
+			return failed
+		}
+		return nil
+	}))
+	var pe *PermutationError
+	if !errors.As(err, &pe) {
+		t.Fatalf("got %v", err)
+	}
+
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record["fingerprint"] != "abc" {
+			t.Fatalf("record %s has no fingerprint", line)
+		}
+		msg := record["msg"].(string)
+		switch msg {
+		case "run started":
+			if record["parallel"] != false {
+				t.Fatalf("got %s", line)
+			}
+		case "consumer error":
+			if record["permutation"] != pe.N.String() || record["error"] != "failed" || record["level"] != "ERROR" {
+				t.Fatalf("got %s", line)
+			}
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) < 3 || msgs[0] != "run started" || msgs[1] != "subtree completed" || msgs[len(msgs)-1] != "consumer error" {
+		t.Fatalf("logged %q", msgs)
+	}
+
+	// Without a logger, nothing is logged.
+	buf.Reset()
+	p.WithLogger(nil, "").ForEach(consumerFunc(nil))
+	if buf.Len() != 0 {
+		t.Fatalf("logged %s", buf.String())
+	}
+}
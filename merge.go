@@ -0,0 +1,177 @@
+package gsim
+
+import (
+	"encoding/binary"
+	"math/big"
+)
+
+// A StateKeyer is an OptionGenerator (of any type) which can produce a
+// canonical encoding of its current state. Two generators with equal
+// keys must generate exactly the same options, in the same order,
+// from then on. graphPermutation implements StateKeyer.
+type StateKeyer interface {
+	StateKey() []byte
+}
+
+// StateKey encodes the state of every node in the graph, and the order
+// of the available nodes. As with StateHash, callbacks must treat the
+// reached incoming edges as a set.
+func (gp *graphPermutation) StateKey() []byte {
+	return gp.stateKey(true)
+}
+
+// WithStateMerging returns a copy of the receiver which, when the
+// OptionGenerator implements StateKeyer, explores the tree as a DAG:
+// whenever two prefixes lead to the same state, the subtree after
+// that state is generated only once, and shared. Unlike
+// WithStateDeduplication, no permutations are lost: each is still
+// supplied to the consumer, with the same number and in the same
+// order as without merging. But as the OptionGenerator is only called
+// once per distinct state, for graphs with many diamonds this turns
+// exponential work in the generator into polynomial work, and Count
+// becomes polynomial too.
+//
+// The DAG is built in full, in memory, before the first permutation
+// is supplied. Merging is not used with WithPrune or WithConstraint
+// (whose decisions depend on the whole prefix rather than the state),
+// WithStateDeduplication, WithSleepSets, WithShuffle, resumed or
+// sharded Permutations, ForEachParGen, or ForEachBestFirst; in those
+// cases the tree is explored as usual, as it is by RunFor. Neither
+// progress reporting nor Snapshot is supported by a merged walk.
+func (p *TypedPermutations[T]) WithStateMerging() *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) { p2.merge = true })
+}
+
+// dagState is a distinct state of the generator, after it has
+// generated options.
+type dagState[T any] struct {
+	options  []T
+	children []*dagState[T]
+	// stuck holds the stuck options of a leaf, if deadlocks are not
+	// ignored, and missed its missed options, if milestones are not.
+	stuck  []T
+	missed []T
+	// count is the number of permutations reachable from the state.
+	count *big.Int
+}
+
+type stateDAG[T any] struct {
+	p      *TypedPermutations[T]
+	states map[string]*dagState[T]
+	perm   []T
+	root   *dagState[T]
+}
+
+// stateDAG builds the DAG of states, if state merging is on and can be
+// used. Otherwise it returns nil.
+func (p *TypedPermutations[T]) stateDAG() *stateDAG[T] {
+	if !p.merge || p.prefixDependent() || p.tracksStates() || p.sleepSets || p.shuffle != nil || p.resume != nil || p.budget > 0 {
+		return nil
+	}
+	gen := p.root.generator.Clone()
+	if _, ok := gen.(StateKeyer); !ok {
+		return nil
+	}
+	dag := &stateDAG[T]{p: p, states: make(map[string]*dagState[T])}
+	dag.root = dag.build(gen, p.root.value, 0)
+	return dag
+}
+
+// build generates the options of gen, after value, and recursively
+// the states which follow, unless the resulting state has already
+// been built. gen is consumed.
+func (dag *stateDAG[T]) build(gen TypedOptionGenerator[T], value T, depth int) *dagState[T] {
+	if depth > 0 {
+		dag.perm = append(dag.perm[:depth-1], value)
+	}
+	options, _ := dag.p.generate(gen, value, dag.perm[:depth])
+	key := gen.(StateKeyer).StateKey()
+	if dag.p.maxDepth > 0 {
+		// The depth limits the options too.
+		key = binary.AppendUvarint(key, uint64(depth))
+	}
+	if state, found := dag.states[string(key)]; found {
+		return state
+	}
+	// The generator may reuse the options slice once consumed.
+	state := &dagState[T]{options: append([]T(nil), options...)}
+	dag.states[string(key)] = state
+	if len(options) == 0 {
+		state.stuck = dag.p.stuck(gen)
+		state.missed = dag.p.missed(gen)
+		state.count = big.NewInt(1)
+		return state
+	}
+
+	// Every clone must be taken before gen is consumed, and clones
+	// may depend on gen's state, so gen is consumed last.
+	gens := make([]TypedOptionGenerator[T], len(options))
+	gens[0] = gen
+	for idx := 1; idx < len(options); idx++ {
+		gens[idx] = gen.Clone()
+	}
+	state.children = make([]*dagState[T], len(options))
+	state.count = new(big.Int)
+	for idx := len(options) - 1; idx >= 0; idx-- {
+		child := dag.build(gens[idx], state.options[idx], depth+1)
+		state.children[idx] = child
+		state.count.Add(state.count, child.count)
+	}
+	return state
+}
+
+// walk supplies every permutation in the DAG whose number is in the
+// range [from, to) to f, in the same order as
+// TypedPermutations.walk.
+func (dag *stateDAG[T]) walk(f TypedPermutationChecker[T], from, to *big.Int) *PermutationError {
+	return dag.walkFrom(f, from, to, dag.root, new(big.Int), big.NewInt(1), []T{})
+}
+
+func (dag *stateDAG[T]) walkFrom(f TypedPermutationChecker[T], from, to *big.Int, state *dagState[T], n, cumuOpts *big.Int, perm []T) *PermutationError {
+	if to != nil && n.Cmp(to) >= 0 {
+		return nil
+	}
+	if ppc, ok := f.(*parPermutationConsumer[T]); ok && len(perm) > 0 {
+		// The last element of perm has just been written.
+		ppc.truncate(len(perm) - 1)
+	}
+	optionCount := len(state.options)
+	if optionCount == 0 {
+		if from != nil && n.Cmp(from) < 0 {
+			return nil
+		}
+		_, isPar := f.(*parPermutationConsumer[T])
+		if !isPar {
+			dag.p.metrics.recordGenerated(1, true)
+		}
+		if handled, err := dag.p.handleIncomplete(f, state.stuck, state.missed, n, perm); err != nil {
+			pe := &PermutationError{N: n, Err: err}
+			dag.p.failed(pe)
+			return pe
+		} else if handled {
+			return nil
+		}
+		if err := f.Check(n, perm); err != nil {
+			pe := &PermutationError{N: n, Err: err}
+			if !isPar {
+				dag.p.failed(pe)
+			}
+			return pe
+		}
+		return nil
+	}
+
+	childCumuOpts := new(big.Int).Mul(cumuOpts, big.NewInt(int64(optionCount)))
+	for idx := optionCount - 1; idx >= 0; idx-- {
+		childN := n
+		if optionCount > 1 {
+			childN = big.NewInt(int64(idx))
+			childN.Mul(childN, cumuOpts)
+			childN.Add(childN, n)
+		}
+		if pe := dag.walkFrom(f, from, to, state.children[idx], childN, childCumuOpts, append(perm, state.options[idx])); pe != nil {
+			return pe
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package gsim
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestMergedCountMatchesCount(t *testing.T) {
+	for _, start := range [][]*GraphNode{chains(3, 3), diamonds(4), egraph()} {
+		p := BuildPermutations(NewGraphPermutation(start...))
+		want := p.Count()
+		if got := p.WithStateMerging().Count(); got.Cmp(want) != 0 {
+			t.Fatalf("merged count %v, want %v", got, want)
+		}
+		if got := len(collect(p)); int64(got) != want.Int64() {
+			t.Fatalf("%d permutations, want %v", got, want)
+		}
+	}
+}
+
+func TestMergedCountDoesNotOverflow(t *testing.T) {
+	// Two chains of 36 interleave in 72 choose 36 ways, far beyond a
+	// uint64, but there are only 37*37 states.
+	p := BuildPermutations(NewGraphPermutation(chains(2, 36)...)).WithStateMerging()
+	want := new(big.Int).Binomial(72, 36)
+	if got := p.Count(); got.Cmp(want) != 0 {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	wantSize, _ := new(big.Float).SetInt(want).Float64()
+	if got := p.EstimateSize(1, 0); got.Mean != wantSize || got.StdErr != 0 {
+		t.Fatalf("got size %v, want %v", got, wantSize)
+	}
+}
+
+func TestMergedForEachMatchesForEach(t *testing.T) {
+	for _, start := range [][]*GraphNode{chains(3, 2), diamonds(3), egraph()} {
+		p := BuildPermutations(NewGraphPermutation(start...))
+		want := newCollector()
+		p.ForEach(want)
+		got := newCollector()
+		p.WithStateMerging().ForEach(got)
+		checkPerms(t, *got.perms, *want.perms)
+		for idx, n := range *got.nums {
+			if n.Cmp((*want.nums)[idx]) != 0 {
+				t.Fatalf("permutation %v numbered %v, want %v", (*got.perms)[idx], n, (*want.nums)[idx])
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package gsim
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics collects counters and gauges describing iteration, so that
+// long-running explorations can be monitored. Attach it to
+// Permutations with WithMetrics, and then either publish it through
+// expvar with Publish, or serve it in the Prometheus text format with
+// WritePrometheus. A Metrics may be shared by several Permutations,
+// and used by several iterations at once; the counters then cover
+// them all. The zero value is not usable: use NewMetrics.
+type Metrics struct {
+	generated uint64
+	consumed  uint64
+	failures  uint64
+	// workers is the number of parallel workers in current runs, and
+	// busy the number of them currently consuming a batch.
+	workers int64
+	busy    int64
+	// busyNanos is the total time workers have spent consuming
+	// batches.
+	busyNanos int64
+	lock      sync.Mutex
+	// runStart is when the current parallel runs started, and
+	// runBusyNanos the value of busyNanos at the time.
+	runStart     time.Time
+	runBusyNanos int64
+}
+
+// MetricsSnapshot holds the values of a Metrics at one moment.
+type MetricsSnapshot struct {
+	// Generated is the number of permutations generated. Those
+	// generated by ForEachPar and ForEachParBounded are counted once
+	// their batch is queued for the workers.
+	Generated uint64
+	// Consumed is the number of permutations supplied to consumers
+	// (including those supplied to Deadlocked).
+	Consumed uint64
+	// InFlight is the number of permutations generated but not yet
+	// consumed: the depth of the queue between generation and
+	// consumption in ForEachPar and ForEachParBounded.
+	InFlight uint64
+	// Failures is the number of permutations for which a checker
+	// returned an error or panicked: the counterexamples found.
+	Failures uint64
+	// Workers is the number of parallel workers currently running,
+	// and Busy the number of them currently consuming permutations.
+	Workers int64
+	Busy    int64
+	// BusySeconds is the total time workers have spent consuming
+	// permutations.
+	BusySeconds float64
+	// Utilization is the fraction of the time since the current
+	// parallel runs started which workers have spent consuming
+	// permutations, between 0 and 1, or 0 if none is running.
+	Utilization float64
+}
+
+// NewMetrics creates a Metrics with every value zero.
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// WithMetrics returns a copy of the receiver which records its
+// iteration in m. Generation and consumption are recorded by every
+// iteration function; worker utilization only by ForEachPar,
+// ForEachParBounded and their checking equivalents, whose workers
+// consume batches from a queue. Recording costs a few atomic
+// operations per permutation.
+func (p *TypedPermutations[T]) WithMetrics(m *Metrics) *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) { p2.metrics = m })
+}
+
+// Snapshot returns the current values of the receiver.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	ms := MetricsSnapshot{
+		Consumed:    atomic.LoadUint64(&m.consumed),
+		Generated:   atomic.LoadUint64(&m.generated),
+		Failures:    atomic.LoadUint64(&m.failures),
+		Workers:     atomic.LoadInt64(&m.workers),
+		Busy:        atomic.LoadInt64(&m.busy),
+		BusySeconds: time.Duration(atomic.LoadInt64(&m.busyNanos)).Seconds(),
+	}
+	if ms.Generated > ms.Consumed {
+		ms.InFlight = ms.Generated - ms.Consumed
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if elapsed := time.Since(m.runStart); ms.Workers > 0 && elapsed > 0 {
+		busy := atomic.LoadInt64(&m.busyNanos) - m.runBusyNanos
+		ms.Utilization = float64(busy) / (float64(ms.Workers) * float64(elapsed))
+		if ms.Utilization > 1 {
+			ms.Utilization = 1
+		}
+	}
+	return ms
+}
+
+// Publish publishes the receiver through expvar under the given name,
+// as the JSON encoding of its MetricsSnapshot. As with expvar.Publish,
+// it panics if the name is already in use.
+func (m *Metrics) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return m.Snapshot() }))
+}
+
+// WritePrometheus writes the current values of the receiver to w in
+// the Prometheus text exposition format, each metric name starting
+// with prefix (for example "gsim_"). It can be served directly from
+// an http.Handler.
+func (m *Metrics) WritePrometheus(w io.Writer, prefix string) error {
+	ms := m.Snapshot()
+	bw := bufio.NewWriter(w)
+	write := func(name, kind, help string, value interface{}) {
+		fmt.Fprintf(bw, "# HELP %s%s %s\n# TYPE %s%s %s\n%s%s %v\n", prefix, name, help, prefix, name, kind, prefix, name, value)
+	}
+	write("permutations_generated_total", "counter", "Permutations generated.", ms.Generated)
+	write("permutations_consumed_total", "counter", "Permutations supplied to consumers.", ms.Consumed)
+	write("permutations_in_flight", "gauge", "Permutations generated but not yet consumed.", ms.InFlight)
+	write("failures_total", "counter", "Permutations which failed a check.", ms.Failures)
+	write("workers", "gauge", "Parallel workers running.", ms.Workers)
+	write("workers_busy", "gauge", "Parallel workers consuming permutations.", ms.Busy)
+	write("worker_busy_seconds_total", "counter", "Time workers have spent consuming permutations.", ms.BusySeconds)
+	write("worker_utilization", "gauge", "Fraction of time workers have spent consuming permutations.", ms.Utilization)
+	return bw.Flush()
+}
+
+// The methods below record iteration, and do nothing if the receiver
+// is nil.
+
+// recordGenerated records count permutations generated, and, if
+// consumed, also consumed.
+func (m *Metrics) recordGenerated(count int, consumed bool) {
+	if m == nil {
+		return
+	}
+	atomic.AddUint64(&m.generated, uint64(count))
+	if consumed {
+		atomic.AddUint64(&m.consumed, uint64(count))
+	}
+}
+
+func (m *Metrics) recordConsumed(count int) {
+	if m != nil {
+		atomic.AddUint64(&m.consumed, uint64(count))
+	}
+}
+
+func (m *Metrics) recordFailure() {
+	if m != nil {
+		atomic.AddUint64(&m.failures, 1)
+	}
+}
+
+// recordWorkers records that count workers have started, if count is
+// positive, or stopped, if it is negative.
+func (m *Metrics) recordWorkers(count int) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if atomic.AddInt64(&m.workers, int64(count)) == int64(count) && count > 0 {
+		m.runStart = time.Now()
+		m.runBusyNanos = atomic.LoadInt64(&m.busyNanos)
+	}
+}
+
+// recordBusy records that a worker has started consuming a batch, and
+// returns a function to be called once it has finished.
+func (m *Metrics) recordBusy() func() {
+	if m == nil {
+		return func() {}
+	}
+	atomic.AddInt64(&m.busy, 1)
+	start := time.Now()
+	return func() {
+		atomic.AddInt64(&m.busyNanos, int64(time.Since(start)))
+		atomic.AddInt64(&m.busy, -1)
+	}
+}
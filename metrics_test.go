@@ -0,0 +1,44 @@
+package gsim
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4})).WithMetrics(m)
+	p.ForEach(consumerFunc(nil))
+	if ms := m.Snapshot(); ms.Generated != 24 || ms.Consumed != 24 || ms.InFlight != 0 || ms.Workers != 0 {
+		t.Fatalf("after ForEach got %+v", ms)
+	}
+	if err := p.WithWorkers(2).ForEachPar(4, consumerFunc(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if ms := m.Snapshot(); ms.Generated != 48 || ms.Consumed != 48 || ms.Workers != 0 || ms.Busy != 0 || ms.BusySeconds <= 0 {
+		t.Fatalf("after ForEachPar got %+v", ms)
+	}
+	failed := errors.New("failed")
+	p.ForEachCheck(checkerFunc(func(*big.Int, []interface{}) error { return failed }))
+	if ms := m.Snapshot(); ms.Failures != 1 {
+		t.Fatalf("after a failure got %+v", ms)
+	}
+
+	var buf bytes.Buffer
+	if err := m.WritePrometheus(&buf, "gsim_"); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE gsim_permutations_generated_total counter",
+		"gsim_permutations_consumed_total 49",
+		"gsim_failures_total 1",
+		"gsim_workers 0",
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("no %q in\n%s", line, buf.String())
+		}
+	}
+}
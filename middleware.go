@@ -0,0 +1,87 @@
+package gsim
+
+import "math/big"
+
+// The functions in this file wrap TypedPermutationConsumers, so that
+// permutations can be logged, sampled, projected and fanned out
+// without writing a new consumer each time. The wrappers are cloned by
+// cloning what they wrap, so they are as safe to use with ForEachPar
+// as the consumers they wrap.
+
+// tee is the TypedPermutationConsumer returned by Tee.
+type tee[T any] struct {
+	consumers []TypedPermutationConsumer[T]
+}
+
+// Tee returns a TypedPermutationConsumer which supplies every
+// permutation to each of the consumers in turn.
+func Tee[T any](consumers ...TypedPermutationConsumer[T]) TypedPermutationConsumer[T] {
+	return &tee[T]{consumers: consumers}
+}
+
+func (t *tee[T]) Clone() TypedPermutationConsumer[T] {
+	consumers := make([]TypedPermutationConsumer[T], len(t.consumers))
+	for idx, consumer := range t.consumers {
+		consumers[idx] = consumer.Clone()
+	}
+	return &tee[T]{consumers: consumers}
+}
+
+func (t *tee[T]) Consume(n *big.Int, perm []T) {
+	for _, consumer := range t.consumers {
+		consumer.Consume(n, perm)
+	}
+}
+
+// filter is the TypedPermutationConsumer returned by Filter.
+type filter[T any] struct {
+	pred  func(*big.Int, []T) bool
+	inner TypedPermutationConsumer[T]
+}
+
+// Filter returns a TypedPermutationConsumer which supplies to inner
+// only the permutations for which pred returns true. pred may be
+// called concurrently by ForEachPar, and must not retain the
+// permutation.
+func Filter[T any](pred func(n *big.Int, perm []T) bool, inner TypedPermutationConsumer[T]) TypedPermutationConsumer[T] {
+	return &filter[T]{pred: pred, inner: inner}
+}
+
+func (f *filter[T]) Clone() TypedPermutationConsumer[T] {
+	return &filter[T]{pred: f.pred, inner: f.inner.Clone()}
+}
+
+func (f *filter[T]) Consume(n *big.Int, perm []T) {
+	if f.pred(n, perm) {
+		f.inner.Consume(n, perm)
+	}
+}
+
+// mapping is the TypedPermutationConsumer returned by Map.
+type mapping[T, U any] struct {
+	transform func(T) U
+	inner     TypedPermutationConsumer[U]
+	mapped    []U
+}
+
+// Map returns a TypedPermutationConsumer which applies transform to
+// every element of each permutation, and supplies the result to
+// inner. This allows, for example, a consumer written for the values
+// of GraphNodes to consume permutations of the nodes themselves. As
+// with any permutation, the backing array of the result is reused
+// once inner.Consume returns.
+func Map[T, U any](transform func(T) U, inner TypedPermutationConsumer[U]) TypedPermutationConsumer[T] {
+	return &mapping[T, U]{transform: transform, inner: inner}
+}
+
+func (m *mapping[T, U]) Clone() TypedPermutationConsumer[T] {
+	return &mapping[T, U]{transform: m.transform, inner: m.inner.Clone()}
+}
+
+func (m *mapping[T, U]) Consume(n *big.Int, perm []T) {
+	m.mapped = m.mapped[:0]
+	for _, elem := range perm {
+		m.mapped = append(m.mapped, m.transform(elem))
+	}
+	m.inner.Consume(n, m.mapped)
+}
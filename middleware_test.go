@@ -0,0 +1,52 @@
+package gsim
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(egraph()...))
+	all := collectSorted(p)
+
+	first, second := newCollector(), newCollector()
+	p.ForEach(Tee[interface{}](first, second))
+	checkPerms(t, first.sorted(), all)
+	checkPerms(t, second.sorted(), all)
+
+	filtered := newCollector()
+	p.ForEach(Filter(func(n *big.Int, perm []interface{}) bool { return len(perm) == 4 }, PermutationConsumer(filtered)))
+	var want []string
+	for _, perm := range all {
+		if len(strings.Fields(perm)) == 4 {
+			want = append(want, perm)
+		}
+	}
+	checkPerms(t, filtered.sorted(), want)
+
+	values := &typedCollector[string]{}
+	p.ForEach(Map(func(elem interface{}) string {
+		return strings.ToLower(elem.(*GraphNode).Value.(string))
+	}, TypedPermutationConsumer[string](values)))
+	if len(values.perms) != len(all) {
+		t.Fatalf("got %d permutations, want %d", len(values.perms), len(all))
+	}
+	for idx, perm := range values.perms {
+		if got := permString(p.Permutation(values.nums[idx])); strings.ToLower(got) != strings.Join(perm, " ") {
+			t.Fatalf("mapped %q to %q", got, perm)
+		}
+	}
+}
+
+func TestMiddlewareWithForEachPar(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5})).WithWorkers(4)
+	c := newCollector()
+	err := p.ForEachPar(8, Filter(func(n *big.Int, perm []interface{}) bool { return perm[0] == 1 }, Tee[interface{}](c)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perms := c.sorted(); len(perms) != 24 || perms[0] != "1 2 3 4 5" || perms[23] != "1 5 4 3 2" {
+		t.Fatalf("got %q", perms)
+	}
+}
@@ -0,0 +1,177 @@
+package gsim
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// SetMandatory marks the node as a milestone which every permutation
+// is expected to visit. Inhibition can end a permutation early, before
+// it has reached events which the model regards as essential (a
+// commit, say); by default such short permutations are supplied to
+// consumers just like complete ones. WithMilestonePolicy determines
+// what happens to permutations which end without visiting every
+// mandatory node. As with adding edges, this must be done before the
+// graph is used.
+func (gn *GraphNode) SetMandatory() {
+	gn.mandatory = true
+}
+
+// Mandatory reports whether the node is a milestone. See SetMandatory.
+func (gn *GraphNode) Mandatory() bool {
+	return gn.mandatory
+}
+
+// A TypedMilestoneDetector is a TypedOptionGenerator which can tell,
+// once Generate has returned no options, which of the options that
+// every permutation must contain have not been chosen.
+// graphPermutation implements it, with the nodes marked by
+// SetMandatory.
+type TypedMilestoneDetector[T any] interface {
+	TypedOptionGenerator[T]
+	// Missed is called after Generate has returned no options. It
+	// returns the mandatory options which have not been chosen, or
+	// nil if there are none.
+	Missed() []T
+}
+
+// MilestoneDetector is the interface{} instantiation of
+// TypedMilestoneDetector.
+type MilestoneDetector = TypedMilestoneDetector[interface{}]
+
+// A TypedMilestoneConsumer is a TypedPermutationConsumer or
+// TypedPermutationChecker which wishes to be told about permutations
+// which missed milestones under the MilestoneFlag policy.
+type TypedMilestoneConsumer[T any] interface {
+	// MissedMilestones is called instead of Consume (or Check) with a
+	// permutation which ended without choosing the missed options.
+	// As with Consume, the arguments must not be retained or mutated.
+	MissedMilestones(n *big.Int, perm []T, missed []T)
+}
+
+// MilestoneConsumer is the interface{} instantiation of
+// TypedMilestoneConsumer.
+type MilestoneConsumer = TypedMilestoneConsumer[interface{}]
+
+// MilestonePolicy determines what happens to permutations which end
+// without visiting every milestone: that is, the OptionGenerator is a
+// TypedMilestoneDetector which reports some options to be missed.
+type MilestonePolicy int
+
+const (
+	// MilestoneIgnore treats permutations which missed milestones as
+	// any other: they are supplied to Consume (or Check). This is the
+	// default.
+	MilestoneIgnore MilestonePolicy = iota
+	// MilestoneSuppress silently drops permutations which missed
+	// milestones: they are supplied to no consumer.
+	MilestoneSuppress
+	// MilestoneFlag supplies permutations which missed milestones to
+	// MissedMilestones if the consumer is a TypedMilestoneConsumer,
+	// and to Consume (or Check) otherwise.
+	MilestoneFlag
+	// MilestoneAbort stops iteration at the first permutation which
+	// missed milestones, returning a *PermutationError whose Err is a
+	// *TypedMilestoneError.
+	MilestoneAbort
+)
+
+// TypedMilestoneError is the error with which iteration stops under
+// the MilestoneAbort policy. It is always wrapped in a
+// *PermutationError identifying the permutation.
+type TypedMilestoneError[T any] struct {
+	// Missed holds the mandatory options which were not chosen.
+	Missed []T
+	// Perm is the permutation which missed them.
+	Perm []T
+}
+
+// MilestoneError is the interface{} instantiation of
+// TypedMilestoneError.
+type MilestoneError = TypedMilestoneError[interface{}]
+
+func (me *TypedMilestoneError[T]) Error() string {
+	return fmt.Sprintf("%v milestones missed: %v, by permutation %v", len(me.Missed), me.Missed, me.Perm)
+}
+
+// WithMilestonePolicy returns a copy of the receiver which deals with
+// permutations which miss milestones according to policy. This
+// affects every iteration function, but not Count, Permutation and
+// the like. A permutation which is deadlocked (see
+// WithDeadlockPolicy) is dealt with as such first.
+func (p *TypedPermutations[T]) WithMilestonePolicy(policy MilestonePolicy) *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) { p2.milestonePolicy = policy })
+}
+
+// missed returns the missed options of gen, if it is a
+// TypedMilestoneDetector and milestones are not ignored.
+func (p *TypedPermutations[T]) missed(gen TypedOptionGenerator[T]) []T {
+	if p.milestonePolicy == MilestoneIgnore {
+		return nil
+	}
+	if detector, ok := gen.(TypedMilestoneDetector[T]); ok {
+		return detector.Missed()
+	}
+	return nil
+}
+
+// handleMissed applies the milestone policy to the permutation perm,
+// whose missed options are known. It reports whether the permutation
+// has been dealt with, in which case f.Check must not be called,
+// along with any error with which iteration must stop.
+func (p *TypedPermutations[T]) handleMissed(f TypedPermutationChecker[T], missed []T, n *big.Int, perm []T) (bool, error) {
+	if len(missed) == 0 {
+		return false, nil
+	}
+	switch p.milestonePolicy {
+	case MilestoneSuppress:
+		return true, nil
+	case MilestoneAbort:
+		return true, &TypedMilestoneError[T]{Missed: missed, Perm: Retain(perm)}
+	}
+	if ppc, ok := f.(*parPermutationConsumer[T]); ok {
+		return true, ppc.add(n, perm, nil, missed)
+	}
+	if mc, ok := milestoneConsumer(f); ok {
+		mc.MissedMilestones(n, perm, missed)
+		return true, nil
+	}
+	return false, nil
+}
+
+// milestoneConsumer finds the TypedMilestoneConsumer behind f, if
+// there is one.
+func milestoneConsumer[T any](f TypedPermutationChecker[T]) (TypedMilestoneConsumer[T], bool) {
+	if cc, ok := f.(consumerChecker[T]); ok {
+		mc, ok := cc.TypedPermutationConsumer.(TypedMilestoneConsumer[T])
+		return mc, ok
+	}
+	mc, ok := f.(TypedMilestoneConsumer[T])
+	return mc, ok
+}
+
+// Missed returns every node marked by SetMandatory which has not been
+// chosen.
+func (gp *graphPermutation) Missed() []interface{} {
+	var missed []interface{}
+	for id, gn := range gp.allNodes() {
+		if !gn.mandatory {
+			continue
+		}
+		if gns, found := gp.stateAt(id, false); !found || gns.visits == 0 {
+			missed = append(missed, gn)
+		}
+	}
+	return missed
+}
+
+// Missed is as graphPermutation's Missed.
+func (bp *bitsetPermutation) Missed() []interface{} {
+	var missed []interface{}
+	for id, gn := range bp.graph.nodes {
+		if gn.mandatory && !bp.visited.has(id) {
+			missed = append(missed, gn)
+		}
+	}
+	return missed
+}
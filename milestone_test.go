@@ -0,0 +1,112 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// milestoneCollector is a collector which also records the
+// permutations which missed milestones, with what they missed.
+type milestoneCollector struct {
+	*collector
+	missed *[]string
+}
+
+func (mc milestoneCollector) Clone() PermutationConsumer {
+	return mc
+}
+
+func (mc milestoneCollector) MissedMilestones(n *big.Int, perm []interface{}, missed []interface{}) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	*mc.missed = append(*mc.missed, permString(perm)+" missing "+permString(missed))
+}
+
+func TestWithMilestonePolicy(t *testing.T) {
+	start := egraph()
+	for _, gn := range reachableGraphNodes(start...) {
+		if gn.Value == "E4" {
+			gn.SetMandatory()
+		}
+	}
+	p := BuildPermutations(NewGraphPermutation(start...))
+	all := collectSorted(p)
+	var complete, short []string
+	for _, perm := range all {
+		if strings.Contains(perm, "E4") {
+			complete = append(complete, perm)
+		} else {
+			short = append(short, perm+" missing E4")
+		}
+	}
+	if len(complete) == 0 || len(short) == 0 {
+		t.Fatalf("got %q", all)
+	}
+
+	checkPerms(t, collectSorted(p.WithMilestonePolicy(MilestoneIgnore)), all)
+	checkPerms(t, collectSorted(p.WithMilestonePolicy(MilestoneSuppress)), complete)
+	checkPerms(t, collectSorted(p.WithMilestonePolicy(MilestoneFlag)), all)
+
+	mc := milestoneCollector{collector: newCollector(), missed: new([]string)}
+	p.WithMilestonePolicy(MilestoneFlag).ForEach(mc)
+	checkPerms(t, mc.sorted(), complete)
+	sort.Strings(*mc.missed)
+	checkPerms(t, *mc.missed, short)
+
+	mc = milestoneCollector{collector: newCollector(), missed: new([]string)}
+	if err := p.WithMilestonePolicy(MilestoneFlag).WithWorkers(2).ForEachPar(2, mc); err != nil {
+		t.Fatal(err)
+	}
+	checkPerms(t, mc.sorted(), complete)
+	if len(*mc.missed) != len(short) {
+		t.Fatalf("ForEachPar flagged %q", *mc.missed)
+	}
+
+	err := p.WithMilestonePolicy(MilestoneAbort).ForEachCheck(checkerFunc(func(*big.Int, []interface{}) error { return nil }))
+	var pe *PermutationError
+	var me *MilestoneError
+	if !errors.As(err, &pe) || !errors.As(err, &me) || permString(me.Perm) != permString(p.Permutation(pe.N)) || permString(me.Missed) != "E4" {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestMilestonesMissedThroughInhibition(t *testing.T) {
+	// In joinOrInhibit, x is never reached once c has inhibited b.
+	build := func() []*GraphNode {
+		start := joinOrInhibit()
+		for _, gn := range reachableGraphNodes(start...) {
+			if gn.Value == "x" {
+				gn.SetMandatory()
+			} else if gn.Mandatory() {
+				t.Fatalf("%v is mandatory", gn)
+			}
+		}
+		return start
+	}
+	bitset, err := NewBitsetGraphPermutation(build()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, gen := range []OptionGenerator{NewGraphPermutation(build()...), bitset} {
+		p := BuildPermutations(gen)
+		var complete, short []string
+		for _, perm := range collectSorted(p) {
+			if strings.Contains(perm, "x") {
+				complete = append(complete, perm)
+			} else {
+				short = append(short, perm+" missing x")
+			}
+		}
+		if len(short) == 0 {
+			t.Fatal("x never missed")
+		}
+		mc := milestoneCollector{collector: newCollector(), missed: new([]string)}
+		p.WithMilestonePolicy(MilestoneFlag).ForEach(mc)
+		checkPerms(t, mc.sorted(), complete)
+		sort.Strings(*mc.missed)
+		checkPerms(t, *mc.missed, short)
+	}
+}
@@ -0,0 +1,71 @@
+package gsim
+
+// Mutex models a lock guarding several critical sections of a graph.
+// Within each permutation, once a section has started, no node of any
+// other section of the same Mutex may be chosen until the section has
+// been released. This saves building meshes of inhibiting edges by
+// hand.
+type Mutex struct {
+	sections []*criticalSection
+}
+
+type criticalSection struct {
+	mutex   *Mutex
+	nodes   []*GraphNode
+	acquire *GraphNode
+	release *GraphNode
+}
+
+// Construct a new Mutex, with no sections.
+func NewMutex() *Mutex {
+	return &Mutex{}
+}
+
+// Section declares a critical section guarded by the receiver. The
+// section starts when its first node is chosen, and is released when
+// its last node is chosen; the nodes in between are part of the
+// section too, and so cannot be chosen while another section holds
+// the lock. No edges are added: the order of the nodes within the
+// section is up to the graph. A node may be in at most one section.
+// If a section's last node never becomes available then the other
+// sections can never run, which WithDeadlockPolicy will detect.
+func (m *Mutex) Section(nodes ...*GraphNode) {
+	if len(nodes) == 0 {
+		panic("Mutex.Section requires at least one node")
+	}
+	cs := &criticalSection{
+		mutex:   m,
+		nodes:   nodes,
+		acquire: nodes[0],
+		release: nodes[len(nodes)-1],
+	}
+	for _, gn := range nodes {
+		if gn.section != nil {
+			panic("GraphNode is already in a critical section: " + gn.String())
+		}
+		gn.section = cs
+	}
+	m.sections = append(m.sections, cs)
+}
+
+// held reports whether the section has started but not been
+// released. This is derived from the visits of its first and last
+// nodes, so it is correct for nodes which may be visited several
+// times.
+func (gp *graphPermutation) held(cs *criticalSection) bool {
+	return cs.acquire != cs.release && gp.Visits(cs.acquire) > gp.Visits(cs.release)
+}
+
+// mutexEligible reports whether gn may be chosen now, given the
+// critical section it is in, if any.
+func (gp *graphPermutation) mutexEligible(gn *GraphNode) bool {
+	if gn.section == nil {
+		return true
+	}
+	for _, cs := range gn.section.mutex.sections {
+		if cs != gn.section && gp.held(cs) {
+			return false
+		}
+	}
+	return true
+}
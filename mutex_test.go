@@ -0,0 +1,23 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestMutexSection(t *testing.T) {
+	start := processes()
+	m := NewMutex()
+	m.Section(start[0], start[0].Out[0])
+	m.Section(start[1], start[1].Out[0])
+	checkPerms(t, collectSorted(BuildPermutations(NewGraphPermutation(start...))), []string{
+		"a1 a2 b1 b2",
+		"b1 b2 a1 a2",
+	})
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic")
+		}
+	}()
+	m.Section(start[0])
+}
@@ -0,0 +1,137 @@
+package gsim
+
+import (
+	"fmt"
+)
+
+// Graph owns a set of GraphNodes, each registered under a unique
+// name. Edges are added by name, so mistakes such as creating two
+// nodes for the same event, or linking to a node that was never
+// registered, are errors rather than silent changes to the
+// permutation space. The nodes are ordinary GraphNodes, so everything
+// else (callbacks, SetMaxVisits and so on) works as usual. For
+// example:
+//
+//	g := gsim.NewGraph()
+//	g.AddNode("start", startEvent)
+//	g.AddNode("stop", stopEvent)
+//	g.AddEdge("start", "stop")
+//	gen := g.NewGraphPermutation()
+type Graph struct {
+	nodes []*GraphNode
+	names map[string]*GraphNode
+	index map[*GraphNode]string
+}
+
+// Construct a new, empty, Graph.
+func NewGraph() *Graph {
+	return &Graph{
+		names: make(map[string]*GraphNode),
+		index: make(map[*GraphNode]string),
+	}
+}
+
+// AddNode creates a node with the given value, registered under the
+// given name. It is an error if the name is already registered.
+func (g *Graph) AddNode(name string, value interface{}) (*GraphNode, error) {
+	if _, found := g.names[name]; found {
+		return nil, fmt.Errorf("graph already has a node named %q", name)
+	}
+	gn := NewGraphNode(value)
+	g.nodes = append(g.nodes, gn)
+	g.names[name] = gn
+	g.index[gn] = name
+	return gn, nil
+}
+
+// AddEdge adds an edge from the node named from to the node named to,
+// as AddEdgeTo. It is an error if either name is not registered, or
+// if the edge already exists.
+func (g *Graph) AddEdge(from, to string) error {
+	gn, err := g.mustGetNode(from)
+	if err != nil {
+		return err
+	}
+	gn2, err := g.mustGetNode(to)
+	if err != nil {
+		return err
+	}
+	for _, out := range gn.Out {
+		if out == gn2 {
+			return fmt.Errorf("graph already has an edge from %q to %q", from, to)
+		}
+	}
+	gn.AddEdgeTo(gn2)
+	return nil
+}
+
+func (g *Graph) mustGetNode(name string) (*GraphNode, error) {
+	gn, found := g.names[name]
+	if !found {
+		return nil, fmt.Errorf("graph has no node named %q", name)
+	}
+	return gn, nil
+}
+
+// GetNode returns the node registered under the given name, if any.
+func (g *Graph) GetNode(name string) (*GraphNode, bool) {
+	gn, found := g.names[name]
+	return gn, found
+}
+
+// Name returns the name under which the node is registered, if it
+// belongs to the receiver.
+func (g *Graph) Name(gn *GraphNode) (string, bool) {
+	name, found := g.index[gn]
+	return name, found
+}
+
+// Nodes returns every node, in the order they were added.
+func (g *Graph) Nodes() []*GraphNode {
+	return append([]*GraphNode(nil), g.nodes...)
+}
+
+// StartNodes returns the nodes with no incoming edges, in the order
+// they were added. These are the nodes which are available at the
+// start of every permutation.
+func (g *Graph) StartNodes() []*GraphNode {
+	var start []*GraphNode
+	for _, gn := range g.nodes {
+		if len(gn.In) == 0 {
+			start = append(start, gn)
+		}
+	}
+	return start
+}
+
+// NewGraphPermutation constructs an OptionGenerator for the graph,
+// starting from its StartNodes.
+func (g *Graph) NewGraphPermutation() OptionGenerator {
+	return NewGraphPermutation(g.StartNodes()...)
+}
+
+// Validate runs ValidateGraph from the StartNodes. As the Graph knows
+// all of its nodes, every node which can not be reached is reported
+// as Unreachable, whether or not it is connected to the rest of the
+// graph. Any node reachable from the graph which was not added to it
+// through AddNode is reported as Unregistered.
+func (g *Graph) Validate() *GraphReport {
+	start := g.StartNodes()
+	report := ValidateGraph(start...)
+	reached := make(map[*GraphNode]bool)
+	for _, gn := range reachableGraphNodes(start...) {
+		reached[gn] = true
+		if _, found := g.index[gn]; !found {
+			report.Unregistered = append(report.Unregistered, gn)
+		}
+	}
+	for _, gn := range report.Unreachable {
+		reached[gn] = true // already reported
+	}
+	for _, gn := range g.nodes {
+		if !reached[gn] {
+			report.Unreachable = append(report.Unreachable, gn)
+		}
+	}
+	return report
+}
@@ -0,0 +1,57 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestGraph(t *testing.T) {
+	g := NewGraph()
+	for _, name := range []string{"start", "left", "right", "stop"} {
+		if _, err := g.AddNode(name, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := g.AddNode("start", "again"); err == nil {
+		t.Fatal("duplicate name registered")
+	}
+	for _, edge := range [][2]string{{"start", "left"}, {"start", "right"}, {"left", "stop"}} {
+		if err := g.AddEdge(edge[0], edge[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, edge := range [][2]string{{"start", "left"}, {"start", "missing"}, {"missing", "stop"}} {
+		if err := g.AddEdge(edge[0], edge[1]); err == nil {
+			t.Errorf("edge %v added", edge)
+		}
+	}
+	left, found := g.GetNode("left")
+	if name, ok := g.Name(left); !found || !ok || name != "left" {
+		t.Fatalf("got name %q for left", name)
+	}
+	if _, ok := g.Name(NewGraphNode("left")); ok {
+		t.Fatal("foreign node named")
+	}
+	if start := g.StartNodes(); len(start) != 1 || start[0].Value != "start" || len(g.Nodes()) != 4 {
+		t.Fatalf("got start nodes %v of %v", start, g.Nodes())
+	}
+	checkPerms(t, collectSorted(BuildPermutations(g.NewGraphPermutation())), []string{
+		"start left right stop",
+		"start left stop right",
+		"start right left stop",
+	})
+	if report := g.Validate(); !report.OK() {
+		t.Fatal(report)
+	}
+
+	// Nodes which cannot be reached, and nodes reachable but not
+	// added, are reported.
+	g.AddNode("island", "island")
+	g.AddEdge("island", "island")
+	stray := NewGraphNode("stray")
+	left.AddEdgeTo(stray)
+	report := g.Validate()
+	if len(report.Unreachable) != 1 || report.Unreachable[0].Value != "island" ||
+		len(report.Unregistered) != 1 || report.Unregistered[0] != stray {
+		t.Fatalf("got %v", report)
+	}
+}
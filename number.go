@@ -0,0 +1,64 @@
+package gsim
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Number is the inverse of Permutation: given a complete permutation
+// it replays the OptionGenerator to find the permutation's number. An
+// error is returned if perm is not a permutation that could be
+// generated, for example because some element is not one of the
+// options available at that point, or because perm stops before the
+// OptionGenerator runs out of options. Elements are compared with
+// ==, so they must be comparable.
+func (p *TypedPermutations[T]) Number(perm []T) (*big.Int, error) {
+	return p.NumberMatching(perm, func(elem, option T) bool {
+		return interface{}(elem) == interface{}(option)
+	})
+}
+
+// NumberMatching is the same as Number, except that match is used to
+// decide whether an element of perm corresponds to one of the options
+// generated. This is useful when perm has been recorded externally:
+// for example, a trace of the values of GraphNodes can be correlated
+// with the permutations of a graph by comparing each element against
+// the option's Value field. The first matching option is chosen.
+func (p *TypedPermutations[T]) NumberMatching(perm []T, match func(elem, option T) bool) (*big.Int, error) {
+	n := new(big.Int)
+	cumuOpts := big.NewInt(1)
+	choiceBig := new(big.Int)
+	prefix := make([]T, 0, len(perm))
+
+	gen := p.root.generator.Clone()
+	val := p.root.value
+	for depth := 0; ; depth++ {
+		options, ok := p.generate(gen, val, prefix)
+		if !ok {
+			return nil, fmt.Errorf("prefix of length %v is pruned", depth)
+		}
+		optionCount := len(options)
+		if depth == len(perm) {
+			if optionCount != 0 {
+				return nil, fmt.Errorf("permutation is incomplete: %v further options are available", optionCount)
+			}
+			return n, nil
+		}
+		choice := -1
+		for idx, option := range options {
+			if match(perm[depth], option) {
+				choice = idx
+				break
+			}
+		}
+		if choice == -1 {
+			return nil, fmt.Errorf("element %v (%v) is not an available option", depth, perm[depth])
+		}
+		choiceBig.SetInt64(int64(choice))
+		n.Add(n, choiceBig.Mul(choiceBig, cumuOpts))
+		cumuOpts.Mul(cumuOpts, big.NewInt(int64(optionCount)))
+		val = options[choice]
+		prefix = append(prefix, val)
+		gen = gen.Clone()
+	}
+}
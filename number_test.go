@@ -0,0 +1,46 @@
+package gsim
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestNumberInvertsPermutation(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4}))
+	p.ForEach(consumerFunc(func(n *big.Int, perm []interface{}) {
+		got, err := p.Number(perm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Cmp(n) != 0 {
+			t.Fatalf("Number(%v) is %v, want %v", perm, got, n)
+		}
+	}))
+	for _, perm := range [][]interface{}{{1, 2, 3}, {1, 2, 3, 3}, {1, 2, 3, 5}} {
+		if _, err := p.Number(perm); err == nil {
+			t.Errorf("Number(%v) succeeded", perm)
+		}
+	}
+}
+
+func TestNumberMatching(t *testing.T) {
+	start := egraph()
+	p := BuildPermutations(NewGraphPermutation(start...))
+	want := newCollector()
+	p.ForEach(want)
+	byValue := func(elem, option interface{}) bool { return elem == option.(*GraphNode).Value }
+	for idx, perm := range *want.perms {
+		var values []interface{}
+		for _, value := range strings.Fields(perm) {
+			values = append(values, value)
+		}
+		n, err := p.NumberMatching(values, byValue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.Cmp((*want.nums)[idx]) != 0 {
+			t.Fatalf("NumberMatching(%v) is %v, want %v", values, n, (*want.nums)[idx])
+		}
+	}
+}
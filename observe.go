@@ -0,0 +1,37 @@
+package gsim
+
+// A VisitObserver is called each time the node it is added to is
+// chosen, with the nodes chosen so far, in order, the last being the
+// node itself. The prefix must be treated as read-only, and must not
+// be retained.
+type VisitObserver func(prefix []interface{})
+
+// AddObserver adds an observer to be called whenever the receiver is
+// chosen, for logging, metrics or assertions about the exploration
+// itself rather than about the permutations consumed. Any number of
+// observers may be added; they are called in the order they were
+// added.
+//
+// Unlike a VisitHook (see OnVisit), an observer cannot change the
+// graph. Observers are called from within Generate, so they see every
+// visit made by the generator and its clones: a node which occurs in
+// the shared prefix of many permutations is observed once for each
+// branch of the tree in which it is chosen, and Count, Permutation and
+// the like cause visits too. With the parallel iteration functions,
+// observers may be called from several go-routines at once. As with
+// adding edges, observers must be added before the graph is used.
+func (gn *GraphNode) AddObserver(observer VisitObserver) {
+	gn.observers = append(gn.observers, observer)
+}
+
+// observe calls the observers of gn, which has just been chosen.
+func (gp *graphPermutation) observe(gn *GraphNode) {
+	history := VisitHistory{gp.history}.Nodes()
+	prefix := make([]interface{}, len(history))
+	for idx, gn2 := range history {
+		prefix[idx] = gn2
+	}
+	for _, observer := range gn.observers {
+		observer(prefix)
+	}
+}
@@ -0,0 +1,42 @@
+package gsim
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestAddObserver(t *testing.T) {
+	start := egraph()
+	e1 := start[0]
+	var prefixes []string
+	e1.AddObserver(func(prefix []interface{}) {
+		if prefix[len(prefix)-1] != e1 {
+			t.Fatalf("observed %q", permString(prefix))
+		}
+		prefixes = append(prefixes, permString(prefix))
+	})
+	calls := 0
+	e1.AddObserver(func(prefix []interface{}) {
+		if calls++; calls != len(prefixes) {
+			t.Fatal("observers called out of order")
+		}
+	})
+	// E1 is observed once for every branch of the tree in which it is
+	// chosen: once for each distinct prefix ending with it.
+	want := make(map[string]bool)
+	BuildPermutations(NewGraphPermutation(start...)).ForEach(consumerFunc(func(n *big.Int, perm []interface{}) {
+		for idx, elem := range perm {
+			if elem == e1 {
+				want[permString(perm[:idx+1])] = true
+			}
+		}
+	}))
+	if len(prefixes) != len(want) || calls != len(prefixes) {
+		t.Fatalf("observed %q, want each of %v once", prefixes, want)
+	}
+	for _, prefix := range prefixes {
+		if !want[prefix] {
+			t.Fatalf("observed %q", prefix)
+		}
+	}
+}
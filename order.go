@@ -0,0 +1,83 @@
+package gsim
+
+import (
+	"sort"
+)
+
+// A TypedOrderFunc reports whether option a should be explored before
+// option b.
+type TypedOrderFunc[T any] func(a, b T) bool
+
+// OrderFunc is the interface{} instantiation of TypedOrderFunc.
+type OrderFunc = TypedOrderFunc[interface{}]
+
+// WithOptionOrder returns a copy of the receiver in which the options
+// returned by each call to Generate are reordered so that the
+// iteration functions explore them in the order given by before:
+// options for which before returns true are explored, along with
+// their entire subtrees, first. Options which are equally ordered
+// keep their relative order. Combined with early termination (for
+// example a PermutationChecker which fails), this can find bugs in
+// huge spaces much sooner by exploring the most interesting
+// interleavings first.
+//
+// Because the order of options determines permutation numbers,
+// numbers from a Permutations with one order are meaningless to a
+// Permutations with another. Count, Permutation and so on all respect
+// the order.
+func (p *TypedPermutations[T]) WithOptionOrder(before TypedOrderFunc[T]) *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) { p2.order = before })
+}
+
+// WithShuffle returns a copy of the receiver which, during ForEach,
+// ForEachPar and their variants, explores the children of every node
+// in an order shuffled from the given seed. Unlike WithOptionOrder,
+// permutation numbers are unchanged, as are Count and Permutation:
+// the same permutations are generated, in a different order. When the
+// space is too large to finish, independent runs with different seeds
+// therefore probe different regions of it first, which is the basis
+// of swarm verification; and the same seed always gives the same
+// order. ForEachParGen ignores the shuffle, and WithStateMerging is
+// disabled by it. A Permutations resumed from a Snapshot continues in
+// a different order, but still generates every permutation not yet
+// consumed.
+func (p *TypedPermutations[T]) WithShuffle(seed int64) *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) { p2.shuffle = &seed })
+}
+
+// orderOptions returns a reordered copy of options. The worklist is
+// a stack, so the options to be explored first must come last.
+func (p *TypedPermutations[T]) orderOptions(options []T) []T {
+	if len(options) < 2 {
+		return options
+	}
+	ordered := make([]T, len(options))
+	for idx, option := range options {
+		ordered[len(options)-1-idx] = option
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return p.order(ordered[i], ordered[j])
+	})
+	for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+		ordered[i], ordered[j] = ordered[j], ordered[i]
+	}
+	return ordered
+}
+
+// SetPriority sets the priority of the node, for use with
+// GraphPriorityOrder. The default priority is 0.
+func (gn *GraphNode) SetPriority(priority int) {
+	gn.priority = priority
+}
+
+// Priority returns the priority of the node. See SetPriority.
+func (gn *GraphNode) Priority() int {
+	return gn.priority
+}
+
+// GraphPriorityOrder is an OrderFunc, for use with WithOptionOrder
+// and a graph OptionGenerator, which explores GraphNodes with higher
+// priorities first.
+func GraphPriorityOrder(a, b interface{}) bool {
+	return a.(*GraphNode).priority > b.(*GraphNode).priority
+}
@@ -0,0 +1,57 @@
+package gsim
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestWithOptionOrder(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3}))
+	descending := p.WithOptionOrder(func(a, b interface{}) bool { return a.(int) > b.(int) })
+	got := collect(descending)
+	checkPerms(t, got, []string{"3 2 1", "3 1 2", "2 3 1", "2 1 3", "1 3 2", "1 2 3"})
+	c := newCollector()
+	descending.ForEach(c)
+	for idx, perm := range *c.perms {
+		if permString(descending.Permutation((*c.nums)[idx])) != perm {
+			t.Fatalf("%q numbered %v", perm, (*c.nums)[idx])
+		}
+	}
+	sort.Strings(got)
+	checkPerms(t, got, collectSorted(p))
+}
+
+func TestGraphPriorityOrder(t *testing.T) {
+	g := nodes("low", "high", "default")
+	g[0].SetPriority(-1)
+	g[1].SetPriority(1)
+	p := BuildPermutations(NewGraphPermutation(g...)).WithOptionOrder(GraphPriorityOrder)
+	if got := collect(p)[0]; got != "high default low" {
+		t.Fatalf("explored %q first", got)
+	}
+}
+
+func TestWithShuffle(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(diamonds(3)...))
+	all := newCollector()
+	p.ForEach(all)
+	orders := make(map[string]bool)
+	for _, seed := range []int64{1, 2, 3} {
+		shuffled := p.WithShuffle(seed)
+		c := newCollector()
+		shuffled.ForEach(c)
+		checkPerms(t, c.sorted(), all.sorted())
+		for n, perm := range c.numbered() {
+			if all.numbered()[n] != perm {
+				t.Fatalf("seed %d numbered %q as %s", seed, perm, n)
+			}
+		}
+		again := collect(shuffled)
+		checkPerms(t, again, *c.perms)
+		orders[strings.Join(again, "|")] = true
+	}
+	if len(orders) < 2 {
+		t.Fatal("every seed gave the same order")
+	}
+}
@@ -0,0 +1,262 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrParGenUnsupported is returned by ForEachParGen and
+// ForEachParGenCheck when state deduplication, bitstate hashing or
+// sleep sets are on: the stealing walk does not support them, and
+// would silently explore far more permutations than ForEach.
+var ErrParGenUnsupported = errors.New("state deduplication, bitstate hashing and sleep sets are not supported by ForEachParGen")
+
+// parGenPath is a persistent list of the values of a node's
+// ancestors, most recent first, shared by siblings. A thief rebuilds
+// the prefix of a stolen node from it.
+type parGenPath[T any] struct {
+	value  T
+	depth  int
+	parent *parGenPath[T]
+}
+
+// newParGenPath builds the list from the values of prefix, root
+// first, as held by resumed nodes.
+func newParGenPath[T any](prefix []T) *parGenPath[T] {
+	var pgp *parGenPath[T]
+	for depth, value := range prefix {
+		pgp = &parGenPath[T]{value: value, depth: depth, parent: pgp}
+	}
+	return pgp
+}
+
+// prefix returns the values of the list, root first.
+func (pgp *parGenPath[T]) prefix() []T {
+	prefix := make([]T, pgp.depth+1)
+	for entry := pgp; entry != nil; entry = entry.parent {
+		prefix[entry.depth] = entry.value
+	}
+	return prefix
+}
+
+// parGenItem is a node in a parGenWorker's deque, along with the path
+// to it, if it was found by a worker rather than resumed.
+type parGenItem[T any] struct {
+	n    *node[T]
+	path *parGenPath[T]
+}
+
+// parGenWorker owns a deque of nodes. The owner pushes and pops at
+// the end; thieves take from the front, where the shallowest, and so
+// usually largest, subtrees are.
+type parGenWorker[T any] struct {
+	lock  sync.Mutex
+	deque []parGenItem[T]
+}
+
+func (w *parGenWorker[T]) pop() parGenItem[T] {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	l := len(w.deque) - 1
+	if l == -1 {
+		return parGenItem[T]{}
+	}
+	item := w.deque[l]
+	w.deque[l] = parGenItem[T]{}
+	w.deque = w.deque[:l]
+	return item
+}
+
+// steal takes the node at the front of the deque, setting its prefix,
+// as the thief's own path does not lead to it.
+func (w *parGenWorker[T]) steal() parGenItem[T] {
+	w.lock.Lock()
+	item := parGenItem[T]{}
+	if len(w.deque) != 0 {
+		item = w.deque[0]
+		w.deque[0] = parGenItem[T]{}
+		w.deque = w.deque[1:]
+	}
+	w.lock.Unlock()
+	if item.path != nil {
+		item.n.prefix = item.path.prefix()
+	}
+	return item
+}
+
+// Iterate through every permutation, using concurrency for both the
+// generation and the consumption of permutations. ForEachPar only
+// consumes permutations concurrently: the tree itself is walked by a
+// single go-routine, which becomes the bottleneck when consuming a
+// permutation is cheap. ForEachParGen instead spawns one go-routine
+// per GOMAXPROCS (or as set by WithWorkers), each of which walks its
+// own part of the tree and supplies the permutations it finds
+// directly to its own clone of f. When a go-routine runs out of work
+// it steals an unexplored subtree from another.
+//
+// As with ForEachPar, the order in which permutations are consumed is
+// not defined, and panics are recovered and returned as a
+// *PermutationError. Progress reporting is not supported by
+// ForEachParGen.
+//
+// Any subtree may be stolen before its siblings are explored, so each
+// child of a node with several options is given its own Clone of the
+// node's OptionGenerator, which must obey the contract of Clone:
+// clones must share no mutable state.
+//
+// ForEachParGen returns ErrParGenUnsupported, without exploring
+// anything, if WithStateDeduplication, WithBitstateHashing or
+// WithSleepSets (with WithIndependence) is in effect.
+func (p *TypedPermutations[T]) ForEachParGen(f TypedPermutationConsumer[T]) error {
+	return p.ForEachParGenCheck(consumerChecker[T]{TypedPermutationConsumer: f})
+}
+
+// ForEachParGenCheck is the checking equivalent of ForEachParGen. As
+// soon as any go-routine's f.Check returns an error, all go-routines
+// stop and a *PermutationError is returned. As with ForEachParCheck,
+// concurrent failures are combined with errors.Join.
+func (p *TypedPermutations[T]) ForEachParGenCheck(f TypedPermutationChecker[T]) error {
+	if p.tracksStates() || (p.sleepSets && p.independent != nil) {
+		return ErrParGenUnsupported
+	}
+	p.cursor.lock.Lock()
+	p.cursor.worklist = nil
+	p.cursor.spill = nil
+	p.cursor.parallel = true
+	p.cursor.lock.Unlock()
+	p.logRunStarted(nil, nil, true)
+
+	par := p.parallelism()
+	workers := make([]*parGenWorker[T], par)
+	for idx := range workers {
+		workers[idx] = &parGenWorker[T]{}
+	}
+	var pending int64
+	if p.resume == nil {
+		workers[0].deque = []parGenItem[T]{{n: p.root.clone()}}
+		pending = 1
+	} else {
+		for idx, resumed := range p.resume {
+			w := workers[idx%par]
+			w.deque = append(w.deque, parGenItem[T]{n: resumed.clone()})
+		}
+		pending = int64(len(p.resume))
+	}
+
+	failures := newFailureCollector()
+	var wg sync.WaitGroup
+	wg.Add(par)
+	for idx := range workers {
+		go func(idx int) {
+			defer wg.Done()
+			if pe := p.parGenWork(idx, workers, &pending, failures, f.Clone()); pe != nil {
+				p.failed(pe)
+				failures.fail(pe)
+			}
+		}(idx)
+	}
+	wg.Wait()
+	return failures.err()
+}
+
+func (p *TypedPermutations[T]) parGenWork(self int, workers []*parGenWorker[T], pending *int64, failures *failureCollector, f TypedPermutationChecker[T]) (pe *PermutationError) {
+	w := workers[self]
+	perm := []T{}
+	idle := 0
+	var cur *node[T]
+	defer func() {
+		if r := recover(); r != nil {
+			var n *big.Int
+			if cur != nil {
+				n = cur.n
+			}
+			pe = recoverPermutation(r, n)
+		}
+	}()
+
+	for !failures.isStopped() {
+		item := w.pop()
+		if item.n == nil {
+			if atomic.LoadInt64(pending) == 0 {
+				return nil
+			}
+			for offset := 1; offset < len(workers) && item.n == nil; offset++ {
+				item = workers[(self+offset)%len(workers)].steal()
+			}
+			if item.n == nil {
+				if idle++; idle > 64 {
+					time.Sleep(50 * time.Microsecond)
+				} else {
+					runtime.Gosched()
+				}
+				continue
+			}
+		}
+		idle = 0
+		cur = item.n
+		if item.path == nil && cur.depth > 0 {
+			item.path = newParGenPath(cur.prefix)
+		}
+
+		if cur.prefix == nil {
+			perm = append(perm[:cur.depth], cur.value)
+		} else {
+			perm = append(append(perm[:0], cur.prefix...), cur.value)
+		}
+
+		options, ok := p.generate(cur.generator, cur.value, perm[1:])
+		optionCount := len(options)
+		if !ok || optionCount == 0 {
+			if ok {
+				p.metrics.recordGenerated(1, true)
+				handled, err := p.deadlocked(f, cur.generator, cur.n, perm[1:])
+				if err == nil && !handled {
+					err = f.Check(cur.n, perm[1:])
+				}
+				if err != nil {
+					return &PermutationError{N: cur.n, Err: err}
+				}
+			}
+			atomic.AddInt64(pending, -1)
+			continue
+		}
+
+		cumuOpts := big.NewInt(int64(optionCount))
+		cumuOpts.Mul(cur.cumuOpts, cumuOpts)
+		weight := cur.weight / float64(optionCount)
+		path := &parGenPath[T]{value: cur.value, depth: cur.depth, parent: item.path}
+		children := make([]parGenItem[T], optionCount)
+		for idx, option := range options {
+			childN := cur.n
+			if optionCount > 1 {
+				childN = big.NewInt(int64(idx))
+				childN.Mul(childN, cur.cumuOpts)
+				childN.Add(childN, cur.n)
+			}
+			gen := cur.generator
+			if optionCount > 1 {
+				gen = gen.Clone()
+			}
+			children[idx] = parGenItem[T]{
+				n: &node[T]{
+					n:         childN,
+					depth:     cur.depth + 1,
+					value:     option,
+					generator: gen,
+					cumuOpts:  cumuOpts,
+					weight:    weight,
+				},
+				path: path,
+			}
+		}
+		atomic.AddInt64(pending, int64(optionCount-1))
+		w.lock.Lock()
+		w.deque = append(w.deque, children...)
+		w.lock.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestForEachParGenMatchesForEach(t *testing.T) {
+	graphs := []func() []*GraphNode{egraph, joins, func() []*GraphNode { return diamonds(3) }, func() []*GraphNode { return chains(3, 3) }}
+	for gidx, graph := range graphs {
+		want := newCollector()
+		BuildPermutations(NewGraphPermutation(graph()...)).ForEach(want)
+		for _, workers := range []int{1, 2, 8} {
+			got := newCollector()
+			p := BuildPermutations(NewGraphPermutation(graph()...)).WithWorkers(workers)
+			if err := p.ForEachParGen(got); err != nil {
+				t.Fatal(err)
+			}
+			if len(*got.perms) != len(*want.perms) {
+				t.Fatalf("graph %d, %d workers: got %d permutations, want %d", gidx, workers, len(*got.perms), len(*want.perms))
+			}
+			gotNumbered := got.numbered()
+			for n, perm := range want.numbered() {
+				if gotNumbered[n] != perm {
+					t.Fatalf("graph %d, %d workers: permutation %s is %q, want %q", gidx, workers, n, gotNumbered[n], perm)
+				}
+			}
+		}
+	}
+}
+
+func TestForEachParGenResumed(t *testing.T) {
+	elems := []interface{}{1, 2, 3, 4, 5}
+	p := BuildPermutations(NewSimplePermutation(elems))
+	stopped := errors.New("stopped")
+	seen := 0
+	p.ForEachCheck(checkerFunc(func(*big.Int, []interface{}) error {
+		if seen++; seen == 30 {
+			return stopped
+		}
+		return nil
+	}))
+	snapshot, err := p.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := ResumePermutations(snapshot, NewSimplePermutation(elems))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := newCollector()
+	resumed.ForEach(want)
+	got := newCollector()
+	if err := resumed.WithWorkers(4).ForEachParGen(got); err != nil {
+		t.Fatal(err)
+	}
+	checkPerms(t, got.sorted(), want.sorted())
+	if len(*got.perms) >= 120 {
+		t.Fatalf("resumed from the first permutation: got %d permutations", len(*got.perms))
+	}
+}
+
+func TestForEachParGenCheckReturnsErrors(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5, 6})).WithWorkers(4)
+	failed := errors.New("failed")
+	err := p.ForEachParGenCheck(checkerFunc(func(n *big.Int, perm []interface{}) error {
+		if perm[0] == 6 && perm[5] == 1 {
+			return failed
+		}
+		return nil
+	}))
+	var pe *PermutationError
+	if !errors.As(err, &pe) || !errors.Is(err, failed) {
+		t.Fatalf("got %v, want a PermutationError wrapping %v", err, failed)
+	}
+}
+
+func TestForEachParGenUnsupported(t *testing.T) {
+	independent := func(a, b interface{}) bool { return true }
+	variants := []func(*Permutations) *Permutations{
+		func(p *Permutations) *Permutations { return p.WithStateDeduplication(nil) },
+		func(p *Permutations) *Permutations { return p.WithBitstateHashing(NewBitstate(16, 2)) },
+		func(p *Permutations) *Permutations { return p.WithIndependence(independent).WithSleepSets() },
+	}
+	for idx, variant := range variants {
+		got := newCollector()
+		p := variant(BuildPermutations(NewGraphPermutation(joins()...)))
+		if err := p.ForEachParGen(got); !errors.Is(err, ErrParGenUnsupported) {
+			t.Fatalf("variant %d: got error %v, want ErrParGenUnsupported", idx, err)
+		}
+		if len(*got.perms) != 0 {
+			t.Fatalf("variant %d: %d permutations consumed", idx, len(*got.perms))
+		}
+	}
+	// Without WithIndependence, sleep sets have no effect.
+	if err := BuildPermutations(NewGraphPermutation(joins()...)).WithSleepSets().ForEachParGen(newCollector()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,172 @@
+package gsim
+
+import (
+	"math/big"
+	"math/rand"
+)
+
+// The functions in this file bridge gsim and property-based testing
+// libraries such as rapid and gopter, which generate test cases from
+// sequences of random choices, and shrink failing cases by making
+// those choices smaller. A permutation is generated from a sequence of
+// choices too: the index of the option chosen at each step. Choosing
+// 0 everywhere gives permutation 0, and lowering the choices gives
+// permutations which follow the generator's own order of options more
+// closely, which is what Shrink does.
+
+// DrawPermutation generates a single permutation by calling choose at
+// every step with more than one option, with the number of options
+// k, to pick the index (from 0 to k-1) of the option to take. It
+// returns the permutation and its number. It is intended for the
+// generators of property-based testing libraries; with rapid, for
+// example:
+//
+//	gen := rapid.Custom(func(t *rapid.T) []interface{} {
+//		_, perm := p.DrawPermutation(func(k int) int {
+//			return rapid.IntRange(0, k-1).Draw(t, "choice")
+//		})
+//		return perm
+//	})
+//
+// rapid then shrinks failing schedules by itself, by shrinking the
+// choices. With gopter, draw from GenParameters.Rng and shrink with
+// Shrink. Out of range choices are clamped. If the permutation is cut
+// short by WithPrune, DrawPermutation returns nil, nil.
+func (p *TypedPermutations[T]) DrawPermutation(choose func(k int) int) (*big.Int, []T) {
+	n, perm, _ := p.drawPermutation(func(_, k int) int { return choose(k) })
+	return n, perm
+}
+
+// drawPermutation implements DrawPermutation. choose is also given
+// the number of choices made so far, and the choices made are
+// returned.
+func (p *TypedPermutations[T]) drawPermutation(choose func(step, k int) int) (*big.Int, []T, []int) {
+	permNum := new(big.Int)
+	cumuOpts := big.NewInt(1)
+	perm := []T{}
+	var choices []int
+	gen := p.root.generator.Clone()
+	val := p.root.value
+	for {
+		options, ok := p.generate(gen, val, perm)
+		if !ok {
+			return nil, nil, nil
+		}
+		optionCount := len(options)
+		if optionCount == 0 {
+			return permNum, perm, choices
+		}
+		idx := 0
+		if optionCount > 1 {
+			idx = choose(len(choices), optionCount)
+			if idx < 0 {
+				idx = 0
+			} else if idx >= optionCount {
+				idx = optionCount - 1
+			}
+			choices = append(choices, idx)
+			choice := big.NewInt(int64(idx))
+			permNum.Add(permNum, choice.Mul(choice, cumuOpts))
+			cumuOpts.Mul(cumuOpts, big.NewInt(int64(optionCount)))
+		}
+		val = options[idx]
+		perm = append(perm, val)
+		gen = gen.Clone()
+	}
+}
+
+// followChoices generates the permutation given by choices, taking
+// option 0 once they run out.
+func (p *TypedPermutations[T]) followChoices(choices []int) (*big.Int, []T, []int) {
+	return p.drawPermutation(func(step, k int) int {
+		if step < len(choices) {
+			return choices[step]
+		}
+		return 0
+	})
+}
+
+// choicesOf returns the choices which generate the permutation with
+// number n.
+func (p *TypedPermutations[T]) choicesOf(n *big.Int) []int {
+	remaining := new(big.Int).Set(n)
+	optionCountBig := new(big.Int)
+	idxBig := new(big.Int)
+	_, _, choices := p.drawPermutation(func(_, k int) int {
+		optionCountBig.SetInt64(int64(k))
+		remaining.QuoRem(remaining, optionCountBig, idxBig)
+		return int(idxBig.Int64())
+	})
+	return choices
+}
+
+// Shrink minimises a counterexample: given the number of a permutation
+// for which fails returns true, it returns the smallest permutation it
+// can find for which fails still returns true, along with its number.
+// Permutations are compared by the sequences of choices (see
+// DrawPermutation) which generate them, so shrinking moves towards
+// permutation 0, taking earlier options wherever possible. Each choice
+// is lowered in turn, the later choices being kept as far as they
+// still apply, until no lower choice still fails.
+func (p *TypedPermutations[T]) Shrink(n *big.Int, fails func(perm []T) bool) (*big.Int, []T) {
+	choices := p.choicesOf(n)
+	n, perm, choices := p.followChoices(choices)
+	for shrunk := true; shrunk; {
+		shrunk = false
+		for step := 0; step < len(choices) && !shrunk; step++ {
+			for lower := 0; lower < choices[step]; lower++ {
+				candidate := append([]int(nil), choices...)
+				candidate[step] = lower
+				n2, perm2, choices2 := p.followChoices(candidate)
+				if perm2 != nil && fails(perm2) {
+					n, perm, choices = n2, perm2, choices2
+					shrunk = true
+					break
+				}
+			}
+		}
+	}
+	return n, perm
+}
+
+// CheckProperty checks that prop holds (returns nil) for the
+// permutations: for every one of them if samples is 0, and otherwise
+// for that many drawn at random, from the given seed, by choosing
+// uniformly amongst the options at each step. As soon as prop fails
+// the counterexample is shrunk with Shrink, and a *PermutationError
+// is returned for the shrunk permutation, with the error prop
+// returned for it.
+func (p *TypedPermutations[T]) CheckProperty(samples int, seed int64, prop func(perm []T) error) error {
+	var failed *big.Int
+	if samples == 0 {
+		pe := p.walk(propertyChecker[T](prop), nil, nil)
+		if pe == nil {
+			return nil
+		}
+		failed = pe.N
+	} else {
+		rng := rand.New(rand.NewSource(seed))
+		for ; samples > 0 && failed == nil; samples-- {
+			n, perm := p.DrawPermutation(rng.Intn)
+			if perm != nil && prop(perm) != nil {
+				failed = n
+			}
+		}
+		if failed == nil {
+			return nil
+		}
+	}
+	n, perm := p.Shrink(failed, func(perm []T) bool { return prop(perm) != nil })
+	return &PermutationError{N: n, Err: prop(perm)}
+}
+
+// propertyChecker adapts a property to a TypedPermutationChecker.
+type propertyChecker[T any] func(perm []T) error
+
+func (pc propertyChecker[T]) Clone() TypedPermutationChecker[T] {
+	return pc
+}
+
+func (pc propertyChecker[T]) Check(n *big.Int, perm []T) error {
+	return pc(perm)
+}
@@ -0,0 +1,63 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestDrawPermutation(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4}))
+	n, perm := p.DrawPermutation(func(k int) int { return 0 })
+	if n.Sign() != 0 || permString(perm) != permString(p.Permutation(n)) {
+		t.Fatalf("drew %v %q", n, permString(perm))
+	}
+	n, perm = p.DrawPermutation(func(k int) int { return k })
+	if permString(perm) != "4 3 2 1" || permString(p.Permutation(n)) != "4 3 2 1" {
+		t.Fatalf("drew %v %q", n, permString(perm))
+	}
+}
+
+// fourBeforeOne fails the permutations of 1, 2, 3, 4 in which 4
+// precedes 1.
+func fourBeforeOne(perm []interface{}) error {
+	if s := permString(perm); strings.Index(s, "4") < strings.Index(s, "1") {
+		return errors.New("4 before 1")
+	}
+	return nil
+}
+
+func TestShrink(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4}))
+	last := new(big.Int).Sub(p.Count(), big.NewInt(1))
+	if got := permString(p.Permutation(last)); got != "4 3 2 1" {
+		t.Fatalf("last permutation is %q", got)
+	}
+	// The smallest sequence of choices which fails is 1, 1, 1, 0.
+	n, perm := p.Shrink(last, func(perm []interface{}) bool {
+		return fourBeforeOne(perm) != nil
+	})
+	if permString(perm) != "2 3 4 1" || permString(p.Permutation(n)) != "2 3 4 1" {
+		t.Fatalf("shrunk to %v %q", n, permString(perm))
+	}
+}
+
+func TestCheckProperty(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4}))
+	// The first failure found exhaustively shrinks to the smallest.
+	err := p.CheckProperty(0, 1, fourBeforeOne)
+	var pe *PermutationError
+	if !errors.As(err, &pe) || permString(p.Permutation(pe.N)) != "2 3 4 1" {
+		t.Fatalf("got %v", err)
+	}
+	err = p.CheckProperty(50, 1, fourBeforeOne)
+	if !errors.As(err, &pe) || fourBeforeOne(p.Permutation(pe.N)) == nil || pe.Err == nil {
+		t.Fatalf("sampling got %v", err)
+	}
+	for _, samples := range []int{0, 50} {
+		if err := p.CheckProperty(samples, 1, func([]interface{}) error { return nil }); err != nil {
+			t.Fatalf("%d samples: passing property returned %v", samples, err)
+		}
+	}
+}
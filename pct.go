@@ -0,0 +1,80 @@
+package gsim
+
+import (
+	"math/big"
+	"math/rand"
+)
+
+// PCT draws n permutations with the Probabilistic Concurrency Testing
+// algorithm, supplying each to f.Consume along with its permutation
+// number, and returns the distinct permutation numbers drawn, as
+// RandomWalk does. It suits spaces far too large to explore
+// exhaustively, but unlike RandomWalk, it comes with a guarantee.
+//
+// Each option belongs to an actor, as given by actorOf: for graphs
+// built with an ActorModel, use its OptionActor. For each walk, the
+// actors are given distinct random priorities, and depth-1 steps are
+// chosen at random from the first steps as change points. At each
+// step, an option of the actor with the highest priority is chosen
+// (at random, if it has several), and at the j-th change point that
+// actor's priority is lowered below every initial priority, to j. A
+// bug which needs depth particular orderings of events (its depth) to
+// manifest is then found by each walk with probability at least
+// 1/(a*steps^(depth-1)), where a is the number of actors and steps
+// bounds the length of the permutations: so walks with a small depth,
+// and a good estimate of steps, find shallow bugs quickly. A steps
+// shorter than the permutations only weakens the guarantee.
+//
+// The same seed always produces the same permutations. depth and
+// steps must be at least 1.
+func PCT[T any, A comparable](p *TypedPermutations[T], n int, seed int64, actorOf func(option T) A, depth, steps int, f TypedPermutationConsumer[T]) []*big.Int {
+	if depth < 1 || steps < 1 {
+		panic("PCT requires a depth and steps of at least 1")
+	}
+	rng := rand.New(rand.NewSource(seed))
+	var candidates []int
+	newWalk := func() func(perm, options []T) int {
+		priorities := make(map[A]float64)
+		// changes maps each change point, a step number, to the
+		// priority it lowers to.
+		changes := make(map[int]int, depth-1)
+		for j := 1; j < depth; j++ {
+			if step := 1 + rng.Intn(steps); changes[step] == 0 {
+				changes[step] = j
+			}
+		}
+		step := 0
+		return func(perm, options []T) int {
+			var best A
+			bestPriority := 0.0
+			candidates = candidates[:0]
+			for idx, option := range options {
+				actor := actorOf(option)
+				priority, found := priorities[actor]
+				if !found {
+					// Initial priorities are at least depth, and their
+					// order, as actors are found, is random.
+					priority = float64(depth) + rng.Float64()
+					priorities[actor] = priority
+				}
+				switch {
+				case len(candidates) == 0 || priority > bestPriority:
+					best, bestPriority = actor, priority
+					candidates = append(candidates[:0], idx)
+				case actor == best:
+					candidates = append(candidates, idx)
+				}
+			}
+			idx := candidates[0]
+			if len(candidates) > 1 {
+				idx = candidates[rng.Intn(len(candidates))]
+			}
+			step++
+			if j, found := changes[step]; found {
+				priorities[best] = float64(j)
+			}
+			return idx
+		}
+	}
+	return p.randomWalks(n, newWalk, f)
+}
@@ -0,0 +1,45 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestPCT(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(processes()...))
+	draw := func(seed int64, depth int) []string {
+		c := newCollector()
+		covered := PCT(p, 50, seed, processOf, depth, 4, c)
+		for idx, perm := range *c.perms {
+			if got := permString(p.Permutation((*c.nums)[idx])); got != perm {
+				t.Fatalf("walk drew %q numbered as %q", perm, got)
+			}
+		}
+		if len(*c.perms) != 50 || len(covered) != len(c.numbered()) {
+			t.Fatalf("drew %d permutations, %d distinct, but covered %d", len(*c.perms), len(c.numbered()), len(covered))
+		}
+		return *c.perms
+	}
+	// With a depth of 1, there are no change points, so each walk runs
+	// one process to completion before the other.
+	for _, perm := range draw(1, 1) {
+		if perm != "a1 a2 b1 b2" && perm != "b1 b2 a1 a2" {
+			t.Fatalf("drew %q", perm)
+		}
+	}
+	perms := draw(1, 2)
+	checkPerms(t, draw(1, 2), perms)
+	interleaved := false
+	for _, perm := range perms {
+		interleaved = interleaved || (perm != "a1 a2 b1 b2" && perm != "b1 b2 a1 a2")
+	}
+	if !interleaved {
+		t.Fatalf("a depth of 2 drew no interleaving: %q", perms)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic")
+		}
+	}()
+	PCT(p, 1, 1, processOf, 0, 4, newCollector())
+}
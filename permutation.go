@@ -1,7 +1,8 @@
 package gsim
 
-type simplePermutation struct {
-	remains []interface{}
+type simplePermutation[T comparable] struct {
+	started bool
+	remains []T
 }
 
 // SimplePermutation is an example implementation of OptionGenerator
@@ -9,20 +10,32 @@ type simplePermutation struct {
 // any values. For example, with the elems a,b,c, every permutation
 // will be found: a,b,c; a,c,b; b,a,c; b,c,a; c,a,b; c,b,a
 func NewSimplePermutation(elems []interface{}) OptionGenerator {
-	return &simplePermutation{
+	return NewTypedSimplePermutation(elems)
+}
+
+// NewTypedSimplePermutation is the typed equivalent of
+// NewSimplePermutation.
+func NewTypedSimplePermutation[T comparable](elems []T) TypedOptionGenerator[T] {
+	return &simplePermutation[T]{
 		remains: elems,
 	}
 }
 
-func (sp *simplePermutation) Clone() OptionGenerator {
-	nsp := &simplePermutation{
-		remains: make([]interface{}, len(sp.remains)),
+func (sp *simplePermutation[T]) Clone() TypedOptionGenerator[T] {
+	nsp := &simplePermutation[T]{
+		started: sp.started,
+		remains: make([]T, len(sp.remains)),
 	}
 	copy(nsp.remains, sp.remains)
 	return nsp
 }
 
-func (sp *simplePermutation) Generate(lastChosen interface{}) []interface{} {
+func (sp *simplePermutation[T]) Generate(lastChosen T) []T {
+	if !sp.started {
+		// lastChosen is just the zero value of T.
+		sp.started = true
+		return sp.remains
+	}
 	for idx, elem := range sp.remains {
 		if elem == lastChosen {
 			sp.remains = append(sp.remains[:idx], sp.remains[idx+1:]...)
@@ -0,0 +1,216 @@
+package gsim
+
+import (
+	"math/big"
+	"time"
+)
+
+// Progress describes how far through an iteration has got. It is
+// supplied to the function registered through WithProgress.
+type Progress struct {
+	// Permutations is the number of permutations generated so
+	// far. For the parallel iteration functions, some of these may
+	// still be waiting to be consumed.
+	Permutations uint64
+	// Depth is the depth in the tree of the node most recently
+	// visited.
+	Depth int
+	// Elapsed is the time since the iteration started.
+	Elapsed time.Duration
+	// Fraction is an estimate of how much of the tree has been
+	// explored, between 0 and 1. Each node is assumed to account for
+	// an equal share of its parent's subtree, so the estimate is only
+	// exact if the tree is perfectly balanced. It is usually good
+	// enough to tell 1% from 99%.
+	Fraction float64
+	// Subtrees is the number of subtrees, rooted at the options
+	// available first, which have been entirely explored.
+	Subtrees int
+}
+
+// WithProgress returns a copy of the receiver which, during
+// iteration, invokes f with the current Progress approximately every
+// interval, and once more when iteration completes. f is invoked from
+// the go-routine generating permutations, so it should return
+// quickly.
+func (p *TypedPermutations[T]) WithProgress(interval time.Duration, f func(Progress)) *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) {
+		p2.progressInterval = interval
+		p2.progress = f
+	})
+}
+
+// progressChecks is how many nodes are visited between each check
+// of the clock.
+const progressChecks = 1024
+
+type progressTracker struct {
+	f        func(Progress)
+	interval time.Duration
+	start    time.Time
+	last     time.Time
+	deadline time.Time
+	steps    int
+	// inSubtree is set once a node at depth 1 has been visited, and
+	// so its subtree is being explored. subtreeN is the number of that
+	// node, and subtree, if non-nil, is invoked as each subtree is
+	// completed.
+	inSubtree bool
+	subtreeN  *big.Int
+	subtree   func(subtrees int, n *big.Int)
+	expired   bool
+	Progress
+}
+
+func newProgressTracker[T any](p *TypedPermutations[T], worklist []*node[T]) *progressTracker {
+	if p.progress == nil && p.budget <= 0 && p.logger == nil {
+		return nil
+	}
+	now := time.Now()
+	pt := &progressTracker{
+		f:        p.progress,
+		interval: p.progressInterval,
+		start:    now,
+		last:     now,
+		Progress: Progress{Fraction: 1},
+	}
+	if p.budget > 0 {
+		pt.deadline = now.Add(p.budget)
+	}
+	if p.logger != nil {
+		pt.subtree = p.logSubtreeCompleted
+	}
+	for _, n := range worklist {
+		pt.Fraction -= n.weight
+	}
+	return pt
+}
+
+// visit is called for every node removed from the worklist. It
+// reports whether the budget has expired, in which case the node must
+// not be explored.
+func (pt *progressTracker) visit(depth int, n *big.Int) bool {
+	if pt == nil {
+		return false
+	}
+	pt.steps++
+	if pt.steps%progressChecks == 0 {
+		now := time.Now()
+		if !pt.deadline.IsZero() && !now.Before(pt.deadline) {
+			pt.expired = true
+			return true
+		}
+		if pt.f != nil && now.Sub(pt.last) >= pt.interval {
+			pt.last = now
+			pt.Elapsed = now.Sub(pt.start)
+			pt.f(pt.Progress)
+		}
+	}
+	pt.Depth = depth
+	// Siblings are visited in turn, so reaching the next node at depth
+	// 1, or returning to the root, completes the previous subtree.
+	if depth <= 1 {
+		if pt.inSubtree {
+			pt.completeSubtree()
+		}
+		pt.inSubtree = depth == 1
+		if pt.subtree != nil {
+			// The walk may recycle n.
+			pt.subtreeN = new(big.Int).Set(n)
+		}
+	}
+	return false
+}
+
+func (pt *progressTracker) completeSubtree() {
+	pt.Subtrees++
+	if pt.subtree != nil {
+		pt.subtree(pt.Subtrees, pt.subtreeN)
+	}
+}
+
+// explored is called when the subtree of a node, of the given
+// weight, has been entirely dealt with.
+func (pt *progressTracker) explored(weight float64) {
+	if pt != nil {
+		pt.Fraction += weight
+	}
+}
+
+func (pt *progressTracker) generated() {
+	if pt != nil {
+		pt.Permutations++
+	}
+}
+
+func (pt *progressTracker) finish() {
+	if pt == nil {
+		return
+	}
+	pt.Elapsed = time.Since(pt.start)
+	if !pt.expired {
+		pt.Fraction = 1
+		if pt.inSubtree {
+			pt.completeSubtree()
+			pt.inSubtree = false
+		}
+	}
+	if pt.f != nil {
+		pt.f(pt.Progress)
+	}
+}
+
+// RunStats describes a run with a time budget. See RunFor.
+type RunStats struct {
+	// Progress is the position at which the run stopped. Its
+	// Permutations is the number of permutations supplied to the
+	// consumer, and its Fraction the estimate of how much of the
+	// space they cover.
+	Progress
+	// Complete is true if every permutation was supplied before the
+	// budget expired.
+	Complete bool
+}
+
+// RunFor iterates, as ForEach does, until either every permutation
+// has been supplied to f or the budget has expired, and then returns
+// statistics describing how far it got. The budget is checked between
+// nodes, and only every so often, so the run may overrun it slightly,
+// by more if f.Consume is slow. Unless the run is complete, Snapshot
+// may then be used to continue from where it stopped. Any function
+// registered with WithProgress is invoked as usual.
+func (p *TypedPermutations[T]) RunFor(budget time.Duration, f TypedPermutationConsumer[T]) *RunStats {
+	stats, _ := p.RunForCheck(budget, consumerChecker[T]{TypedPermutationConsumer: f})
+	return stats
+}
+
+// RunForCheck is the checking equivalent of RunFor. If f.Check
+// returns an error, the run stops and a *PermutationError is returned
+// instead of statistics.
+func (p *TypedPermutations[T]) RunForCheck(budget time.Duration, f TypedPermutationChecker[T]) (*RunStats, error) {
+	stats := &RunStats{}
+	// A plain copy shares the iteration position, for Snapshot.
+	p2 := *p
+	p2.budget = budget
+	if p2.budget <= 0 {
+		p2.budget = 1
+	}
+	p2.progress = func(progress Progress) {
+		stats.Progress = progress
+		if p.progress != nil {
+			p.progress(progress)
+		}
+	}
+	if p.progress == nil {
+		p2.progressInterval = budget
+	}
+	pe := p2.walk(f, nil, nil)
+	switch {
+	case pe == nil:
+		stats.Complete = true
+	case pe.Err == errBudgetExpired:
+	default:
+		return nil, pe
+	}
+	return stats, nil
+}
@@ -0,0 +1,59 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestWithProgress(t *testing.T) {
+	var reports []Progress
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5, 6, 7})).
+		WithProgress(0, func(pr Progress) { reports = append(reports, pr) })
+	p.ForEach(consumerFunc(nil))
+	if len(reports) < 2 {
+		t.Fatalf("got %d reports", len(reports))
+	}
+	for idx := 1; idx < len(reports); idx++ {
+		if reports[idx].Permutations < reports[idx-1].Permutations || reports[idx].Fraction < reports[idx-1].Fraction {
+			t.Fatalf("progress went backwards: %+v then %+v", reports[idx-1], reports[idx])
+		}
+	}
+	last := reports[len(reports)-1]
+	if last.Permutations != 5040 || last.Fraction < 0.999 || last.Subtrees != 7 {
+		t.Fatalf("final report %+v, want 5040 permutations, fraction 1 and 7 subtrees", last)
+	}
+}
+
+func TestRunFor(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5, 6, 7}))
+	stats := p.RunFor(time.Minute, consumerFunc(nil))
+	if !stats.Complete || stats.Permutations != 5040 || stats.Fraction < 0.999 {
+		t.Fatalf("got %+v, want a complete run", stats)
+	}
+
+	c := newCollector()
+	stats = p.RunFor(20*time.Millisecond, consumerFunc(func(n *big.Int, perm []interface{}) {
+		time.Sleep(100 * time.Microsecond)
+		c.Consume(n, perm)
+	}))
+	if stats.Complete || stats.Permutations != uint64(len(*c.perms)) || stats.Permutations == 0 || stats.Fraction >= 1 {
+		t.Fatalf("got %+v after %d permutations", stats, len(*c.perms))
+	}
+	snapshot, err := p.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := ResumePermutations(snapshot, NewSimplePermutation([]interface{}{1, 2, 3, 4, 5, 6, 7}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed.ForEach(c)
+	checkPerms(t, c.sorted(), collectSorted(p))
+
+	failed := errors.New("failed")
+	if _, err := p.RunForCheck(time.Minute, checkerFunc(func(*big.Int, []interface{}) error { return failed })); !errors.Is(err, failed) {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package gsim
+
+// The queries in this file are answered by static analysis of the
+// graph's edges and callbacks, without generating any permutations.
+// As with ValidateGraph, callbacks are invoked with every combination
+// of reachable incoming edges, in the order of the node's In edges,
+// so they must be deterministic and free of side effects. The
+// analysis is conservative: MustPrecede only answers true, and
+// MayCoexist false, when that has been proven.
+
+// graphAnalysis holds what is known of the graph reachable from a set
+// of starting nodes.
+type graphAnalysis struct {
+	nodes []*GraphNode
+	index map[*GraphNode]int
+	// enabling holds, for each node, the sets of reachable incoming
+	// edges given which its callback makes it available, or nil if
+	// the node has too many incoming edges to try every set. The
+	// starting nodes are enabled by the empty set.
+	enabling [][][]int
+	// before holds, for each node, the nodes which are chosen before
+	// it in every permutation in which it appears, as a bitset.
+	before [][]uint64
+}
+
+func newGraphAnalysis(start []*GraphNode) *graphAnalysis {
+	ga := &graphAnalysis{
+		nodes: reachableGraphNodes(start...),
+	}
+	ga.index = make(map[*GraphNode]int, len(ga.nodes))
+	for idx, gn := range ga.nodes {
+		ga.index[gn] = idx
+	}
+	isStart := make(map[*GraphNode]bool, len(start))
+	for _, gn := range start {
+		isStart[gn] = true
+	}
+	ga.enabling = make([][][]int, len(ga.nodes))
+	for idx, gn := range ga.nodes {
+		if isStart[gn] {
+			ga.enabling[idx] = [][]int{{}}
+			continue
+		}
+		incoming := ga.incoming(gn)
+		if len(incoming) > maxValidateIncoming {
+			continue
+		}
+		enabling := [][]int{}
+		ga.forEachSubset(gn, incoming, func(subset []int, result GraphNodeStateChange) {
+			if result == MakeAvailable || result == Release {
+				enabling = append(enabling, append([]int{}, subset...))
+			}
+		})
+		ga.enabling[idx] = enabling
+	}
+	ga.computeBefore()
+	return ga
+}
+
+// incoming returns the indices of the reachable incoming edges of gn.
+func (ga *graphAnalysis) incoming(gn *GraphNode) []int {
+	incoming := make([]int, 0, len(gn.In))
+	for _, in := range gn.In {
+		if idx, found := ga.index[in]; found {
+			incoming = append(incoming, idx)
+		}
+	}
+	return incoming
+}
+
+// forEachSubset invokes the callback of gn with every non-empty
+// subset of incoming, in the order of incoming, passing the subset
+// and the result to f.
+func (ga *graphAnalysis) forEachSubset(gn *GraphNode, incoming []int, f func(subset []int, result GraphNodeStateChange)) {
+	subset := make([]int, 0, len(incoming))
+	reached := make([]*GraphNode, 0, len(incoming))
+	for bits := 1; bits < 1<<len(incoming); bits++ {
+		subset, reached = subset[:0], reached[:0]
+		for pos, in := range incoming {
+			if bits&(1<<pos) != 0 {
+				subset = append(subset, in)
+				reached = append(reached, ga.nodes[in])
+			}
+		}
+		f(subset, gn.Callback.IncomingEdgesReached(gn, reached))
+	}
+}
+
+// computeBefore finds the greatest solution of: the nodes before v
+// are those common to every enabling set of v, along with the nodes
+// before them. A node with no enabling sets never appears, so every
+// node is (vacuously) before it.
+func (ga *graphAnalysis) computeBefore() {
+	words := (len(ga.nodes) + 63) / 64
+	all := make([]uint64, words)
+	for idx := range ga.nodes {
+		all[idx/64] |= 1 << (idx % 64)
+	}
+	ga.before = make([][]uint64, len(ga.nodes))
+	for idx, enabling := range ga.enabling {
+		if enabling == nil {
+			ga.before[idx] = make([]uint64, words)
+		} else {
+			ga.before[idx] = append([]uint64{}, all...)
+		}
+	}
+	union := make([]uint64, words)
+	meet := make([]uint64, words)
+	for changed := true; changed; {
+		changed = false
+		for idx, enabling := range ga.enabling {
+			if len(enabling) == 0 {
+				continue
+			}
+			copy(meet, all)
+			for _, set := range enabling {
+				for word := range union {
+					union[word] = 0
+				}
+				for _, in := range set {
+					union[in/64] |= 1 << (in % 64)
+					for word, bits := range ga.before[in] {
+						union[word] |= bits
+					}
+				}
+				for word := range meet {
+					meet[word] &= union[word]
+				}
+			}
+			for word, bits := range meet {
+				if ga.before[idx][word] != bits {
+					ga.before[idx][word] = bits
+					changed = true
+				}
+			}
+		}
+	}
+}
+
+// neverAppears reports whether the node can be shown never to appear
+// in any permutation.
+func (ga *graphAnalysis) neverAppears(gn *GraphNode) bool {
+	idx, found := ga.index[gn]
+	return !found || (ga.enabling[idx] != nil && len(ga.enabling[idx]) == 0)
+}
+
+// mustPrecede reports whether a has been shown to be chosen before b
+// in every permutation in which b appears.
+func (ga *graphAnalysis) mustPrecede(a, b *GraphNode) bool {
+	if ga.neverAppears(b) {
+		return true
+	}
+	idxA, found := ga.index[a]
+	if !found {
+		return false
+	}
+	idxB := ga.index[b]
+	return ga.before[idxB][idxA/64]&(1<<(idxA%64)) != 0
+}
+
+// excludes reports whether choosing a is shown to prevent b from ever
+// being chosen afterwards: a kills b, or reaching the edge from a to
+// b always inhibits b, whatever other edges have been reached, and b
+// is never released.
+func (ga *graphAnalysis) excludes(a, b *GraphNode) bool {
+	if containsGraphNode(a.kills, b) {
+		return true
+	}
+	// Guarded and timed edges may be reached later, or not at all.
+	if !containsGraphNode(a.Out, b) || a.outGuards[b] != nil || b.inDelays[a] != 0 {
+		return false
+	}
+	incoming := ga.incoming(b)
+	if len(incoming) > maxValidateIncoming {
+		return false
+	}
+	idxA := ga.index[a]
+	excluded := true
+	ga.forEachSubset(b, incoming, func(subset []int, result GraphNodeStateChange) {
+		switch {
+		case result == Release:
+			excluded = false
+		case containsInt(subset, idxA) && result != Inhibit:
+			excluded = false
+		}
+	})
+	return excluded
+}
+
+// mayOccurBefore reports whether a may be chosen before b in some
+// permutation containing both.
+func (ga *graphAnalysis) mayOccurBefore(a, b *GraphNode) bool {
+	return !ga.mustPrecede(b, a) && !ga.excludes(a, b)
+}
+
+// CanReach reports whether the node named b can be reached from the
+// node named a by following one or more edges. It is an error if
+// either name is not registered.
+func (g *Graph) CanReach(a, b string) (bool, error) {
+	gnA, gnB, err := g.getNodePair(a, b)
+	if err != nil {
+		return false, err
+	}
+	for _, gn := range reachableGraphNodes(gnA.Out...) {
+		if gn == gnB {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// MustPrecede reports whether the node named a is chosen before the
+// node named b in every permutation of the graph which contains b,
+// and so also whenever b can never appear. For example, it is true
+// when every path from the StartNodes to b passes through a. It is an
+// error if either name is not registered.
+func (g *Graph) MustPrecede(a, b string) (bool, error) {
+	gnA, gnB, err := g.getNodePair(a, b)
+	if err != nil {
+		return false, err
+	}
+	return newGraphAnalysis(g.StartNodes()).mustPrecede(gnA, gnB), nil
+}
+
+// MayCoexist reports whether the nodes named a and b may both appear
+// in a single permutation of the graph. It returns false when either
+// node can never appear, or when neither can be chosen before the
+// other: each must precede the other, or is inhibited or killed once
+// the other has been chosen. It is an error if either name is not
+// registered.
+func (g *Graph) MayCoexist(a, b string) (bool, error) {
+	gnA, gnB, err := g.getNodePair(a, b)
+	if err != nil {
+		return false, err
+	}
+	ga := newGraphAnalysis(g.StartNodes())
+	if ga.neverAppears(gnA) || ga.neverAppears(gnB) {
+		return false, nil
+	}
+	return gnA == gnB || ga.mayOccurBefore(gnA, gnB) || ga.mayOccurBefore(gnB, gnA), nil
+}
+
+func (g *Graph) getNodePair(a, b string) (*GraphNode, *GraphNode, error) {
+	gnA, err := g.mustGetNode(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	gnB, err := g.mustGetNode(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return gnA, gnB, nil
+}
@@ -0,0 +1,55 @@
+package gsim
+
+import (
+	"testing"
+)
+
+// exclusiveGraph builds a Graph in which start is followed by either
+// left or right, but never both, and left is followed by stop.
+func exclusiveGraph() *Graph {
+	g := NewGraph()
+	for _, name := range []string{"start", "left", "right", "stop"} {
+		g.AddNode(name, name)
+	}
+	g.AddEdge("start", "left")
+	g.AddEdge("start", "right")
+	g.AddEdge("left", "right")
+	g.AddEdge("right", "left")
+	g.AddEdge("left", "stop")
+	start, _ := g.GetNode("start")
+	left, _ := g.GetNode("left")
+	right, _ := g.GetNode("right")
+	left.Callback = InhibitWhen(After(right), After(start))
+	right.Callback = InhibitWhen(After(left), After(start))
+	return g
+}
+
+func TestGraphQueries(t *testing.T) {
+	g := exclusiveGraph()
+	checkPerms(t, collectSorted(BuildPermutations(g.NewGraphPermutation())), []string{
+		"start left stop",
+		"start right",
+	})
+	for _, tc := range []struct {
+		query      func(a, b string) (bool, error)
+		name, a, b string
+		want       bool
+	}{
+		{g.CanReach, "CanReach", "start", "stop", true},
+		{g.CanReach, "CanReach", "stop", "start", false},
+		{g.MustPrecede, "MustPrecede", "start", "stop", true},
+		{g.MustPrecede, "MustPrecede", "left", "stop", true},
+		{g.MustPrecede, "MustPrecede", "right", "stop", false},
+		{g.MayCoexist, "MayCoexist", "start", "right", true},
+		{g.MayCoexist, "MayCoexist", "left", "right", false},
+	} {
+		if got, err := tc.query(tc.a, tc.b); err != nil || got != tc.want {
+			t.Errorf("%s(%s, %s) is %v, %v, want %v", tc.name, tc.a, tc.b, got, err, tc.want)
+		}
+	}
+	for _, query := range []func(a, b string) (bool, error){g.CanReach, g.MustPrecede, g.MayCoexist} {
+		if _, err := query("start", "missing"); err == nil {
+			t.Error("unregistered name accepted")
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package gsim
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+)
+
+// A TypedWeightFunc returns the weight of choosing option next, after
+// the given prefix. Weights are relative: an option is chosen with
+// probability proportional to its weight. They must not be negative.
+type TypedWeightFunc[T any] func(prefix []T, option T) float64
+
+// WeightFunc is the interface{} instantiation of TypedWeightFunc.
+type WeightFunc = TypedWeightFunc[interface{}]
+
+// RandomWalk draws n permutations by walking from the root of the
+// tree to a leaf, choosing between the options at each step at
+// random, in proportion to their weights as given by weight (if
+// weight is nil, or every option has a weight of 0, the options are
+// equally likely). Each permutation is supplied to f.Consume along
+// with its permutation number. The same seed always produces the same
+// permutations.
+//
+// Unlike Sample, RandomWalk never counts subtrees, so it is cheap
+// even when the space is far too large to count, but it is not
+// uniform: the weights can instead be used to bias the walk towards
+// rare orderings, for example those with many preemptions. The
+// distinct permutation numbers drawn are returned, in the order they
+// were first drawn, so that they can later be replayed exactly with
+// Replay.
+func (p *TypedPermutations[T]) RandomWalk(n int, seed int64, weight TypedWeightFunc[T], f TypedPermutationConsumer[T]) []*big.Int {
+	rng := rand.New(rand.NewSource(seed))
+	weights := []float64{}
+	choose := func(perm, options []T) int {
+		optionCount := len(options)
+		if optionCount == 1 {
+			return 0
+		}
+		weights = weights[:0]
+		total := 0.0
+		for _, option := range options {
+			w := 1.0
+			if weight != nil {
+				if w = weight(perm, option); w < 0 {
+					panic(fmt.Sprintf("negative weight %v", w))
+				}
+			}
+			weights = append(weights, w)
+			total += w
+		}
+		if total == 0 {
+			return rng.Intn(optionCount)
+		}
+		idx := 0
+		r := rng.Float64() * total
+		for ; idx < optionCount-1 && r >= weights[idx]; idx++ {
+			r -= weights[idx]
+		}
+		return idx
+	}
+	return p.randomWalks(n, func() func(perm, options []T) int { return choose }, f)
+}
+
+// randomWalks draws n permutations by walking from the root of the
+// tree to a leaf, supplying each to f.Consume, and returns the
+// distinct permutation numbers drawn, as RandomWalk. Each walk calls
+// newWalk for the function which chooses the index of the option
+// taken at each step, given the prefix so far.
+func (p *TypedPermutations[T]) randomWalks(n int, newWalk func() func(perm, options []T) int, f TypedPermutationConsumer[T]) []*big.Int {
+	var covered []*big.Int
+	seen := make(map[string]bool)
+
+	for ; n > 0; n-- {
+		choose := newWalk()
+		permNum := new(big.Int)
+		cumuOpts := big.NewInt(1)
+		perm := []T{}
+		gen := p.root.generator.Clone()
+		val := p.root.value
+		for {
+			options, _ := p.generate(gen, val, perm)
+			optionCount := len(options)
+			if optionCount == 0 {
+				break
+			}
+			idx := choose(perm, options)
+
+			choice := big.NewInt(int64(idx))
+			permNum.Add(permNum, choice.Mul(choice, cumuOpts))
+			cumuOpts.Mul(cumuOpts, big.NewInt(int64(optionCount)))
+			val = options[idx]
+			perm = append(perm, val)
+		}
+		if key := permNum.String(); !seen[key] {
+			seen[key] = true
+			covered = append(covered, permNum)
+		}
+		f.Consume(permNum, perm)
+	}
+	return covered
+}
+
+// SetWeight sets the weight of the node, for use with GraphNodeWeight.
+// The default weight is 1.
+func (gn *GraphNode) SetWeight(weight float64) {
+	if weight < 0 {
+		panic(fmt.Sprintf("negative weight %v", weight))
+	}
+	gn.weight = weight
+	gn.hasWeight = true
+}
+
+// Weight returns the weight of the node. See SetWeight.
+func (gn *GraphNode) Weight() float64 {
+	if !gn.hasWeight {
+		return 1
+	}
+	return gn.weight
+}
+
+// GraphNodeWeight is a WeightFunc, for use with RandomWalk and a graph
+// OptionGenerator, which uses the weights set with SetWeight.
+func GraphNodeWeight(prefix []interface{}, option interface{}) float64 {
+	return option.(*GraphNode).Weight()
+}
@@ -0,0 +1,38 @@
+package gsim
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestRandomWalk(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(diamonds(3)...))
+	walk := func(seed int64, weight WeightFunc) ([]string, []*big.Int) {
+		c := newCollector()
+		covered := p.RandomWalk(50, seed, weight, c)
+		for idx, perm := range *c.perms {
+			if got := permString(p.Permutation((*c.nums)[idx])); got != perm {
+				t.Fatalf("walk drew %q numbered as %q", perm, got)
+			}
+		}
+		return *c.perms, covered
+	}
+	perms, covered := walk(1, nil)
+	if len(perms) != 50 || len(covered) == 0 || len(covered) > 50 {
+		t.Fatalf("drew %d permutations, %d distinct", len(perms), len(covered))
+	}
+	again, _ := walk(1, nil)
+	checkPerms(t, again, perms)
+
+	// A node of weight 0 is only chosen when nothing else is available.
+	g := nodes("a", "b", "c")
+	g[0].SetWeight(0)
+	p = BuildPermutations(NewGraphPermutation(g...))
+	perms, _ = walk(2, GraphNodeWeight)
+	for _, perm := range perms {
+		if !strings.HasSuffix(perm, "a") {
+			t.Fatalf("drew %q", perm)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package gsim
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TypedFailureRecorder is a TypedPermutationChecker which wraps
+// another, and appends the number of every permutation which fails
+// (returns an error, or panics) to a file, along with a fingerprint
+// identifying the generator. A later run, for example the morning
+// after an overnight CI run, can then use ReplayFailures to re-run
+// exactly the failing permutations. Clones share the file, so a
+// TypedFailureRecorder may be used with the parallel iteration
+// functions.
+type TypedFailureRecorder[T any] struct {
+	shared      *recorderFile
+	fingerprint string
+	f           TypedPermutationChecker[T]
+	keepGoing   bool
+}
+
+// FailureRecorder is the interface{} instantiation of
+// TypedFailureRecorder.
+type FailureRecorder = TypedFailureRecorder[interface{}]
+
+type recorderFile struct {
+	lock sync.Mutex
+	file *os.File
+	err  error
+}
+
+// NewFailureRecorder creates a FailureRecorder. See
+// NewTypedFailureRecorder.
+func NewFailureRecorder(path, fingerprint string, f PermutationChecker, keepGoing bool) (*FailureRecorder, error) {
+	return NewTypedFailureRecorder(path, fingerprint, f, keepGoing)
+}
+
+// NewTypedFailureRecorder creates a TypedFailureRecorder which wraps
+// f and appends failures to the file at path, creating it if
+// necessary. The fingerprint must identify the generator, so that
+// permutation numbers are never replayed against a different one; for
+// graphs, use GraphFingerprint. It must not contain tabs or newlines.
+// If keepGoing is true, failures are recorded but not returned, so
+// iteration continues and every failure is recorded. Otherwise the
+// first failure stops iteration as usual.
+func NewTypedFailureRecorder[T any](path, fingerprint string, f TypedPermutationChecker[T], keepGoing bool) (*TypedFailureRecorder[T], error) {
+	if strings.ContainsAny(fingerprint, "\t\n") {
+		return nil, errors.New("fingerprint contains tab or newline")
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedFailureRecorder[T]{
+		shared:      &recorderFile{file: file},
+		fingerprint: fingerprint,
+		f:           f,
+		keepGoing:   keepGoing,
+	}, nil
+}
+
+func (fr *TypedFailureRecorder[T]) Clone() TypedPermutationChecker[T] {
+	return &TypedFailureRecorder[T]{
+		shared:      fr.shared,
+		fingerprint: fr.fingerprint,
+		f:           fr.f.Clone(),
+		keepGoing:   fr.keepGoing,
+	}
+}
+
+func (fr *TypedFailureRecorder[T]) Check(n *big.Int, perm []T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			fr.record(n, fmt.Errorf("panic: %v", r))
+			panic(r)
+		}
+	}()
+	if err = fr.f.Check(n, perm); err == nil {
+		return nil
+	}
+	fr.record(n, err)
+	if fr.keepGoing {
+		return nil
+	}
+	return err
+}
+
+// record appends a single line: the fingerprint, the permutation
+// number and the first line of the error, separated by tabs.
+func (fr *TypedFailureRecorder[T]) record(n *big.Int, err error) {
+	msg, _, _ := strings.Cut(err.Error(), "\n")
+	line := fmt.Sprintf("%s\t%v\t%s\n", fr.fingerprint, n, strings.ReplaceAll(msg, "\t", " "))
+	fr.shared.lock.Lock()
+	defer fr.shared.lock.Unlock()
+	if fr.shared.err == nil {
+		_, fr.shared.err = fr.shared.file.WriteString(line)
+	}
+}
+
+// Close closes the file, returning the first error encountered while
+// writing to it, if any.
+func (fr *TypedFailureRecorder[T]) Close() error {
+	fr.shared.lock.Lock()
+	defer fr.shared.lock.Unlock()
+	if err := fr.shared.file.Close(); fr.shared.err == nil {
+		fr.shared.err = err
+	}
+	return fr.shared.err
+}
+
+// LoadFailures reads the numbers of the permutations recorded in the
+// file at path by a FailureRecorder with the given fingerprint, in the
+// order they were recorded and without duplicates. Records with other
+// fingerprints are ignored.
+func LoadFailures(path, fingerprint string) ([]*big.Int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var nums []*big.Int
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: malformed record", path, line)
+		}
+		if fields[0] != fingerprint || seen[fields[1]] {
+			continue
+		}
+		n, ok := new(big.Int).SetString(fields[1], 10)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: malformed permutation number %q", path, line, fields[1])
+		}
+		seen[fields[1]] = true
+		nums = append(nums, n)
+	}
+	return nums, scanner.Err()
+}
+
+// ReplayFailures replays, with Replay, every permutation recorded in
+// the file at path by a FailureRecorder with the given fingerprint.
+func (p *TypedPermutations[T]) ReplayFailures(path, fingerprint string, f TypedPermutationConsumer[T]) error {
+	nums, err := LoadFailures(path, fingerprint)
+	if err != nil {
+		return err
+	}
+	return p.Replay(nums, f)
+}
+
+// GraphFingerprint returns a fingerprint of the graph reachable from
+// the starting nodes, for use with FailureRecorder. It covers the
+// values of the nodes (as formatted by fmt), the edges, the types of
+// the callbacks and the other settings of each node, so any change to
+// the graph which might change permutation numbers is very likely to
+// change the fingerprint.
+func GraphFingerprint(start ...*GraphNode) string {
+	nodes := reachableGraphNodes(start...)
+	index := make(map[*GraphNode]int, len(nodes))
+	for idx, gn := range nodes {
+		index[gn] = idx
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n", len(start))
+	for _, gn := range nodes {
+		fmt.Fprintf(h, "%q %T %d %d %v %d", fmt.Sprint(gn.Value), gn.Callback, gn.maxVisits, gn.priority, gn.hasDeadline, gn.deadline)
+		for _, out := range gn.Out {
+			fmt.Fprintf(h, " >%d", index[out])
+			if gn.outGuards[out] != nil {
+				fmt.Fprint(h, "?")
+			}
+		}
+		for _, in := range gn.In {
+			idx, found := index[in]
+			if !found {
+				idx = -1
+			}
+			fmt.Fprintf(h, " <%d:%d", idx, gn.inDelays[in])
+		}
+		if gn.symmetryPred != nil {
+			fmt.Fprintf(h, " =%d", index[gn.symmetryPred])
+		}
+		for _, killed := range gn.kills {
+			fmt.Fprintf(h, " x%d", index[killed])
+		}
+		if gn.section != nil {
+			fmt.Fprintf(h, " !%d:%d", index[gn.section.mutex.sections[0].acquire], index[gn.section.acquire])
+		}
+		for _, s := range gn.acquires {
+			fmt.Fprintf(h, " $%d:%d", semaphoreIndex(s, index), s.tokens)
+		}
+		for _, s := range gn.releases {
+			fmt.Fprintf(h, " ^%d", semaphoreIndex(s, index))
+		}
+		if gn.atomic != nil {
+			fmt.Fprintf(h, " @%d:%d:%v", index[gn.atomic.nodes[0]], gn.atomicIdx, gn.atomic.composite != nil)
+		}
+		fmt.Fprintln(h)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// semaphoreIndex identifies a Semaphore within a fingerprint by the
+// index of its first acquire node, or else its first release node.
+func semaphoreIndex(s *Semaphore, index map[*GraphNode]int) int {
+	if len(s.acquires) > 0 {
+		return index[s.acquires[0]]
+	}
+	return -1 - index[s.releases[0]]
+}
@@ -0,0 +1,86 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFailureRecorder(t *testing.T) {
+	start := diamonds(3)
+	p := BuildPermutations(NewGraphPermutation(start...))
+	fingerprint := GraphFingerprint(start...)
+	path := filepath.Join(t.TempDir(), "failures")
+
+	// Permutations which choose [0 1] before [0 0] fail.
+	var want []string
+	for _, perm := range collect(p) {
+		if strings.HasPrefix(perm, "start [0 1]") {
+			want = append(want, perm)
+		}
+	}
+	fails := checkerFunc(func(n *big.Int, perm []interface{}) error {
+		if perm[1].(*GraphNode).Value == [2]int{0, 1} {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	fr, err := NewFailureRecorder(path, fingerprint, fails, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ForEachCheck(fr); err != nil {
+		t.Fatalf("keepGoing recorder returned %v", err)
+	}
+	if err := fr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	nums, err := LoadFailures(path, fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nums) != len(want) || len(want) == 0 {
+		t.Fatalf("loaded %d failures, want %d", len(nums), len(want))
+	}
+	got := newCollector()
+	if err := p.ReplayFailures(path, fingerprint, got); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(want)
+	checkPerms(t, got.sorted(), want)
+
+	// Another graph's failures are ignored.
+	if nums, err := LoadFailures(path, GraphFingerprint(egraph()...)); err != nil || len(nums) != 0 {
+		t.Fatalf("loaded %v, %v for another graph", nums, err)
+	}
+
+	// Without keepGoing, the first failure stops iteration.
+	fr, err = NewFailureRecorder(path, fingerprint, fails, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ForEachCheck(fr); err == nil {
+		t.Fatal("failure not returned")
+	}
+	if err := fr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if nums, err := LoadFailures(path, fingerprint); err != nil || len(nums) != len(want) {
+		t.Fatalf("loaded %d failures, %v, want %d without duplicates", len(nums), err, len(want))
+	}
+}
+
+func TestGraphFingerprint(t *testing.T) {
+	if GraphFingerprint(egraph()...) != GraphFingerprint(egraph()...) {
+		t.Fatal("identical graphs have different fingerprints")
+	}
+	g := egraph()
+	g[0].Out[0].SetMaxVisits(2)
+	if GraphFingerprint(g...) == GraphFingerprint(egraph()...) {
+		t.Fatal("different graphs have the same fingerprint")
+	}
+}
@@ -0,0 +1,106 @@
+package gsim
+
+// A TypedIndependenceFunc reports whether two options are
+// independent: that is, choosing one never enables or disables the
+// other, and choosing them in either order has the same effect. It
+// must be symmetric. Getting this wrong makes partial-order reduction
+// unsound, silently losing permutations which are not equivalent to
+// any that are generated.
+type TypedIndependenceFunc[T any] func(a, b T) bool
+
+// IndependenceFunc is the interface{} instantiation of
+// TypedIndependenceFunc.
+type IndependenceFunc = TypedIndependenceFunc[interface{}]
+
+// A TypedFutureOptionsGenerator is a TypedOptionGenerator which can
+// report every option which might still be returned by Generate,
+// either now or at any point in the future. This is needed for
+// partial-order reduction. graphPermutation implements it.
+type TypedFutureOptionsGenerator[T any] interface {
+	TypedOptionGenerator[T]
+	// FutureOptions is called after Generate with one of the options
+	// Generate has just returned. It must return a superset of the
+	// options which Generate could return from now on, on any path
+	// which does not choose without. It may include without itself.
+	FutureOptions(without T) []T
+}
+
+// FutureOptionsGenerator is the interface{} instantiation of
+// TypedFutureOptionsGenerator.
+type FutureOptionsGenerator = TypedFutureOptionsGenerator[interface{}]
+
+// WithIndependence returns a copy of the receiver which applies
+// partial-order reduction using the given independence relation.
+// Whenever one of the available options is independent of every
+// other option which is, or may yet become, available without it
+// being chosen, only that option is explored: every permutation which
+// chooses something else first is equivalent (by swapping adjacent
+// independent options) to one which chooses it first. This is an
+// ample-set reduction with singleton ample sets, and it requires the
+// OptionGenerator to implement TypedFutureOptionsGenerator; for other
+// generators it has no effect.
+//
+// The reduced space is self-consistent: permutation numbers, Count,
+// Permutation and so on all refer to the reduced space.
+func (p *TypedPermutations[T]) WithIndependence(independent TypedIndependenceFunc[T]) *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) { p2.independent = independent })
+}
+
+// ampleSet returns the options reduced to a singleton ample set if
+// one exists, or otherwise the options unchanged.
+func (p *TypedPermutations[T]) ampleSet(gen TypedOptionGenerator[T], options []T) []T {
+	if len(options) < 2 {
+		return options
+	}
+	futureGen, ok := gen.(TypedFutureOptionsGenerator[T])
+	if !ok {
+		return options
+	}
+	for idx, option := range options {
+		ample := true
+		for _, other := range futureGen.FutureOptions(option) {
+			if interface{}(option) != interface{}(other) && !p.independent(option, other) {
+				ample = false
+				break
+			}
+		}
+		if ample {
+			return options[idx : idx+1]
+		}
+	}
+	return options
+}
+
+// FutureOptions returns every node which is not inhibited and which
+// is reachable from the currently available nodes, other than
+// without, without passing through without.
+func (gp *graphPermutation) FutureOptions(without interface{}) []interface{} {
+	future := make([]interface{}, 0, len(gp.current))
+	seen := make(map[*GraphNode]bool, len(gp.current))
+	if gn, ok := without.(*GraphNode); ok {
+		if gn.atomic != nil && gn == gn.atomic.composite {
+			gn = gn.atomic.nodes[0]
+		}
+		seen[gn] = true
+	}
+	for _, node := range gp.current {
+		gn := node.(*GraphNode)
+		if !seen[gn] {
+			seen[gn] = true
+			future = append(future, gn)
+		}
+	}
+	for idx := 0; idx < len(future); idx++ {
+		for _, gn := range future[idx].(*GraphNode).Out {
+			if seen[gn] {
+				continue
+			}
+			seen[gn] = true
+			if gns, found := gp.getNodeState(gn, false); found && gns.inhibited && !gns.blocked {
+				continue
+			}
+			future = append(future, gn)
+		}
+	}
+	return collapseAtomic(future)
+}
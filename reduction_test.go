@@ -0,0 +1,52 @@
+package gsim
+
+import (
+	"strings"
+	"testing"
+)
+
+// processes builds two processes, a1 then a2, and b1 then b2.
+func processes() []*GraphNode {
+	g := nodes("a1", "a2", "b1", "b2")
+	g[0].AddEdgeTo(g[1])
+	g[2].AddEdgeTo(g[3])
+	return []*GraphNode{g[0], g[2]}
+}
+
+// sameProcess reports whether two nodes of processes() belong to
+// the same process.
+func sameProcess(a, b interface{}) bool {
+	return a.(*GraphNode).Value.(string)[0] == b.(*GraphNode).Value.(string)[0]
+}
+
+func TestWithIndependence(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(processes()...))
+	all := make(map[string]bool)
+	for _, perm := range collect(p) {
+		all[perm] = true
+	}
+
+	// Nothing is shared, so one permutation represents them all.
+	reduced := collect(p.WithIndependence(func(a, b interface{}) bool { return !sameProcess(a, b) }))
+	if len(reduced) != 1 || !all[reduced[0]] {
+		t.Fatalf("got %q", reduced)
+	}
+
+	// a2 and b2 both write to the same variable, so both of their
+	// orders must be explored.
+	conflicting := func(a, b interface{}) bool {
+		va, vb := a.(*GraphNode).Value.(string), b.(*GraphNode).Value.(string)
+		return !sameProcess(a, b) && !(va[1] == '2' && vb[1] == '2')
+	}
+	orders := make(map[bool]bool)
+	reduced = collect(p.WithIndependence(conflicting))
+	for _, perm := range reduced {
+		if !all[perm] {
+			t.Fatalf("generated %q, which is not a permutation", perm)
+		}
+		orders[strings.Index(perm, "a2") < strings.Index(perm, "b2")] = true
+	}
+	if len(orders) != 2 || len(reduced) >= len(all) {
+		t.Fatalf("got %d of %d permutations: %q", len(reduced), len(all), reduced)
+	}
+}
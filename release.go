@@ -0,0 +1,121 @@
+package gsim
+
+type release struct{}
+
+func (r *release) graphNodeStateChangeWitness() {}
+func (r *release) String() string               { return "Release" }
+
+// Release is a GraphNodeStateChange which makes the node available,
+// as MakeAvailable does, even if the node's callback previously
+// inhibited it. Inhibit is otherwise permanent, but the callback of a
+// node it has inhibited is still invoked as further incoming edges are
+// reached: any result other than Release is then ignored. A callback
+// can thus keep a node inhibited while some lock is held, and release
+// it once the lock is freed.
+//
+// Only a ReleasingCallback may release a node: the inhibitions of
+// other callbacks are permanent, and their callbacks are not invoked
+// again. Nodes which are inhibited because they have been chosen (see
+// SetMaxVisits) or killed (see DeclareCrash) cannot be released
+// either. A node which is still inhibited by its callback, awaiting
+// release, when a permutation ends is reported by Stuck.
+var Release GraphNodeStateChange = &release{}
+
+// A ReleasingCallback is a GraphNodeCallback which may return Release
+// after it has inhibited its node. While a node so inhibited awaits
+// release it is neither available nor settled: it is reported by
+// Stuck, and a node which follows it in a symmetry group (see
+// DeclareSymmetric) may not be chosen.
+type ReleasingCallback interface {
+	GraphNodeCallback
+	// MayRelease reports whether the callback may return Release.
+	MayRelease() bool
+}
+
+// mayRelease reports whether callback is a ReleasingCallback which may
+// return Release.
+func mayRelease(callback GraphNodeCallback) bool {
+	rc, ok := callback.(ReleasingCallback)
+	return ok && rc.MayRelease()
+}
+
+// MayRelease reports whether any of the callbacks may return Release.
+func (cc *CombinationCallback) MayRelease() bool {
+	for _, callback := range cc.callbacks {
+		if mayRelease(callback) {
+			return true
+		}
+	}
+	return false
+}
+
+type blockedUntilCallback struct {
+	block, release *GraphNode
+	callback       GraphNodeCallback
+}
+
+// NewBlockedUntilCallback returns a callback which inhibits the node
+// whenever block has been reached more recently than release. The node
+// thus models an event which cannot happen while a lock, acquired by
+// block and freed by release, is held by someone else. Otherwise, the
+// result is that of callback given the other incoming edges reached,
+// except that once the node has been inhibited, it stays inhibited
+// until callback returns MakeAvailable, whereupon it is released. A
+// node with no other incoming edges is released as soon as it is
+// unblocked. Both block and release must have edges to the node.
+func NewBlockedUntilCallback(block, release *GraphNode, callback GraphNodeCallback) GraphNodeCallback {
+	return &blockedUntilCallback{
+		block:    block,
+		release:  release,
+		callback: callback,
+	}
+}
+
+func (bc *blockedUntilCallback) IncomingEdgesReached(node *GraphNode, reached []*GraphNode) GraphNodeStateChange {
+	blocked, everBlocked := false, false
+	others := make([]*GraphNode, 0, len(reached))
+	// reached is in the order in which the edges were reached.
+	for _, gn := range reached {
+		switch gn {
+		case bc.block:
+			blocked, everBlocked = true, true
+		case bc.release:
+			blocked = false
+		default:
+			others = append(others, gn)
+		}
+	}
+	if blocked {
+		return Inhibit
+	}
+	result := GraphNodeStateChange(NoChange)
+	if len(others) != 0 {
+		result = bc.callback.IncomingEdgesReached(node, others)
+	} else if everBlocked && !bc.hasOtherIncoming(node) {
+		// A starting node was available before it was blocked.
+		result = MakeAvailable
+	}
+	switch {
+	case !everBlocked:
+		return result
+	case result == MakeAvailable:
+		return Release
+	case result == NoChange:
+		return Inhibit
+	default:
+		return result
+	}
+}
+
+func (bc *blockedUntilCallback) MayRelease() bool {
+	return true
+}
+
+func (bc *blockedUntilCallback) hasOtherIncoming(node *GraphNode) bool {
+	for _, in := range node.In {
+		if in != bc.block && in != bc.release {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestInhibitedNodesAreNotStuck(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(egraph()...))
+	all := collectSorted(p)
+	checkPerms(t, all, []string{
+		"E1 E2 E3",
+		"E1 E2 E4 E3",
+		"E1 E4 E2 E3",
+		"E2 E1 E3",
+		"E2 E1 E4 E3",
+		"E2 E4 E1 E3",
+	})
+	c := newCollector()
+	err := p.WithDeadlockPolicy(DeadlockAbort).ForEachCheck(checkerFunc(func(n *big.Int, perm []interface{}) error {
+		c.Consume(n, perm)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPerms(t, c.sorted(), all)
+}
+
+func TestBlockedNodeIsStuck(t *testing.T) {
+	// lock blocks b, and nothing releases it.
+	g := nodes("lock", "unlock", "b")
+	lock, unlock, b := g[0], g[1], g[2]
+	lock.AddEdgeTo(b)
+	unlock.AddEdgeTo(b)
+	b.Callback = NewBlockedUntilCallback(lock, unlock, AvailableAnyCallback)
+	p := BuildPermutations(NewGraphPermutation(lock)).WithDeadlockPolicy(DeadlockAbort)
+	err := p.ForEachCheck(checkerFunc(func(*big.Int, []interface{}) error { return nil }))
+	var de *DeadlockError
+	if !errors.As(err, &de) || len(de.Stuck) != 1 || de.Stuck[0] != b {
+		t.Fatalf("got %v, want b stuck", err)
+	}
+}
+
+func TestBlockedUntilReleased(t *testing.T) {
+	// b follows a, but not while lock is held.
+	g := nodes("a", "lock", "unlock", "b")
+	a, lock, unlock, b := g[0], g[1], g[2], g[3]
+	lock.AddEdgeTo(unlock)
+	for _, gn := range []*GraphNode{a, lock, unlock} {
+		gn.AddEdgeTo(b)
+	}
+	b.Callback = NewBlockedUntilCallback(lock, unlock, AvailableAnyCallback)
+	p := BuildPermutations(NewGraphPermutation(a, lock)).WithDeadlockPolicy(DeadlockAbort)
+	checkPerms(t, collectSorted(p), []string{
+		"a b lock unlock",
+		"a lock unlock b",
+		"lock a unlock b",
+		"lock unlock a b",
+	})
+	err := p.ForEachCheck(checkerFunc(func(*big.Int, []interface{}) error { return nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCombinationPassesRelease(t *testing.T) {
+	g := nodes("a", "lock", "unlock", "b")
+	a, lock, unlock, b := g[0], g[1], g[2], g[3]
+	lock.AddEdgeTo(unlock)
+	for _, gn := range []*GraphNode{a, lock, unlock} {
+		gn.AddEdgeTo(b)
+	}
+	cc := NewCombinationCallback(InhibitThenAvailableCombiner)
+	cc.AddCallback(NewBlockedUntilCallback(lock, unlock, NewAvailableAllCallback(a)))
+	b.Callback = cc
+	if !cc.MayRelease() {
+		t.Fatal("combination of a blocked until callback cannot release")
+	}
+	p := BuildPermutations(NewGraphPermutation(a, lock))
+	checkPerms(t, collectSorted(p), []string{
+		"a b lock unlock",
+		"a lock unlock b",
+		"lock a unlock b",
+		"lock unlock a b",
+	})
+}
+
+func TestSymmetricAfterInhibitedPredecessor(t *testing.T) {
+	// k inhibits a, after which b may follow.
+	g := nodes("k", "a", "b")
+	k, a, b := g[0], g[1], g[2]
+	k.AddEdgeTo(a)
+	a.Callback = InhibitAnyCallback
+	DeclareSymmetric(a, b)
+	p := BuildPermutations(NewGraphPermutation(k, a, b))
+	checkPerms(t, collectSorted(p), []string{
+		"a b k",
+		"a k b",
+		"k b",
+	})
+}
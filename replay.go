@@ -0,0 +1,72 @@
+package gsim
+
+import (
+	"fmt"
+	"math/big"
+)
+
+type replayEntry struct {
+	n         *big.Int
+	remaining *big.Int
+}
+
+// Replay regenerates the permutations with the given numbers and
+// supplies each of them to f.Consume. It produces the same results as
+// calling Permutation for each number, but permutations which share a
+// prefix share the work of generating that prefix, so replaying
+// thousands of saved numbers (for example, every failure found by an
+// overnight run) is much faster. Permutations are supplied in tree
+// order, not in the order of nums.
+//
+// If any number does not correspond to a permutation, the remaining
+// numbers are still replayed and then an error is returned.
+func (p *TypedPermutations[T]) Replay(nums []*big.Int, f TypedPermutationConsumer[T]) error {
+	entries := make([]replayEntry, len(nums))
+	for idx, n := range nums {
+		entries[idx] = replayEntry{n: n, remaining: new(big.Int).Set(n)}
+	}
+	var invalid []*big.Int
+	p.replay(p.root.generator.Clone(), p.root.value, []T{}, entries, f, &invalid)
+	if len(invalid) != 0 {
+		return fmt.Errorf("%v of %v numbers are not valid permutation numbers, including %v", len(invalid), len(nums), invalid[0])
+	}
+	return nil
+}
+
+func (p *TypedPermutations[T]) replay(gen TypedOptionGenerator[T], value T, perm []T, entries []replayEntry, f TypedPermutationConsumer[T], invalid *[]*big.Int) {
+	options, ok := p.generate(gen, value, perm)
+	optionCount := len(options)
+	if !ok || optionCount == 0 {
+		for _, entry := range entries {
+			if ok && entry.remaining.Sign() == 0 {
+				f.Consume(entry.n, perm)
+			} else {
+				*invalid = append(*invalid, entry.n)
+			}
+		}
+		return
+	}
+
+	groups := make([][]replayEntry, optionCount)
+	countBig := big.NewInt(int64(optionCount))
+	choiceBig := new(big.Int)
+	for _, entry := range entries {
+		entry.remaining.QuoRem(entry.remaining, countBig, choiceBig)
+		choice := int(choiceBig.Int64())
+		groups[choice] = append(groups[choice], entry)
+	}
+	last := optionCount - 1
+	for last >= 0 && len(groups[last]) == 0 {
+		last--
+	}
+	for idx, group := range groups[:last+1] {
+		if len(group) == 0 {
+			continue
+		}
+		childGen := gen
+		if idx != last {
+			childGen = gen.Clone()
+		}
+		p.replay(childGen, options[idx], append(perm, options[idx]), group, f, invalid)
+	}
+}
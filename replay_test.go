@@ -0,0 +1,38 @@
+package gsim
+
+import (
+	"math/big"
+	"sort"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(diamonds(3)...))
+	all := newCollector()
+	p.ForEach(all)
+	var nums []*big.Int
+	var want []string
+	for idx := len(*all.nums) - 1; idx >= 0; idx -= 2 {
+		nums = append(nums, (*all.nums)[idx])
+		want = append(want, (*all.perms)[idx])
+	}
+	got := newCollector()
+	if err := p.Replay(nums, got); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(want)
+	checkPerms(t, got.sorted(), want)
+	for idx, perm := range *got.perms {
+		if permString(p.Permutation((*got.nums)[idx])) != perm {
+			t.Fatalf("%q replayed as number %v", perm, (*got.nums)[idx])
+		}
+	}
+
+	got = newCollector()
+	if err := p.Replay(append(nums, big.NewInt(1000)), got); err == nil {
+		t.Fatal("invalid number replayed without error")
+	}
+	if len(*got.perms) != len(nums) {
+		t.Fatalf("replayed %d valid numbers, want %d", len(*got.perms), len(nums))
+	}
+}
@@ -0,0 +1,227 @@
+package gsim
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of checking a single permutation, as recorded
+// by a ResultStore.
+type Result struct {
+	Fingerprint string        `json:"fingerprint"`
+	N           *big.Int      `json:"n"`
+	Err         string        `json:"err,omitempty"`
+	Duration    time.Duration `json:"duration"`
+	Payload     []byte        `json:"payload,omitempty"`
+}
+
+// Failed reports whether the permutation failed.
+func (r *Result) Failed() bool {
+	return r.Err != ""
+}
+
+// A ResultPayloader can be implemented by the checker wrapped by a
+// ResultStore to attach a payload of its own to each result. Payload
+// is called after every Check, on the same clone.
+type ResultPayloader interface {
+	Payload() []byte
+}
+
+// TypedResultStore is a TypedPermutationChecker which wraps another,
+// and appends the outcome of every permutation it checks (its number,
+// error if any, how long Check took, and an optional payload) to a
+// file. The file is opened and read when the TypedResultStore is
+// created, and permutations which already have a result with the same
+// fingerprint are skipped: they are not passed to the wrapped
+// checker. So if a long run is interrupted, re-running it with the
+// same file only checks the permutations not yet done. This is useful
+// when checking a permutation is expensive, for example because it
+// drives a real external system.
+//
+// Each result is one line of JSON, written as soon as Check returns.
+// A partial line left by a crash is discarded when the file is next
+// opened. Clones share the file, so a TypedResultStore may be used
+// with the parallel iteration functions.
+type TypedResultStore[T any] struct {
+	shared      *resultFile
+	fingerprint string
+	f           TypedPermutationChecker[T]
+	keepGoing   bool
+}
+
+// ResultStore is the interface{} instantiation of TypedResultStore.
+type ResultStore = TypedResultStore[interface{}]
+
+type resultFile struct {
+	lock sync.Mutex
+	file *os.File
+	done map[string]bool
+	err  error
+}
+
+// NewResultStore creates a ResultStore. See NewTypedResultStore.
+func NewResultStore(path, fingerprint string, f PermutationChecker, keepGoing bool) (*ResultStore, error) {
+	return NewTypedResultStore(path, fingerprint, f, keepGoing)
+}
+
+// NewTypedResultStore creates a TypedResultStore which wraps f and
+// records results in the file at path, creating it if necessary. As
+// with NewTypedFailureRecorder, the fingerprint must identify the
+// generator, and if keepGoing is true then failures are recorded but
+// not returned. A failed permutation counts as done, and so is not
+// checked again on restart; use LoadResults to find it.
+func NewTypedResultStore[T any](path, fingerprint string, f TypedPermutationChecker[T], keepGoing bool) (*TypedResultStore[T], error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[string]bool)
+	size, err := readResults(file, func(r *Result) {
+		if r.Fingerprint == fingerprint {
+			done[r.N.String()] = true
+		}
+	})
+	if err == nil {
+		// Discard any partial line, and append from there.
+		if err = file.Truncate(size); err == nil {
+			_, err = file.Seek(size, io.SeekStart)
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &TypedResultStore[T]{
+		shared:      &resultFile{file: file, done: done},
+		fingerprint: fingerprint,
+		f:           f,
+		keepGoing:   keepGoing,
+	}, nil
+}
+
+// readResults calls f with every complete result in r, and returns
+// the length of the complete lines read.
+func readResults(r io.Reader, f func(*Result)) (int64, error) {
+	reader := bufio.NewReader(r)
+	size := int64(0)
+	for line := 1; ; line++ {
+		text, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return size, nil // any partial line is ignored
+		} else if err != nil {
+			return 0, err
+		}
+		result := &Result{}
+		if err := json.Unmarshal(bytes.TrimSpace(text), result); err != nil || result.N == nil {
+			return 0, fmt.Errorf("line %d: malformed result", line)
+		}
+		f(result)
+		size += int64(len(text))
+	}
+}
+
+// LoadResults reads every result recorded in the file at path by a
+// ResultStore with the given fingerprint, in the order they were
+// recorded. Records with other fingerprints are ignored.
+func LoadResults(path, fingerprint string) ([]*Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var results []*Result
+	_, err = readResults(file, func(r *Result) {
+		if r.Fingerprint == fingerprint {
+			results = append(results, r)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return results, nil
+}
+
+func (rs *TypedResultStore[T]) Clone() TypedPermutationChecker[T] {
+	return &TypedResultStore[T]{
+		shared:      rs.shared,
+		fingerprint: rs.fingerprint,
+		f:           rs.f.Clone(),
+		keepGoing:   rs.keepGoing,
+	}
+}
+
+func (rs *TypedResultStore[T]) Check(n *big.Int, perm []T) (err error) {
+	key := n.String()
+	rs.shared.lock.Lock()
+	done := rs.shared.done[key]
+	rs.shared.lock.Unlock()
+	if done {
+		return nil
+	}
+
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			rs.record(key, n, start, fmt.Errorf("panic: %v", r))
+			panic(r)
+		}
+	}()
+	err = rs.f.Check(n, perm)
+	rs.record(key, n, start, err)
+	if rs.keepGoing {
+		return nil
+	}
+	return err
+}
+
+func (rs *TypedResultStore[T]) record(key string, n *big.Int, start time.Time, err error) {
+	result := &Result{
+		Fingerprint: rs.fingerprint,
+		N:           n,
+		Duration:    time.Since(start),
+	}
+	if err != nil {
+		result.Err = err.Error()
+	}
+	if payloader, ok := rs.f.(ResultPayloader); ok {
+		result.Payload = payloader.Payload()
+	}
+	line, jsonErr := json.Marshal(result)
+	line = append(line, '\n')
+
+	rs.shared.lock.Lock()
+	defer rs.shared.lock.Unlock()
+	rs.shared.done[key] = true
+	if rs.shared.err == nil {
+		if rs.shared.err = jsonErr; jsonErr == nil {
+			_, rs.shared.err = rs.shared.file.Write(line)
+		}
+	}
+}
+
+// Done reports whether the permutation with the given number already
+// had a result when the store was opened, or has had one recorded
+// since.
+func (rs *TypedResultStore[T]) Done(n *big.Int) bool {
+	rs.shared.lock.Lock()
+	defer rs.shared.lock.Unlock()
+	return rs.shared.done[n.String()]
+}
+
+// Close closes the file, returning the first error encountered while
+// writing to it, if any.
+func (rs *TypedResultStore[T]) Close() error {
+	rs.shared.lock.Lock()
+	defer rs.shared.lock.Unlock()
+	if err := rs.shared.file.Close(); rs.shared.err == nil {
+		rs.shared.err = err
+	}
+	return rs.shared.err
+}
@@ -0,0 +1,98 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// payloadChecker is a checker which counts the permutations it
+// checks, fails the permutation numbered fail, and attaches the
+// number of the permutation to each result.
+type payloadChecker struct {
+	checked *int
+	fail    int64
+	last    *big.Int
+}
+
+func (pc *payloadChecker) Clone() PermutationChecker {
+	return pc
+}
+
+func (pc *payloadChecker) Check(n *big.Int, perm []interface{}) error {
+	*pc.checked++
+	pc.last = n
+	if n.Int64() == pc.fail {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func (pc *payloadChecker) Payload() []byte {
+	return []byte(pc.last.String())
+}
+
+func TestResultStore(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4}))
+	path := filepath.Join(t.TempDir(), "results")
+	checked := 0
+	rs, err := NewResultStore(path, "fp", &payloadChecker{checked: &checked, fail: 5}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ForEachCheck(rs); err == nil {
+		t.Fatal("failure not returned")
+	}
+	if err := rs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	first := checked
+
+	// A partial line, as left by a crash, is discarded.
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"fingerprint":"fp","n":`)
+	file.Close()
+
+	checked = 0
+	rs, err = NewResultStore(path, "fp", &payloadChecker{checked: &checked, fail: -1}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rs.Done(big.NewInt(5)) {
+		t.Fatal("failed permutation not done")
+	}
+	if err := p.ForEachCheck(rs); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if first+checked != 24 {
+		t.Fatalf("checked %d then %d permutations, want 24 in all", first, checked)
+	}
+
+	results, err := LoadResults(path, "fp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := 0
+	for _, result := range results {
+		if string(result.Payload) != result.N.String() {
+			t.Fatalf("result for %v has payload %q", result.N, result.Payload)
+		}
+		if result.Failed() {
+			failed++
+		}
+	}
+	if len(results) != 24 || failed != 1 {
+		t.Fatalf("loaded %d results, %d failed, want 24 and 1", len(results), failed)
+	}
+	if results, err := LoadResults(path, "other"); err != nil || len(results) != 0 {
+		t.Fatalf("loaded %d results, %v, for another fingerprint", len(results), err)
+	}
+}
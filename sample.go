@@ -0,0 +1,76 @@
+package gsim
+
+import (
+	"math/big"
+	"math/rand"
+)
+
+// sampleTrie caches the sizes of subtrees discovered whilst sampling,
+// so that repeated samples do not need to recount the upper levels of
+// the tree.
+type sampleTrie struct {
+	counts   []uint64
+	children []*sampleTrie
+}
+
+// Sample draws n permutations uniformly at random, with replacement,
+// from the entire set of permutations, and supplies each one to
+// f.Consume along with its permutation number. The same seed will
+// always produce the same sequence of permutations.
+//
+// To be uniform, Sample needs to know the size of every subtree it
+// descends into, so the first sample costs about the same as Count.
+// Subtree sizes are cached, so subsequent samples are much cheaper.
+// This is useful when the full space is too large to iterate through
+// in the time you have, but the space can still be counted.
+func (p *TypedPermutations[T]) Sample(n int, seed int64, f TypedPermutationConsumer[T]) {
+	rng := rand.New(rand.NewSource(seed))
+	total := new(big.Int).SetUint64(p.countFrom(p.root.value, p.root.generator.Clone(), nil))
+	if total.Sign() == 0 {
+		return
+	}
+	root := &sampleTrie{}
+	target := new(big.Int)
+
+	for ; n > 0; n-- {
+		target.Rand(rng, total)
+		r := target.Uint64()
+
+		permNum := new(big.Int)
+		cumuOpts := big.NewInt(1)
+		perm := []T{}
+		trie := root
+		gen := p.root.generator.Clone()
+		val := p.root.value
+		for {
+			options, _ := p.generate(gen, val, perm)
+			optionCount := len(options)
+			if optionCount == 0 {
+				break
+			}
+			if trie.counts == nil {
+				trie.counts = make([]uint64, optionCount)
+				trie.children = make([]*sampleTrie, optionCount)
+				for idx, option := range options {
+					trie.counts[idx] = p.countFrom(option, gen.Clone(), append(perm[:len(perm):len(perm)], option))
+				}
+			}
+			idx := 0
+			for ; r >= trie.counts[idx]; idx++ {
+				r -= trie.counts[idx]
+			}
+			if trie.children[idx] == nil {
+				trie.children[idx] = &sampleTrie{}
+			}
+			trie = trie.children[idx]
+
+			choice := big.NewInt(int64(idx))
+			permNum.Add(permNum, choice.Mul(choice, cumuOpts))
+			cumuOpts.Mul(cumuOpts, big.NewInt(int64(optionCount)))
+			val = options[idx]
+			perm = append(perm, val)
+			gen = gen.Clone()
+		}
+		f.Consume(permNum, perm)
+	}
+}
@@ -0,0 +1,43 @@
+package gsim
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestSampleIsUniform(t *testing.T) {
+	// a b c, a c b and c a b: two of the three start with a, so
+	// choosing uniformly at each step would not be uniform.
+	g := nodes("a", "b", "c")
+	g[0].AddEdgeTo(g[1])
+	p := BuildPermutations(NewGraphPermutation(g[0], g[2]))
+
+	c := newCollector()
+	p.Sample(3000, 42, c)
+	counts := make(map[string]int)
+	for idx, perm := range *c.perms {
+		counts[perm]++
+		if got := permString(p.Permutation((*c.nums)[idx])); got != perm {
+			t.Fatalf("sample %q numbered as %q", perm, got)
+		}
+	}
+	if len(counts) != 3 {
+		t.Fatalf("sampled %v", counts)
+	}
+	for perm, count := range counts {
+		if count < 850 || count > 1150 {
+			t.Fatalf("%q sampled %d times of 3000: %v", perm, count, counts)
+		}
+	}
+
+	again := newCollector()
+	p.Sample(3000, 42, again)
+	checkPerms(t, *again.perms, *c.perms)
+}
+
+func TestSampleEmpty(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2})).WithPrune(func([]interface{}) bool { return true })
+	p.Sample(10, 1, consumerFunc(func(*big.Int, []interface{}) {
+		t.Fatal("sampled a pruned permutation")
+	}))
+}
@@ -0,0 +1,70 @@
+package gsim
+
+// Semaphore models a pool of interchangeable tokens, such as the
+// connections of a pool or the slots of a bounded buffer. Each visit
+// of an acquire node takes a token, and each visit of a release node
+// returns one; an acquire node cannot be chosen while the pool is
+// empty. This saves building meshes of inhibiting edges by hand.
+type Semaphore struct {
+	tokens   int
+	acquires []*GraphNode
+	releases []*GraphNode
+}
+
+// Construct a new Semaphore with the given number of tokens, and no
+// acquire or release nodes.
+func NewSemaphore(tokens int) *Semaphore {
+	if tokens < 0 {
+		panic("NewSemaphore requires a non-negative number of tokens")
+	}
+	return &Semaphore{tokens: tokens}
+}
+
+// Acquire declares nodes which each take a token whenever they are
+// chosen. A node may acquire from several Semaphores, in which case
+// it can only be chosen while all of them have a token. No edges are
+// added: which release returns a token is up to the graph. If the
+// pool never refills then the acquire nodes can never be chosen,
+// which WithDeadlockPolicy will detect.
+func (s *Semaphore) Acquire(nodes ...*GraphNode) {
+	for _, gn := range nodes {
+		gn.acquires = append(gn.acquires, s)
+		s.acquires = append(s.acquires, gn)
+	}
+}
+
+// Release declares nodes which each return a token whenever they are
+// chosen. Releases are not checked against acquires: the graph should
+// only make a release node available once the matching acquire has
+// been chosen, or the pool will grow beyond its initial tokens.
+func (s *Semaphore) Release(nodes ...*GraphNode) {
+	for _, gn := range nodes {
+		gn.releases = append(gn.releases, s)
+		s.releases = append(s.releases, gn)
+	}
+}
+
+// available returns the number of tokens in the pool. As with held,
+// this is derived from visits, so it is correct for nodes which may be
+// visited several times.
+func (gp *graphPermutation) available(s *Semaphore) int {
+	tokens := s.tokens
+	for _, gn := range s.acquires {
+		tokens -= gp.Visits(gn)
+	}
+	for _, gn := range s.releases {
+		tokens += gp.Visits(gn)
+	}
+	return tokens
+}
+
+// semaphoreEligible reports whether gn may be chosen now, given the
+// Semaphores it acquires from, if any.
+func (gp *graphPermutation) semaphoreEligible(gn *GraphNode) bool {
+	for _, s := range gn.acquires {
+		if gp.available(s) <= 0 {
+			return false
+		}
+	}
+	return true
+}
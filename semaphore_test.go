@@ -0,0 +1,46 @@
+package gsim
+
+import (
+	"strings"
+	"testing"
+)
+
+// workers builds n chains, each of which acquires and then releases a
+// token of a Semaphore with the given tokens.
+func workers(n, tokens int) []*GraphNode {
+	s := NewSemaphore(tokens)
+	start := make([]*GraphNode, n)
+	for idx := range start {
+		acquire := NewGraphNode(string(rune('a'+idx)) + "+")
+		release := NewGraphNode(string(rune('a'+idx)) + "-")
+		acquire.AddEdgeTo(release)
+		s.Acquire(acquire)
+		s.Release(release)
+		start[idx] = acquire
+	}
+	return start
+}
+
+func TestSemaphore(t *testing.T) {
+	// With no tokens, nothing can be chosen.
+	checkPerms(t, collect(BuildPermutations(NewGraphPermutation(workers(3, 0)...))), []string{""})
+	for tokens, want := range map[int]int{1: 6, 2: 54, 3: 90} {
+		perms := collect(BuildPermutations(NewGraphPermutation(workers(3, tokens)...)))
+		if len(perms) != want {
+			t.Fatalf("%d tokens: got %d permutations, want %d", tokens, len(perms), want)
+		}
+		for _, perm := range perms {
+			held := 0
+			for _, elem := range strings.Fields(perm) {
+				if strings.HasSuffix(elem, "+") {
+					held++
+				} else {
+					held--
+				}
+				if held > tokens {
+					t.Fatalf("%d tokens: %q holds %d", tokens, perm, held)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package gsim
+
+import (
+	"fmt"
+)
+
+// shardFactor is how many subtrees per shard the tree is split into
+// before the subtrees are divided between the shards. More subtrees
+// give a more even division of the work.
+const shardFactor = 8
+
+// Shard returns a copy of the receiver which iterates through only
+// the i-th (counting from 0) of n disjoint partitions of the
+// permutations. Between them, the n shards contain every permutation
+// exactly once, with the same numbers as in the receiver. The tree is
+// split, by expanding its shallowest branches, into subtrees which
+// are then divided between the shards, balanced by their estimated
+// size. This is deterministic, provided the OptionGenerator is, so
+// separate processes (for example, separate CI jobs) can each iterate
+// through their own shard with no coordination. If the tree is too
+// small to split n ways then some shards are empty. Count is not
+// affected by sharding.
+func (p *TypedPermutations[T]) Shard(i, n int) *TypedPermutations[T] {
+	if n < 1 || i < 0 || i >= n {
+		panic(fmt.Sprintf("Shard(%d, %d): shard out of range", i, n))
+	}
+	loads := make([]float64, n)
+	shard := []*node[T]{}
+	for _, cur := range p.frontier(n * shardFactor) {
+		least := 0
+		for idx, load := range loads {
+			if load < loads[least] {
+				least = idx
+			}
+		}
+		loads[least] += cur.weight
+		if least == i {
+			shard = append(shard, cur)
+		}
+	}
+	return p.with(func(p2 *TypedPermutations[T]) { p2.resume = shard })
+}
+
+// Split partitions the permutations of the receiver into k disjoint
+// parts, each a copy of the receiver, with the same options, which
+// iterates through only its own part. Between them, the parts contain
+// every permutation exactly once, with the same numbers as in the
+// receiver, and each may be iterated independently (and concurrently)
+// with any of the iteration functions, or have Snapshot taken. This
+// is the primitive on which schedulers of their own can be built:
+// parts can be handed to go-routines, processes or machines as they
+// become free, and split again if they turn out to be large.
+//
+// The tree is split, by expanding its shallowest branches, into at
+// least k subtrees, which are then divided, in tree order, into k
+// runs of roughly equal numbers of subtrees. The parts are therefore
+// not necessarily of similar size; see Shard for a balanced split. If
+// the tree is too small to split k ways, fewer parts are returned.
+func (p *TypedPermutations[T]) Split(k int) []*TypedPermutations[T] {
+	if k < 1 {
+		panic(fmt.Sprintf("Split(%d): k must be positive", k))
+	}
+	subtrees := p.frontier(k)
+	if len(subtrees) < k {
+		k = len(subtrees)
+	}
+	parts := make([]*TypedPermutations[T], k)
+	for idx := range parts {
+		part := subtrees[idx*len(subtrees)/k : (idx+1)*len(subtrees)/k]
+		parts[idx] = p.with(func(p2 *TypedPermutations[T]) { p2.resume = part })
+	}
+	return parts
+}
@@ -0,0 +1,73 @@
+package gsim
+
+import (
+	"testing"
+)
+
+// checkPartition fails the test unless, between them, the parts
+// contain every permutation of p exactly once, with the same number.
+func checkPartition(t *testing.T, p *Permutations, parts []*Permutations) {
+	t.Helper()
+	want := newCollector()
+	p.ForEach(want)
+	wantNumbered := want.numbered()
+	seen := make(map[string]bool)
+	for idx, part := range parts {
+		c := newCollector()
+		part.ForEach(c)
+		for n, perm := range c.numbered() {
+			if seen[n] {
+				t.Fatalf("part %d: %s (%q) is in another part", idx, n, perm)
+			} else if wantNumbered[n] != perm {
+				t.Fatalf("part %d: %s is %q, want %q", idx, n, perm, wantNumbered[n])
+			}
+			seen[n] = true
+		}
+	}
+	if len(seen) != len(wantNumbered) {
+		t.Fatalf("parts hold %d permutations, want %d", len(seen), len(wantNumbered))
+	}
+}
+
+func TestShard(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5}))
+	for _, n := range []int{1, 3, 7} {
+		shards := make([]*Permutations, n)
+		for i := range shards {
+			shards[i] = p.Shard(i, n)
+		}
+		checkPartition(t, p, shards)
+	}
+	// Sharding is deterministic.
+	checkPerms(t, collect(p.Shard(1, 3)), collect(p.Shard(1, 3)))
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic")
+		}
+	}()
+	p.Shard(3, 3)
+}
+
+func TestSplit(t *testing.T) {
+	for _, p := range []*Permutations{
+		BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5})),
+		BuildPermutations(NewGraphPermutation(egraph()...)),
+	} {
+		for _, k := range []int{1, 2, 4, 7} {
+			parts := p.Split(k)
+			if len(parts) < 1 || len(parts) > k {
+				t.Fatalf("Split(%d) gave %d parts", k, len(parts))
+			}
+			checkPartition(t, p, parts)
+		}
+	}
+	// A part may be split again.
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5}))
+	parts := p.Split(2)
+	checkPartition(t, p, append(parts[1].Split(3), parts[0]))
+	// A tree too small to split k ways gives fewer parts.
+	if parts := BuildPermutations(NewSimplePermutation([]interface{}{1, 2})).Split(5); len(parts) != 2 {
+		t.Fatalf("Split(5) of 2 permutations gave %d parts", len(parts))
+	}
+}
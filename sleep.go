@@ -0,0 +1,76 @@
+package gsim
+
+// WithSleepSets returns a copy of the receiver which uses sleep sets,
+// with the independence relation given to WithIndependence, to avoid
+// exploring equivalent permutations during ForEach, ForEachPar and
+// their variants. Once the subtree which chooses option a has been
+// explored, a sibling subtree which chooses b next need not choose a
+// until something dependent on a has been chosen: a is put to sleep,
+// as every such permutation is equivalent to one in which a and b are
+// swapped. Nodes whose options are all asleep are dropped, and are
+// not generated as permutations.
+//
+// Sleep sets complement the ample sets of WithIndependence: they need
+// nothing from the OptionGenerator beyond the independence relation,
+// and only prefix-local bookkeeping. Unlike ample sets, they do not
+// alter the space: permutation numbers, Count, Permutation and so on
+// are unaffected, iteration merely omits some permutations. Without
+// WithIndependence, WithSleepSets has no effect. Sample ignores sleep
+// sets, as do subtrees resumed from a snapshot, which then explore
+// more than they need to. ForEachParGen does not support sleep sets,
+// and returns ErrParGenUnsupported. Sleep sets should not be
+// combined with WithStateDeduplication: a state first reached with
+// some of its options asleep will not be explored again when reached
+// with those options awake.
+func (p *TypedPermutations[T]) WithSleepSets() *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) { p2.sleepSets = true })
+}
+
+// awake reports, for each option, whether it is absent from sleep.
+func (p *TypedPermutations[T]) awake(sleep, options []T) []bool {
+	awake := make([]bool, len(options))
+	for idx, option := range options {
+		awake[idx] = !containsOption(sleep, option)
+	}
+	return awake
+}
+
+// childSleep calculates the sleep set of the child which chooses the
+// option at position pos of order, the order in which the children
+// are pushed (nil meaning the order of options). Children are
+// explored last pushed first, so the awake options after pos have
+// already been explored by the time the child is. Of those and of the
+// parent's sleep set, everything independent of the option chosen
+// stays asleep.
+func (p *TypedPermutations[T]) childSleep(sleep, options []T, awake []bool, order []int, pos int) []T {
+	idx := pos
+	if order != nil {
+		idx = order[pos]
+	}
+	chosen := options[idx]
+	var childSleep []T
+	for _, option := range sleep {
+		if p.independent(chosen, option) {
+			childSleep = append(childSleep, option)
+		}
+	}
+	for pos2 := pos + 1; pos2 < len(options); pos2++ {
+		idx2 := pos2
+		if order != nil {
+			idx2 = order[pos2]
+		}
+		if option := options[idx2]; awake[idx2] && p.independent(chosen, option) {
+			childSleep = append(childSleep, option)
+		}
+	}
+	return childSleep
+}
+
+func containsOption[T any](options []T, option T) bool {
+	for _, o := range options {
+		if interface{}(o) == interface{}(option) {
+			return true
+		}
+	}
+	return false
+}
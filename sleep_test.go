@@ -0,0 +1,30 @@
+package gsim
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithSleepSets(t *testing.T) {
+	// Only 1 and 2 are dependent, so the permutations fall into two
+	// classes: those with 1 before 2, and those with 2 before 1. The
+	// simple generator cannot report its future options, so there are
+	// no ample sets.
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4})).
+		WithIndependence(func(a, b interface{}) bool { return a.(int)+b.(int) != 3 })
+	if got := collect(p); len(got) != 24 {
+		t.Fatalf("got %d permutations without sleep sets, want 24", len(got))
+	}
+	c := newCollector()
+	p.WithSleepSets().ForEach(c)
+	orders := make(map[bool]bool)
+	for idx, perm := range *c.perms {
+		orders[strings.Index(perm, "1") < strings.Index(perm, "2")] = true
+		if got := permString(p.Permutation((*c.nums)[idx])); got != perm {
+			t.Fatalf("%q numbered as %q", perm, got)
+		}
+	}
+	if len(orders) != 2 || len(*c.perms) > 4 {
+		t.Fatalf("got %q", *c.perms)
+	}
+}
@@ -0,0 +1,186 @@
+package gsim
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const snapshotVersion = 1
+
+// ErrSnapshotUnavailable is returned by Snapshot when the iteration
+// position cannot be captured, which is the case during and after
+// ForEachPar and ForEachParCheck: permutations may have been
+// generated but not yet consumed.
+var ErrSnapshotUnavailable = errors.New("snapshot unavailable for parallel iteration")
+
+func (n *node[T]) clone() *node[T] {
+	gen := n.generator
+	if gen != nil {
+		gen = gen.Clone()
+	}
+	return &node[T]{
+		n:         n.n,
+		depth:     n.depth,
+		value:     n.value,
+		generator: gen,
+		cumuOpts:  n.cumuOpts,
+		weight:    n.weight,
+		prefix:    n.prefix,
+		sleep:     n.sleep,
+		choice:    n.choice,
+	}
+}
+
+// Snapshot captures the position of the most recent sequential
+// iteration (ForEach, ForEachCheck, ForEachRange and so on) as a
+// sequence of bytes. It may be called from within f.Consume or
+// f.Check, in which case the permutation currently being consumed is
+// regarded as done, or once the iteration has returned, for example
+// after a PermutationChecker has failed. If no iteration has yet
+// happened, the snapshot covers every permutation.
+//
+// The snapshot only records the work which remains, not the state of
+// any OptionGenerator, so it can be passed to ResumePermutations with
+// a freshly constructed OptionGenerator which is identical to the one
+// used to build the receiver. Multi-day runs can thus periodically
+// save snapshots and, should the process die, continue from the most
+// recent one rather than from the first permutation.
+func (p *TypedPermutations[T]) Snapshot() ([]byte, error) {
+	p.cursor.lock.Lock()
+	defer p.cursor.lock.Unlock()
+	if p.cursor.parallel {
+		return nil, ErrSnapshotUnavailable
+	}
+	var worklist []*node[T]
+	switch {
+	case p.cursor.worklist != nil:
+		worklist = *p.cursor.worklist
+	case p.resume != nil:
+		worklist = p.resume
+	default:
+		worklist = []*node[T]{p.root}
+	}
+	// Nodes spilled by WithMemoryBudget are below those in memory.
+	spilled, spilledCount, err := p.cursor.spill.records()
+	if err != nil {
+		return nil, err
+	}
+
+	p.logCheckpoint(worklist, spilled, spilledCount)
+	return encodeSnapshot(spilled, spilledCount, worklist), nil
+}
+
+// encodeSnapshot encodes the position of each of the nodes, following
+// the count records already encoded in spilled.
+func encodeSnapshot[T any](spilled []byte, count int, worklist []*node[T]) []byte {
+	buf := binary.AppendUvarint(nil, snapshotVersion)
+	buf = binary.AppendUvarint(buf, uint64(count+len(worklist)))
+	buf = append(buf, spilled...)
+	return appendNodeRecords(buf, worklist)
+}
+
+// ResumePermutations constructs a Permutations which, when iterated,
+// will only produce the permutations which had not been consumed when
+// the snapshot was taken. gen must be identical to the generator used
+// to construct the Permutations from which the snapshot was taken.
+// Permutation numbers are preserved. Snapshots may be taken from the
+// resumed Permutations too.
+func ResumePermutations(snapshot []byte, gen OptionGenerator) (*Permutations, error) {
+	return ResumeTypedPermutations[interface{}](snapshot, gen)
+}
+
+// ResumeTypedPermutations is the typed equivalent of
+// ResumePermutations.
+func ResumeTypedPermutations[T any](snapshot []byte, gen TypedOptionGenerator[T]) (*TypedPermutations[T], error) {
+	return BuildTypedPermutations(gen).resumeSnapshot(snapshot)
+}
+
+// resumeSnapshot returns a copy of the receiver, with the same
+// options, which resumes from the snapshot.
+func (p *TypedPermutations[T]) resumeSnapshot(snapshot []byte) (*TypedPermutations[T], error) {
+	readUvarint := func() (uint64, error) {
+		v, l := binary.Uvarint(snapshot)
+		if l <= 0 {
+			return 0, errors.New("corrupt snapshot")
+		}
+		snapshot = snapshot[l:]
+		return v, nil
+	}
+
+	version, err := readUvarint()
+	if err != nil {
+		return nil, err
+	} else if version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %v", version)
+	}
+	count, err := readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	resume := make([]*node[T], 0, count)
+	for ; count > 0; count-- {
+		n, depth, rest, err := readNodeRecord(snapshot)
+		if err != nil {
+			return nil, errors.New("corrupt snapshot")
+		}
+		snapshot = rest
+		resumed, err := p.replayNode(n, depth)
+		if err != nil {
+			return nil, err
+		}
+		resume = append(resume, resumed)
+	}
+	if len(snapshot) != 0 {
+		return nil, errors.New("corrupt snapshot")
+	}
+	return p.with(func(p2 *TypedPermutations[T]) { p2.resume = resume }), nil
+}
+
+// replayNode rebuilds the worklist node with the given number and
+// depth by replaying choices from the root.
+func (p *TypedPermutations[T]) replayNode(n *big.Int, depth int) (*node[T], error) {
+	remaining := new(big.Int).Set(n)
+	choiceBig := new(big.Int)
+	cumuOpts := p.root.cumuOpts
+	weight := p.root.weight
+	prefix := make([]T, 1, depth+1)
+	prefix[0] = p.root.value
+	path := make([]T, 0, depth)
+
+	gen := p.root.generator.Clone()
+	val := p.root.value
+	for d := 0; d < depth; d++ {
+		options, _ := p.generate(gen, val, path)
+		optionCount := len(options)
+		if optionCount == 0 {
+			return nil, fmt.Errorf("permutation %v does not reach depth %v", n, depth)
+		}
+		choiceBig.SetInt64(int64(optionCount))
+		remaining.QuoRem(remaining, choiceBig, choiceBig)
+		cumuOpts = new(big.Int).Mul(cumuOpts, big.NewInt(int64(optionCount)))
+		weight /= float64(optionCount)
+		val = options[int(choiceBig.Int64())]
+		gen = gen.Clone()
+		path = append(path, val)
+		if d+1 < depth {
+			prefix = append(prefix, val)
+		}
+	}
+	if remaining.Sign() != 0 {
+		return nil, fmt.Errorf("%v is not a valid permutation number at depth %v", n, depth)
+	}
+	if depth == 0 {
+		prefix = nil
+	}
+	return &node[T]{
+		n:         n,
+		depth:     depth,
+		value:     val,
+		generator: gen,
+		cumuOpts:  cumuOpts,
+		weight:    weight,
+		prefix:    prefix,
+	}, nil
+}
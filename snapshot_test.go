@@ -0,0 +1,68 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestSnapshotResume(t *testing.T) {
+	start := diamonds(4)
+	p := BuildPermutations(NewGraphPermutation(start...))
+	all := newCollector()
+	p.ForEach(all)
+
+	var snapshot []byte
+	stop := errors.New("stop")
+	seen := 0
+	err := p.ForEachCheck(checkerFunc(func(n *big.Int, perm []interface{}) error {
+		if seen++; seen == 5 {
+			var err error
+			if snapshot, err = p.Snapshot(); err != nil {
+				return err
+			}
+			return stop
+		}
+		return nil
+	}))
+	if !errors.Is(err, stop) {
+		t.Fatal(err)
+	}
+	resumed, err := ResumePermutations(snapshot, NewGraphPermutation(start...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := newCollector()
+	resumed.ForEach(got)
+	checkPerms(t, *got.perms, (*all.perms)[5:])
+	for idx, n := range *got.nums {
+		if want := (*all.nums)[idx+5]; n.Cmp(want) != 0 {
+			t.Fatalf("permutation %d is numbered %v, want %v", idx, n, want)
+		}
+	}
+
+	// A snapshot taken before iteration covers every permutation.
+	snapshot, err = BuildPermutations(NewGraphPermutation(start...)).Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed, err = ResumePermutations(snapshot, NewGraphPermutation(start...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPerms(t, collect(resumed), *all.perms)
+
+	if _, err := ResumePermutations([]byte{0xff}, NewGraphPermutation(start...)); err == nil {
+		t.Fatal("corrupt snapshot resumed without error")
+	}
+}
+
+func TestSnapshotUnavailableAfterForEachPar(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3}))
+	if err := p.ForEachPar(2, newCollector()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Snapshot(); !errors.Is(err, ErrSnapshotUnavailable) {
+		t.Fatalf("got %v, want %v", err, ErrSnapshotUnavailable)
+	}
+}
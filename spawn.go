@@ -0,0 +1,96 @@
+package gsim
+
+// A VisitHook is called each time the node it is set on is chosen,
+// with the node, the nodes chosen so far (including the node itself),
+// and a Spawn through which new nodes can be created. It allows
+// models in which an event causes further events whose identity is
+// not known statically, such as a request which fans out to a
+// data-dependent number of sub-requests. It must be deterministic.
+type VisitHook func(gn *GraphNode, visited VisitedSet, spawn *Spawn)
+
+// Spawn creates new nodes from within a VisitHook. The new nodes
+// exist only in the permutations which follow the visit: they are
+// not added to the graph, so other permutations are unaffected. The
+// new nodes which have no incoming edges from other new nodes become
+// available immediately; the others become available as usual,
+// according to their callbacks. New nodes may themselves have
+// VisitHooks.
+//
+// Once the VisitHook has returned, the new nodes must not be
+// modified.
+type Spawn struct {
+	nodes  []*GraphNode
+	closed bool
+}
+
+// Node creates a new node with the given value.
+func (s *Spawn) Node(value interface{}) *GraphNode {
+	if s.closed {
+		panic("Spawn used after its VisitHook has returned")
+	}
+	gn := NewGraphNode(value)
+	s.nodes = append(s.nodes, gn)
+	return gn
+}
+
+// AddEdge adds an edge from a new node to another node, which may be
+// new, or may be an existing node of the graph. Edges from existing
+// nodes to new nodes cannot be added. An edge to an existing node
+// is recorded only in the Out field of the new node, so the existing
+// node's In field is not modified.
+func (s *Spawn) AddEdge(from, to *GraphNode) {
+	if s.closed {
+		panic("Spawn used after its VisitHook has returned")
+	}
+	if !containsGraphNode(s.nodes, from) {
+		panic("Spawn.AddEdge from a node not created by this Spawn: " + from.String())
+	}
+	if containsGraphNode(s.nodes, to) {
+		from.AddEdgeTo(to)
+	} else if !containsGraphNode(from.Out, to) {
+		from.Out = append(from.Out, to)
+	}
+}
+
+// OnVisit sets the hook to be called whenever the receiver is chosen.
+// A nil hook removes it. Graphs with hooks must not be used with
+// WithIndependence, as future spawned nodes cannot be predicted, and
+// hooks are not saved by WriteDOT or WriteGraphJSON, nor seen by
+// ValidateGraph.
+func (gn *GraphNode) OnVisit(hook VisitHook) {
+	gn.onVisit = hook
+}
+
+// spawn calls the hook of gn, which has just been chosen, and makes
+// available the new nodes with no incoming edges.
+func (gp *graphPermutation) spawn(gn *GraphNode) {
+	s := &Spawn{}
+	gn.onVisit(gn, gp, s)
+	s.closed = true
+	for _, gn2 := range s.nodes {
+		id := gp.id(gn2, true)
+		if len(gn2.In) != 0 {
+			continue
+		}
+		gp.nodeState.set(gp, id, &graphNodeState{
+			GraphNode:       gn2,
+			id:              id,
+			permutation:     gp,
+			available:       true,
+			incomingVisited: []*GraphNode{},
+			time:            gp.clock,
+		})
+		gp.current = append(gp.current, gn2)
+	}
+}
+
+// allNodes returns every node of the graph, followed by every node
+// spawned so far, in order of id.
+func (gp *graphPermutation) allNodes() []*GraphNode {
+	gp.init()
+	if len(gp.spawned) == 0 {
+		return gp.graph.nodes
+	}
+	nodes := make([]*GraphNode, 0, len(gp.graph.nodes)+len(gp.spawned))
+	return append(append(nodes, gp.graph.nodes...), gp.spawned...)
+}
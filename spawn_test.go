@@ -0,0 +1,27 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestOnVisitSpawnsNodes(t *testing.T) {
+	g := nodes("req", "x")
+	g[0].OnVisit(func(gn *GraphNode, visited VisitedSet, spawn *Spawn) {
+		if !visited.Visited(gn) {
+			t.Error("hook called before its node is visited")
+		}
+		sub1, sub2 := spawn.Node("sub1"), spawn.Node("sub2")
+		spawn.AddEdge(sub1, sub2)
+	})
+	checkPerms(t, collectSorted(BuildPermutations(NewGraphPermutation(g...))), []string{
+		"req sub1 sub2 x",
+		"req sub1 x sub2",
+		"req x sub1 sub2",
+		"x req sub1 sub2",
+	})
+
+	// The spawned nodes do not leak into the graph.
+	if len(g[0].Out) != 0 {
+		t.Fatalf("req has edges to %v", g[0].Out)
+	}
+}
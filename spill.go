@@ -0,0 +1,196 @@
+package gsim
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"os"
+)
+
+// worklistNodeBytes is a rough estimate of the memory held by each
+// node of a worklist, including its clone of the OptionGenerator,
+// used to turn the budget given to WithMemoryBudget into a number of
+// nodes.
+const worklistNodeBytes = 512
+
+// WithMemoryBudget returns a copy of the receiver which bounds the
+// memory held by the worklist of nodes waiting to be explored to
+// roughly the given number of bytes. Trees which are broad rather
+// than deep can otherwise make the worklist grow without bound. Once
+// the budget is exceeded, the nodes which would be explored last are
+// written to a temporary file in dir (or os.TempDir if dir is empty),
+// in the same compact form as Snapshot uses, and are read back once
+// the nodes still in memory have been explored. The file is removed
+// when iteration returns.
+//
+// Nodes read back are rebuilt by replaying choices from a fresh Clone
+// of the root OptionGenerator, as with ResumePermutations, so each
+// costs a Generate call per level of its depth; they also lose their
+// sleep sets (see WithSleepSets), so may yield permutations which
+// would otherwise have been skipped as equivalent. The budget applies
+// to ForEach, ForEachPar and the other functions which walk the tree
+// from a single go-routine, but not to ForEachParGen, nor to walks
+// merged by WithStateMerging. A budget of 0 removes the bound.
+func (p *TypedPermutations[T]) WithMemoryBudget(bytes int64, dir string) *TypedPermutations[T] {
+	return p.with(func(p2 *TypedPermutations[T]) {
+		p2.memoryBudget = bytes
+		p2.spillDir = dir
+	})
+}
+
+// worklistSpill holds the bottom of a walk's worklist in a temporary
+// file. The nodes are written in chunks, each of which is spilled from
+// the worklist as it exceeds maxNodes. Nodes spilled later were pushed
+// later, and so are explored earlier: the file, read from the start,
+// is therefore in worklist order, and chunks are read back from the
+// end.
+type worklistSpill[T any] struct {
+	p        *TypedPermutations[T]
+	maxNodes int
+	file     *os.File
+	chunks   []spillChunk
+	// size is the length of the file in use: the end of the last
+	// chunk.
+	size int64
+	// retained holds the records of the file, and count their number,
+	// once the walk has returned and the file has been removed.
+	retained []byte
+	count    int
+}
+
+type spillChunk struct {
+	offset int64
+	count  int
+}
+
+// newWorklistSpill returns a worklistSpill for a walk of p, or nil if
+// p has no memory budget.
+func newWorklistSpill[T any](p *TypedPermutations[T]) *worklistSpill[T] {
+	if p.memoryBudget <= 0 {
+		return nil
+	}
+	maxNodes := int(p.memoryBudget / worklistNodeBytes)
+	if maxNodes < 2 {
+		maxNodes = 2
+	}
+	return &worklistSpill[T]{p: p, maxNodes: maxNodes}
+}
+
+// spill writes the older half of the worklist to the file, if it
+// holds more than maxNodes, returning the nodes which remain. Spilled
+// nodes are released to the arena.
+func (ws *worklistSpill[T]) spill(worklist []*node[T], arena *walkArena[T]) ([]*node[T], error) {
+	if len(worklist) <= ws.maxNodes {
+		return worklist, nil
+	}
+	if ws.file == nil {
+		file, err := os.CreateTemp(ws.p.spillDir, "gsim-worklist-*")
+		if err != nil {
+			return worklist, err
+		}
+		ws.file = file
+	}
+	half := len(worklist) / 2
+	buf := appendNodeRecords(nil, worklist[:half])
+	if _, err := ws.file.WriteAt(buf, ws.size); err != nil {
+		return worklist, err
+	}
+	ws.chunks = append(ws.chunks, spillChunk{offset: ws.size, count: half})
+	ws.size += int64(len(buf))
+	ws.count += half
+	for _, n := range worklist[:half] {
+		arena.release(n, true)
+	}
+	kept := copy(worklist, worklist[half:])
+	clear(worklist[kept:])
+	return worklist[:kept], nil
+}
+
+// refill reads back the most recently spilled chunk, appending its
+// nodes to the worklist, which must be empty. It reports false if
+// nothing remains spilled.
+func (ws *worklistSpill[T]) refill(worklist []*node[T]) ([]*node[T], bool, error) {
+	if ws == nil || len(ws.chunks) == 0 {
+		return worklist, false, nil
+	}
+	chunk := ws.chunks[len(ws.chunks)-1]
+	buf := make([]byte, ws.size-chunk.offset)
+	if _, err := ws.file.ReadAt(buf, chunk.offset); err != nil {
+		return worklist, false, err
+	}
+	for count := chunk.count; count > 0; count-- {
+		n, depth, rest, err := readNodeRecord(buf)
+		if err != nil {
+			return worklist, false, err
+		}
+		buf = rest
+		resumed, err := ws.p.replayNode(n, depth)
+		if err != nil {
+			return worklist, false, err
+		}
+		worklist = append(worklist, resumed)
+	}
+	ws.chunks = ws.chunks[:len(ws.chunks)-1]
+	ws.size = chunk.offset
+	ws.count -= chunk.count
+	return worklist, true, nil
+}
+
+// records returns the encoded records of every spilled node, in
+// worklist order, along with their number.
+func (ws *worklistSpill[T]) records() ([]byte, int, error) {
+	if ws == nil {
+		return nil, 0, nil
+	} else if ws.file == nil {
+		return ws.retained, ws.count, nil
+	}
+	buf := make([]byte, ws.size)
+	if _, err := ws.file.ReadAt(buf, 0); err != nil {
+		return nil, 0, err
+	}
+	return buf, ws.count, nil
+}
+
+// close removes the file, first reading into memory any records it
+// still holds, which Snapshot needs if the walk returned early.
+func (ws *worklistSpill[T]) close() {
+	if ws == nil || ws.file == nil {
+		return
+	}
+	ws.retained, ws.count, _ = ws.records()
+	ws.file.Close()
+	os.Remove(ws.file.Name())
+	ws.file = nil
+	ws.chunks = nil
+	ws.size = 0
+}
+
+// appendNodeRecords appends to buf the position of each of the nodes:
+// its depth and number.
+func appendNodeRecords[T any](buf []byte, nodes []*node[T]) []byte {
+	for _, n := range nodes {
+		buf = binary.AppendUvarint(buf, uint64(n.depth))
+		nBytes := n.n.Bytes()
+		buf = binary.AppendUvarint(buf, uint64(len(nBytes)))
+		buf = append(buf, nBytes...)
+	}
+	return buf
+}
+
+// readNodeRecord decodes the record at the start of buf, as written
+// by appendNodeRecords, returning the node's number and depth, and
+// the remainder of buf.
+func readNodeRecord(buf []byte) (*big.Int, int, []byte, error) {
+	corrupt := errors.New("corrupt node record")
+	depth, l := binary.Uvarint(buf)
+	if l <= 0 {
+		return nil, 0, nil, corrupt
+	}
+	buf = buf[l:]
+	nLen, l := binary.Uvarint(buf)
+	if l <= 0 || uint64(len(buf)-l) < nLen {
+		return nil, 0, nil, corrupt
+	}
+	buf = buf[l:]
+	return new(big.Int).SetBytes(buf[:nLen]), int(depth), buf[nLen:], nil
+}
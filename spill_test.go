@@ -0,0 +1,56 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+)
+
+func TestWithMemoryBudget(t *testing.T) {
+	dir := t.TempDir()
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5, 6}))
+	all := newCollector()
+	p.ForEach(all)
+	budgeted := p.WithMemoryBudget(4*worklistNodeBytes, dir)
+
+	got := newCollector()
+	budgeted.ForEach(got)
+	checkPerms(t, *got.perms, *all.perms)
+	for n, perm := range got.numbered() {
+		if all.numbered()[n] != perm {
+			t.Fatalf("%q numbered %s", perm, n)
+		}
+	}
+	par := newCollector()
+	if err := budgeted.WithWorkers(2).ForEachPar(8, par); err != nil {
+		t.Fatal(err)
+	}
+	checkPerms(t, par.sorted(), all.sorted())
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("left %v behind: %v", entries, err)
+	}
+
+	// A Snapshot includes the nodes spilled.
+	var snapshot []byte
+	stop := errors.New("stop")
+	seen := 0
+	err := budgeted.ForEachCheck(checkerFunc(func(n *big.Int, perm []interface{}) error {
+		if seen++; seen == 100 {
+			var err error
+			if snapshot, err = budgeted.Snapshot(); err != nil {
+				return err
+			}
+			return stop
+		}
+		return nil
+	}))
+	if !errors.Is(err, stop) {
+		t.Fatal(err)
+	}
+	resumed, err := ResumePermutations(snapshot, NewSimplePermutation([]interface{}{1, 2, 3, 4, 5, 6}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPerms(t, collect(resumed), (*all.perms)[100:])
+}
@@ -0,0 +1,131 @@
+package gsim
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// A TypedSimulation is a user-defined state threaded through the
+// generation of permutations by Simulate, such as the balances of
+// accounts, which decides which options may be chosen.
+type TypedSimulation[S, T any] struct {
+	// Initial is the state before any option has been chosen.
+	Initial S
+	// Update returns the state after chosen. It must not modify state,
+	// which is shared with other prefixes: states must be treated as
+	// values.
+	Update func(state S, chosen T) S
+	// Guard reports whether option may be chosen in state. If nil,
+	// every option may be.
+	Guard func(state S, option T) bool
+	// Key, if not nil, returns a canonical encoding of state: equal
+	// states must have equal keys. See Simulate.
+	Key func(state S) []byte
+}
+
+// simulation is the OptionGenerator returned by Simulate.
+type simulation[S, T any] struct {
+	sim     *TypedSimulation[S, T]
+	gen     TypedOptionGenerator[T]
+	started bool
+	state   S
+}
+
+// keyedSimulation is the OptionGenerator returned by Simulate when
+// states can be keyed.
+type keyedSimulation[S, T any] struct {
+	*simulation[S, T]
+}
+
+// Simulate returns an OptionGenerator which threads the state of sim
+// through the generation of gen's options: after each option is
+// chosen the state is updated, and then the options of gen which
+// sim's Guard vetoes are withheld. A vetoed option is offered again
+// once the state allows it, so data-dependent constraints, such as
+// "withdraw only if the balance is positive", are enforced during
+// generation rather than by filtering permutations afterwards. Should
+// every option be vetoed, the permutation ends there, as if gen were
+// exhausted.
+//
+// If gen implements StateKeyer (as graphs do) and sim has a Key, the
+// generator returned implements StateKeyer and StateHasher too, over
+// both gen's state and sim's, so that WithStateMerging and
+// WithStateDeduplication share the subtrees of prefixes which reach
+// the same state.
+func Simulate[S, T any](gen TypedOptionGenerator[T], sim TypedSimulation[S, T]) TypedOptionGenerator[T] {
+	s := &simulation[S, T]{sim: &sim, gen: gen, state: sim.Initial}
+	if _, ok := gen.(StateKeyer); ok && sim.Key != nil {
+		return &keyedSimulation[S, T]{simulation: s}
+	}
+	return s
+}
+
+// State returns the current state of the simulation, if gen was
+// returned by Simulate with a TypedSimulation of S. It is intended
+// for use by WithPrune and the like.
+func State[S, T any](gen TypedOptionGenerator[T]) (state S, ok bool) {
+	switch s := gen.(type) {
+	case *simulation[S, T]:
+		return s.state, true
+	case *keyedSimulation[S, T]:
+		return s.state, true
+	}
+	return state, false
+}
+
+func (s *simulation[S, T]) clone() *simulation[S, T] {
+	return &simulation[S, T]{
+		sim:     s.sim,
+		gen:     s.gen.Clone(),
+		started: s.started,
+		state:   s.state,
+	}
+}
+
+func (s *simulation[S, T]) Clone() TypedOptionGenerator[T] {
+	return s.clone()
+}
+
+func (s *simulation[S, T]) Generate(lastChosen T) []T {
+	if s.started {
+		s.state = s.sim.Update(s.state, lastChosen)
+	}
+	s.started = true
+	options := s.gen.Generate(lastChosen)
+	if s.sim.Guard == nil {
+		return options
+	}
+	for idx, option := range options {
+		if s.sim.Guard(s.state, option) {
+			continue
+		}
+		kept := make([]T, idx, len(options)-1)
+		copy(kept, options[:idx])
+		for _, option := range options[idx+1:] {
+			if s.sim.Guard(s.state, option) {
+				kept = append(kept, option)
+			}
+		}
+		return kept
+	}
+	return options
+}
+
+func (ks *keyedSimulation[S, T]) Clone() TypedOptionGenerator[T] {
+	return &keyedSimulation[S, T]{simulation: ks.clone()}
+}
+
+// StateKey encodes the wrapped generator's key, length prefixed, and
+// then the simulation's.
+func (ks *keyedSimulation[S, T]) StateKey() []byte {
+	genKey := ks.gen.(StateKeyer).StateKey()
+	key := binary.AppendUvarint(nil, uint64(len(genKey)))
+	key = append(key, genKey...)
+	return append(key, ks.sim.Key(ks.state)...)
+}
+
+func (ks *keyedSimulation[S, T]) StateHash() uint64 {
+	h := fnv.New64a()
+	h.Write(ks.StateKey())
+	return h.Sum64()
+}
@@ -0,0 +1,59 @@
+package gsim
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// balance is a simulation of a balance which deposits (named d*)
+// increase and withdrawals (named w*) decrease, and which must not
+// be overdrawn.
+func balance(keyed bool) TypedSimulation[int, interface{}] {
+	sim := TypedSimulation[int, interface{}]{
+		Update: func(balance int, chosen interface{}) int {
+			if strings.HasPrefix(chosen.(*GraphNode).Value.(string), "d") {
+				return balance + 1
+			}
+			return balance - 1
+		},
+		Guard: func(balance int, option interface{}) bool {
+			return balance > 0 || strings.HasPrefix(option.(*GraphNode).Value.(string), "d")
+		},
+	}
+	if keyed {
+		sim.Key = func(balance int) []byte { return binary.AppendVarint(nil, int64(balance)) }
+	}
+	return sim
+}
+
+func TestSimulate(t *testing.T) {
+	want := []string{
+		"d1 d2 w1 w2", "d1 d2 w2 w1", "d1 w1 d2 w2", "d1 w2 d2 w1",
+		"d2 d1 w1 w2", "d2 d1 w2 w1", "d2 w1 d1 w2", "d2 w2 d1 w1",
+	}
+	for _, keyed := range []bool{false, true} {
+		p := BuildPermutations(Simulate(NewGraphPermutation(nodes("d1", "d2", "w1", "w2")...), balance(keyed)))
+		checkPerms(t, collectSorted(p), want)
+		if keyed {
+			if _, ok := p.root.generator.(StateKeyer); !ok {
+				t.Fatal("keyed simulation of a graph is not a StateKeyer")
+			}
+			checkPerms(t, collectSorted(p.WithStateMerging()), want)
+		}
+	}
+
+	// State follows the options chosen.
+	gen := Simulate(NewGraphPermutation(nodes("d1", "d2", "w1", "w2")...), balance(false))
+	options := gen.Generate(nil)
+	if balance, ok := State[int, interface{}](gen); !ok || balance != 0 || len(options) != 2 {
+		t.Fatalf("initially, balance %d (%v) with options %q", balance, ok, permString(options))
+	}
+	gen.Generate(options[0])
+	if balance, _ := State[int, interface{}](gen); balance != 1 {
+		t.Fatalf("after a deposit, balance %d", balance)
+	}
+	if _, ok := State[int, interface{}](NewGraphPermutation(nodes("d1")...)); ok {
+		t.Fatal("a graph has a state")
+	}
+}
@@ -0,0 +1,100 @@
+package gsim
+
+const (
+	stateTrieBits  = 4
+	stateTrieWidth = 1 << stateTrieBits
+	stateTrieMask  = stateTrieWidth - 1
+)
+
+// nodeStates is a persistent vector of node states, indexed by node
+// id. It is a trie of fixed width: copying a nodeStates is enough to
+// clone it, and setting a state copies only the path from the root
+// to the state, so both are O(log n). Like the states themselves,
+// the trie nodes are owned by a graphPermutation, which modifies its
+// own nodes in place.
+type nodeStates struct {
+	root  *stateTrie
+	shift uint
+	len   int
+}
+
+// stateTrie is a node of a nodeStates trie. Interior nodes use
+// children; leaves use states.
+type stateTrie struct {
+	owner    *graphPermutation
+	children [stateTrieWidth]*stateTrie
+	states   [stateTrieWidth]*graphNodeState
+}
+
+// local returns st, or a copy of it owned by owner if it belongs to
+// another graphPermutation.
+func (st *stateTrie) local(owner *graphPermutation) *stateTrie {
+	if st.owner == owner {
+		return st
+	}
+	st2 := *st
+	st2.owner = owner
+	return &st2
+}
+
+// newNodeStates creates a nodeStates of the given length, holding
+// only nils.
+func newNodeStates(owner *graphPermutation, length int) nodeStates {
+	ns := nodeStates{root: &stateTrie{owner: owner}}
+	for ns.capacity() < length {
+		ns.deepen(owner)
+	}
+	ns.len = length
+	return ns
+}
+
+func (ns *nodeStates) capacity() int {
+	return stateTrieWidth << ns.shift
+}
+
+// deepen adds a new root above the existing one.
+func (ns *nodeStates) deepen(owner *graphPermutation) {
+	root := &stateTrie{owner: owner}
+	root.children[0] = ns.root
+	ns.root = root
+	ns.shift += stateTrieBits
+}
+
+// get returns the state with the given id, or nil.
+func (ns *nodeStates) get(id int) *graphNodeState {
+	st := ns.root
+	for shift := ns.shift; shift > 0; shift -= stateTrieBits {
+		if st = st.children[(id>>shift)&stateTrieMask]; st == nil {
+			return nil
+		}
+	}
+	return st.states[id&stateTrieMask]
+}
+
+// set sets the state with the given id, copying the trie nodes on the
+// path to it which are not owned by owner.
+func (ns *nodeStates) set(owner *graphPermutation, id int, gns *graphNodeState) {
+	ns.root = ns.root.local(owner)
+	st := ns.root
+	for shift := ns.shift; shift > 0; shift -= stateTrieBits {
+		idx := (id >> shift) & stateTrieMask
+		child := st.children[idx]
+		if child == nil {
+			child = &stateTrie{owner: owner}
+		} else {
+			child = child.local(owner)
+		}
+		st.children[idx] = child
+		st = child
+	}
+	st.states[id&stateTrieMask] = gns
+}
+
+// grow appends a nil state, returning its id.
+func (ns *nodeStates) grow(owner *graphPermutation) int {
+	if ns.len == ns.capacity() {
+		ns.deepen(owner)
+	}
+	ns.len++
+	return ns.len - 1
+}
@@ -0,0 +1,44 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestNodeStatesCopyOnWrite(t *testing.T) {
+	gp1, gp2 := &graphPermutation{}, &graphPermutation{}
+	ns := newNodeStates(gp1, 3)
+	states := make([]*graphNodeState, 300)
+	for id := range states {
+		if id >= ns.len {
+			if got := ns.grow(gp1); got != id {
+				t.Fatalf("grow returned %d, want %d", got, id)
+			}
+		}
+		if ns.get(id) != nil {
+			t.Fatalf("state %d is set before being set", id)
+		}
+		states[id] = &graphNodeState{id: id}
+		ns.set(gp1, id, states[id])
+	}
+
+	// A copy shares the trie until it is set by another owner.
+	ns2 := ns
+	replaced := &graphNodeState{id: 42}
+	ns2.set(gp2, 42, replaced)
+	ns2.set(gp2, 7, nil)
+	for id, gns := range states {
+		want, want2 := gns, gns
+		switch id {
+		case 42:
+			want2 = replaced
+		case 7:
+			want2 = nil
+		}
+		if got := ns.get(id); got != want {
+			t.Fatalf("original state %d is %v, want %v", id, got, want)
+		}
+		if got := ns2.get(id); got != want2 {
+			t.Fatalf("copied state %d is %v, want %v", id, got, want2)
+		}
+	}
+}
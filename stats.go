@@ -0,0 +1,167 @@
+package gsim
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// StatsConsumer is a PermutationConsumer, for permutations of a
+// graph, which records which nodes, edges and ordered pairs of nodes
+// have appeared across all the permutations it consumes, so that the
+// coverage of the graph can be reported. This is essential when
+// sampling, rather than exhausting, the permutation space. A node is
+// covered once it appears in a permutation; an edge once its source
+// appears before its target in the same permutation; and an ordered
+// pair (a, b) once a appears immediately before b.
+//
+// Clones accumulate separately, and Coverage combines them, so a
+// StatsConsumer may be used with the parallel iteration functions.
+// Coverage must not be called until iteration has finished.
+type StatsConsumer struct {
+	shared *statsShared
+	stats  *statsCounts
+}
+
+type statsShared struct {
+	lock  sync.Mutex
+	nodes []*GraphNode
+	index map[*GraphNode]int
+	edges int
+	all   []*statsCounts
+}
+
+type statsCounts struct {
+	permutations uint64
+	nodes        map[int]bool
+	edges        map[[2]int]bool
+	pairs        map[[2]int]bool
+}
+
+// Coverage is the report produced by StatsConsumer.
+type Coverage struct {
+	Permutations uint64
+	// Nodes is the number of nodes covered, out of TotalNodes
+	// reachable from the starting nodes.
+	Nodes, TotalNodes int
+	// Edges is the number of edges covered, out of TotalEdges between
+	// reachable nodes.
+	Edges, TotalEdges int
+	// Pairs is the number of ordered pairs of distinct nodes covered,
+	// out of TotalPairs possible (not all of which may be feasible).
+	Pairs, TotalPairs int
+	// Uncovered holds the reachable nodes which were never covered.
+	Uncovered []*GraphNode
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// NodePercent returns the percentage of nodes covered.
+func (c *Coverage) NodePercent() float64 { return percent(c.Nodes, c.TotalNodes) }
+
+// EdgePercent returns the percentage of edges covered.
+func (c *Coverage) EdgePercent() float64 { return percent(c.Edges, c.TotalEdges) }
+
+// PairPercent returns the percentage of ordered pairs covered.
+func (c *Coverage) PairPercent() float64 { return percent(c.Pairs, c.TotalPairs) }
+
+func (c *Coverage) String() string {
+	return fmt.Sprintf("%d permutations; nodes %d/%d (%.1f%%); edges %d/%d (%.1f%%); pairs %d/%d (%.1f%%)",
+		c.Permutations, c.Nodes, c.TotalNodes, c.NodePercent(), c.Edges, c.TotalEdges, c.EdgePercent(),
+		c.Pairs, c.TotalPairs, c.PairPercent())
+}
+
+// NewStatsConsumer creates a StatsConsumer for the graph reachable
+// from the starting nodes.
+func NewStatsConsumer(start ...*GraphNode) *StatsConsumer {
+	nodes := reachableGraphNodes(start...)
+	shared := &statsShared{
+		nodes: nodes,
+		index: make(map[*GraphNode]int, len(nodes)),
+	}
+	for idx, gn := range nodes {
+		shared.index[gn] = idx
+	}
+	for _, gn := range nodes {
+		shared.edges += len(gn.Out)
+	}
+	return shared.newConsumer()
+}
+
+func (ss *statsShared) newConsumer() *StatsConsumer {
+	stats := &statsCounts{
+		nodes: make(map[int]bool),
+		edges: make(map[[2]int]bool),
+		pairs: make(map[[2]int]bool),
+	}
+	ss.lock.Lock()
+	ss.all = append(ss.all, stats)
+	ss.lock.Unlock()
+	return &StatsConsumer{shared: ss, stats: stats}
+}
+
+func (sc *StatsConsumer) Clone() PermutationConsumer {
+	return sc.shared.newConsumer()
+}
+
+func (sc *StatsConsumer) Consume(n *big.Int, perm []interface{}) {
+	stats := sc.stats
+	stats.permutations++
+	index := sc.shared.index
+	seen := make(map[*GraphNode]bool, len(perm))
+	prev := -1
+	for _, elem := range perm {
+		gn := elem.(*GraphNode)
+		cur := index[gn]
+		stats.nodes[cur] = true
+		for _, in := range gn.In {
+			if seen[in] {
+				stats.edges[[2]int{index[in], cur}] = true
+			}
+		}
+		if prev != -1 && prev != cur {
+			stats.pairs[[2]int{prev, cur}] = true
+		}
+		seen[gn] = true
+		prev = cur
+	}
+}
+
+// Coverage combines the statistics of the receiver and all its
+// clones.
+func (sc *StatsConsumer) Coverage() *Coverage {
+	sc.shared.lock.Lock()
+	defer sc.shared.lock.Unlock()
+	nodes := make(map[int]bool)
+	edges := make(map[[2]int]bool)
+	pairs := make(map[[2]int]bool)
+	coverage := &Coverage{
+		TotalNodes: len(sc.shared.nodes),
+		TotalEdges: sc.shared.edges,
+		TotalPairs: len(sc.shared.nodes) * (len(sc.shared.nodes) - 1),
+	}
+	for _, stats := range sc.shared.all {
+		coverage.Permutations += stats.permutations
+		for k := range stats.nodes {
+			nodes[k] = true
+		}
+		for k := range stats.edges {
+			edges[k] = true
+		}
+		for k := range stats.pairs {
+			pairs[k] = true
+		}
+	}
+	coverage.Nodes, coverage.Edges, coverage.Pairs = len(nodes), len(edges), len(pairs)
+	for idx, gn := range sc.shared.nodes {
+		if !nodes[idx] {
+			coverage.Uncovered = append(coverage.Uncovered, gn)
+		}
+	}
+	return coverage
+}
@@ -0,0 +1,36 @@
+package gsim
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestStatsConsumer(t *testing.T) {
+	start := egraph()
+	p := BuildPermutations(NewGraphPermutation(start...)).WithWorkers(2)
+	sc := NewStatsConsumer(start...)
+	if err := p.ForEachPar(1, sc); err != nil {
+		t.Fatal(err)
+	}
+	c := sc.Coverage()
+	// E4 can never follow E3, and only 9 of the 12 ordered pairs are
+	// feasible.
+	if c.Permutations != 6 || c.Nodes != 4 || c.TotalNodes != 4 || c.Edges != 4 || c.TotalEdges != 5 ||
+		c.Pairs != 9 || c.TotalPairs != 12 || len(c.Uncovered) != 0 {
+		t.Fatalf("got %+v", c)
+	}
+	if c.EdgePercent() != 80 {
+		t.Fatalf("edge coverage %v%%, want 80%%", c.EdgePercent())
+	}
+
+	sc = NewStatsConsumer(start...)
+	BuildPermutations(NewGraphPermutation(start...)).ForEach(consumerFunc(func(n *big.Int, perm []interface{}) {
+		if len(perm) == 3 {
+			sc.Consume(n, perm)
+		}
+	}))
+	c = sc.Coverage()
+	if c.Permutations != 2 || c.Nodes != 3 || len(c.Uncovered) != 1 || c.Uncovered[0].Value != "E4" {
+		t.Fatalf("got %+v", c)
+	}
+}
@@ -0,0 +1,168 @@
+package gsim
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+)
+
+// StreamFormat selects the format in which a TypedStreamWriter writes
+// permutations.
+type StreamFormat int
+
+const (
+	// StreamJSONLines writes each permutation as a line of JSON: an
+	// object with the permutation number as "n" and the encoded
+	// elements as "perm".
+	StreamJSONLines StreamFormat = iota
+	// StreamCSV writes each permutation as a CSV record: the
+	// permutation number followed by the encoded elements, formatted
+	// with fmt.
+	StreamCSV
+)
+
+// streamFlushSize is the size beyond which a clone's buffer is
+// written out.
+const streamFlushSize = 64 * 1024
+
+// TypedStreamWriter is a TypedPermutationConsumer which writes every
+// permutation to an io.Writer, in a StreamFormat. Each clone buffers
+// what it writes, and writes its buffer out whenever it grows large,
+// so clones may be used with ForEachPar without contending on the
+// io.Writer. Records are never interleaved, but with ForEachPar they
+// are not in order of permutation number. Once iteration has finished
+// Flush must be called to write out what remains buffered.
+type TypedStreamWriter[T any] struct {
+	shared *streamShared
+	format StreamFormat
+	encode func(T) interface{}
+	buf    *bytes.Buffer
+	csv    *csv.Writer
+	fields []string
+	record streamRecord
+}
+
+// StreamWriter is the interface{} instantiation of TypedStreamWriter.
+type StreamWriter = TypedStreamWriter[interface{}]
+
+type streamShared struct {
+	lock   sync.Mutex
+	w      io.Writer
+	err    error
+	clones []*bytes.Buffer
+}
+
+type streamRecord struct {
+	N    *big.Int      `json:"n"`
+	Perm []interface{} `json:"perm"`
+}
+
+// NewStreamWriter creates a StreamWriter. See NewTypedStreamWriter.
+func NewStreamWriter(w io.Writer, format StreamFormat, encode func(interface{}) interface{}) *StreamWriter {
+	return NewTypedStreamWriter(w, format, encode)
+}
+
+// NewTypedStreamWriter creates a TypedStreamWriter which writes to w.
+// encode is applied to every element of each permutation: for
+// StreamJSONLines its result is marshalled with encoding/json, and
+// for StreamCSV it is formatted with fmt. If encode is nil, elements
+// are formatted with fmt, except that GraphNodes are represented by
+// their values.
+func NewTypedStreamWriter[T any](w io.Writer, format StreamFormat, encode func(T) interface{}) *TypedStreamWriter[T] {
+	if encode == nil {
+		encode = stringifyElement[T]
+	}
+	return newStreamWriter(&streamShared{w: w}, format, encode)
+}
+
+func newStreamWriter[T any](shared *streamShared, format StreamFormat, encode func(T) interface{}) *TypedStreamWriter[T] {
+	sw := &TypedStreamWriter[T]{
+		shared: shared,
+		format: format,
+		encode: encode,
+		buf:    new(bytes.Buffer),
+	}
+	if format == StreamCSV {
+		sw.csv = csv.NewWriter(sw.buf)
+	}
+	shared.lock.Lock()
+	shared.clones = append(shared.clones, sw.buf)
+	shared.lock.Unlock()
+	return sw
+}
+
+// stringifyElement is the default encoding of elements.
+func stringifyElement[T any](elem T) interface{} {
+	if gn, ok := interface{}(elem).(*GraphNode); ok {
+		return fmt.Sprint(gn.Value)
+	}
+	return fmt.Sprint(elem)
+}
+
+func (sw *TypedStreamWriter[T]) Clone() TypedPermutationConsumer[T] {
+	return newStreamWriter(sw.shared, sw.format, sw.encode)
+}
+
+func (sw *TypedStreamWriter[T]) Consume(n *big.Int, perm []T) {
+	switch sw.format {
+	case StreamCSV:
+		sw.fields = append(sw.fields[:0], n.String())
+		for _, elem := range perm {
+			sw.fields = append(sw.fields, fmt.Sprint(sw.encode(elem)))
+		}
+		sw.csv.Write(sw.fields)
+		sw.csv.Flush()
+	default:
+		sw.record.N = n
+		sw.record.Perm = sw.record.Perm[:0]
+		for _, elem := range perm {
+			sw.record.Perm = append(sw.record.Perm, sw.encode(elem))
+		}
+		line, err := json.Marshal(&sw.record)
+		if err != nil {
+			sw.shared.fail(err)
+			return
+		}
+		sw.buf.Write(append(line, '\n'))
+	}
+	if sw.buf.Len() >= streamFlushSize {
+		sw.shared.lock.Lock()
+		sw.shared.writeOut(sw.buf)
+		sw.shared.lock.Unlock()
+	}
+}
+
+// Flush writes out everything buffered by the receiver and all its
+// clones, and returns the first error encountered while encoding or
+// writing, if any. It must not be called concurrently with Consume.
+func (sw *TypedStreamWriter[T]) Flush() error {
+	sw.shared.lock.Lock()
+	defer sw.shared.lock.Unlock()
+	for _, buf := range sw.shared.clones {
+		sw.shared.writeOut(buf)
+	}
+	// The clones made for earlier iterations are no longer in use.
+	sw.shared.clones = append(sw.shared.clones[:0], sw.buf)
+	return sw.shared.err
+}
+
+// writeOut writes buf to the io.Writer, and empties it. The lock must
+// be held.
+func (ss *streamShared) writeOut(buf *bytes.Buffer) {
+	if ss.err == nil && buf.Len() != 0 {
+		_, ss.err = ss.w.Write(buf.Bytes())
+	}
+	buf.Reset()
+}
+
+func (ss *streamShared) fail(err error) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	if ss.err == nil {
+		ss.err = err
+	}
+}
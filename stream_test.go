@@ -0,0 +1,71 @@
+package gsim
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestStreamWriterJSONLines(t *testing.T) {
+	p := BuildPermutations(NewGraphPermutation(egraph()...))
+	var buf bytes.Buffer
+	sw := NewStreamWriter(&buf, StreamJSONLines, nil)
+	p.ForEach(sw)
+	if err := sw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := newCollector()
+	p.ForEach(want)
+	got := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		var record struct {
+			N    json.Number
+			Perm []interface{}
+		}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		got[record.N.String()] = permString(record.Perm)
+	}
+	if len(got) != len(*want.perms) {
+		t.Fatalf("wrote %d records, want %d", len(got), len(*want.perms))
+	}
+	for n, perm := range want.numbered() {
+		if got[n] != perm {
+			t.Fatalf("permutation %s written as %q, want %q", n, got[n], perm)
+		}
+	}
+}
+
+func TestStreamWriterCSVWithForEachPar(t *testing.T) {
+	p := BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3, 4, 5, 6})).WithWorkers(4)
+	var buf bytes.Buffer
+	sw := NewStreamWriter(&buf, StreamCSV, func(elem interface{}) interface{} { return elem.(int) * 10 })
+	if err := p.ForEachPar(16, sw); err != nil {
+		t.Fatal(err)
+	}
+	if err := sw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, record := range records {
+		n, ok := new(big.Int).SetString(record[0], 10)
+		if !ok {
+			t.Fatalf("record %q has no permutation number", record)
+		}
+		if perm := permString(p.Permutation(n)); strings.ReplaceAll(strings.Join(record[1:], " "), "0", "") != perm {
+			t.Fatalf("record %q is not permutation %q", record, perm)
+		}
+		seen[record[0]] = true
+	}
+	if len(records) != 720 || len(seen) != 720 {
+		t.Fatalf("wrote %d records, %d distinct, want 720", len(records), len(seen))
+	}
+}
@@ -0,0 +1,34 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestDeclareSymmetric(t *testing.T) {
+	// Two identical clients, each of which connects then sends.
+	g := nodes("c1", "s1", "c2", "s2")
+	g[0].AddEdgeTo(g[1])
+	g[2].AddEdgeTo(g[3])
+	start := []*GraphNode{g[0], g[2]}
+	if n := len(collect(BuildPermutations(NewGraphPermutation(start...)))); n != 6 {
+		t.Fatalf("got %d permutations before reduction, want 6", n)
+	}
+	DeclareSymmetric(g[0], g[2])
+	p := BuildPermutations(NewGraphPermutation(start...))
+	checkPerms(t, collectSorted(p), []string{
+		"c1 c2 s1 s2",
+		"c1 c2 s2 s1",
+		"c1 s1 c2 s2",
+	})
+	if count := p.Count(); count.Int64() != 3 {
+		t.Fatalf("Count is %v, want 3", count)
+	}
+
+	// Declaring the group again, in the other order, replaces it.
+	DeclareSymmetric(g[2], g[0])
+	checkPerms(t, collectSorted(BuildPermutations(NewGraphPermutation(start...))), []string{
+		"c2 c1 s1 s2",
+		"c2 c1 s2 s1",
+		"c2 s2 c1 s1",
+	})
+}
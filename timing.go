@@ -0,0 +1,122 @@
+package gsim
+
+import (
+	"errors"
+	"math"
+)
+
+// AddTimedEdgeTo adds an edge from the receiver to the argument, as
+// AddEdgeTo, which carries a minimum logical delay: the argument
+// cannot be chosen until at least delay units of logical time after
+// the receiver was chosen. Adding the same edge again replaces the
+// delay.
+//
+// Once timing constraints are used, every node chosen in a
+// permutation is given a timestamp. A node is ready at the latest of
+// the times its reached incoming edges permit (starting nodes are
+// ready at time 0), and is chosen at the earliest time which is no
+// earlier than both its readiness and the timestamp of the node chosen
+// before it: logical time never goes backwards. Only permutations
+// consistent with this timing model are generated, which lets
+// timeouts and heartbeat intervals be modelled directly. See also
+// SetDeadline and GraphTimestamps.
+func (gn *GraphNode) AddTimedEdgeTo(gn2 *GraphNode, delay int64) {
+	gn.AddEdgeTo(gn2)
+	if gn2.inDelays == nil {
+		gn2.inDelays = make(map[*GraphNode]int64)
+	}
+	gn2.inDelays[gn] = delay
+}
+
+// SetDeadline declares that the node must be chosen no more than
+// deadline units of logical time after it becomes ready: whilst it is
+// available, no node which becomes ready later than that may be
+// chosen before it. A deadline of 0 makes the node urgent. Without a
+// deadline a node may be delayed indefinitely, so for a node with a
+// timeout, it is the deadlines of the competing nodes which determine
+// whether the timeout can fire.
+func (gn *GraphNode) SetDeadline(deadline int64) {
+	gn.deadline = deadline
+	gn.hasDeadline = true
+}
+
+// isTimed reports whether any node in the graph has timing
+// constraints.
+func (gi *graphInfo) isTimed() bool {
+	gi.build()
+	return gi.timed
+}
+
+// readyTime calculates the earliest time at which gns may be chosen,
+// given the incoming edges it has reached.
+func (gp *graphPermutation) readyTime(gns *graphNodeState) int64 {
+	ready := int64(0)
+	for _, in := range gns.incomingVisited {
+		inState, found := gp.getNodeState(in, false)
+		if !found {
+			continue
+		}
+		if t := inState.time + gns.inDelays[in]; t > ready {
+			ready = t
+		}
+	}
+	return ready
+}
+
+// tick advances the clock as gns, which must be local to gp, is
+// chosen.
+func (gp *graphPermutation) tick(gns *graphNodeState) {
+	if gns.time > gp.clock {
+		gp.clock = gns.time
+	}
+	gns.time = gp.clock
+}
+
+// deadline returns the earliest deadline of any available node.
+func (gp *graphPermutation) deadline() int64 {
+	deadline := int64(math.MaxInt64)
+	for _, node := range gp.current {
+		gn := node.(*GraphNode)
+		if !gn.hasDeadline {
+			continue
+		}
+		if gns, found := gp.getNodeState(gn, false); found {
+			if t := gns.time + gn.deadline; t < deadline {
+				deadline = t
+			}
+		}
+	}
+	return deadline
+}
+
+// timely returns a filter which keeps the nodes which are ready no
+// later than deadline.
+func (gp *graphPermutation) timely(deadline int64) func(*GraphNode) bool {
+	return func(gn *GraphNode) bool {
+		gns, found := gp.getNodeState(gn, false)
+		return found && gns.time <= deadline
+	}
+}
+
+// GraphTimestamps returns the logical timestamp of each node in perm,
+// which must be a permutation (or prefix of one) generated from gen,
+// an OptionGenerator created by NewGraphPermutation. gen itself is
+// not modified.
+func GraphTimestamps(gen OptionGenerator, perm []interface{}) ([]int64, error) {
+	gp, ok := gen.(*graphPermutation)
+	if !ok {
+		return nil, errors.New("not a graph OptionGenerator")
+	}
+	gp = gp.Clone().(*graphPermutation)
+	timestamps := make([]int64, len(perm))
+	options := gp.Generate(nil)
+	for idx, node := range perm {
+		if !containsOption(options, node) {
+			return nil, errors.New("not a permutation of the graph")
+		}
+		gp = gp.Clone().(*graphPermutation)
+		options = gp.Generate(node)
+		timestamps[idx] = gp.clock
+	}
+	return timestamps, nil
+}
@@ -0,0 +1,51 @@
+package gsim
+
+import (
+	"math/big"
+	"testing"
+)
+
+// timeout builds a graph in which a response may arrive 2 units
+// after a request, and a timeout fires 5 units after it.
+func timeout() (request, response, timeout *GraphNode) {
+	g := nodes("request", "response", "timeout")
+	request, response, timeout = g[0], g[1], g[2]
+	request.AddTimedEdgeTo(response, 2)
+	request.AddTimedEdgeTo(timeout, 5)
+	return
+}
+
+func TestTimedEdges(t *testing.T) {
+	request, _, _ := timeout()
+	gen := NewGraphPermutation(request)
+	checkPerms(t, collectSorted(BuildPermutations(gen)), []string{
+		"request response timeout",
+		"request timeout response",
+	})
+	p := BuildPermutations(gen)
+	p.ForEach(consumerFunc(func(n *big.Int, perm []interface{}) {
+		times, err := GraphTimestamps(gen, perm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []int64{0, 2, 5}
+		if perm[1].(*GraphNode).Value == "timeout" {
+			want = []int64{0, 5, 5}
+		}
+		for idx := range want {
+			if times[idx] != want[idx] {
+				t.Fatalf("%q has timestamps %v, want %v", permString(perm), times, want)
+			}
+		}
+	}))
+}
+
+func TestSetDeadline(t *testing.T) {
+	// The response must arrive within 1 unit of becoming ready, so
+	// before the timeout can fire.
+	request, response, _ := timeout()
+	response.SetDeadline(1)
+	checkPerms(t, collect(BuildPermutations(NewGraphPermutation(request))), []string{
+		"request response timeout",
+	})
+}
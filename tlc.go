@@ -0,0 +1,176 @@
+package gsim
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TLCVariable is one variable of a state in a TLC trace. Value must
+// already be formatted as a TLA+ expression; see TLAValue.
+type TLCVariable struct {
+	Name  string
+	Value string
+}
+
+// A TypedTLCStateFunc returns the variables of the state reached
+// after the actions in prefix have been taken. It is called with
+// every prefix of each permutation, including the empty prefix for
+// the initial state.
+type TypedTLCStateFunc[T any] func(prefix []T) []TLCVariable
+
+// TLCStateFunc is the interface{} instantiation of TypedTLCStateFunc.
+type TLCStateFunc = TypedTLCStateFunc[interface{}]
+
+// TypedTLCTraceWriter is a TypedPermutationConsumer which writes each
+// permutation as a behaviour trace in the style of the error traces
+// printed by TLC, the TLA+ model checker: one numbered state per step,
+// each labelled with the action which led to it, and each variable on
+// its own line as a conjunct. Counterexamples found by gsim can thus
+// be cross-checked against a TLA+ specification of the same protocol.
+// Each trace is preceded by a comment giving its permutation number.
+//
+// Traces are written whole, so TypedTLCTraceWriter may be used with
+// ForEachPar: clones share the writer.
+type TypedTLCTraceWriter[T any] struct {
+	shared *tlcShared
+	action func(T) string
+	state  TypedTLCStateFunc[T]
+}
+
+// TLCTraceWriter is the interface{} instantiation of
+// TypedTLCTraceWriter.
+type TLCTraceWriter = TypedTLCTraceWriter[interface{}]
+
+type tlcShared struct {
+	lock sync.Mutex
+	w    *bufio.Writer
+	err  error
+}
+
+// NewTLCTraceWriter creates a TLCTraceWriter writing to w. See
+// NewTypedTLCTraceWriter.
+func NewTLCTraceWriter(w io.Writer, action func(interface{}) string, state TLCStateFunc) *TLCTraceWriter {
+	return NewTypedTLCTraceWriter[interface{}](w, action, state)
+}
+
+// NewTypedTLCTraceWriter creates a TypedTLCTraceWriter writing to w.
+// action names the action for each element of a permutation; if nil,
+// the element is formatted with fmt.Sprint (or, for GraphNodes, their
+// values are). state provides the variables of each state; if nil, a
+// single variable, trace, holds the sequence of action names so far.
+// Call Flush once iteration has finished.
+func NewTypedTLCTraceWriter[T any](w io.Writer, action func(T) string, state TypedTLCStateFunc[T]) *TypedTLCTraceWriter[T] {
+	tw := &TypedTLCTraceWriter[T]{
+		shared: &tlcShared{w: bufio.NewWriter(w)},
+		action: action,
+		state:  state,
+	}
+	if tw.action == nil {
+		tw.action = func(v T) string {
+			if gn, ok := interface{}(v).(*GraphNode); ok {
+				return fmt.Sprint(gn.Value)
+			}
+			return fmt.Sprint(v)
+		}
+	}
+	if tw.state == nil {
+		tw.state = func(prefix []T) []TLCVariable {
+			names := make([]interface{}, len(prefix))
+			for idx, v := range prefix {
+				names[idx] = tw.action(v)
+			}
+			return []TLCVariable{{Name: "trace", Value: TLAValue(names)}}
+		}
+	}
+	return tw
+}
+
+func (tw *TypedTLCTraceWriter[T]) Clone() TypedPermutationConsumer[T] {
+	return tw
+}
+
+func (tw *TypedTLCTraceWriter[T]) Consume(n *big.Int, perm []T) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\\* Permutation %v\n", n)
+	for idx := 0; idx <= len(perm); idx++ {
+		if idx == 0 {
+			sb.WriteString("State 1: <Initial predicate>\n")
+		} else {
+			fmt.Fprintf(&sb, "State %d: <%s>\n", idx+1, tw.action(perm[idx-1]))
+		}
+		for _, variable := range tw.state(perm[:idx]) {
+			fmt.Fprintf(&sb, "/\\ %s = %s\n", variable.Name, variable.Value)
+		}
+		sb.WriteString("\n")
+	}
+
+	tw.shared.lock.Lock()
+	defer tw.shared.lock.Unlock()
+	if tw.shared.err == nil {
+		_, tw.shared.err = tw.shared.w.WriteString(sb.String())
+	}
+}
+
+// Flush writes any buffered traces, and returns the first error
+// encountered while writing, if any.
+func (tw *TypedTLCTraceWriter[T]) Flush() error {
+	tw.shared.lock.Lock()
+	defer tw.shared.lock.Unlock()
+	if tw.shared.err == nil {
+		tw.shared.err = tw.shared.w.Flush()
+	}
+	return tw.shared.err
+}
+
+// TLAValue formats v as a TLA+ expression: strings are quoted,
+// booleans become TRUE and FALSE, slices and arrays become sequences,
+// maps become functions (with their keys sorted), and nil becomes the
+// empty sequence. Integers are formatted as usual, and anything else
+// is quoted as a string.
+func TLAValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "<<>>"
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case *GraphNode:
+		return TLAValue(v.Value)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprint(v)
+	case reflect.Slice, reflect.Array:
+		elems := make([]string, rv.Len())
+		for idx := range elems {
+			elems[idx] = TLAValue(rv.Index(idx).Interface())
+		}
+		return "<<" + strings.Join(elems, ", ") + ">>"
+	case reflect.Map:
+		entries := make([]string, 0, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			entries = append(entries, TLAValue(iter.Key().Interface())+" :> "+TLAValue(iter.Value().Interface()))
+		}
+		if len(entries) == 0 {
+			return "<<>>"
+		}
+		sort.Strings(entries)
+		return "(" + strings.Join(entries, " @@ ") + ")"
+	default:
+		return strconv.Quote(fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,70 @@
+package gsim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTLCTraceWriter(t *testing.T) {
+	var buf bytes.Buffer
+	tw := NewTLCTraceWriter(&buf, nil, nil)
+	BuildPermutations(NewSimplePermutation([]interface{}{"a", "b"})).ForEach(tw)
+	if err := tw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := `\* Permutation 1
+State 1: <Initial predicate>
+/\ trace = <<>>
+
+State 2: <b>
+/\ trace = <<"b">>
+
+State 3: <a>
+/\ trace = <<"b", "a">>
+
+\* Permutation 0
+State 1: <Initial predicate>
+/\ trace = <<>>
+
+State 2: <a>
+/\ trace = <<"a">>
+
+State 3: <b>
+/\ trace = <<"a", "b">>
+
+`
+	if buf.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	tw = NewTLCTraceWriter(&buf, func(v interface{}) string { return "Step" + v.(*GraphNode).Value.(string) },
+		func(prefix []interface{}) []TLCVariable {
+			return []TLCVariable{{Name: "steps", Value: TLAValue(len(prefix))}}
+		})
+	BuildPermutations(NewGraphPermutation(nodes("x")...)).ForEach(tw)
+	if err := tw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, "State 2: <Stepx>\n/\\ steps = 1\n") {
+		t.Fatalf("got:\n%s", got)
+	}
+}
+
+func TestTLAValue(t *testing.T) {
+	for _, test := range []struct {
+		value interface{}
+		want  string
+	}{
+		{"s", `"s"`},
+		{true, "TRUE"},
+		{42, "42"},
+		{[]int{1, 2}, "<<1, 2>>"},
+		{map[string]int{"y": 2, "x": 1}, `("x" :> 1 @@ "y" :> 2)`},
+	} {
+		if got := TLAValue(test.value); got != test.want {
+			t.Errorf("TLAValue(%#v) is %s, want %s", test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package gsim
+
+import (
+	"errors"
+)
+
+// VectorClock is a vector clock, mapping each process to the number
+// of its events known of. Missing processes count as 0.
+type VectorClock map[string]uint64
+
+// HappensBefore reports whether the event with clock vc happened
+// before the event with clock other: vc is less than or equal to
+// other for every process, and less for at least one.
+func (vc VectorClock) HappensBefore(other VectorClock) bool {
+	less := false
+	for process, t := range vc {
+		if t > other[process] {
+			return false
+		} else if t < other[process] {
+			less = true
+		}
+	}
+	if !less {
+		for process, t := range other {
+			if _, found := vc[process]; !found && t > 0 {
+				less = true
+				break
+			}
+		}
+	}
+	return less
+}
+
+// TraceEvent is an event recorded from a real execution, with the
+// vector clock of the process at the time of the event.
+type TraceEvent struct {
+	Value interface{}
+	Clock VectorClock
+}
+
+// GraphFromTrace builds a graph whose permutations are exactly the
+// reorderings of the recorded trace which respect its happens-before
+// relation, as given by the events' vector clocks. This turns one
+// observed execution into every schedule which could have produced
+// the same causality. The nodes are returned in the same order as the
+// events, along with the starting nodes. Each node's value is that of
+// its event, and each node requires all of its direct predecessors.
+func GraphFromTrace(events []TraceEvent) (nodes, start []*GraphNode) {
+	before := func(i, j int) bool { return events[i].Clock.HappensBefore(events[j].Clock) }
+	preds := make([][]int, len(events))
+	for j := range events {
+		for i := range events {
+			if !before(i, j) {
+				continue
+			}
+			// Only add an edge if i directly precedes j.
+			direct := true
+			for k := range events {
+				if before(i, k) && before(k, j) {
+					direct = false
+					break
+				}
+			}
+			if direct {
+				preds[j] = append(preds[j], i)
+			}
+		}
+	}
+	values := make([]interface{}, len(events))
+	for idx, event := range events {
+		values[idx] = event.Value
+	}
+	return graphFromPredecessors(values, preds)
+}
+
+// GraphFromHappensBefore builds a graph whose permutations are
+// exactly the orderings of the values which respect the given
+// happens-before pairs: for each pair, the value with the first index
+// must come before that with the second. The nodes are returned in
+// the same order as the values, along with the starting nodes. It is
+// an error for the pairs to contain a cycle, or an index out of
+// range.
+func GraphFromHappensBefore(values []interface{}, before [][2]int) (nodes, start []*GraphNode, err error) {
+	preds := make([][]int, len(values))
+	for _, pair := range before {
+		if pair[0] < 0 || pair[0] >= len(values) || pair[1] < 0 || pair[1] >= len(values) {
+			return nil, nil, errors.New("happens-before pair out of range")
+		}
+		preds[pair[1]] = append(preds[pair[1]], pair[0])
+	}
+	if hasCycle(preds) {
+		return nil, nil, errors.New("happens-before pairs contain a cycle")
+	}
+	nodes, start = graphFromPredecessors(values, preds)
+	return nodes, start, nil
+}
+
+// hasCycle reports whether the graph given by the predecessors of
+// each node contains a cycle, by attempting a topological sort.
+func hasCycle(preds [][]int) bool {
+	succs := make([][]int, len(preds))
+	pending := make([]int, len(preds))
+	var ready []int
+	for j, ps := range preds {
+		pending[j] = len(ps)
+		for _, i := range ps {
+			succs[i] = append(succs[i], j)
+		}
+		if len(ps) == 0 {
+			ready = append(ready, j)
+		}
+	}
+	sorted := 0
+	for len(ready) > 0 {
+		i := ready[len(ready)-1]
+		ready = ready[:len(ready)-1]
+		sorted++
+		for _, j := range succs[i] {
+			if pending[j]--; pending[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+	return sorted != len(preds)
+}
+
+func graphFromPredecessors(values []interface{}, preds [][]int) (nodes, start []*GraphNode) {
+	nodes = make([]*GraphNode, len(values))
+	for idx, value := range values {
+		nodes[idx] = NewGraphNode(value)
+	}
+	for j, ps := range preds {
+		if len(ps) == 0 {
+			start = append(start, nodes[j])
+			continue
+		}
+		required := make([]*GraphNode, len(ps))
+		for idx, i := range ps {
+			required[idx] = nodes[i]
+			nodes[i].AddEdgeTo(nodes[j])
+		}
+		nodes[j].Callback = NewAvailableAllCallback(required...)
+	}
+	return nodes, start
+}
@@ -0,0 +1,59 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestVectorClockHappensBefore(t *testing.T) {
+	for _, tc := range []struct {
+		a, b VectorClock
+		want bool
+	}{
+		{VectorClock{"p": 1}, VectorClock{"p": 2}, true},
+		{VectorClock{"p": 1}, VectorClock{"p": 1, "q": 1}, true},
+		{VectorClock{"p": 1}, VectorClock{"p": 1}, false},
+		{VectorClock{"p": 1}, VectorClock{"q": 1}, false},
+		{VectorClock{"p": 2}, VectorClock{"p": 1, "q": 3}, false},
+	} {
+		if got := tc.a.HappensBefore(tc.b); got != tc.want {
+			t.Errorf("%v.HappensBefore(%v) is %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestGraphFromTrace(t *testing.T) {
+	// p sends to q between its two events.
+	nodes, start := GraphFromTrace([]TraceEvent{
+		{Value: "p1", Clock: VectorClock{"p": 1}},
+		{Value: "p2", Clock: VectorClock{"p": 2}},
+		{Value: "q1", Clock: VectorClock{"q": 1}},
+		{Value: "q2", Clock: VectorClock{"p": 1, "q": 2}},
+	})
+	if len(nodes) != 4 || len(start) != 2 {
+		t.Fatalf("got %d nodes, %d starting", len(nodes), len(start))
+	}
+	checkPerms(t, collectSorted(BuildPermutations(NewGraphPermutation(start...))), []string{
+		"p1 p2 q1 q2",
+		"p1 q1 p2 q2",
+		"p1 q1 q2 p2",
+		"q1 p1 p2 q2",
+		"q1 p1 q2 p2",
+	})
+}
+
+func TestGraphFromHappensBefore(t *testing.T) {
+	_, start, err := GraphFromHappensBefore([]interface{}{"a", "b", "c"}, [][2]int{{0, 2}, {1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPerms(t, collectSorted(BuildPermutations(NewGraphPermutation(start...))), []string{
+		"a b c",
+		"b a c",
+	})
+	if _, _, err := GraphFromHappensBefore([]interface{}{"a", "b"}, [][2]int{{0, 1}, {1, 0}}); err == nil {
+		t.Fatal("cycle accepted")
+	}
+	if _, _, err := GraphFromHappensBefore([]interface{}{"a"}, [][2]int{{0, 1}}); err == nil {
+		t.Fatal("pair out of range accepted")
+	}
+}
@@ -0,0 +1,92 @@
+package gsim
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// treeLevel summarises the nodes of the tree at one depth.
+type treeLevel struct {
+	nodes, complete, pruned int
+	options                 int
+	min, max                int
+}
+
+// WriteTree writes the tree which iteration explores, down to
+// maxDepth, to w as indented text. Each node of the tree is written
+// on its own line, indented by its depth, with its value and the
+// number of options which follow it; complete permutations are marked
+// as such, as are prefixes abandoned by WithPrune. Nodes at maxDepth
+// are written, but not their children. A summary of each depth
+// follows: the number of nodes, how many are complete or pruned, and
+// the total, smallest and largest numbers of options. This shows
+// where the branching which makes a space large comes from.
+//
+// Nodes are written in the order of their options, and so of their
+// permutation numbers, rather than the order in which iteration
+// visits them. As each node is written, the output grows with the
+// number of nodes down to maxDepth, so keep maxDepth small for large
+// spaces.
+func (p *TypedPermutations[T]) WriteTree(w io.Writer, maxDepth int) error {
+	bw := bufio.NewWriter(w)
+	var levels []treeLevel
+	var prefix []T
+	var writeNode func(gen TypedOptionGenerator[T], value T, depth int)
+	writeNode = func(gen TypedOptionGenerator[T], value T, depth int) {
+		options, ok := p.generate(gen, value, prefix)
+		if depth == len(levels) {
+			levels = append(levels, treeLevel{min: -1})
+		}
+		level := &levels[depth]
+		level.nodes++
+		indent := strings.Repeat("  ", depth)
+		label := "(root)"
+		if depth > 0 {
+			label = fmt.Sprint(stringifyElement(value))
+		}
+		switch {
+		case !ok:
+			level.pruned++
+			fmt.Fprintf(bw, "%s%s pruned\n", indent, label)
+			return
+		case len(options) == 0:
+			level.complete++
+			fmt.Fprintf(bw, "%s%s complete\n", indent, label)
+			return
+		case len(options) == 1:
+			fmt.Fprintf(bw, "%s%s 1 option\n", indent, label)
+		default:
+			fmt.Fprintf(bw, "%s%s %d options\n", indent, label, len(options))
+		}
+		level.options += len(options)
+		if level.min == -1 || len(options) < level.min {
+			level.min = len(options)
+		}
+		if len(options) > level.max {
+			level.max = len(options)
+		}
+		if depth >= maxDepth {
+			return
+		}
+		// The options may alias the generator's state.
+		options = Retain(options)
+		for _, option := range options {
+			prefix = append(prefix, option)
+			writeNode(gen.Clone(), option, depth+1)
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	writeNode(p.root.generator.Clone(), p.root.value, 0)
+
+	fmt.Fprintln(bw)
+	for depth, level := range levels {
+		fmt.Fprintf(bw, "depth %d: %d nodes, %d complete, %d pruned, %d options", depth, level.nodes, level.complete, level.pruned, level.options)
+		if level.min != -1 {
+			fmt.Fprintf(bw, " (%d to %d)", level.min, level.max)
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
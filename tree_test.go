@@ -0,0 +1,50 @@
+package gsim
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteTree(t *testing.T) {
+	for _, tc := range []struct {
+		p        *Permutations
+		maxDepth int
+		want     string
+	}{
+		{
+			p:        BuildPermutations(NewSimplePermutation([]interface{}{1, 2, 3})),
+			maxDepth: 1,
+			want: `(root) 3 options
+  1 2 options
+  2 2 options
+  3 2 options
+
+depth 0: 1 nodes, 0 complete, 0 pruned, 3 options (3 to 3)
+depth 1: 3 nodes, 0 complete, 0 pruned, 6 options (2 to 2)
+`,
+		},
+		{
+			p: BuildPermutations(NewSimplePermutation([]interface{}{1, 2})).WithPrune(func(prefix []interface{}) bool {
+				return len(prefix) > 0 && prefix[0] == 2
+			}),
+			maxDepth: 5,
+			want: `(root) 2 options
+  1 1 option
+    2 complete
+  2 pruned
+
+depth 0: 1 nodes, 0 complete, 0 pruned, 2 options (2 to 2)
+depth 1: 2 nodes, 0 complete, 1 pruned, 1 options (1 to 1)
+depth 2: 1 nodes, 1 complete, 0 pruned, 0 options
+`,
+		},
+	} {
+		var buf bytes.Buffer
+		if err := tc.p.WriteTree(&buf, tc.maxDepth); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("got\n%s\nwant\n%s", got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package gsim
+
+// Create an OptionGenerator for the given graphs which, rather than
+// eliminating cycles, unrolls them: every node which lies on a cycle
+// may be visited up to bound times in each permutation, so that loops
+// such as retry-until-ack can be modelled directly. Nodes for which
+// SetMaxVisits has been called keep their own budget, so the bound
+// can be overridden per node. See SetMaxVisits for how nodes are
+// re-armed between visits.
+func NewUnrolledGraphPermutation(bound int, startingNode ...*GraphNode) OptionGenerator {
+	gp := NewGraphPermutation(startingNode...).(*graphPermutation)
+	gp.graph.unroll = bound
+	return gp
+}
+
+// maxVisits returns the number of times gn may be visited in each
+// permutation, taking into account any unrolling of cycles.
+func (gp *graphPermutation) maxVisits(gn *GraphNode) int {
+	if gn.maxVisits == 0 && gp.graph.unroll > 1 {
+		gp.graph.build()
+		if gp.graph.cyclic[gn] {
+			return gp.graph.unroll
+		}
+	}
+	return gn.MaxVisits()
+}
@@ -0,0 +1,26 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestNewUnrolledGraphPermutation(t *testing.T) {
+	// send is retried until ack; done follows ack.
+	g := nodes("send", "ack", "done")
+	send, ack, done := g[0], g[1], g[2]
+	send.AddEdgeTo(ack)
+	ack.AddEdgeTo(send)
+	ack.AddEdgeTo(done)
+	checkPerms(t, collect(BuildPermutations(NewGraphPermutation(send))), []string{"send ack done"})
+	checkPerms(t, collectSorted(BuildPermutations(NewUnrolledGraphPermutation(2, send))), []string{
+		"send ack done send ack",
+		"send ack send ack done",
+		"send ack send done ack",
+	})
+
+	// Nodes with their own budget keep it.
+	send.SetMaxVisits(1)
+	checkPerms(t, collectSorted(BuildPermutations(NewUnrolledGraphPermutation(2, send))), []string{
+		"send ack done",
+	})
+}
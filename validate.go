@@ -0,0 +1,213 @@
+package gsim
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// maxValidateIncoming limits the number of reachable incoming edges
+// for which ValidateGraph will try every combination when checking
+// whether a node's callback can ever return MakeAvailable.
+const maxValidateIncoming = 16
+
+// GraphReport is the result of ValidateGraph. Each field lists the
+// nodes exhibiting one kind of problem; a report in which every
+// field is empty describes a graph with no detectable mis-wirings.
+type GraphReport struct {
+	// Unreachable holds the nodes which are connected to the graph
+	// (they have edges to or from nodes which are reachable), but
+	// which can never be reached from the starting nodes.
+	Unreachable []*GraphNode
+	// NeverAvailable holds the reachable nodes (other than starting
+	// nodes) whose callbacks never return MakeAvailable, for any set
+	// of reachable incoming edges. Such nodes can never appear in a
+	// permutation.
+	NeverAvailable []*GraphNode
+	// Unchecked holds the nodes which have too many reachable
+	// incoming edges for every combination to be tried, and so
+	// could not be checked for NeverAvailable.
+	Unchecked []*GraphNode
+	// DuplicateValues holds each group of reachable nodes which share
+	// the same Value.
+	DuplicateValues [][]*GraphNode
+	// Cycles holds each strongly connected component of the
+	// reachable graph which contains a cycle. Cycles are permitted,
+	// but unless SetMaxVisits is used, the nodes on them can appear
+	// in permutations at most once, which may not be what was
+	// intended.
+	Cycles [][]*GraphNode
+	// Unregistered is only used by Graph.Validate, and holds the
+	// reachable nodes which do not belong to the Graph.
+	Unregistered []*GraphNode
+}
+
+// OK reports whether the report contains no problems. Unchecked nodes
+// and cycles are not regarded as problems.
+func (gr *GraphReport) OK() bool {
+	return len(gr.Unreachable) == 0 && len(gr.NeverAvailable) == 0 && len(gr.DuplicateValues) == 0 && len(gr.Unregistered) == 0
+}
+
+func (gr *GraphReport) String() string {
+	var sb strings.Builder
+	line := func(title string, gns []*GraphNode) {
+		if len(gns) == 0 {
+			return
+		}
+		values := make([]string, len(gns))
+		for idx, gn := range gns {
+			values[idx] = fmt.Sprint(gn.Value)
+		}
+		fmt.Fprintf(&sb, "%s: %s\n", title, strings.Join(values, ", "))
+	}
+	line("unreachable", gr.Unreachable)
+	line("never available", gr.NeverAvailable)
+	line("unchecked", gr.Unchecked)
+	for _, gns := range gr.DuplicateValues {
+		line("duplicate values", gns)
+	}
+	for _, gns := range gr.Cycles {
+		line("cycle", gns)
+	}
+	line("unregistered", gr.Unregistered)
+	if sb.Len() == 0 {
+		return "ok"
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// ValidateGraph examines the graph reachable from the given starting
+// nodes for mistakes which would otherwise silently shrink the
+// permutation space: nodes which can never be reached, nodes whose
+// callbacks can never make them available, and nodes which share a
+// value (and so are indistinguishable in permutations). It also
+// reports cycles. Callbacks are invoked with every combination of
+// reachable incoming edges, so they must be deterministic and free of
+// side effects, which all the provided callbacks are.
+func ValidateGraph(start ...*GraphNode) *GraphReport {
+	report := &GraphReport{}
+	nodes := reachableGraphNodes(start...)
+	reachable := make(map[*GraphNode]bool, len(nodes))
+	for _, gn := range nodes {
+		reachable[gn] = true
+	}
+	isStart := make(map[*GraphNode]bool, len(start))
+	for _, gn := range start {
+		isStart[gn] = true
+	}
+
+	unreachable := make(map[*GraphNode]bool)
+	for _, gn := range nodes {
+		for _, in := range gn.In {
+			if !reachable[in] && !unreachable[in] {
+				unreachable[in] = true
+				report.Unreachable = append(report.Unreachable, in)
+			}
+		}
+	}
+
+	for _, gn := range nodes {
+		if isStart[gn] {
+			continue
+		}
+		incoming := make([]*GraphNode, 0, len(gn.In))
+		for _, in := range gn.In {
+			if reachable[in] {
+				incoming = append(incoming, in)
+			}
+		}
+		if len(incoming) > maxValidateIncoming {
+			report.Unchecked = append(report.Unchecked, gn)
+		} else if !canBecomeAvailable(gn, incoming) {
+			report.NeverAvailable = append(report.NeverAvailable, gn)
+		}
+	}
+
+	byValue := make(map[interface{}][]*GraphNode)
+	var values []interface{}
+	for _, gn := range nodes {
+		if gn.Value == nil || !reflect.TypeOf(gn.Value).Comparable() {
+			continue
+		}
+		if _, found := byValue[gn.Value]; !found {
+			values = append(values, gn.Value)
+		}
+		byValue[gn.Value] = append(byValue[gn.Value], gn)
+	}
+	for _, value := range values {
+		if gns := byValue[value]; len(gns) > 1 {
+			report.DuplicateValues = append(report.DuplicateValues, gns)
+		}
+	}
+
+	report.Cycles = graphCycles(nodes)
+	return report
+}
+
+// canBecomeAvailable tries the node's callback with every non-empty
+// subset of incoming, in the order of incoming.
+func canBecomeAvailable(gn *GraphNode, incoming []*GraphNode) bool {
+	reached := make([]*GraphNode, 0, len(incoming))
+	for subset := 1; subset < 1<<len(incoming); subset++ {
+		reached = reached[:0]
+		for idx, in := range incoming {
+			if subset&(1<<idx) != 0 {
+				reached = append(reached, in)
+			}
+		}
+		if gn.Callback.IncomingEdgesReached(gn, reached) == MakeAvailable {
+			return true
+		}
+	}
+	return false
+}
+
+// graphCycles finds the strongly connected components of nodes (using
+// Tarjan's algorithm) which contain cycles: those with more than one
+// node, or with a node which has an edge to itself.
+func graphCycles(nodes []*GraphNode) [][]*GraphNode {
+	var cycles [][]*GraphNode
+	index := make(map[*GraphNode]int, len(nodes))
+	lowlink := make(map[*GraphNode]int, len(nodes))
+	onStack := make(map[*GraphNode]bool, len(nodes))
+	stack := []*GraphNode{}
+
+	var connect func(gn *GraphNode)
+	connect = func(gn *GraphNode) {
+		index[gn] = len(index)
+		lowlink[gn] = index[gn]
+		stack = append(stack, gn)
+		onStack[gn] = true
+		for _, out := range gn.Out {
+			if _, found := index[out]; !found {
+				connect(out)
+				if lowlink[out] < lowlink[gn] {
+					lowlink[gn] = lowlink[out]
+				}
+			} else if onStack[out] && index[out] < lowlink[gn] {
+				lowlink[gn] = index[out]
+			}
+		}
+		if lowlink[gn] != index[gn] {
+			return
+		}
+		l := len(stack) - 1
+		for stack[l] != gn {
+			l--
+		}
+		component := append([]*GraphNode{}, stack[l:]...)
+		stack = stack[:l]
+		for _, member := range component {
+			onStack[member] = false
+		}
+		if len(component) > 1 || containsGraphNode(gn.Out, gn) {
+			cycles = append(cycles, component)
+		}
+	}
+	for _, gn := range nodes {
+		if _, found := index[gn]; !found {
+			connect(gn)
+		}
+	}
+	return cycles
+}
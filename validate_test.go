@@ -0,0 +1,49 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestValidateGraph(t *testing.T) {
+	if report := ValidateGraph(egraph()...); !report.OK() || report.String() != "ok" {
+		t.Fatalf("egraph: %v", report)
+	}
+
+	g := nodes("a", "b", "c", "orphan", "a", "loop")
+	a, b, c, orphan, dup, loop := g[0], g[1], g[2], g[3], g[4], g[5]
+	a.AddEdgeTo(b)
+	// c requires orphan, which can never be reached.
+	a.AddEdgeTo(c)
+	orphan.AddEdgeTo(c)
+	c.Callback = NewAvailableAllCallback(a, orphan)
+	// b is inhibited by its only predecessor.
+	b.Callback = InhibitAnyCallback
+	a.AddEdgeTo(dup)
+	dup.AddEdgeTo(loop)
+	loop.AddEdgeTo(dup)
+
+	report := ValidateGraph(a)
+	if report.OK() {
+		t.Fatal("mis-wired graph passed")
+	}
+	check := func(field string, got []*GraphNode, want ...*GraphNode) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %v, want %v", field, got, want)
+		}
+		for idx := range got {
+			if got[idx] != want[idx] {
+				t.Fatalf("%s: got %v, want %v", field, got, want)
+			}
+		}
+	}
+	check("Unreachable", report.Unreachable, orphan)
+	check("NeverAvailable", report.NeverAvailable, b, c)
+	if len(report.DuplicateValues) != 1 || len(report.Cycles) != 1 {
+		t.Fatalf("got duplicates %v and cycles %v", report.DuplicateValues, report.Cycles)
+	}
+	check("DuplicateValues", report.DuplicateValues[0], a, dup)
+	if len(report.Cycles[0]) != 2 {
+		t.Fatalf("got cycle %v", report.Cycles[0])
+	}
+}
@@ -0,0 +1,42 @@
+package gsim
+
+// SetMaxVisits allows the node to appear up to k times in each
+// permutation, rather than just once. This models retries, repeated
+// ticks and the like without cloning nodes and wiring duplicate edges
+// by hand.
+//
+// After each visit but the last, the node is re-armed: it is no
+// longer available, and the incoming edges it has reached are
+// forgotten, so that its callback is consulted afresh as incoming
+// edges are reached again (by predecessors which may themselves be
+// visited several times, or by edges from successors, forming a
+// loop). A node with no incoming edges at all is available again
+// immediately. After the last visit, the node is inhibited as usual.
+//
+// As with adding edges, this must be done before the graph is used.
+func (gn *GraphNode) SetMaxVisits(k int) {
+	if k < 1 {
+		k = 1
+	}
+	gn.maxVisits = k
+}
+
+// MaxVisits returns the number of times the node may appear in each
+// permutation. See SetMaxVisits.
+func (gn *GraphNode) MaxVisits() int {
+	if gn.maxVisits == 0 {
+		return 1
+	}
+	return gn.maxVisits
+}
+
+// rearm prepares a node which has just been visited, but which has
+// visits remaining, to be visited again. gns must be local to gp.
+func (gp *graphPermutation) rearm(gns *graphNodeState) {
+	gns.available = false
+	gns.incomingVisited = gns.incomingVisited[:0]
+	if len(gns.In) == 0 {
+		gns.available = true
+		gp.current = append(gp.current, gns.GraphNode)
+	}
+}
@@ -0,0 +1,34 @@
+package gsim
+
+import (
+	"testing"
+)
+
+func TestSetMaxVisits(t *testing.T) {
+	// tick has no incoming edges, so it is available again at once.
+	g := nodes("tick", "b")
+	g[0].SetMaxVisits(3)
+	if g[0].MaxVisits() != 3 || g[1].MaxVisits() != 1 {
+		t.Fatalf("got max visits %d and %d", g[0].MaxVisits(), g[1].MaxVisits())
+	}
+	checkPerms(t, collectSorted(BuildPermutations(NewGraphPermutation(g...))), []string{
+		"b tick tick tick",
+		"tick b tick tick",
+		"tick tick b tick",
+		"tick tick tick b",
+	})
+
+	// y is re-armed after each visit, but x, its only predecessor, is
+	// only visited once.
+	h := nodes("x", "y")
+	h[0].AddEdgeTo(h[1])
+	h[1].SetMaxVisits(3)
+	checkPerms(t, collect(BuildPermutations(NewGraphPermutation(h[0]))), []string{"x y"})
+
+	loop := nodes("ping", "pong")
+	loop[0].AddEdgeTo(loop[1])
+	loop[1].AddEdgeTo(loop[0])
+	loop[0].SetMaxVisits(2)
+	loop[1].SetMaxVisits(2)
+	checkPerms(t, collect(BuildPermutations(NewGraphPermutation(loop[0]))), []string{"ping pong ping pong"})
+}
@@ -0,0 +1,128 @@
+package gsim
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const wireVersion = 1
+
+// ErrWrongGraph is returned by PermutationCodec.Decode for a
+// permutation encoded from a different graph.
+var ErrWrongGraph = errors.New("permutation encoded from a different graph")
+
+// PermutationCodec encodes permutations of a graph in a compact binary
+// format, and decodes them again, so that they can be stored cheaply
+// or shipped to tools not written in Go. Each node is identified by
+// its position in a breadth-first traversal of the graph: the
+// starting nodes, in order, and then the targets of each node's
+// outgoing edges, in order, skipping nodes already seen. A record
+// consists of:
+//
+//   - the format version, 1, as a uvarint;
+//   - the 16 bytes of the GraphFingerprint, raw rather than in hex;
+//   - the length of the permutation number as a uvarint, followed by
+//     the number as big-endian bytes;
+//   - the length of the permutation as a uvarint, followed by the id
+//     of each node as a uvarint.
+//
+// Uvarints are as encoding/binary (and protobuf). Records are
+// self-delimiting, so they may simply be concatenated.
+type PermutationCodec struct {
+	fingerprint []byte
+	nodes       []*GraphNode
+	index       map[*GraphNode]int
+}
+
+// NewPermutationCodec creates a PermutationCodec for the graph
+// reachable from the starting nodes, which must not be changed
+// thereafter.
+func NewPermutationCodec(start ...*GraphNode) *PermutationCodec {
+	fingerprint, _ := hex.DecodeString(GraphFingerprint(start...))
+	nodes := reachableGraphNodes(start...)
+	index := make(map[*GraphNode]int, len(nodes))
+	for idx, gn := range nodes {
+		index[gn] = idx
+	}
+	return &PermutationCodec{fingerprint: fingerprint, nodes: nodes, index: index}
+}
+
+// Append appends the encoding of the permutation with number n to
+// buf. Every element of perm must be a GraphNode of the graph: nodes
+// created by a VisitHook, for example, have no id and cannot be
+// encoded.
+func (pc *PermutationCodec) Append(buf []byte, n *big.Int, perm []interface{}) ([]byte, error) {
+	buf = binary.AppendUvarint(buf, wireVersion)
+	buf = append(buf, pc.fingerprint...)
+	nBytes := n.Bytes()
+	buf = binary.AppendUvarint(buf, uint64(len(nBytes)))
+	buf = append(buf, nBytes...)
+	buf = binary.AppendUvarint(buf, uint64(len(perm)))
+	for _, elem := range perm {
+		gn, ok := elem.(*GraphNode)
+		id, found := pc.index[gn]
+		if !ok || !found {
+			return nil, fmt.Errorf("%v is not a node of the graph", elem)
+		}
+		buf = binary.AppendUvarint(buf, uint64(id))
+	}
+	return buf, nil
+}
+
+// Decode decodes the record at the start of buf, returning the
+// permutation number, the permutation, and the remainder of buf.
+// ErrWrongGraph is returned if the record was not encoded from this
+// graph.
+func (pc *PermutationCodec) Decode(buf []byte) (*big.Int, []interface{}, []byte, error) {
+	corrupt := errors.New("corrupt permutation encoding")
+	readUvarint := func() (uint64, error) {
+		v, l := binary.Uvarint(buf)
+		if l <= 0 {
+			return 0, corrupt
+		}
+		buf = buf[l:]
+		return v, nil
+	}
+
+	version, err := readUvarint()
+	if err != nil {
+		return nil, nil, nil, err
+	} else if version != wireVersion {
+		return nil, nil, nil, fmt.Errorf("unsupported permutation encoding version %v", version)
+	}
+	if len(buf) < len(pc.fingerprint) {
+		return nil, nil, nil, corrupt
+	} else if string(buf[:len(pc.fingerprint)]) != string(pc.fingerprint) {
+		return nil, nil, nil, ErrWrongGraph
+	}
+	buf = buf[len(pc.fingerprint):]
+	nLen, err := readUvarint()
+	if err != nil {
+		return nil, nil, nil, err
+	} else if uint64(len(buf)) < nLen {
+		return nil, nil, nil, corrupt
+	}
+	n := new(big.Int).SetBytes(buf[:nLen])
+	buf = buf[nLen:]
+	count, err := readUvarint()
+	if err != nil {
+		return nil, nil, nil, err
+	} else if uint64(len(buf)) < count {
+		// Every id takes at least one byte.
+		return nil, nil, nil, corrupt
+	}
+	perm := make([]interface{}, count)
+	for idx := range perm {
+		id, err := readUvarint()
+		if err != nil {
+			return nil, nil, nil, err
+		} else if id >= uint64(len(pc.nodes)) {
+			return nil, nil, nil, corrupt
+		}
+		perm[idx] = pc.nodes[id]
+	}
+	return n, perm, buf, nil
+}
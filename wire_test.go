@@ -0,0 +1,49 @@
+package gsim
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestPermutationCodec(t *testing.T) {
+	start := egraph()
+	p := BuildPermutations(NewGraphPermutation(start...))
+	pc := NewPermutationCodec(start...)
+	c := newCollector()
+	var buf []byte
+	p.ForEach(consumerFunc(func(n *big.Int, perm []interface{}) {
+		var err error
+		if buf, err = pc.Append(buf, n, perm); err != nil {
+			t.Fatal(err)
+		}
+		c.Consume(n, perm)
+	}))
+	for idx, want := range *c.perms {
+		n, perm, rest, err := pc.Decode(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.Cmp((*c.nums)[idx]) != 0 || permString(perm) != want {
+			t.Fatalf("decoded %v %q, want %v %q", n, permString(perm), (*c.nums)[idx], want)
+		}
+		buf = rest
+	}
+	if len(buf) != 0 {
+		t.Fatalf("%d bytes left over", len(buf))
+	}
+
+	record, err := pc.Append(nil, big.NewInt(1), p.Permutation(big.NewInt(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := NewPermutationCodec(joins()...).Decode(record); !errors.Is(err, ErrWrongGraph) {
+		t.Fatalf("decoding with another graph returned %v", err)
+	}
+	if _, _, _, err := pc.Decode(record[:len(record)-1]); err == nil {
+		t.Fatal("truncated record decoded")
+	}
+	if _, err := pc.Append(nil, big.NewInt(0), []interface{}{NewGraphNode("E1")}); err == nil {
+		t.Fatal("foreign node encoded")
+	}
+}